@@ -13,5 +13,7 @@ func buildBuildCommand(m *helm3.Mixin) *cobra.Command {
 			return m.Build(cmd.Context())
 		},
 	}
+	cmd.Flags().StringVarP(&m.OutputFormat, "output", "o", "",
+		"Specify the format of the build output, text for the Dockerfile lines or json for a structured output. Allowed values: text, json")
 	return cmd
 }
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"github.com/MChorfa/porter-helm3/pkg/helm3"
+	"github.com/spf13/cobra"
+)
+
+func buildConfigCommand(m *helm3.Mixin) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the mixin configuration of the bundle",
+	}
+	cmd.AddCommand(buildConfigShowCommand(m))
+	cmd.AddCommand(buildConfigValidateCommand(m))
+	return cmd
+}
+
+func buildConfigShowCommand(m *helm3.Mixin) *cobra.Command {
+	return &cobra.Command{
+		Use:   "show",
+		Short: "Print the mixin configuration with the defaults of the mixin filled in",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return m.ConfigShow(cmd.Context())
+		},
+	}
+}
+
+func buildConfigValidateCommand(m *helm3.Mixin) *cobra.Command {
+	return &cobra.Command{
+		Use:   "validate",
+		Short: "Check the mixin configuration and the steps of the bundle without building it",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return m.ConfigValidate(cmd.Context())
+		},
+	}
+}
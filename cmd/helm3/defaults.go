@@ -0,0 +1,22 @@
+package main
+
+import (
+	"github.com/MChorfa/porter-helm3/pkg/helm3"
+	"github.com/spf13/cobra"
+)
+
+func buildDefaultsCommand(m *helm3.Mixin) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "defaults",
+		Short: "Print the default versions and the supported platforms of the mixin",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return m.ValidateOutputFormat()
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return m.PrintDefaults()
+		},
+	}
+	cmd.Flags().StringVarP(&m.OutputFormat, "output", "o", "",
+		"Specify the output format, defaults to $PORTER_MIXIN_OUTPUT_FORMAT or text.  Allowed values: text, json")
+	return cmd
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"github.com/MChorfa/porter-helm3/pkg/helm3"
+	"github.com/spf13/cobra"
+)
+
+func buildDoctorCommand(m *helm3.Mixin) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check that helm, kubectl, the kubeconfig and the cluster are available to the mixin",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return m.ValidateOutputFormat()
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return m.Doctor(cmd.Context())
+		},
+	}
+	cmd.Flags().StringVarP(&m.OutputFormat, "output", "o", "",
+		"Specify the format of the report, defaults to $PORTER_MIXIN_OUTPUT_FORMAT or text.  Allowed values: text, json")
+	return cmd
+}
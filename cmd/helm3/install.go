@@ -14,12 +14,12 @@ func buildInstallCommand(m *helm3.Mixin) *cobra.Command {
 		Use:   "install",
 		Short: "Execute the install functionality of this mixin",
 		PreRunE: func(cmd *cobra.Command, args []string) error {
-			//Do something here if needed
-			return nil
+			return m.ValidateOutputFormat()
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return m.Install(cmd.Context())
 		},
 	}
+	addOutputFlag(cmd, m)
 	return cmd
 }
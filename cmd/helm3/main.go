@@ -1,29 +1,41 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
 
 	"github.com/MChorfa/porter-helm3/pkg/helm3"
 	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 func main() {
-	cmd, err := buildRootCommand(os.Stdin)
+	m := helm3.New()
+	cmd, err := buildRootCommand(m, os.Stdin)
 	if err != nil {
 		fmt.Printf("err: %s\n", err)
 		os.Exit(1)
 	}
-	if err := cmd.Execute(); err != nil {
+
+	// Export the spans of the mixin when OpenTelemetry is configured with the OTEL_* environment variables
+	ctx := m.ConfigureTelemetry(context.Background())
+	ctx, log := m.StartRootSpan(ctx, "helm3", attribute.StringSlice("args", os.Args[1:]))
+	err = cmd.ExecuteContext(ctx)
+	if err != nil {
+		log.Error(err)
+	}
+	log.Close()
+
+	if err != nil {
 		fmt.Printf("err: %s\n", err)
-		os.Exit(1)
+		// Recognized helm failures have their own exit code, so that automation can branch on the failure
+		os.Exit(helm3.ExitCode(err))
 	}
 }
 
-func buildRootCommand(in io.Reader) (*cobra.Command, error) {
-	m := helm3.New()
-
+func buildRootCommand(m *helm3.Mixin, in io.Reader) (*cobra.Command, error) {
 	m.In = in
 	cmd := &cobra.Command{
 		Use:  "helm3",
@@ -39,12 +51,21 @@ func buildRootCommand(in io.Reader) (*cobra.Command, error) {
 	cmd.PersistentFlags().BoolVar(&m.DebugMode, "debug", false, "Enable debug logging")
 
 	cmd.AddCommand(buildVersionCommand(m))
+	cmd.AddCommand(buildDefaultsCommand(m))
 	cmd.AddCommand(buildSchemaCommand(m))
 	cmd.AddCommand(buildBuildCommand(m))
 	cmd.AddCommand(buildInstallCommand(m))
 	cmd.AddCommand(buildInvokeCommand(m))
 	cmd.AddCommand(buildUpgradeCommand(m))
 	cmd.AddCommand(buildUninstallCommand(m))
+	cmd.AddCommand(buildDoctorCommand(m))
+	cmd.AddCommand(buildConfigCommand(m))
 
 	return cmd, nil
 }
+
+// addOutputFlag defines the --output flag of the commands that run helm
+func addOutputFlag(cmd *cobra.Command, m *helm3.Mixin) {
+	cmd.Flags().StringVarP(&m.OutputFormat, "output", "o", "",
+		"Specify the format of the logs, defaults to $PORTER_MIXIN_OUTPUT_FORMAT or text.  Allowed values: text, json")
+}
@@ -9,9 +9,13 @@ func buildUninstallCommand(m *helm3.Mixin) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "uninstall",
 		Short: "Execute the uninstall functionality of this mixin",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return m.ValidateOutputFormat()
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return m.Uninstall(cmd.Context())
 		},
 	}
+	addOutputFlag(cmd, m)
 	return cmd
 }
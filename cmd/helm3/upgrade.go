@@ -9,9 +9,13 @@ func buildUpgradeCommand(m *helm3.Mixin) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "upgrade",
 		Short: "Execute the invoke functionality of this mixin",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return m.ValidateOutputFormat()
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return m.Upgrade(cmd.Context())
 		},
 	}
+	addOutputFlag(cmd, m)
 	return cmd
 }
@@ -8,6 +8,7 @@ import (
 
 func buildVersionCommand(m *helm3.Mixin) *cobra.Command {
 	opts := version.Options{}
+	var details bool
 
 	cmd := &cobra.Command{
 		Use:   "version",
@@ -16,6 +17,9 @@ func buildVersionCommand(m *helm3.Mixin) *cobra.Command {
 			return opts.Validate()
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if details {
+				return m.PrintVersionDetails(cmd.Context(), opts)
+			}
 			return m.PrintVersion(opts)
 		},
 	}
@@ -23,6 +27,8 @@ func buildVersionCommand(m *helm3.Mixin) *cobra.Command {
 	f := cmd.Flags()
 	f.StringVarP(&opts.RawFormat, "output", "o", string(version.DefaultVersionFormat),
 		"Specify an output format.  Allowed values: json, plaintext")
+	f.BoolVar(&details, "details", false,
+		"Include the default client version, api version, supported platforms and the installed helm version")
 
 	return cmd
 }
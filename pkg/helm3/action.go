@@ -7,6 +7,8 @@ import (
 var _ builder.ExecutableAction = Action{}
 var _ builder.BuildableAction = Action{}
 var _ builder.ExecutableStep = ExecuteStep{}
+var _ builder.HasEnvironmentVars = ExecuteStep{}
+var _ builder.SuppressesOutput = ExecuteStep{}
 
 type Action struct {
 	// Name of the action: install, upgrade, invoke, uninstall.
@@ -65,9 +67,13 @@ type ExecuteSteps struct {
 
 type ExecuteStep struct {
 	Step      `yaml:",inline"`
-	Namespace string        `yaml:"namespace,omitempty"`
-	Arguments []string      `yaml:"arguments,omitempty"`
-	Flags     builder.Flags `yaml:"flags,omitempty"`
+	Namespace string            `yaml:"namespace,omitempty"`
+	Arguments []string          `yaml:"arguments,omitempty"`
+	Flags     builder.Flags     `yaml:"flags,omitempty"`
+	Env       map[string]string `yaml:"env,omitempty"`
+
+	// binary is the helm binary run by the step, set by the mixin at runtime
+	binary string
 }
 
 func (s ExecuteStep) GetWorkingDir() string {
@@ -75,7 +81,10 @@ func (s ExecuteStep) GetWorkingDir() string {
 }
 
 func (s ExecuteStep) GetCommand() string {
-	return "helm3"
+	if s.binary != "" {
+		return s.binary
+	}
+	return defaultHelmBinary
 }
 
 func (s ExecuteStep) GetArguments() []string {
@@ -85,3 +94,7 @@ func (s ExecuteStep) GetArguments() []string {
 func (s ExecuteStep) GetFlags() builder.Flags {
 	return s.Flags
 }
+
+func (s ExecuteStep) GetEnvironmentVars() map[string]string {
+	return s.Env
+}
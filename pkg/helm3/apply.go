@@ -0,0 +1,130 @@
+package helm3
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	k8s "k8s.io/client-go/kubernetes"
+)
+
+// Modes of the install and upgrade steps
+const (
+	// ModeHelm installs or upgrades a helm release, it is the default
+	ModeHelm = "helm"
+
+	// ModeApply renders the chart with helm template and applies it with kubectl, without a helm release
+	ModeApply = "apply"
+)
+
+// applyFieldManager is the field manager of the resources applied in apply mode
+const applyFieldManager = "helm3-mixin"
+
+// validateMode checks the mode of a step, and that the step doesn't use options that need a helm release in apply mode.
+// releaseOptions are the names of those options, with whether the step sets them.
+func validateMode(mode string, releaseOptions map[string]bool) error {
+	switch mode {
+	case "", ModeHelm:
+		return nil
+	case ModeApply:
+	default:
+		return errors.Errorf("unsupported mode %q, allowed values are %s and %s", mode, ModeHelm, ModeApply)
+	}
+
+	var set []string
+	for name, ok := range releaseOptions {
+		if ok {
+			set = append(set, name)
+		}
+	}
+	if len(set) > 0 {
+		sort.Strings(set)
+		return errors.Errorf("%s cannot be used with mode %s, because there is no helm release", strings.Join(set, ", "), ModeApply)
+	}
+	return nil
+}
+
+// validateRenderVersions checks that kubeVersion and apiVersions are only set in apply mode, since helm install and
+// upgrade use the version and the APIs of the cluster.
+func validateRenderVersions(mode, kubeVersion string, apiVersions []string) error {
+	if mode == ModeApply || (kubeVersion == "" && len(apiVersions) == 0) {
+		return nil
+	}
+	return errors.Errorf("kubeVersion and apiVersions can only be used with mode %s, helm renders the release for the version of the cluster", ModeApply)
+}
+
+// applySetParent is the ConfigMap that kubectl uses to track the resources applied for the release,
+// so that the resources that the chart no longer renders are pruned.
+func applySetParent(release string) string {
+	return "configmaps/helm3-mixin-" + release
+}
+
+// templateArgs returns the arguments of helm template that render the chart like the install or upgrade of the release.
+// The hooks are not rendered because kubectl would apply them like the other resources, instead of running them.
+func templateArgs(a helmArgs) helmArgs {
+	t := a
+	t.Command = []string{"template"}
+	no := false
+	t.Atomic = &no
+	t.CreateNamespace = &no
+	t.Wait = &no
+	t.Timeout = ""
+	t.ResetValues = false
+	t.ReuseValues = false
+	t.TakeOwnership = false
+	t.HideNotes = false
+	t.RenderSubchartNotes = false
+	t.SkipCrds = false
+	t.NoHooks = true
+	t.Labels = nil
+	return t
+}
+
+// applyChart renders the chart with helm template and applies it with kubectl server-side apply, instead of creating
+// a helm release, for clusters where the release secrets of helm are prohibited. The resources that the chart no
+// longer renders are pruned with an ApplySet.
+func (m *Mixin) applyChart(ctx context.Context, kubeClient k8s.Interface, a helmArgs, env []string) error {
+	args := buildHelmArgs(templateArgs(a))
+	if !a.SkipCrds {
+		args = append(args, "--include-crds")
+	}
+
+	// the rendered manifest isn't printed, it contains the secrets of the release
+	step := stepFromContext(ctx)
+	step.SuppressOutput = true
+	manifest := &bytes.Buffer{}
+	err := m.runHelmWithStdout(withStep(ctx, step), args, env, manifest)
+	if err != nil {
+		return errors.Wrapf(err, "could not render chart %s", a.Chart)
+	}
+
+	err = m.ensureNamespace(ctx, kubeClient, a, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	applyArgs := []string{"apply", "--server-side", "--field-manager", applyFieldManager, "--prune", "--applyset", applySetParent(a.Release)}
+	if a.Namespace != "" {
+		applyArgs = append(applyArgs, "--namespace", a.Namespace)
+	}
+	applyArgs = append(applyArgs, a.kubectlFlags()...)
+	applyArgs = append(applyArgs, "--filename", "-")
+
+	cmd := m.NewCommand(ctx, "kubectl", applyArgs...)
+	// ApplySets are an alpha feature of kubectl
+	cmd.Env = append(cmd.Env, env...)
+	cmd.Env = append(cmd.Env, "KUBECTL_APPLYSET=true")
+	cmd.Stdin = manifest
+	cmd.Stdout = m.Out
+	cmd.Stderr = m.Err
+
+	prettyCmd := fmt.Sprintf("kubectl %s", strings.Join(maskCredentials(applyArgs), " "))
+	fmt.Fprintln(m.Out, prettyCmd)
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "couldn't run command %s", prettyCmd)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package helm3
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// Kubernetes client authentication plugins that can be installed in the invocation image,
+// for kubeconfigs that authenticate with an exec plugin.
+const (
+	awsIAMAuthenticatorPlugin = "aws-iam-authenticator"
+	gkeGcloudAuthPlugin       = "gke-gcloud-auth-plugin"
+	kubeloginPlugin           = "kubelogin"
+)
+
+// Pinned versions of the authentication plugins
+const (
+	awsIAMAuthenticatorVersion = "0.6.14"
+	gkeGcloudAuthVersion       = "474.0.0-0"
+	kubeloginVersion           = "v0.1.3"
+)
+
+// authPluginCommands returns the Dockerfile lines that install the authentication plugins.
+// The plugins are downloaded with curl, so they require the default image platform.
+func (m *Mixin) authPluginCommands(config MixinConfig) ([]string, error) {
+	if len(config.AuthPlugins) == 0 {
+		return nil, nil
+	}
+	if config.ImagePlatform != ImagePlatformDefault {
+		return nil, errors.Errorf("authPlugins are not supported with imagePlatform %q", config.ImagePlatform)
+	}
+	arch := m.HelmClientArchitecture
+	if arch != "amd64" && arch != "arm64" {
+		return nil, errors.Errorf("authPlugins are not available for the %s architecture, only amd64 and arm64 are supported", arch)
+	}
+
+	var lines []string
+	for _, plugin := range config.AuthPlugins {
+		switch plugin {
+		case awsIAMAuthenticatorPlugin:
+			lines = append(lines, fmt.Sprintf("RUN curl --fail -L -o /usr/local/bin/aws-iam-authenticator "+
+				"https://github.com/kubernetes-sigs/aws-iam-authenticator/releases/download/v%[1]s/aws-iam-authenticator_%[1]s_linux_%[2]s &&\\\n"+
+				"    chmod a+x /usr/local/bin/aws-iam-authenticator", awsIAMAuthenticatorVersion, arch))
+		case gkeGcloudAuthPlugin:
+			lines = append(lines, fmt.Sprintf("RUN apt-get update && apt-get install -y gnupg &&\\\n"+
+				"    curl --fail https://packages.cloud.google.com/apt/doc/apt-key.gpg | gpg --dearmor -o /usr/share/keyrings/cloud.google.gpg &&\\\n"+
+				"    echo \"deb [signed-by=/usr/share/keyrings/cloud.google.gpg] https://packages.cloud.google.com/apt cloud-sdk main\" > /etc/apt/sources.list.d/google-cloud-sdk.list &&\\\n"+
+				"    apt-get update && apt-get install -y google-cloud-cli-gke-gcloud-auth-plugin=%s", gkeGcloudAuthVersion))
+		case kubeloginPlugin:
+			lines = append(lines, fmt.Sprintf("RUN apt-get update && apt-get install -y unzip &&\\\n"+
+				"    curl --fail -L -o kubelogin.zip https://github.com/Azure/kubelogin/releases/download/%[1]s/kubelogin-linux-%[2]s.zip &&\\\n"+
+				"    unzip kubelogin.zip && mv bin/linux_%[2]s/kubelogin /usr/local/bin/kubelogin && rm -r kubelogin.zip bin", kubeloginVersion, arch))
+		default:
+			return nil, errors.Errorf("unsupported authPlugin %q, allowed values are %s, %s and %s",
+				plugin, awsIAMAuthenticatorPlugin, gkeGcloudAuthPlugin, kubeloginPlugin)
+		}
+	}
+	return lines, nil
+}
@@ -3,112 +3,512 @@ package helm3
 import (
 	"context"
 	"fmt"
+	"path"
+	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	"get.porter.sh/porter/pkg/exec/builder"
+	"get.porter.sh/porter/pkg/tracing"
 	"github.com/Masterminds/semver"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
 	"gopkg.in/yaml.v2"
 )
 
-// clientVersionConstraint represents the semver constraint for the Helm client version
-// Currently, this mixin only supports Helm clients versioned v3.x.x
+// clientVersionConstraint represents the default semver constraint for the Helm client version,
+// it can be overridden with the clientVersionConstraint of the mixin configuration, for example to use Helm v4
 const clientVersionConstraint string = "^v3.x"
 
+// repositoryFilesDir is where the TLS files of the repositories are copied in the invocation image
+const repositoryFilesDir = "/etc/helm3-mixin/repositories"
+
 // BuildInput represents stdin passed to the mixin for the build command.
 type BuildInput struct {
 	Config MixinConfig
+
+	// Actions that use the mixin, keyed by the action name
+	Actions map[string][]BuildStep `yaml:"actions,omitempty"`
+}
+
+// BuildStep is the subset of a step used by the build command.
+type BuildStep struct {
+	Helm3 struct {
+		BuildRelease `yaml:",inline"`
+
+		Releases []BuildRelease `yaml:"releases,omitempty"`
+		Push     *PushArguments `yaml:"push,omitempty"`
+		GC       *GCArguments   `yaml:"gc,omitempty"`
+	} `yaml:"helm3"`
+}
+
+// BuildRelease is the subset of a release, declared by a step or in its releases, used by the build command.
+type BuildRelease struct {
+	Name    string `yaml:"name,omitempty"`
+	Chart   string `yaml:"chart,omitempty"`
+	Version string `yaml:"version,omitempty"`
+
+	Namespace        string `yaml:"namespace,omitempty"`
+	ReleaseNamespace string `yaml:"releaseNamespace,omitempty"`
+	Mode             string `yaml:"mode,omitempty"`
+
+	FixDeprecatedAPIs *bool `yaml:"fixDeprecatedAPIs,omitempty"`
+}
+
+// releases returns the releases declared by the step, the step itself when it doesn't declare releases.
+// The arguments of the step are the defaults of its releases.
+func (s BuildStep) releases() []BuildRelease {
+	if len(s.Helm3.Releases) == 0 {
+		return []BuildRelease{s.Helm3.BuildRelease}
+	}
+
+	releases := make([]BuildRelease, len(s.Helm3.Releases))
+	for i, release := range s.Helm3.Releases {
+		if release.Chart == "" {
+			release.Chart = s.Helm3.Chart
+		}
+		if release.Version == "" {
+			release.Version = s.Helm3.Version
+		}
+		if release.FixDeprecatedAPIs == nil {
+			release.FixDeprecatedAPIs = s.Helm3.FixDeprecatedAPIs
+		}
+		if release.Namespace == "" {
+			release.Namespace = s.Helm3.Namespace
+		}
+		if release.ReleaseNamespace == "" {
+			release.ReleaseNamespace = s.Helm3.ReleaseNamespace
+		}
+		if release.Mode == "" {
+			release.Mode = s.Helm3.Mode
+		}
+		releases[i] = release
+	}
+	return releases
 }
 
 // MixinConfig represents configuration that can be set on the helm3 mixin in porter.yaml
 // mixins:
 // - helm3:
 // 	  clientVersion: v3.8.2
+//	  clientVersionConstraint: ^v3.x
+//	  clientVersionIndex: https://helm-mirror.example.com/
+//	  apiVersion: v1.22.1 | auto
+//	  clusterVersion: v1.28
+//	  helmBinary: helm
 // 	  clientPlatform: linux
-// 	  clientArchitecture: amd64 | arm64 | arm | i386
+// 	  clientArchitecture: amd64 | arm64 | arm | 386 | s390x | ppc64le
+//	  imagePlatform: copy-from-image
+//	  platforms:
+//	    - name: alpine
+//	      init:
+//	        - RUN apk add --no-cache helm kubectl && ln -s /usr/bin/helm /usr/local/bin/helm3
+//	  disableBuildCache: false
+//	  httpProxy: http://proxy.example.com:3128
+//	  httpsProxy: http://proxy.example.com:3128
+//	  noProxy: localhost,.svc
+//	  extraCACerts:
+//	    - certs/corporate-ca.pem
+//	  authPlugins:
+//	    - aws-iam-authenticator
+//	  extraBuildLines:
+//	    pre:
+//	      - RUN apt-get update && apt-get install -y jq
+//	    post:
+//	      - ENV HELM_CACHE_HOME=/cnab/app/.cache/helm
 //	  repositories:
 //	    stable:
 //		  url: "https://charts.helm.sh/stable"
+//		  vendorCharts: true
+//		  skipUpdate: false
+//		  pinIndex: false
+//		  caFile: certs/charts-ca.pem
+//		  certFile: certs/charts-client.pem
+//		  keyFile: certs/charts-client-key.pem
+//		  insecureSkipTlsVerify: false
+//		  passCredentials: false
+//		  forceUpdate: false
+//	    private:
+//		  url: "https://charts.example.com"
+//		  usernameSecret: charts-username
+//		  passwordSecret: charts-password
+//	  strictRepositories: false
+//	  updateReposAtBuild: true
+//	  updateReposAtRuntime: false
+//	  plugins:
+//	    diff:
+//	      url: "https://github.com/databus23/helm-diff"
+//	      version: v3.6.0
+//	  vendorCharts: false
+//	  lintCharts: false
+//	  defaultNamespace: mynamespace
+//	  defaultTimeout: 10m
+//	  atomic: false
+//	  wait: true
+//	  createNamespace: false
+//	  debug: true
+//	  burstLimit: 200
+//	  qps: 50
+//	  heartbeatInterval: 1m
+//	  verifyClientVersion: true
+//	  allowCRDRemoval: false
+//	  ownershipLabels: true
+//	  offline: false
+//	  timingsOutput: timings
 
 type MixinConfig struct {
-	ClientVersion      string                `yaml:"clientVersion,omitempty"`
-	ClientPlatform     string                `yaml:"clientPlatform,omitempty"`
-	ClientArchitecture string                `yaml:"clientArchitecture,omitempty"`
-	Repositories       map[string]Repository `yaml:"repositories,omitempty"`
+	ClientVersion           string                `yaml:"clientVersion,omitempty"`
+	ClientVersionConstraint string                `yaml:"clientVersionConstraint,omitempty"`
+	ClientPlatform          string                `yaml:"clientPlatform,omitempty"`
+	ClientArchitecture      string                `yaml:"clientArchitecture,omitempty"`
+	Repositories            map[string]Repository `yaml:"repositories,omitempty"`
+
+	// ClientVersionIndex is the URL of a page listing the helm release archives, used to resolve a clientVersion
+	// such as v3.14.x to its latest patch release instead of get.helm.sh
+	ClientVersionIndex string `yaml:"clientVersionIndex,omitempty"`
+
+	// APIVersion is the version of kubectl installed in the invocation image, or auto to select it from
+	// the Kubernetes versions supported by the helm client
+	APIVersion string `yaml:"apiVersion,omitempty"`
+
+	// ClusterVersion is the version of the target cluster, kubectl has its minor version unless APIVersion is set,
+	// and APIVersion must be within one minor version of it
+	ClusterVersion string `yaml:"clusterVersion,omitempty"`
+
+	// HelmBinary is the name or the path of a helm binary already in the invocation image, used instead of installing helm
+	HelmBinary string `yaml:"helmBinary,omitempty"`
+
+	// ImagePlatform selects how helm and kubectl are installed in the invocation image, see the ImagePlatform constants,
+	// or the name of one of the Platforms
+	ImagePlatform string `yaml:"imagePlatform,omitempty"`
+
+	// Platforms are custom image platforms, that install helm and kubectl with their own Dockerfile lines
+	Platforms []Platform `yaml:"platforms,omitempty"`
+
+	// DisableBuildCache downloads helm and kubectl on every build, for builders that do not support BuildKit cache mounts
+	DisableBuildCache bool `yaml:"disableBuildCache,omitempty"`
+
+	// Proxy used by the build and by helm at runtime
+	HTTPProxy  string `yaml:"httpProxy,omitempty"`
+	HTTPSProxy string `yaml:"httpsProxy,omitempty"`
+	NoProxy    string `yaml:"noProxy,omitempty"`
+
+	// ExtraCACerts are CA certificates, paths in the bundle directory, added to the trust store of the invocation image
+	ExtraCACerts []string `yaml:"extraCACerts,omitempty"`
+
+	// AuthPlugins are Kubernetes client authentication plugins installed in the invocation image
+	AuthPlugins []string `yaml:"authPlugins,omitempty"`
+
+	// ExtraBuildLines are Dockerfile lines written before and after the lines that install helm
+	ExtraBuildLines ExtraBuildLines `yaml:"extraBuildLines,omitempty"`
+
+	// Plugins are helm plugins installed into the invocation image, keyed by the plugin name
+	Plugins map[string]Plugin `yaml:"plugins,omitempty"`
+
+	// VendorCharts downloads the charts used by the install and upgrade steps into the invocation image
+	VendorCharts bool `yaml:"vendorCharts,omitempty"`
+
+	// LintCharts runs helm lint against the vendored charts, failing the build on errors
+	LintCharts bool `yaml:"lintCharts,omitempty"`
+
+	// StrictRepositories fails the build when a repository is invalid, instead of skipping it
+	StrictRepositories bool `yaml:"strictRepositories,omitempty"`
+
+	// UpdateReposAtBuild runs helm repo update after adding the repositories, it defaults to true
+	UpdateReposAtBuild *bool `yaml:"updateReposAtBuild,omitempty"`
+
+	// UpdateReposAtRuntime runs helm repo update for the repository of the chart before it is installed or upgraded
+	UpdateReposAtRuntime bool `yaml:"updateReposAtRuntime,omitempty"`
+
+	// Runtime defaults, used by the install, upgrade and uninstall steps when they do not set the value.
+	DefaultNamespace string `yaml:"defaultNamespace,omitempty"`
+	DefaultTimeout   string `yaml:"defaultTimeout,omitempty"`
+	Atomic           *bool  `yaml:"atomic,omitempty"`
+	Wait             *bool  `yaml:"wait,omitempty"`
+	CreateNamespace  *bool  `yaml:"createNamespace,omitempty"`
+	Debug            *bool  `yaml:"debug,omitempty"`
+	BurstLimit       int    `yaml:"burstLimit,omitempty"`
+
+	// QPS tunes the Kubernetes client used by the mixin to collect outputs
+	QPS float32 `yaml:"qps,omitempty"`
+
+	// VerifyClientVersion checks the version of the helm client before a release is installed or upgraded, it defaults to true
+	VerifyClientVersion *bool `yaml:"verifyClientVersion,omitempty"`
+
+	// AllowCRDRemoval confirms that the uninstall steps with removeCRDs can delete CRDs from the cluster
+	AllowCRDRemoval bool `yaml:"allowCRDRemoval,omitempty"`
+
+	// OwnershipLabels labels the releases with the Porter installation that owns them
+	OwnershipLabels bool `yaml:"ownershipLabels,omitempty"`
+
+	// TimingsOutput is the name of the output that receives the timings of the releases of the action as JSON,
+	// setting it also prints the timings at the end of each step
+	TimingsOutput string `yaml:"timingsOutput,omitempty"`
+
+	// Offline forbids the operations that need the network when the bundle runs, like updating the repositories
+	// or pulling charts that are not vendored
+	Offline bool `yaml:"offline,omitempty"`
+
+	// HeartbeatInterval is how often a heartbeat is printed while helm waits for a release, 0 disables it
+	HeartbeatInterval string `yaml:"heartbeatInterval,omitempty"`
+}
+
+// ExtraBuildLines are Dockerfile lines added to the invocation image by the bundle
+type ExtraBuildLines struct {
+	Pre  []string `yaml:"pre,omitempty"`
+	Post []string `yaml:"post,omitempty"`
 }
 
 type Repository struct {
 	URL string `yaml:"url,omitempty"`
+
+	// VendorCharts downloads the charts from this repository into the invocation image
+	VendorCharts bool `yaml:"vendorCharts,omitempty"`
+
+	// SkipUpdate excludes this repository from the helm repo update run at build time
+	SkipUpdate bool `yaml:"skipUpdate,omitempty"`
+
+	// CAFile, CertFile and KeyFile are paths in the bundle directory, copied into the invocation image,
+	// to verify the certificate of the repository and to authenticate with a client certificate
+	CAFile   string `yaml:"caFile,omitempty"`
+	CertFile string `yaml:"certFile,omitempty"`
+	KeyFile  string `yaml:"keyFile,omitempty"`
+
+	InsecureSkipTLSVerify bool `yaml:"insecureSkipTlsVerify,omitempty"`
+
+	// PassCredentials passes the credentials of the repository to the domains that host its charts
+	PassCredentials bool `yaml:"passCredentials,omitempty"`
+
+	// ForceUpdate replaces the repository when it is already added
+	ForceUpdate bool `yaml:"forceUpdate,omitempty"`
+
+	// UsernameSecret and PasswordSecret are the ids of the build secrets with the credentials of the repository.
+	// The repository isn't added to the invocation image, they are only used to vendor its charts.
+	UsernameSecret string `yaml:"usernameSecret,omitempty"`
+	PasswordSecret string `yaml:"passwordSecret,omitempty"`
+
+	// PinIndex keeps the index of the repository downloaded at build time, so that the chart versions
+	// are resolved from it at runtime
+	PinIndex bool `yaml:"pinIndex,omitempty"`
 }
 
 // Build will generate the necessary Dockerfile lines
-// for an invocation image using this mixin
+// for an invocation image using this mixin, or a BuildOutput with --output json
 func (m *Mixin) Build(ctx context.Context) error {
+	return m.buildWithOutput(ctx, m.buildDockerfile)
+}
 
-	// Create new Builder.
+// loadBuildInput reads the mixin configuration and the steps of the bundle from porter.
+func (m *Mixin) loadBuildInput(ctx context.Context) (BuildInput, error) {
 	var input BuildInput
 	err := builder.LoadAction(ctx, m.RuntimeConfig, "", func(contents []byte) (interface{}, error) {
+		if err := validateConfig(contents); err != nil {
+			return &input, err
+		}
 		err := yaml.Unmarshal(contents, &input)
 		return &input, err
 	})
+	return input, err
+}
+
+// buildDockerfile writes the Dockerfile lines of the invocation image.
+func (m *Mixin) buildDockerfile(ctx context.Context) error {
+	ctx, log := tracing.StartSpan(ctx)
+	defer log.EndSpan()
+
+	input, err := m.loadBuildInput(ctx)
 	if err != nil {
 		return err
 	}
 
-	suppliedClientVersion := input.Config.ClientVersion
+	constraint := clientVersionConstraint
+	if input.Config.ClientVersionConstraint != "" {
+		constraint = input.Config.ClientVersionConstraint
+	}
+	suppliedClientVersion, err := m.resolveClientVersion(input.Config)
+	if err != nil {
+		return err
+	}
 	if suppliedClientVersion != "" {
-		ok, err := validate(suppliedClientVersion, clientVersionConstraint)
+		ok, err := validate(suppliedClientVersion, constraint)
 		if err != nil {
 			return err
 		}
 		if !ok {
 			return errors.Errorf("supplied clientVersion %q does not meet semver constraint %q",
-				suppliedClientVersion, clientVersionConstraint)
+				suppliedClientVersion, constraint)
 		}
 		m.HelmClientVersion = suppliedClientVersion
 	}
 
+	m.APIVersion, err = m.resolveAPIVersion(input.Config)
+	if err != nil {
+		return err
+	}
+	if err := validateApplyAPIVersion(input, m.APIVersion); err != nil {
+		return err
+	}
+
+	if input.Config.HeartbeatInterval != "" {
+		if _, err := time.ParseDuration(input.Config.HeartbeatInterval); err != nil {
+			return errors.Wrapf(err, "supplied heartbeatInterval %q is not a valid duration", input.Config.HeartbeatInterval)
+		}
+	}
+
 	if input.Config.ClientPlatform != "" {
 		m.HelmClientPlatform = input.Config.ClientPlatform
 	}
 
 	if input.Config.ClientArchitecture != "" {
-		m.HelmClientArchitecture = input.Config.ClientArchitecture
+		arch, err := validateClientArchitecture(input.Config.ClientArchitecture)
+		if err != nil {
+			return err
+		}
+		m.HelmClientArchitecture = arch
 	}
+	log.SetAttributes(
+		attribute.String("clientVersion", m.HelmClientVersion),
+		attribute.String("clientPlatform", m.HelmClientPlatform),
+		attribute.String("clientArchitecture", m.HelmClientArchitecture),
+		attribute.String("apiVersion", m.APIVersion),
+	)
+
+	// Check the charts bundled with the invocation image before building it
+	for _, steps := range input.Actions {
+		for _, step := range steps {
+			for _, release := range step.releases() {
+				if err := m.validateLocalChart(release.Chart); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	vendoredCharts, err := input.vendoredCharts()
+	if err != nil {
+		return err
+	}
+	err = input.checkOffline(vendoredCharts)
+	if err != nil {
+		return err
+	}
+	err = validateImagePlatform(input.Config, vendoredCharts)
+	if err != nil {
+		return err
+	}
+	err = input.Config.validateRepositorySecrets()
+	if err != nil {
+		return err
+	}
+	if input.Config.StrictRepositories {
+		err = input.Config.validateRepositories()
+		if err != nil {
+			return err
+		}
+	}
+
+	plugins, err := input.pluginCommands()
+	if err != nil {
+		return err
+	}
+
+	authPlugins, err := m.authPluginCommands(input.Config)
+	if err != nil {
+		return err
+	}
+
+	m.writeBundleLines(input.Config.ExtraBuildLines.Pre)
+
+	// Configure the proxy and the trusted certificates first so that the downloads use them
+	for _, line := range input.Config.proxyEnv() {
+		fmt.Fprintln(m.Out, line)
+	}
+	err = m.writeExtraCACerts(input.Config)
+	if err != nil {
+		return err
+	}
+
 	// Install helm3
-	fmt.Fprint(m.Out, "ENV HELM_EXPERIMENTAL_OCI=1")
-	fmt.Fprintf(m.Out, "\nRUN apt-get update && apt-get install -y curl")
-	fmt.Fprintf(m.Out, "\nRUN curl https://get.helm.sh/helm-%s-%s-%s.tar.gz --output helm3.tar.gz",
-		m.HelmClientVersion, m.HelmClientPlatform, m.HelmClientArchitecture)
-	fmt.Fprintf(m.Out, "\nRUN tar -xvf helm3.tar.gz && rm helm3.tar.gz")
-	fmt.Fprintf(m.Out, "\nRUN mv linux-amd64/helm /usr/local/bin/helm3")
-	fmt.Fprintf(m.Out, "\nRUN curl -o kubectl https://storage.googleapis.com/kubernetes-release/release/v1.22.1/bin/linux/amd64/kubectl &&\\")
-	fmt.Fprintf(m.Out, "\n    mv kubectl /usr/local/bin && chmod a+x /usr/local/bin/kubectl\n")
-	if len(input.Config.Repositories) > 0 {
+	err = m.writeClientInstall(input.Config)
+	if err != nil {
+		return err
+	}
+	for _, line := range authPlugins {
+		fmt.Fprintln(m.Out, line)
+	}
+	m.writeBundleLines(input.Config.ExtraBuildLines.Post)
+
+	if line := clientVersionEnv(m.HelmClientVersion); line != "" {
+		fmt.Fprintln(m.Out, line)
+	}
+	if line := clientVersionConstraintEnv(input.Config.ClientVersionConstraint); line != "" {
+		fmt.Fprintln(m.Out, line)
+	}
+	for _, line := range input.Config.defaultsEnv() {
+		fmt.Fprintln(m.Out, line)
+	}
+	if releases, ok := input.declaredReleases(); ok {
+		fmt.Fprintf(m.Out, "ENV %s=%s\n", declaredReleasesEnv, strings.Join(releases, ","))
+	}
+	if len(vendoredCharts) > 0 {
+		fmt.Fprintf(m.Out, "RUN mkdir -p %s && chown -R ${BUNDLE_USER} %s\n", strings.Join(vendoredChartDirs(vendoredCharts), " "), vendoredChartsDir)
+	}
+	err = m.writeRepositoryFiles(input.Config)
+	if err != nil {
+		return err
+	}
+	pinnedRepos := input.Config.pinnedRepositories()
+	if len(pinnedRepos) > 0 {
+		fmt.Fprintf(m.Out, "ENV %s=%s\n", pinnedReposEnv, strings.Join(pinnedRepos, ","))
+		fmt.Fprintf(m.Out, "RUN mkdir -p %s && chown ${BUNDLE_USER} %s\n", pinnedRepositoryCacheDir, pinnedRepositoryCacheDir)
+	}
+	if len(input.Config.Repositories) > 0 || len(vendoredCharts) > 0 || len(plugins) > 0 {
 		// Switch to a non-root user so helm is configured for the user the container will execute as
 		fmt.Fprintln(m.Out, "USER ${BUNDLE_USER}")
 
-		// Go through repositories
-		names := make([]string, 0, len(input.Config.Repositories))
-		for name := range input.Config.Repositories {
-			names = append(names, name)
+		for _, line := range plugins {
+			fmt.Fprintln(m.Out, line)
 		}
-		sort.Strings(names) //sort by key
-		for _, name := range names {
-			url := input.Config.Repositories[name].URL
-			repositoryCommand, err := getRepositoryCommand(name, url)
-			if err != nil {
-				if m.DebugMode {
-					fmt.Fprintf(m.Err, "DEBUG: addition of repository failed: %s\n", err.Error())
+
+		if len(input.Config.Repositories) > 0 {
+			// Go through repositories
+			names := make([]string, 0, len(input.Config.Repositories))
+			for name, repo := range input.Config.Repositories {
+				// the repositories with build secrets are only used to vendor charts, with their credentials
+				if !repo.usesBuildSecrets() {
+					names = append(names, name)
 				}
-			} else {
-				fmt.Fprintln(m.Out, strings.Join(repositoryCommand, " "))
+			}
+			sort.Strings(names) //sort by key
+			for _, name := range names {
+				repositoryCommand, err := getRepositoryCommand(name, input.Config.Repositories[name])
+				if err != nil {
+					if m.DebugMode {
+						fmt.Fprintf(m.Err, "DEBUG: addition of repository failed: %s\n", err.Error())
+					}
+				} else {
+					fmt.Fprintln(m.Out, strings.Join(repositoryCommand, " "))
+				}
+			}
+			if line := input.Config.repoUpdateCommand(names); line != "" {
+				fmt.Fprintln(m.Out, line)
+			}
+			// Keep a snapshot of the pinned indexes, helm would replace them in its own cache on the next update
+			for _, name := range pinnedRepos {
+				fmt.Fprintf(m.Out, "RUN cp \"$(helm3 env HELM_REPOSITORY_CACHE)/%s-index.yaml\" %s/\n", name, pinnedRepositoryCacheDir)
+			}
+		}
+
+		// Download the vendored charts so that installing them doesn't need access to the repositories
+		for _, chart := range vendoredCharts {
+			fmt.Fprintln(m.Out, input.Config.vendoredChartPullCommand(chart))
+		}
+		if input.Config.LintCharts {
+			for _, chart := range vendoredCharts {
+				fmt.Fprintf(m.Out, "RUN helm3 lint %s\n", vendoredChartPath(chart.Chart, chart.Version))
 			}
 		}
-		// Make sure we update  the helm repositories
-		// So we don\'t have to do it later
-		fmt.Fprintln(m.Out, "RUN helm3 repo update")
 
 		// Switch back to root so that subsequent mixins can install things
 		fmt.Fprintln(m.Out, "USER root")
@@ -117,19 +517,111 @@ func (m *Mixin) Build(ctx context.Context) error {
 	return nil
 }
 
-func getRepositoryCommand(name, url string) (repositoryCommand []string, err error) {
+// repoUpdateCommand returns the RUN line that updates the repositories at build time, scoped to the repositories
+// that don't set skipUpdate, or an empty string when no repository is updated.
+func (c MixinConfig) repoUpdateCommand(names []string) string {
+	if c.UpdateReposAtBuild != nil && !*c.UpdateReposAtBuild {
+		return ""
+	}
+
+	var updated []string
+	for _, name := range names {
+		if !c.Repositories[name].SkipUpdate {
+			updated = append(updated, name)
+		}
+	}
+	switch len(updated) {
+	case 0:
+		return ""
+	case len(names):
+		return "RUN helm3 repo update"
+	default:
+		return "RUN helm3 repo update " + strings.Join(updated, " ")
+	}
+}
+
+func getRepositoryCommand(name string, repo Repository) (repositoryCommand []string, err error) {
 
 	var commandBuilder []string
 
-	if url == "" {
+	if repo.URL == "" {
 		return commandBuilder, fmt.Errorf("repository url must be supplied")
 	}
 
-	commandBuilder = append(commandBuilder, "RUN", "helm3", "repo", "add", name, url)
+	commandBuilder = append(commandBuilder, "RUN", "helm3", "repo", "add", name, repo.URL)
+
+	if repo.CAFile != "" {
+		commandBuilder = append(commandBuilder, "--ca-file", repositoryFilePath(name, repo.CAFile))
+	}
+	if repo.CertFile != "" {
+		commandBuilder = append(commandBuilder, "--cert-file", repositoryFilePath(name, repo.CertFile))
+	}
+	if repo.KeyFile != "" {
+		commandBuilder = append(commandBuilder, "--key-file", repositoryFilePath(name, repo.KeyFile))
+	}
+	if repo.InsecureSkipTLSVerify {
+		commandBuilder = append(commandBuilder, "--insecure-skip-tls-verify")
+	}
+	if repo.PassCredentials {
+		commandBuilder = append(commandBuilder, "--pass-credentials")
+	}
+	if repo.ForceUpdate {
+		commandBuilder = append(commandBuilder, "--force-update")
+	}
 
 	return commandBuilder, nil
 }
 
+// validateRepositories checks the repositories that are added to the invocation image,
+// which are otherwise skipped when they are invalid.
+func (c MixinConfig) validateRepositories() error {
+	names := make([]string, 0, len(c.Repositories))
+	for name := range c.Repositories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, err := getRepositoryCommand(name, c.Repositories[name]); err != nil {
+			return errors.Wrapf(err, "invalid repository %s", name)
+		}
+	}
+	return nil
+}
+
+// repositoryFilePath is the path of a TLS file of a repository in the invocation image
+func repositoryFilePath(name, file string) string {
+	return path.Join(repositoryFilesDir, name, filepath.Base(file))
+}
+
+// writeRepositoryFiles copies the TLS files of the repositories into the invocation image, owned by the bundle user
+// so that helm can read the keys.
+func (m *Mixin) writeRepositoryFiles(config MixinConfig) error {
+	names := make([]string, 0, len(config.Repositories))
+	for name := range config.Repositories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		repo := config.Repositories[name]
+		for _, file := range []string{repo.CAFile, repo.CertFile, repo.KeyFile} {
+			if file == "" {
+				continue
+			}
+			exists, err := m.FileSystem.Exists(file)
+			if err != nil {
+				return errors.Wrapf(err, "could not check file %s of repository %s", file, name)
+			}
+			if !exists {
+				return errors.Errorf("file %s of repository %s does not exist", file, name)
+			}
+			fmt.Fprintf(m.Out, "COPY --chown=${BUNDLE_USER} %s %s\n", file, repositoryFilePath(name, file))
+		}
+	}
+	return nil
+}
+
 // validate validates that the supplied clientVersion meets the supplied semver constraint
 func validate(clientVersion, constraint string) (bool, error) {
 	c, err := semver.NewConstraint(constraint)
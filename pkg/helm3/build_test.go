@@ -3,8 +3,10 @@ package helm3
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -20,11 +22,12 @@ func TestMixin_Build(t *testing.T) {
 
 	buildOutput := `ENV HELM_EXPERIMENTAL_OCI=1
 RUN apt-get update && apt-get install -y curl
-RUN curl https://get.helm.sh/helm-%s-%s-%s.tar.gz --output helm3.tar.gz
-RUN tar -xvf helm3.tar.gz && rm helm3.tar.gz
-RUN mv linux-amd64/helm /usr/local/bin/helm3
-RUN curl -o kubectl https://storage.googleapis.com/kubernetes-release/release/v1.22.1/bin/linux/amd64/kubectl &&\
-    mv kubectl /usr/local/bin && chmod a+x /usr/local/bin/kubectl
+RUN --mount=type=cache,target=/var/cache/helm3-mixin \
+    (test -f /var/cache/helm3-mixin/helm-%[1]s-%[2]s-%[3]s.tar.gz || (curl --fail https://get.helm.sh/helm-%[1]s-%[2]s-%[3]s.tar.gz --output /var/cache/helm3-mixin/helm-%[1]s-%[2]s-%[3]s.tar.gz.tmp && mv /var/cache/helm3-mixin/helm-%[1]s-%[2]s-%[3]s.tar.gz.tmp /var/cache/helm3-mixin/helm-%[1]s-%[2]s-%[3]s.tar.gz)) &&\
+    tar -xvf /var/cache/helm3-mixin/helm-%[1]s-%[2]s-%[3]s.tar.gz && mv linux-amd64/helm /usr/local/bin/helm3 && rm -r linux-amd64
+RUN --mount=type=cache,target=/var/cache/helm3-mixin \
+    (test -f /var/cache/helm3-mixin/kubectl-v1.22.1-linux-amd64 || (curl --fail -o /var/cache/helm3-mixin/kubectl-v1.22.1-linux-amd64.tmp https://storage.googleapis.com/kubernetes-release/release/v1.22.1/bin/linux/amd64/kubectl && mv /var/cache/helm3-mixin/kubectl-v1.22.1-linux-amd64.tmp /var/cache/helm3-mixin/kubectl-v1.22.1-linux-amd64)) &&\
+    cp /var/cache/helm3-mixin/kubectl-v1.22.1-linux-amd64 /usr/local/bin/kubectl && chmod a+x /usr/local/bin/kubectl
 `
 
 	t.Run("build with a valid config", func(t *testing.T) {
@@ -71,6 +74,64 @@ USER root
 		assert.Equal(t, wantOutput, gotOutput)
 	})
 
+	t.Run("build with scoped repo update", func(t *testing.T) {
+		b, err := ioutil.ReadFile("testdata/build-input-with-scoped-repo-update.yaml")
+		require.NoError(t, err)
+
+		m := NewTestMixin(t)
+		m.DebugMode = false
+		m.In = bytes.NewReader(b)
+
+		err = m.Build(ctx)
+		require.NoError(t, err, "build failed")
+
+		wantOutput := fmt.Sprintf(buildOutput, m.HelmClientVersion, m.HelmClientPlatform, m.HelmClientArchitecture) +
+			`ENV HELM3_MIXIN_UPDATE_REPOS=true
+USER ${BUNDLE_USER}
+RUN helm3 repo add jetstack https://charts.jetstack.io
+RUN helm3 repo add stable https://charts.helm.sh/stable
+RUN helm3 repo update jetstack
+USER root
+`
+		gotOutput := m.TestContext.GetOutput()
+		assert.Equal(t, wantOutput, gotOutput)
+	})
+
+	t.Run("build with pinned repositories", func(t *testing.T) {
+		b, err := ioutil.ReadFile("testdata/build-input-with-pinned-repos.yaml")
+		require.NoError(t, err)
+
+		m := NewTestMixin(t)
+		m.DebugMode = false
+		m.In = bytes.NewReader(b)
+
+		err = m.Build(ctx)
+		require.NoError(t, err, "build failed")
+
+		wantOutput := fmt.Sprintf(buildOutput, m.HelmClientVersion, m.HelmClientPlatform, m.HelmClientArchitecture) +
+			`ENV HELM3_MIXIN_PINNED_REPOS=stable
+RUN mkdir -p /var/lib/helm3-mixin/repository-cache && chown ${BUNDLE_USER} /var/lib/helm3-mixin/repository-cache
+USER ${BUNDLE_USER}
+RUN helm3 repo add jetstack https://charts.jetstack.io
+RUN helm3 repo add stable https://charts.helm.sh/stable
+RUN helm3 repo update
+RUN cp "$(helm3 env HELM_REPOSITORY_CACHE)/stable-index.yaml" /var/lib/helm3-mixin/repository-cache/
+USER root
+`
+		gotOutput := m.TestContext.GetOutput()
+		assert.Equal(t, wantOutput, gotOutput)
+	})
+
+	t.Run("build without repo update", func(t *testing.T) {
+		m := NewTestMixin(t)
+		m.DebugMode = false
+		m.In = bytes.NewReader([]byte("config:\n  updateReposAtBuild: false\n  repositories:\n    stable:\n      url: https://charts.helm.sh/stable\n"))
+
+		err := m.Build(ctx)
+		require.NoError(t, err, "build failed")
+		assert.NotContains(t, m.TestContext.GetOutput(), "repo update")
+	})
+
 	t.Run("build with invalid config", func(t *testing.T) {
 		b, err := ioutil.ReadFile("testdata/build-input-with-invalid-config.yaml")
 		require.NoError(t, err)
@@ -90,6 +151,15 @@ USER root
 		assert.Equal(t, wantOutput, gotOutput)
 	})
 
+	t.Run("build with invalid config and strict repositories", func(t *testing.T) {
+		m := NewTestMixin(t)
+		m.In = bytes.NewReader([]byte("config:\n  strictRepositories: true\n  repositories:\n    stable: {}\n"))
+
+		err := m.Build(ctx)
+		require.EqualError(t, err, "invalid repository stable: repository url must be supplied")
+		assert.Empty(t, m.TestContext.GetOutput(), "the build should fail before writing any Dockerfile lines")
+	})
+
 	t.Run("build with a defined helm client version", func(t *testing.T) {
 
 		b, err := ioutil.ReadFile("testdata/build-input-with-version.yaml")
@@ -105,6 +175,458 @@ USER root
 		assert.Equal(t, wantOutput, gotOutput)
 	})
 
+	t.Run("build with runtime defaults", func(t *testing.T) {
+		b, err := ioutil.ReadFile("testdata/build-input-with-defaults.yaml")
+		require.NoError(t, err)
+
+		m := NewTestMixin(t)
+		m.DebugMode = false
+		m.In = bytes.NewReader(b)
+		err = m.Build(ctx)
+		require.NoError(t, err, "build failed")
+		wantOutput := fmt.Sprintf(buildOutput, m.HelmClientVersion, m.HelmClientPlatform, m.HelmClientArchitecture) +
+			`ENV HELM3_MIXIN_DEFAULT_NAMESPACE=mynamespace
+ENV HELM3_MIXIN_DEFAULT_TIMEOUT=10m
+ENV HELM3_MIXIN_ATOMIC=false
+ENV HELM3_MIXIN_WAIT=true
+ENV HELM3_MIXIN_BURST_LIMIT=200
+ENV HELM3_MIXIN_QPS=50
+ENV HELM3_MIXIN_HEARTBEAT_INTERVAL=30s
+ENV HELM3_MIXIN_VERIFY_CLIENT_VERSION=false
+`
+		gotOutput := m.TestContext.GetOutput()
+		assert.Equal(t, wantOutput, gotOutput)
+	})
+
+	t.Run("build with local charts", func(t *testing.T) {
+		b, err := ioutil.ReadFile("testdata/build-input-with-local-charts.yaml")
+		require.NoError(t, err)
+
+		m := NewTestMixin(t)
+		m.DebugMode = false
+		m.In = bytes.NewReader(b)
+		m.TestContext.AddTestDirectory("testdata/charts", "charts")
+		err = m.Build(ctx)
+		require.NoError(t, err, "build failed")
+		wantOutput := fmt.Sprintf(buildOutput, m.HelmClientVersion, m.HelmClientPlatform, m.HelmClientArchitecture)
+		gotOutput := m.TestContext.GetOutput()
+		assert.Equal(t, wantOutput, gotOutput)
+	})
+
+	t.Run("build with a local chart that is not a chart directory", func(t *testing.T) {
+		b, err := ioutil.ReadFile("testdata/build-input-with-invalid-local-chart.yaml")
+		require.NoError(t, err)
+
+		m := NewTestMixin(t)
+		m.DebugMode = false
+		m.In = bytes.NewReader(b)
+		m.TestContext.AddTestDirectory("testdata/charts", "charts")
+		err = m.Build(ctx)
+		require.EqualError(t, err, "chart ./charts/nochart is not a chart directory, it does not contain a Chart.yaml file")
+	})
+
+	t.Run("build with vendored charts", func(t *testing.T) {
+		b, err := ioutil.ReadFile("testdata/build-input-with-vendored-charts.yaml")
+		require.NoError(t, err)
+
+		m := NewTestMixin(t)
+		m.DebugMode = false
+		m.In = bytes.NewReader(b)
+		err = m.Build(ctx)
+		require.NoError(t, err, "build failed")
+		wantOutput := fmt.Sprintf(buildOutput, m.HelmClientVersion, m.HelmClientPlatform, m.HelmClientArchitecture) +
+			`RUN mkdir -p /charts/stable && chown -R ${BUNDLE_USER} /charts
+USER ${BUNDLE_USER}
+RUN helm3 repo add jetstack https://charts.jetstack.io
+RUN helm3 repo add stable https://charts.helm.sh/stable
+RUN helm3 repo update
+RUN helm3 pull stable/mysql --version 1.6.2 --destination /charts/stable
+USER root
+`
+		gotOutput := m.TestContext.GetOutput()
+		assert.Equal(t, wantOutput, gotOutput)
+	})
+
+	t.Run("build with repository credentials from build secrets", func(t *testing.T) {
+		b, err := ioutil.ReadFile("testdata/build-input-with-repository-secrets.yaml")
+		require.NoError(t, err)
+
+		m := NewTestMixin(t)
+		m.DebugMode = false
+		m.In = bytes.NewReader(b)
+		err = m.Build(ctx)
+		require.NoError(t, err, "build failed")
+		wantOutput := fmt.Sprintf(buildOutput, m.HelmClientVersion, m.HelmClientPlatform, m.HelmClientArchitecture) +
+			`RUN mkdir -p /charts/private && chown -R ${BUNDLE_USER} /charts
+USER ${BUNDLE_USER}
+RUN helm3 repo add stable https://charts.helm.sh/stable
+RUN helm3 repo update
+RUN --mount=type=secret,id=charts-username,required=true --mount=type=secret,id=charts-password,required=true ` +
+			`helm3 pull mysql --repo https://charts.example.com --version 1.6.2 --destination /charts/private ` +
+			`--username "$(cat /run/secrets/charts-username)" --password "$(cat /run/secrets/charts-password)"
+USER root
+`
+		gotOutput := m.TestContext.GetOutput()
+		assert.Equal(t, wantOutput, gotOutput)
+	})
+
+	t.Run("build with an incomplete repository secret", func(t *testing.T) {
+		m := NewTestMixin(t)
+		m.In = bytes.NewReader([]byte("config:\n  repositories:\n    private:\n      url: https://charts.example.com\n      usernameSecret: charts-username\n"))
+		err := m.Build(ctx)
+		require.EqualError(t, err, "repository private must set both usernameSecret and passwordSecret")
+	})
+
+	t.Run("build with repository TLS options", func(t *testing.T) {
+		b, err := ioutil.ReadFile("testdata/build-input-with-repository-tls.yaml")
+		require.NoError(t, err)
+
+		m := NewTestMixin(t)
+		m.DebugMode = false
+		for _, file := range []string{"certs/charts-ca.pem", "certs/charts-client.pem", "certs/charts-client-key.pem"} {
+			require.NoError(t, m.FileSystem.WriteFile(file, []byte("pem"), 0600))
+		}
+		m.In = bytes.NewReader(b)
+		err = m.Build(ctx)
+		require.NoError(t, err, "build failed")
+		wantOutput := fmt.Sprintf(buildOutput, m.HelmClientVersion, m.HelmClientPlatform, m.HelmClientArchitecture) +
+			`COPY --chown=${BUNDLE_USER} certs/charts-ca.pem /etc/helm3-mixin/repositories/internal/charts-ca.pem
+COPY --chown=${BUNDLE_USER} certs/charts-client.pem /etc/helm3-mixin/repositories/internal/charts-client.pem
+COPY --chown=${BUNDLE_USER} certs/charts-client-key.pem /etc/helm3-mixin/repositories/internal/charts-client-key.pem
+USER ${BUNDLE_USER}
+RUN helm3 repo add internal https://charts.internal.example.com ` +
+			`--ca-file /etc/helm3-mixin/repositories/internal/charts-ca.pem ` +
+			`--cert-file /etc/helm3-mixin/repositories/internal/charts-client.pem ` +
+			`--key-file /etc/helm3-mixin/repositories/internal/charts-client-key.pem --pass-credentials --force-update
+RUN helm3 repo add legacy https://charts.legacy.example.com --insecure-skip-tls-verify
+RUN helm3 repo update
+USER root
+`
+		gotOutput := m.TestContext.GetOutput()
+		assert.Equal(t, wantOutput, gotOutput)
+	})
+
+	t.Run("build with a missing repository file", func(t *testing.T) {
+		m := NewTestMixin(t)
+		m.In = bytes.NewReader([]byte("config:\n  repositories:\n    internal:\n      url: https://charts.internal.example.com\n      caFile: certs/missing.pem\n"))
+		err := m.Build(ctx)
+		require.EqualError(t, err, "file certs/missing.pem of repository internal does not exist")
+	})
+
+	t.Run("build with linted charts", func(t *testing.T) {
+		b, err := ioutil.ReadFile("testdata/build-input-with-linted-charts.yaml")
+		require.NoError(t, err)
+
+		m := NewTestMixin(t)
+		m.DebugMode = false
+		m.In = bytes.NewReader(b)
+		err = m.Build(ctx)
+		require.NoError(t, err, "build failed")
+		wantOutput := fmt.Sprintf(buildOutput, m.HelmClientVersion, m.HelmClientPlatform, m.HelmClientArchitecture) +
+			`RUN mkdir -p /charts/stable && chown -R ${BUNDLE_USER} /charts
+USER ${BUNDLE_USER}
+RUN helm3 repo add jetstack https://charts.jetstack.io
+RUN helm3 repo add stable https://charts.helm.sh/stable
+RUN helm3 repo update
+RUN helm3 pull stable/mysql --version 1.6.2 --destination /charts/stable
+RUN helm3 lint /charts/stable/mysql-1.6.2.tgz
+USER root
+`
+		gotOutput := m.TestContext.GetOutput()
+		assert.Equal(t, wantOutput, gotOutput)
+	})
+
+	t.Run("build without the build cache", func(t *testing.T) {
+		m := NewTestMixin(t)
+		m.DebugMode = false
+		m.In = bytes.NewReader([]byte("config:\n  disableBuildCache: true\n"))
+		err := m.Build(ctx)
+		require.NoError(t, err, "build failed")
+		wantOutput := fmt.Sprintf(`ENV HELM_EXPERIMENTAL_OCI=1
+RUN apt-get update && apt-get install -y curl
+RUN curl https://get.helm.sh/helm-%s-%s-%s.tar.gz --output helm3.tar.gz
+RUN tar -xvf helm3.tar.gz && rm helm3.tar.gz
+RUN mv linux-amd64/helm /usr/local/bin/helm3
+RUN curl -o kubectl https://storage.googleapis.com/kubernetes-release/release/v1.22.1/bin/linux/amd64/kubectl &&\
+    mv kubectl /usr/local/bin && chmod a+x /usr/local/bin/kubectl
+`, m.HelmClientVersion, m.HelmClientPlatform, m.HelmClientArchitecture)
+		gotOutput := m.TestContext.GetOutput()
+		assert.Equal(t, wantOutput, gotOutput)
+	})
+
+	t.Run("build copying the clients from their images", func(t *testing.T) {
+		m := NewTestMixin(t)
+		m.DebugMode = false
+		m.In = bytes.NewReader([]byte("config:\n  clientVersion: v3.12.0\n  imagePlatform: copy-from-image\n"))
+		err := m.Build(ctx)
+		require.NoError(t, err, "build failed")
+		wantOutput := `ENV HELM_EXPERIMENTAL_OCI=1
+COPY --from=alpine/helm:3.12.0 /usr/bin/helm /usr/local/bin/helm3
+COPY --from=bitnami/kubectl:1.22.1 /opt/bitnami/kubectl/bin/kubectl /usr/local/bin/kubectl
+`
+		gotOutput := m.TestContext.GetOutput()
+		assert.Equal(t, wantOutput, gotOutput)
+	})
+
+	t.Run("build with a helm binary", func(t *testing.T) {
+		m := NewTestMixin(t)
+		m.In = bytes.NewReader([]byte("config:\n  helmBinary: /opt/helm/bin/helm\n  imagePlatform: copy-from-image\n"))
+		err := m.Build(ctx)
+		require.NoError(t, err, "build failed")
+		wantOutput := `ENV HELM_EXPERIMENTAL_OCI=1
+COPY --from=bitnami/kubectl:1.22.1 /opt/bitnami/kubectl/bin/kubectl /usr/local/bin/kubectl
+RUN ln -sf "$(command -v /opt/helm/bin/helm)" /usr/local/bin/helm3
+`
+		gotOutput := m.TestContext.GetOutput()
+		assert.Equal(t, wantOutput, gotOutput)
+	})
+
+	t.Run("build a windows invocation image with a helm binary", func(t *testing.T) {
+		m := NewTestMixin(t)
+		m.In = bytes.NewReader([]byte("config:\n  imagePlatform: windows\n  helmBinary: helm\n"))
+		err := m.Build(ctx)
+		require.EqualError(t, err, "helmBinary is not supported with imagePlatform windows")
+	})
+
+	t.Run("build with an unsupported image platform", func(t *testing.T) {
+		m := NewTestMixin(t)
+		m.In = bytes.NewReader([]byte("config:\n  imagePlatform: alpine\n"))
+		err := m.Build(ctx)
+		require.EqualError(t, err, `unsupported imagePlatform "alpine", allowed values are "copy-from-image" and "windows"`)
+		assert.Empty(t, m.TestContext.GetOutput(), "the build should fail before writing any Dockerfile lines")
+	})
+
+	t.Run("build with a custom image platform", func(t *testing.T) {
+		m := NewTestMixin(t)
+		m.In = bytes.NewReader([]byte(`config:
+  clientVersion: v3.14.4
+  apiVersion: v1.29.0
+  imagePlatform: alpine
+  platforms:
+  - name: alpine
+    init:
+    - RUN apk add --no-cache curl
+    - RUN curl --fail https://get.helm.sh/helm-{{helmVersion}}-{{clientPlatform}}-{{clientArchitecture}}.tar.gz
+    - RUN curl --fail https://dl.k8s.io/release/{{kubectlVersion}}/bin/{{clientPlatform}}/{{clientArchitecture}}/kubectl
+`))
+		err := m.Build(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, `RUN apk add --no-cache curl
+RUN curl --fail https://get.helm.sh/helm-v3.14.4-linux-amd64.tar.gz
+RUN curl --fail https://dl.k8s.io/release/v1.29.0/bin/linux/amd64/kubectl
+`, m.TestContext.GetOutput())
+	})
+
+	t.Run("build with an unknown custom image platform", func(t *testing.T) {
+		m := NewTestMixin(t)
+		m.In = bytes.NewReader([]byte("config:\n  imagePlatform: alpne\n  platforms:\n  - name: alpine\n    init: [RUN true]\n"))
+		err := m.Build(ctx)
+		require.EqualError(t, err, `unsupported imagePlatform "alpne", allowed values are "copy-from-image", "alpine" and "windows"`)
+	})
+
+	t.Run("build a windows invocation image", func(t *testing.T) {
+		m := NewTestMixin(t)
+		m.DebugMode = false
+		m.In = bytes.NewReader([]byte("config:\n  imagePlatform: windows\n"))
+		err := m.Build(ctx)
+		require.NoError(t, err, "build failed")
+		wantOutput := fmt.Sprintf(`ENV HELM_EXPERIMENTAL_OCI=1
+SHELL ["powershell", "-Command", "$ErrorActionPreference = 'Stop'; $ProgressPreference = 'SilentlyContinue';"]
+RUN New-Item -ItemType Directory -Force -Path C:\helm3 | Out-Null; \
+    Invoke-WebRequest -Uri https://get.helm.sh/helm-%s-windows-amd64.zip -OutFile helm3.zip; \
+    Expand-Archive helm3.zip -DestinationPath helm3; \
+    Move-Item helm3\windows-amd64\helm.exe C:\helm3\helm3.exe; \
+    Remove-Item -Recurse helm3, helm3.zip
+RUN Invoke-WebRequest -Uri https://storage.googleapis.com/kubernetes-release/release/v1.22.1/bin/windows/amd64/kubectl.exe -OutFile C:\helm3\kubectl.exe
+RUN setx /M PATH $($env:PATH + ';C:\helm3')
+`, m.HelmClientVersion)
+		gotOutput := m.TestContext.GetOutput()
+		assert.Equal(t, wantOutput, gotOutput)
+	})
+
+	t.Run("build a windows invocation image with vendored charts", func(t *testing.T) {
+		m := NewTestMixin(t)
+		m.In = bytes.NewReader([]byte("config:\n  imagePlatform: windows\n  vendorCharts: true\nactions:\n  install:\n  - helm3:\n      chart: stable/mysql\n      version: 1.6.2\n"))
+		err := m.Build(ctx)
+		require.EqualError(t, err, "vendored charts are not supported with imagePlatform windows")
+	})
+
+	t.Run("build with a proxy and extra CA certificates", func(t *testing.T) {
+		m := NewTestMixin(t)
+		m.DebugMode = false
+		m.FileSystem.WriteFile("certs/corporate-ca.pem", []byte("-----BEGIN CERTIFICATE-----"), 0644)
+		m.In = bytes.NewReader([]byte(`config:
+  httpProxy: http://proxy.example.com:3128
+  httpsProxy: http://proxy.example.com:3128
+  noProxy: localhost,.svc
+  extraCACerts:
+    - certs/corporate-ca.pem
+`))
+		err := m.Build(ctx)
+		require.NoError(t, err, "build failed")
+		wantOutput := `ENV HTTP_PROXY=http://proxy.example.com:3128 http_proxy=http://proxy.example.com:3128
+ENV HTTPS_PROXY=http://proxy.example.com:3128 https_proxy=http://proxy.example.com:3128
+ENV NO_PROXY=localhost,.svc no_proxy=localhost,.svc
+COPY certs/corporate-ca.pem /usr/local/share/ca-certificates/corporate-ca.crt
+RUN apt-get update && apt-get install -y ca-certificates && update-ca-certificates
+` + fmt.Sprintf(buildOutput, m.HelmClientVersion, m.HelmClientPlatform, m.HelmClientArchitecture)
+		gotOutput := m.TestContext.GetOutput()
+		assert.Equal(t, wantOutput, gotOutput)
+	})
+
+	t.Run("build with a missing CA certificate", func(t *testing.T) {
+		m := NewTestMixin(t)
+		m.In = bytes.NewReader([]byte("config:\n  extraCACerts:\n    - certs/missing.pem\n"))
+		err := m.Build(ctx)
+		require.EqualError(t, err, "CA certificate certs/missing.pem does not exist")
+	})
+
+	t.Run("build with extra build lines", func(t *testing.T) {
+		m := NewTestMixin(t)
+		m.DebugMode = false
+		m.In = bytes.NewReader([]byte(`config:
+  extraBuildLines:
+    pre:
+      - RUN apt-get update && apt-get install -y jq
+    post:
+      - ENV HELM_CACHE_HOME=/cnab/app/.cache/helm
+`))
+		err := m.Build(ctx)
+		require.NoError(t, err, "build failed")
+		wantOutput := "RUN apt-get update && apt-get install -y jq\n" +
+			fmt.Sprintf(buildOutput, m.HelmClientVersion, m.HelmClientPlatform, m.HelmClientArchitecture) +
+			"ENV HELM_CACHE_HOME=/cnab/app/.cache/helm\n"
+		gotOutput := m.TestContext.GetOutput()
+		assert.Equal(t, wantOutput, gotOutput)
+	})
+
+	t.Run("build with auth plugins", func(t *testing.T) {
+		m := NewTestMixin(t)
+		m.DebugMode = false
+		m.In = bytes.NewReader([]byte("config:\n  authPlugins:\n    - aws-iam-authenticator\n    - kubelogin\n"))
+		err := m.Build(ctx)
+		require.NoError(t, err, "build failed")
+		wantOutput := fmt.Sprintf(buildOutput, m.HelmClientVersion, m.HelmClientPlatform, m.HelmClientArchitecture) +
+			`RUN curl --fail -L -o /usr/local/bin/aws-iam-authenticator https://github.com/kubernetes-sigs/aws-iam-authenticator/releases/download/v0.6.14/aws-iam-authenticator_0.6.14_linux_amd64 &&\
+    chmod a+x /usr/local/bin/aws-iam-authenticator
+RUN apt-get update && apt-get install -y unzip &&\
+    curl --fail -L -o kubelogin.zip https://github.com/Azure/kubelogin/releases/download/v0.1.3/kubelogin-linux-amd64.zip &&\
+    unzip kubelogin.zip && mv bin/linux_amd64/kubelogin /usr/local/bin/kubelogin && rm -r kubelogin.zip bin
+`
+		gotOutput := m.TestContext.GetOutput()
+		assert.Equal(t, wantOutput, gotOutput)
+	})
+
+	t.Run("build with an unsupported auth plugin", func(t *testing.T) {
+		m := NewTestMixin(t)
+		m.In = bytes.NewReader([]byte("config:\n  authPlugins:\n    - oidc-login\n"))
+		err := m.Build(ctx)
+		require.EqualError(t, err, `unsupported authPlugin "oidc-login", allowed values are aws-iam-authenticator, gke-gcloud-auth-plugin and kubelogin`)
+	})
+
+	t.Run("build with a client architecture", func(t *testing.T) {
+		m := NewTestMixin(t)
+		m.DebugMode = false
+		m.In = bytes.NewReader([]byte("config:\n  clientArchitecture: s390x\n  disableBuildCache: true\n"))
+		err := m.Build(ctx)
+		require.NoError(t, err, "build failed")
+		wantOutput := fmt.Sprintf(`ENV HELM_EXPERIMENTAL_OCI=1
+RUN apt-get update && apt-get install -y curl
+RUN curl https://get.helm.sh/helm-%s-linux-s390x.tar.gz --output helm3.tar.gz
+RUN tar -xvf helm3.tar.gz && rm helm3.tar.gz
+RUN mv linux-s390x/helm /usr/local/bin/helm3
+RUN curl -o kubectl https://storage.googleapis.com/kubernetes-release/release/v1.22.1/bin/linux/s390x/kubectl &&\
+    mv kubectl /usr/local/bin && chmod a+x /usr/local/bin/kubectl
+`, m.HelmClientVersion)
+		gotOutput := m.TestContext.GetOutput()
+		assert.Equal(t, wantOutput, gotOutput)
+	})
+
+	t.Run("build with an unsupported client architecture", func(t *testing.T) {
+		m := NewTestMixin(t)
+		m.In = bytes.NewReader([]byte("config:\n  clientArchitecture: riscv64\n"))
+		err := m.Build(ctx)
+		require.EqualError(t, err, `unsupported clientArchitecture "riscv64", allowed values are amd64, arm64, arm, 386, s390x, ppc64le`)
+		assert.Empty(t, m.TestContext.GetOutput(), "the build should fail before writing any Dockerfile lines")
+	})
+
+	t.Run("build with helm v4", func(t *testing.T) {
+		m := NewTestMixin(t)
+		m.DebugMode = false
+		m.In = bytes.NewReader([]byte("config:\n  clientVersion: v4.0.0\n  clientVersionConstraint: \">= v3.0.0, < v5.0.0\"\n"))
+		err := m.Build(ctx)
+		require.NoError(t, err, "build failed")
+		wantOutput := fmt.Sprintf(buildOutput, "v4.0.0", m.HelmClientPlatform, m.HelmClientArchitecture) +
+			"ENV HELM3_MIXIN_CLIENT_VERSION=v4.0.0\n" +
+			"ENV HELM3_MIXIN_CLIENT_VERSION_CONSTRAINT=\">= v3.0.0, < v5.0.0\"\n"
+		gotOutput := m.TestContext.GetOutput()
+		assert.Equal(t, wantOutput, gotOutput)
+	})
+
+	t.Run("build with helm v4 and the default constraint", func(t *testing.T) {
+		m := NewTestMixin(t)
+		m.In = bytes.NewReader([]byte("config:\n  clientVersion: v4.0.0\n"))
+		err := m.Build(ctx)
+		require.EqualError(t, err, `supplied clientVersion "v4.0.0" does not meet semver constraint "^v3.x"`)
+	})
+
+	t.Run("build with an apiVersion", func(t *testing.T) {
+		m := NewTestMixin(t)
+		m.DebugMode = false
+		m.In = bytes.NewReader([]byte("config:\n  apiVersion: v1.28.4\n  imagePlatform: copy-from-image\n"))
+		err := m.Build(ctx)
+		require.NoError(t, err, "build failed")
+		assert.Contains(t, m.TestContext.GetOutput(), "COPY --from=bitnami/kubectl:1.28.4 /opt/bitnami/kubectl/bin/kubectl /usr/local/bin/kubectl\n")
+	})
+
+	t.Run("build with an invalid apiVersion", func(t *testing.T) {
+		m := NewTestMixin(t)
+		m.In = bytes.NewReader([]byte("config:\n  apiVersion: latest\n"))
+		err := m.Build(ctx)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `supplied apiVersion "latest" cannot be parsed as semver`)
+		assert.Empty(t, m.TestContext.GetOutput(), "the build should fail before writing any Dockerfile lines")
+	})
+
+	t.Run("build with an invalid heartbeatInterval", func(t *testing.T) {
+		m := NewTestMixin(t)
+		m.In = bytes.NewReader([]byte("config:\n  heartbeatInterval: often\n"))
+		err := m.Build(ctx)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `supplied heartbeatInterval "often" is not a valid duration`)
+	})
+
+	t.Run("build with plugins", func(t *testing.T) {
+		b, err := ioutil.ReadFile("testdata/build-input-with-plugins.yaml")
+		require.NoError(t, err)
+
+		m := NewTestMixin(t)
+		m.DebugMode = false
+		m.In = bytes.NewReader(b)
+		err = m.Build(ctx)
+		require.NoError(t, err, "build failed")
+		wantOutput := fmt.Sprintf(buildOutput, m.HelmClientVersion, m.HelmClientPlatform, m.HelmClientArchitecture) +
+			`USER ${BUNDLE_USER}
+RUN helm3 plugin install https://github.com/chartmuseum/helm-push
+RUN helm3 plugin install https://github.com/databus23/helm-diff --version v3.6.0
+RUN helm3 plugin install https://github.com/helm/helm-mapkubeapis
+USER root
+`
+		gotOutput := m.TestContext.GetOutput()
+		assert.Equal(t, wantOutput, gotOutput)
+	})
+
+	t.Run("build with a vendored chart without a version", func(t *testing.T) {
+		b, err := ioutil.ReadFile("testdata/build-input-with-unversioned-vendored-chart.yaml")
+		require.NoError(t, err)
+
+		m := NewTestMixin(t)
+		m.DebugMode = false
+		m.In = bytes.NewReader(b)
+		err = m.Build(ctx)
+		require.EqualError(t, err, "chart stable/mysql must set a version to be vendored")
+	})
+
 	t.Run("build with a defined helm client version that does not meet the semver constraint", func(t *testing.T) {
 
 		b, err := ioutil.ReadFile("testdata/build-input-with-unsupported-client-version.yaml")
@@ -129,3 +651,147 @@ USER root
 		require.EqualError(t, err, `supplied client version "v3.8.2.0" cannot be parsed as semver: Invalid Semantic Version`)
 	})
 }
+
+func TestMixin_BuildOutputJSON(t *testing.T) {
+	b, err := ioutil.ReadFile("testdata/build-input-with-valid-config.yaml")
+	require.NoError(t, err)
+
+	m := NewTestMixin(t)
+	m.In = bytes.NewReader(b)
+	m.OutputFormat = OutputFormatJSON
+
+	err = m.Build(context.Background())
+	require.NoError(t, err)
+
+	var output BuildOutput
+	require.NoError(t, json.Unmarshal([]byte(m.TestContext.GetOutput()), &output))
+	assert.Equal(t, "1", output.Env["HELM_EXPERIMENTAL_OCI"])
+	assert.Equal(t, "RUN apt-get update && apt-get install -y curl", output.Lines[0])
+	assert.Contains(t, output.Lines[1], "\\\n    tar -xvf", "continued instructions are kept together")
+	assert.Equal(t, []string{"RUN helm3 repo add stable kubernetes-charts", "RUN helm3 repo update"}, output.UserLines)
+	for _, line := range append(output.Lines, output.UserLines...) {
+		assert.NotContains(t, line, "USER ")
+	}
+}
+
+func TestParseBuildOutput(t *testing.T) {
+	output := parseBuildOutput(splitInstructions(`ARG PROXY=http://proxy
+ENV HTTP_PROXY=http://proxy
+ENV GREETING="hello world"
+RUN echo \
+    hello
+USER ${BUNDLE_USER}
+RUN helm3 repo update
+USER root
+`))
+	assert.Equal(t, BuildOutput{
+		Env:       map[string]string{"HTTP_PROXY": "http://proxy"},
+		BuildArgs: []string{"PROXY"},
+		Lines:     []string{"ARG PROXY=http://proxy", `ENV GREETING="hello world"`, "RUN echo \\\n    hello"},
+		UserLines: []string{"RUN helm3 repo update"},
+	}, output)
+}
+
+func TestDedupeInstructions(t *testing.T) {
+	deduped := dedupeInstructions(splitInstructions(`RUN apt-get update && apt-get install -y curl
+ENV HELM_EXPERIMENTAL_OCI=1
+RUN apt-get update && apt-get install -y curl
+ENV HELM_EXPERIMENTAL_OCI=1
+ENV HELM_EXPERIMENTAL_OCI=0
+ENV HELM_EXPERIMENTAL_OCI=1
+USER ${BUNDLE_USER}
+RUN apt-get update && apt-get install -y curl
+RUN helm3 repo update
+RUN helm3 repo update
+USER root
+# helm3-mixin: bundle line
+RUN apt-get update && apt-get install -y curl
+RUN apt-get update && apt-get install -y curl
+`))
+	assert.Equal(t, []string{
+		"RUN apt-get update && apt-get install -y curl",
+		"ENV HELM_EXPERIMENTAL_OCI=1",
+		"ENV HELM_EXPERIMENTAL_OCI=0",
+		"ENV HELM_EXPERIMENTAL_OCI=1",
+		"USER ${BUNDLE_USER}",
+		"RUN apt-get update && apt-get install -y curl",
+		"RUN helm3 repo update",
+		"USER root",
+		"RUN apt-get update && apt-get install -y curl",
+	}, deduped)
+}
+
+func TestVendoredChartPath(t *testing.T) {
+	charts := []vendoredChart{
+		{Chart: "stable/mysql", Version: "1.6.2"},
+		{Chart: "bitnami/mysql", Version: "1.6.2"},
+		{Chart: "oci://registry.example.com/charts/mysql", Version: "1.6.2"},
+	}
+	assert.Equal(t, "/charts/stable/mysql-1.6.2.tgz", vendoredChartPath(charts[0].Chart, charts[0].Version))
+	assert.Equal(t, "/charts/bitnami/mysql-1.6.2.tgz", vendoredChartPath(charts[1].Chart, charts[1].Version))
+	assert.Equal(t, "/charts/registry.example.com/charts/mysql-1.6.2.tgz", vendoredChartPath(charts[2].Chart, charts[2].Version))
+	assert.Equal(t, []string{"/charts/bitnami", "/charts/registry.example.com/charts", "/charts/stable"}, vendoredChartDirs(charts))
+}
+
+func TestMixin_BuildDedupesExtraLines(t *testing.T) {
+	b := []byte(`config:
+  extraBuildLines:
+    pre:
+    - RUN apt-get update && apt-get install -y curl
+    post:
+    - ENV HELM_EXPERIMENTAL_OCI=1
+`)
+	m := NewTestMixin(t)
+	m.In = bytes.NewReader(b)
+
+	err := m.Build(context.Background())
+	require.NoError(t, err)
+	output := m.TestContext.GetOutput()
+	assert.Equal(t, 1, strings.Count(output, "RUN apt-get update && apt-get install -y curl\n"))
+	assert.Equal(t, 1, strings.Count(output, "ENV HELM_EXPERIMENTAL_OCI=1\n"))
+}
+
+func TestMixin_BuildKeepsRepeatedExtraLines(t *testing.T) {
+	b := []byte(`config:
+  extraBuildLines:
+    pre:
+    - COPY certs/ca.crt /usr/local/share/ca-certificates/
+    - RUN update-ca-certificates
+    - COPY certs/proxy.crt /usr/local/share/ca-certificates/
+    - RUN update-ca-certificates
+    post:
+    - RUN apt-get update && apt-get install -y curl
+`)
+	m := NewTestMixin(t)
+	m.In = bytes.NewReader(b)
+
+	err := m.Build(context.Background())
+	require.NoError(t, err)
+	output := m.TestContext.GetOutput()
+	assert.Equal(t, 2, strings.Count(output, "RUN update-ca-certificates\n"))
+	assert.Equal(t, 2, strings.Count(output, "RUN apt-get update && apt-get install -y curl\n"),
+		"the extra line written after the install of helm is kept")
+	assert.NotContains(t, output, bundleLineMarker)
+}
+
+func TestValidatePlatforms(t *testing.T) {
+	init := []string{"RUN apk add --no-cache helm kubectl"}
+	assert.NoError(t, validatePlatforms([]Platform{{Name: "alpine", Init: init}, {Name: "distroless", Init: init}}))
+	assert.EqualError(t, validatePlatforms([]Platform{{Init: init}}), "platform 1 must set a name")
+	assert.EqualError(t, validatePlatforms([]Platform{{Name: "alpine"}}), "platform alpine must set the init lines that install helm3 and kubectl")
+	assert.EqualError(t, validatePlatforms([]Platform{{Name: "alpine", Init: init}, {Name: "alpine", Init: init}}), "platform alpine is declared more than once")
+	assert.EqualError(t, validatePlatforms([]Platform{{Name: "windows", Init: init}}), "platform windows has the name of a built-in image platform")
+}
+
+func TestMixin_BuildLeavesPorterHomeUntouched(t *testing.T) {
+	m := NewTestMixin(t)
+	m.Setenv("PORTER_HOME", "/home/porter/.porter")
+	m.In = bytes.NewReader([]byte("config:\n  clientVersion: v3.14.4\n"))
+
+	err := m.Build(context.Background())
+	require.NoError(t, err)
+
+	exists, err := m.FileSystem.Exists("/home/porter/.porter")
+	require.NoError(t, err)
+	assert.False(t, exists, "build must use the in-memory defaults and not write a config file to PORTER_HOME")
+}
@@ -0,0 +1,170 @@
+package helm3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// bundleUserLine and rootUserLine switch the user of the Dockerfile lines of the mixin
+const (
+	bundleUserLine = "USER ${BUNDLE_USER}"
+	rootUserLine   = "USER root"
+)
+
+// bundleLineMarker is written before each instruction of the Dockerfile lines declared by the bundle, so that
+// they are told apart from the lines of the mixin and kept when they are repeated. It is removed from the output.
+const bundleLineMarker = "# helm3-mixin: bundle line"
+
+// BuildOutput is the structured output of the build command, returned instead of the Dockerfile lines with
+// --output json, so that porter can merge the environment variables of the mixins and switch the user itself.
+type BuildOutput struct {
+	// Env are the environment variables of the invocation image, set before the lines
+	Env map[string]string `json:"env,omitempty"`
+
+	// BuildArgs are the names of the build arguments declared with ARG
+	BuildArgs []string `json:"buildArgs,omitempty"`
+
+	// Lines are the Dockerfile instructions run as root, in order
+	Lines []string `json:"lines,omitempty"`
+
+	// UserLines are the Dockerfile instructions run as the user of the bundle, after the lines
+	UserLines []string `json:"userLines,omitempty"`
+}
+
+// buildWithOutput runs build, and writes its Dockerfile lines without the duplicated instructions, or as a
+// BuildOutput when the output format is json. Only the --output flag selects the json output of build, not the
+// environment variable of the logs, because porter reads the Dockerfile lines of the mixins that don't support it.
+func (m *Mixin) buildWithOutput(ctx context.Context, build func(ctx context.Context) error) error {
+	out := m.Out
+	dockerfile := &bytes.Buffer{}
+	m.Out = dockerfile
+	err := build(ctx)
+	m.Out = out
+	if err != nil {
+		return err
+	}
+
+	instructions := dedupeInstructions(splitInstructions(dockerfile.String()))
+	if m.OutputFormat != OutputFormatJSON {
+		for _, instruction := range instructions {
+			fmt.Fprintln(m.Out, instruction)
+		}
+		return nil
+	}
+
+	data, err := json.MarshalIndent(parseBuildOutput(instructions), "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "could not marshal the build output")
+	}
+	fmt.Fprintln(m.Out, string(data))
+	return nil
+}
+
+// splitInstructions splits Dockerfile lines into instructions, keeping the instructions continued on the next
+// line with a trailing backslash together.
+func splitInstructions(dockerfile string) []string {
+	var instructions []string
+	instruction := ""
+	for _, line := range strings.Split(dockerfile, "\n") {
+		if instruction != "" {
+			instruction += "\n"
+		}
+		instruction += line
+		if strings.HasSuffix(line, "\\") {
+			continue
+		}
+		if strings.TrimSpace(instruction) != "" {
+			instructions = append(instructions, instruction)
+		}
+		instruction = ""
+	}
+	return instructions
+}
+
+// writeBundleLines writes the Dockerfile lines declared by the bundle, each instruction after a bundleLineMarker.
+func (m *Mixin) writeBundleLines(lines []string) {
+	for _, instruction := range splitInstructions(strings.Join(lines, "\n")) {
+		fmt.Fprintln(m.Out, bundleLineMarker)
+		fmt.Fprintln(m.Out, instruction)
+	}
+}
+
+// dedupeInstructions removes the instructions written by the mixin that were already run as the same user, for
+// example a RUN line of the extra build lines that the mixin also writes, and the ENV instructions that don't
+// change the value of their variable, so that the invocation image doesn't get duplicated layers. The USER
+// switches and the other lines of the bundle, marked with bundleLineMarker, are kept even when they are repeated.
+func dedupeInstructions(instructions []string) []string {
+	deduped := make([]string, 0, len(instructions))
+	user := rootUserLine
+	env := map[string]string{}
+	seen := map[string]bool{}
+	bundleLine := false
+	for _, instruction := range instructions {
+		current := strings.TrimSpace(instruction)
+		if current == bundleLineMarker {
+			bundleLine = true
+			continue
+		}
+		fromBundle := bundleLine
+		bundleLine = false
+		switch {
+		case strings.HasPrefix(current, "USER "):
+			user = current
+		case strings.HasPrefix(current, "ENV ") && isSingleEnv(current):
+			name, value, _ := strings.Cut(strings.TrimPrefix(current, "ENV "), "=")
+			if previous, ok := env[name]; ok && previous == value {
+				continue
+			}
+			env[name] = value
+		default:
+			key := user + "\n" + current
+			if seen[key] && !fromBundle {
+				continue
+			}
+			seen[key] = true
+		}
+		deduped = append(deduped, instruction)
+	}
+	return deduped
+}
+
+// parseBuildOutput splits the instructions written by build into a BuildOutput. The ENV instructions that set
+// several variables, or use the legacy ENV NAME VALUE form, are kept as lines.
+func parseBuildOutput(instructions []string) BuildOutput {
+	var output BuildOutput
+	asUser := false
+	for _, instruction := range instructions {
+		current := strings.TrimSpace(instruction)
+		switch {
+		case current == bundleUserLine:
+			asUser = true
+		case current == rootUserLine:
+			asUser = false
+		case strings.HasPrefix(current, "ARG "):
+			output.BuildArgs = append(output.BuildArgs, strings.SplitN(strings.TrimPrefix(current, "ARG "), "=", 2)[0])
+			output.Lines = append(output.Lines, current)
+		case strings.HasPrefix(current, "ENV ") && isSingleEnv(current):
+			name, value, _ := strings.Cut(strings.TrimPrefix(current, "ENV "), "=")
+			if output.Env == nil {
+				output.Env = map[string]string{}
+			}
+			output.Env[name] = value
+		case asUser:
+			output.UserLines = append(output.UserLines, current)
+		default:
+			output.Lines = append(output.Lines, current)
+		}
+	}
+	return output
+}
+
+// isSingleEnv returns true when the ENV instruction sets a single variable with NAME=VALUE.
+func isSingleEnv(instruction string) bool {
+	assignment := strings.TrimPrefix(instruction, "ENV ")
+	return strings.Contains(assignment, "=") && !strings.ContainsAny(assignment, " \t\n\"'")
+}
@@ -0,0 +1,76 @@
+package helm3
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// buildSecretsDir is where BuildKit mounts the build secrets passed to porter build with --secret
+const buildSecretsDir = "/run/secrets"
+
+// usesBuildSecrets returns true when the credentials of the repository come from build secrets
+func (r Repository) usesBuildSecrets() bool {
+	return r.UsernameSecret != "" || r.PasswordSecret != ""
+}
+
+// validateRepositorySecrets checks that the repositories with build secrets set both the username and the password
+// secrets. Their index can't be pinned because they aren't added to the invocation image.
+func (c MixinConfig) validateRepositorySecrets() error {
+	names := make([]string, 0, len(c.Repositories))
+	for name := range c.Repositories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		repo := c.Repositories[name]
+		if !repo.usesBuildSecrets() {
+			continue
+		}
+		if repo.UsernameSecret == "" || repo.PasswordSecret == "" {
+			return errors.Errorf("repository %s must set both usernameSecret and passwordSecret", name)
+		}
+		if repo.PinIndex {
+			return errors.Errorf("repository %s cannot set pinIndex, the repositories with build secrets aren't added to the invocation image", name)
+		}
+	}
+	return nil
+}
+
+// vendoredChartPullCommand returns the RUN line that downloads a vendored chart. The charts of a repository with
+// build secrets are pulled with --repo, so that the credentials aren't stored in the repositories of helm,
+// and with the secrets mounted only for that line, so that they aren't kept in the layers of the image.
+func (c MixinConfig) vendoredChartPullCommand(chart vendoredChart) string {
+	parts := strings.SplitN(chart.Chart, "/", 2)
+	repo, ok := c.Repositories[parts[0]]
+	if len(parts) != 2 || !ok || !repo.usesBuildSecrets() {
+		return fmt.Sprintf("RUN helm3 pull %s --version %s --destination %s", chart.Chart, chart.Version, vendoredChartDir(chart.Chart))
+	}
+
+	line := fmt.Sprintf("RUN --mount=type=secret,id=%s,required=true --mount=type=secret,id=%s,required=true "+
+		"helm3 pull %s --repo %s --version %s --destination %s --username \"$(cat %s)\" --password \"$(cat %s)\"",
+		repo.UsernameSecret, repo.PasswordSecret, parts[1], repo.URL, chart.Version, vendoredChartDir(chart.Chart),
+		path.Join(buildSecretsDir, repo.UsernameSecret), path.Join(buildSecretsDir, repo.PasswordSecret))
+
+	// the TLS options of the repository, that helm repo add would otherwise store
+	if repo.CAFile != "" {
+		line += " --ca-file " + repositoryFilePath(parts[0], repo.CAFile)
+	}
+	if repo.CertFile != "" {
+		line += " --cert-file " + repositoryFilePath(parts[0], repo.CertFile)
+	}
+	if repo.KeyFile != "" {
+		line += " --key-file " + repositoryFilePath(parts[0], repo.KeyFile)
+	}
+	if repo.InsecureSkipTLSVerify {
+		line += " --insecure-skip-tls-verify"
+	}
+	if repo.PassCredentials {
+		line += " --pass-credentials"
+	}
+	return line
+}
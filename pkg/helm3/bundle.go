@@ -0,0 +1,45 @@
+package helm3
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// bundlePath is where the CNAB runtime provides the bundle definition
+const bundlePath = "/cnab/bundle.json"
+
+// bundle is the subset of the bundle definition used by the mixin
+type bundle struct {
+	Images     map[string]bundleImage     `json:"images,omitempty"`
+	Parameters map[string]bundleParameter `json:"parameters,omitempty"`
+}
+
+// bundleImage is an image declared in the images section of the bundle
+type bundleImage struct {
+	Image         string `json:"image"`
+	ContentDigest string `json:"contentDigest,omitempty"`
+}
+
+// bundleParameter is a parameter of the bundle, file parameters are written to the destination path
+type bundleParameter struct {
+	Destination struct {
+		Path string `json:"path,omitempty"`
+		Env  string `json:"env,omitempty"`
+	} `json:"destination"`
+}
+
+// loadBundle reads the bundle definition provided by the CNAB runtime.
+func (m *Mixin) loadBundle() (bundle, error) {
+	var bun bundle
+	data, err := m.FileSystem.ReadFile(bundlePath)
+	if err != nil {
+		return bun, errors.Wrapf(err, "could not read the bundle %s", bundlePath)
+	}
+
+	err = json.Unmarshal(data, &bun)
+	if err != nil {
+		return bun, errors.Wrapf(err, "could not parse the bundle %s", bundlePath)
+	}
+	return bun, nil
+}
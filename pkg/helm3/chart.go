@@ -0,0 +1,238 @@
+package helm3
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// vendoredChartsDir is where the vendored charts are downloaded in the invocation image
+const vendoredChartsDir = "/charts"
+
+// pinnedRepositoryCacheDir is the repository cache with the indexes of the pinned repositories, as they were
+// downloaded when the invocation image was built
+const pinnedRepositoryCacheDir = "/var/lib/helm3-mixin/repository-cache"
+
+// pinnedReposEnv hands the names of the pinned repositories over to the invocation image, separated by commas
+const pinnedReposEnv = "HELM3_MIXIN_PINNED_REPOS"
+
+// chartMetadata is the subset of Chart.yaml used by the mixin
+type chartMetadata struct {
+	Dependencies []interface{} `yaml:"dependencies,omitempty"`
+}
+
+// isLocalChartPath returns true when the chart is referenced by a path, for example ./charts/mychart,
+// instead of by a repository reference or URL.
+func isLocalChartPath(chart string) bool {
+	return strings.HasPrefix(chart, ".") || filepath.IsAbs(chart)
+}
+
+// isChartURL returns true when the chart is referenced by the url of its archive,
+// for example https://example.com/charts/mysql-1.6.2.tgz.
+func isChartURL(chart string) bool {
+	return strings.HasPrefix(chart, "https://") || strings.HasPrefix(chart, "http://")
+}
+
+// validateLocalChart checks that a chart directory contains a Chart.yaml file.
+// Packaged charts and charts that are not referenced by a path are not checked.
+func (m *Mixin) validateLocalChart(chart string) error {
+	if !isLocalChartPath(chart) || strings.HasSuffix(chart, ".tgz") {
+		return nil
+	}
+
+	exists, err := m.FileSystem.Exists(filepath.Join(chart, "Chart.yaml"))
+	if err != nil {
+		return errors.Wrapf(err, "could not check chart %s", chart)
+	}
+	if !exists {
+		return errors.Errorf("chart %s is not a chart directory, it does not contain a Chart.yaml file", chart)
+	}
+	return nil
+}
+
+// buildChartDependencies downloads the dependencies of a chart directory before it is installed.
+// The lock file is used when present, otherwise the dependencies are resolved from Chart.yaml.
+func (m *Mixin) buildChartDependencies(ctx context.Context, a helmArgs, env []string) error {
+	isDir, err := m.FileSystem.DirExists(a.Chart)
+	if err != nil || !isDir {
+		return nil
+	}
+
+	chartFile, err := m.FileSystem.ReadFile(filepath.Join(a.Chart, "Chart.yaml"))
+	if err != nil {
+		return errors.Wrapf(err, "could not read the Chart.yaml file of chart %s", a.Chart)
+	}
+
+	var chart chartMetadata
+	err = yaml.Unmarshal(chartFile, &chart)
+	if err != nil {
+		return errors.Wrapf(err, "could not parse the Chart.yaml file of chart %s", a.Chart)
+	}
+	if len(chart.Dependencies) == 0 {
+		return nil
+	}
+
+	command := "update"
+	hasLock, _ := m.FileSystem.Exists(filepath.Join(a.Chart, "Chart.lock"))
+	if hasLock {
+		command = "build"
+	}
+
+	err = m.runHelm(ctx, []string{"dependency", command, a.Chart}, env)
+	if err != nil {
+		return errors.Wrapf(err, "could not %s the dependencies of chart %s", command, a.Chart)
+	}
+	return nil
+}
+
+// vendoredChart is a chart that is downloaded into the invocation image at build time
+type vendoredChart struct {
+	Chart   string
+	Version string
+}
+
+// vendoredCharts returns the charts of the install and upgrade steps that should be vendored,
+// either because vendorCharts is set for the mixin or for the repository of the chart.
+func (input BuildInput) vendoredCharts() ([]vendoredChart, error) {
+	found := map[vendoredChart]bool{}
+	for _, steps := range input.Actions {
+		for _, step := range steps {
+			for _, release := range step.releases() {
+				chart := release.Chart
+				if chart == "" || isLocalChartPath(chart) || isChartURL(chart) {
+					continue
+				}
+
+				vendor := input.Config.VendorCharts
+				if repo, ok := input.Config.Repositories[strings.SplitN(chart, "/", 2)[0]]; ok && repo.VendorCharts {
+					vendor = true
+				}
+				if !vendor {
+					continue
+				}
+
+				if release.Version == "" {
+					return nil, errors.Errorf("chart %s must set a version to be vendored", chart)
+				}
+				found[vendoredChart{Chart: chart, Version: release.Version}] = true
+			}
+		}
+	}
+
+	charts := make([]vendoredChart, 0, len(found))
+	for chart := range found {
+		charts = append(charts, chart)
+	}
+	sort.Slice(charts, func(i, j int) bool {
+		if charts[i].Chart == charts[j].Chart {
+			return charts[i].Version < charts[j].Version
+		}
+		return charts[i].Chart < charts[j].Chart
+	})
+	return charts, nil
+}
+
+// vendoredChartDir is the directory where helm pull downloads the chart at build time, named after the repository
+// or the registry of the chart so that the charts with the same name from different repositories don't collide.
+func vendoredChartDir(chart string) string {
+	return path.Join(vendoredChartsDir, path.Dir(strings.TrimPrefix(chart, "oci://")))
+}
+
+// vendoredChartPath is the path of the chart archive downloaded by helm pull at build time.
+func vendoredChartPath(chart, version string) string {
+	return path.Join(vendoredChartDir(chart), fmt.Sprintf("%s-%s.tgz", path.Base(chart), version))
+}
+
+// vendoredChartDirs returns the sorted directories of the vendored charts.
+func vendoredChartDirs(charts []vendoredChart) []string {
+	found := map[string]bool{}
+	for _, chart := range charts {
+		found[vendoredChartDir(chart.Chart)] = true
+	}
+	dirs := make([]string, 0, len(found))
+	for dir := range found {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// useVendoredChart installs the chart from the archive downloaded at build time, when it is present,
+// so that the chart repository isn't needed at runtime.
+func (m *Mixin) useVendoredChart(a helmArgs) helmArgs {
+	if a.Chart == "" || a.Version == "" || isLocalChartPath(a.Chart) {
+		return a
+	}
+
+	archive := vendoredChartPath(a.Chart, a.Version)
+	if exists, _ := m.FileSystem.Exists(archive); !exists {
+		return a
+	}
+
+	a.Chart = archive
+	a.Version = ""
+	a.Repo = ""
+	return a
+}
+
+// pinnedRepositories returns the sorted names of the repositories that set pinIndex.
+func (c MixinConfig) pinnedRepositories() []string {
+	var names []string
+	for name, repo := range c.Repositories {
+		if repo.PinIndex {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// chartRepoName returns the name of the repository of a chart referenced as REPO/CHART,
+// or an empty string when the chart is referenced by a path, a url or with the repo of the step.
+func chartRepoName(a helmArgs) string {
+	if a.Repo != "" || isLocalChartPath(a.Chart) || isOCIRemote(a.Chart) || isChartURL(a.Chart) || !strings.Contains(a.Chart, "/") {
+		return ""
+	}
+	return strings.SplitN(a.Chart, "/", 2)[0]
+}
+
+// usePinnedIndex resolves the chart from the index downloaded at build time when its repository is pinned.
+func (m *Mixin) usePinnedIndex(a helmArgs) helmArgs {
+	repo := chartRepoName(a)
+	if repo == "" {
+		return a
+	}
+	for _, pinned := range strings.Split(m.Getenv(pinnedReposEnv), ",") {
+		if pinned == repo {
+			a.RepositoryCache = pinnedRepositoryCacheDir
+			return a
+		}
+	}
+	return a
+}
+
+// updateChartRepo updates the repository of a chart referenced as REPO/CHART before it is installed or upgraded,
+// when updateReposAtRuntime is set, so that the repositories don't need to be updated when the bundle is built.
+// Pinned repositories are not updated.
+func (m *Mixin) updateChartRepo(ctx context.Context, a helmArgs, env []string) error {
+	if update := m.getBoolEnv(updateReposEnv); update == nil || !*update {
+		return nil
+	}
+	// the index of a pinned repository must not change after the build
+	repo := chartRepoName(a)
+	if repo == "" || a.RepositoryCache != "" {
+		return nil
+	}
+
+	err := m.runHelm(ctx, []string{"repo", "update", repo}, env)
+	if err != nil {
+		return errors.Wrapf(err, "could not update repository %s", repo)
+	}
+	return nil
+}
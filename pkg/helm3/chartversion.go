@@ -0,0 +1,68 @@
+package helm3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Masterminds/semver"
+	"github.com/pkg/errors"
+)
+
+// searchResult is a chart version listed by helm search repo
+type searchResult struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// resolveChartVersion resolves the version of a chart referenced as REPO/CHART, when it is a semver range
+// like ~15.2.x, to the latest version of the repository index that matches it, so that the version that is
+// deployed is logged and can be set as an output. Exact versions, and the charts referenced by a path, a url
+// or with the repo of the step, are returned as is.
+func (m *Mixin) resolveChartVersion(ctx context.Context, a helmArgs, env []string) (string, error) {
+	if a.Version == "" || exactVersion.MatchString(a.Version) || chartRepoName(a) == "" {
+		return a.Version, nil
+	}
+
+	args := []string{"search", "repo", a.Chart, "--versions", "--version", a.Version, "--output", "json"}
+	if a.Devel {
+		args = append(args, "--devel")
+	}
+	if a.RepositoryCache != "" {
+		args = append(args, "--repository-cache", a.RepositoryCache)
+	}
+	output := &bytes.Buffer{}
+	err := m.runHelmWithStdout(ctx, args, env, output)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not search the versions of chart %s", a.Chart)
+	}
+
+	var results []searchResult
+	err = json.Unmarshal(output.Bytes(), &results)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not parse the versions of chart %s", a.Chart)
+	}
+	var latest *semver.Version
+	var resolved string
+	for _, result := range results {
+		// the search also returns the charts whose name contains the name of the chart
+		if result.Name != a.Chart {
+			continue
+		}
+		v, err := semver.NewVersion(result.Version)
+		if err != nil {
+			continue
+		}
+		if latest == nil || v.GreaterThan(latest) {
+			latest = v
+			resolved = result.Version
+		}
+	}
+	if resolved == "" {
+		return "", errors.Errorf("no version of chart %s matches %q", a.Chart, a.Version)
+	}
+
+	fmt.Fprintf(m.Out, "Resolved version %s of chart %s to %s\n", a.Version, a.Chart, resolved)
+	return resolved, nil
+}
@@ -0,0 +1,83 @@
+package helm3
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Masterminds/semver"
+	"github.com/pkg/errors"
+)
+
+// clientVersionEnvVar hands the version of the helm client over to the invocation image,
+// so that the flags are built for its major version. It is only set for clients other than Helm v3.
+const clientVersionEnvVar = "HELM3_MIXIN_CLIENT_VERSION"
+
+// clientVersionConstraintEnvVar hands the clientVersionConstraint of the mixin configuration over to the
+// invocation image, so that the helm client is checked against it before the release is installed or upgraded.
+const clientVersionConstraintEnvVar = "HELM3_MIXIN_CLIENT_VERSION_CONSTRAINT"
+
+// verifyClientVersionEnv disables the check of the helm client version at runtime when set to false.
+const verifyClientVersionEnv = "HELM3_MIXIN_VERIFY_CLIENT_VERSION"
+
+// defaultClientMajorVersion is the major version of helm that the flags are built for by default
+const defaultClientMajorVersion = 3
+
+// clientVersionEnv returns the ENV line that embeds the client version in the invocation image,
+// or an empty string for Helm v3 clients.
+func clientVersionEnv(version string) string {
+	if clientMajorVersion(version) == defaultClientMajorVersion {
+		return ""
+	}
+	return fmt.Sprintf("ENV %s=%s", clientVersionEnvVar, version)
+}
+
+// clientVersionConstraintEnv returns the ENV line that embeds the client version constraint in the invocation image,
+// or an empty string when the mixin configuration does not set one.
+func clientVersionConstraintEnv(constraint string) string {
+	if constraint == "" {
+		return ""
+	}
+	return fmt.Sprintf("ENV %s=%q", clientVersionConstraintEnvVar, constraint)
+}
+
+// clientMajorVersion returns the major version of the helm client, defaulting to Helm v3
+// when the version is not set or cannot be parsed.
+func clientMajorVersion(version string) int {
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return defaultClientMajorVersion
+	}
+	return int(v.Major())
+}
+
+// runtimeClientVersionConstraint returns the semver constraint that the helm client of the invocation image
+// must meet: the clientVersionConstraint of the mixin configuration, or the major version the image was built for.
+func (m *Mixin) runtimeClientVersionConstraint() string {
+	if constraint := m.Getenv(clientVersionConstraintEnvVar); constraint != "" {
+		return constraint
+	}
+	return fmt.Sprintf("^v%d.x", clientMajorVersion(m.Getenv(clientVersionEnvVar)))
+}
+
+// verifyClientVersion checks that the helm client of the invocation image meets the client version constraint,
+// so that a binary replaced by a custom Dockerfile fails the step before helm is run.
+func (m *Mixin) verifyClientVersion(ctx context.Context) error {
+	if verify := m.getBoolEnv(verifyClientVersionEnv); verify != nil && !*verify {
+		return nil
+	}
+
+	version, err := m.helmVersion(ctx)
+	if err != nil {
+		return errors.Wrap(err, "could not check the version of the helm client")
+	}
+	constraint := m.runtimeClientVersionConstraint()
+	ok, err := validate(version, constraint)
+	if err != nil {
+		return errors.Wrapf(err, "could not check the version of the helm client against %q", constraint)
+	}
+	if !ok {
+		return errors.Errorf("the helm client of the invocation image is %s, which does not meet the semver constraint %q, check that the Dockerfile does not replace %s",
+			version, constraint, m.helmBinary())
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package helm3
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"get.porter.sh/porter/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMixin_ApplyDefaultsClientMajorVersion(t *testing.T) {
+	m := NewTestMixin(t)
+	assert.Equal(t, 3, m.applyDefaults(helmArgs{}).ClientMajorVersion)
+
+	m.Setenv(clientVersionEnvVar, "v4.0.1")
+	assert.Equal(t, 4, m.applyDefaults(helmArgs{}).ClientMajorVersion)
+}
+
+func TestMixin_VerifyClientVersion(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	defer os.Unsetenv(test.ExpectedCommandOutputEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 version --template {{.Version}}")
+
+	t.Run("matching client", func(t *testing.T) {
+		os.Setenv(test.ExpectedCommandOutputEnv, "v3.8.2")
+		m := NewTestMixin(t)
+
+		require.NoError(t, m.verifyClientVersion(ctx))
+	})
+
+	t.Run("mismatched client", func(t *testing.T) {
+		os.Setenv(test.ExpectedCommandOutputEnv, "v2.17.0")
+		m := NewTestMixin(t)
+
+		err := m.verifyClientVersion(ctx)
+		require.EqualError(t, err, `the helm client of the invocation image is v2.17.0, which does not meet the semver constraint "^v3.x", check that the Dockerfile does not replace helm3`)
+	})
+
+	t.Run("constraint of the mixin configuration", func(t *testing.T) {
+		os.Setenv(test.ExpectedCommandOutputEnv, "v4.0.1")
+		m := NewTestMixin(t)
+		m.Setenv(clientVersionEnvVar, "v4.0.0")
+		m.Setenv(clientVersionConstraintEnvVar, ">= v3.0.0, < v5.0.0")
+
+		require.NoError(t, m.verifyClientVersion(ctx))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		os.Setenv(test.ExpectedCommandOutputEnv, "v2.17.0")
+		m := NewTestMixin(t)
+		m.Setenv(verifyClientVersionEnv, "false")
+
+		require.NoError(t, m.verifyClientVersion(ctx))
+	})
+}
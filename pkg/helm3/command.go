@@ -0,0 +1,100 @@
+package helm3
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"get.porter.sh/porter/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// helmBinaryEnv overrides the helm binary run by the mixin, for invocation images where helm isn't installed as helm3
+const helmBinaryEnv = "HELM3_MIXIN_HELM_BINARY"
+
+// defaultHelmBinary is the helm binary installed by the mixin
+const defaultHelmBinary = "helm3"
+
+// helmBinary returns the name or the path of the helm binary run by the mixin.
+func (m *Mixin) helmBinary() string {
+	if binary := m.Getenv(helmBinaryEnv); binary != "" {
+		return binary
+	}
+	return defaultHelmBinary
+}
+
+// runHelm runs the helm client with the specified arguments and additional
+// environment variables, streaming its output to the mixin's output.
+func (m *Mixin) runHelm(ctx context.Context, args []string, env []string) error {
+	return m.execHelm(ctx, args, env, nil, io.Discard, io.Discard)
+}
+
+// runHelmWithOutput runs the helm client like runHelm, also copying its
+// stdout and stderr to output.
+func (m *Mixin) runHelmWithOutput(ctx context.Context, args []string, env []string, output io.Writer) error {
+	return m.execHelm(ctx, args, env, nil, output, output)
+}
+
+// runHelmWithStdout runs the helm client like runHelm, also copying its stdout to stdout,
+// for example to read the result of a command without its warnings.
+func (m *Mixin) runHelmWithStdout(ctx context.Context, args []string, env []string, stdout io.Writer) error {
+	return m.execHelm(ctx, args, env, nil, stdout, io.Discard)
+}
+
+// runHelmWithInput runs the helm client like runHelm, reading its stdin from input,
+// for example to pass a password without printing it with the command.
+func (m *Mixin) runHelmWithInput(ctx context.Context, args []string, env []string, input io.Reader) error {
+	return m.execHelm(ctx, args, env, input, io.Discard, io.Discard)
+}
+
+func (m *Mixin) execHelm(ctx context.Context, args []string, env []string, input io.Reader, stdoutOutput io.Writer, stderrOutput io.Writer) (err error) {
+	ctx, log := tracing.StartSpanWithName(ctx, "helm3 "+args[0], attribute.String("command", args[0]))
+	defer func() {
+		log.SetAttributes(attribute.Int("exitCode", exitCode(err)))
+		if err != nil {
+			log.Error(err)
+		}
+		log.EndSpan()
+	}()
+
+	cmd := m.NewCommand(ctx, m.helmBinary(), args...)
+	cmd.Env = append(cmd.Env, env...)
+	cmd.Stdin = input
+
+	// format the command with all arguments, except the credentials
+	prettyCmd := fmt.Sprintf("%s %s", cmd.Path, strings.Join(maskCredentials(cmd.Args), " "))
+
+	if m.getOutputFormat() == OutputFormatJSON {
+		// Buffer the output of the command so that it is logged as a single line
+		stdout := &bytes.Buffer{}
+		stderr := &bytes.Buffer{}
+		cmd.Stdout = io.MultiWriter(stdout, stdoutOutput)
+		cmd.Stderr = io.MultiWriter(stderr, stderrOutput)
+
+		start := time.Now()
+		err = cmd.Run()
+		m.logCommand(ctx, "helm3 "+strings.Join(maskCredentials(args), " "), time.Since(start), err, stdout.String(), stderr.String())
+		return classifyHelmError(err, stdout.String()+stderr.String())
+	}
+
+	stdout := m.Out
+	if stepFromContext(ctx).SuppressOutput {
+		stdout = io.Discard
+	}
+	// Keep the output to classify the failure of the command
+	output := &bytes.Buffer{}
+	cmd.Stdout = io.MultiWriter(stdout, stdoutOutput, output)
+	cmd.Stderr = io.MultiWriter(m.Err, stderrOutput, output)
+	fmt.Fprintln(m.Out, prettyCmd)
+
+	// Here where really the command get executed
+	err = cmd.Start()
+	// Exit on error
+	if err != nil {
+		return fmt.Errorf("could not execute command, %s: %s", prettyCmd, err)
+	}
+	return classifyHelmError(cmd.Wait(), output.String())
+}
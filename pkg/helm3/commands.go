@@ -0,0 +1,491 @@
+package helm3
+
+import (
+	"bytes"
+	"context"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Commands are the helm commands that a step can run instead of the command of its action,
+// for example to log in to a registry once before installing several charts from it.
+// A step sets at most one command.
+type Commands struct {
+	RegistryLogin  *RegistryLoginArguments  `yaml:"registryLogin,omitempty"`
+	RegistryLogout *RegistryLogoutArguments `yaml:"registryLogout,omitempty"`
+	Package        *PackageArguments        `yaml:"package,omitempty"`
+	Push           *PushArguments           `yaml:"push,omitempty"`
+	Pull           *PullArguments           `yaml:"pull,omitempty"`
+	Show           *ShowArguments           `yaml:"show,omitempty"`
+	Dependency     *DependencyArguments     `yaml:"dependency,omitempty"`
+	Lint           *LintArguments           `yaml:"lint,omitempty"`
+	Export         *ExportArguments         `yaml:"export,omitempty"`
+	List           *ListArguments           `yaml:"list,omitempty"`
+	GC             *GCArguments             `yaml:"gc,omitempty"`
+}
+
+// RegistryLoginArguments are the arguments of the registryLogin command
+type RegistryLoginArguments struct {
+	Host      string `yaml:"host"`
+	Username  string `yaml:"username,omitempty"`
+	Password  string `yaml:"password,omitempty"`
+	Insecure  bool   `yaml:"insecure,omitempty"`
+	PlainHTTP bool   `yaml:"plainHttp,omitempty"`
+}
+
+// RegistryLogoutArguments are the arguments of the registryLogout command
+type RegistryLogoutArguments struct {
+	Host string `yaml:"host"`
+}
+
+// PackageArguments are the arguments of the package command
+type PackageArguments struct {
+	// Chart is the path of the chart directory to package
+	Chart       string `yaml:"chart"`
+	Destination string `yaml:"destination,omitempty"`
+	Version     string `yaml:"version,omitempty"`
+	AppVersion  string `yaml:"appVersion,omitempty"`
+	Sign        bool   `yaml:"sign,omitempty"`
+	Key         string `yaml:"key,omitempty"`
+	Keyring     string `yaml:"keyring,omitempty"`
+}
+
+// PushArguments are the arguments of the push command
+type PushArguments struct {
+	// Chart is the path of the packaged chart to push
+	Chart string `yaml:"chart"`
+
+	// Remote is either an oci:// registry or the name or url of a ChartMuseum repository,
+	// which is pushed to with the cm-push plugin
+	Remote string `yaml:"remote"`
+
+	InsecureSkipTLSVerify bool `yaml:"insecureSkipTlsVerify,omitempty"`
+	PlainHTTP             bool `yaml:"plainHttp,omitempty"`
+}
+
+// PullArguments are the arguments of the pull command
+type PullArguments struct {
+	Chart       string `yaml:"chart"`
+	Version     string `yaml:"version,omitempty"`
+	Repo        string `yaml:"repo,omitempty"`
+	Destination string `yaml:"destination,omitempty"`
+	Untar       bool   `yaml:"untar,omitempty"`
+	Verify      bool   `yaml:"verify,omitempty"`
+	Keyring     string `yaml:"keyring,omitempty"`
+	Prov        bool   `yaml:"prov,omitempty"`
+
+	// Output is the name of an output that is set to the path of the pulled chart
+	Output string `yaml:"output,omitempty"`
+}
+
+// ShowArguments are the arguments of the show command
+type ShowArguments struct {
+	Chart string `yaml:"chart"`
+
+	// Subcommand is the information shown: chart, values, readme or crds. Defaults to chart.
+	Subcommand string `yaml:"subcommand,omitempty"`
+	Version    string `yaml:"version,omitempty"`
+	Repo       string `yaml:"repo,omitempty"`
+
+	// AppVersionConstraint fails the step when the appVersion of the chart doesn't meet the semver constraint
+	AppVersionConstraint string `yaml:"appVersionConstraint,omitempty"`
+
+	// Output is the name of an output that is set to the information shown
+	Output string `yaml:"output,omitempty"`
+}
+
+// DependencyArguments are the arguments of the dependency command
+type DependencyArguments struct {
+	// Chart is the path of the chart directory
+	Chart string `yaml:"chart"`
+
+	// Subcommand is build, update or list. Defaults to build.
+	Subcommand  string `yaml:"subcommand,omitempty"`
+	SkipRefresh bool   `yaml:"skipRefresh,omitempty"`
+
+	// Output is the name of an output that is set to the dependencies of the chart, as listed by helm
+	Output string `yaml:"output,omitempty"`
+}
+
+// LintArguments are the arguments of the lint command
+type LintArguments struct {
+	// Chart is the path of the chart directory or archive
+	Chart  string            `yaml:"chart"`
+	Strict bool              `yaml:"strict,omitempty"`
+	Values []string          `yaml:"values,omitempty"`
+	Set    map[string]string `yaml:"set,omitempty"`
+}
+
+// hasCommand returns true when the step runs one of the commands instead of the command of its action.
+func (c Commands) hasCommand() bool {
+	return c.RegistryLogin != nil || c.RegistryLogout != nil || c.Package != nil || c.Push != nil || c.Pull != nil || c.Show != nil || c.Dependency != nil || c.Lint != nil || c.Export != nil || c.List != nil || c.GC != nil
+}
+
+// runCommand runs the command of the step.
+func (m *Mixin) runCommand(ctx context.Context, c Commands) error {
+	if operations := c.networkOperations(); len(operations) > 0 && m.isOffline(ctx) {
+		return offlineError(operations)
+	}
+
+	switch {
+	case c.RegistryLogin != nil:
+		return m.registryLogin(ctx, *c.RegistryLogin)
+	case c.RegistryLogout != nil:
+		return m.registryLogout(ctx, *c.RegistryLogout)
+	case c.Package != nil:
+		return m.packageChart(ctx, *c.Package)
+	case c.Push != nil:
+		return m.pushChart(ctx, *c.Push)
+	case c.Pull != nil:
+		return m.pullChart(ctx, *c.Pull)
+	case c.Show != nil:
+		return m.showChart(ctx, *c.Show)
+	case c.Dependency != nil:
+		return m.chartDependency(ctx, *c.Dependency)
+	case c.Lint != nil:
+		return m.lintChart(ctx, *c.Lint)
+	case c.Export != nil:
+		return m.exportChart(ctx, *c.Export)
+	case c.List != nil:
+		return m.listReleases(ctx, *c.List)
+	case c.GC != nil:
+		return m.collectGarbage(ctx, *c.GC)
+	default:
+		return errors.New("the step does not set a command")
+	}
+}
+
+// registryLogin logs in to an OCI registry, the login is used by the following steps that use charts from the registry.
+func (m *Mixin) registryLogin(ctx context.Context, a RegistryLoginArguments) error {
+	if a.Host == "" {
+		return errors.New("registryLogin requires a host")
+	}
+
+	args := []string{"registry", "login", a.Host}
+	if a.Username != "" {
+		args = append(args, "--username", a.Username)
+	}
+	if a.Password != "" {
+		// Pass the password on stdin so that it isn't printed with the command
+		args = append(args, "--password-stdin")
+	}
+	if a.Insecure {
+		args = append(args, "--insecure")
+	}
+	if a.PlainHTTP {
+		args = append(args, "--plain-http")
+	}
+
+	err := m.runHelmWithInput(ctx, args, nil, strings.NewReader(a.Password))
+	if err != nil {
+		return errors.Wrapf(err, "could not log in to registry %s", a.Host)
+	}
+	return nil
+}
+
+// registryLogout logs out of an OCI registry.
+func (m *Mixin) registryLogout(ctx context.Context, a RegistryLogoutArguments) error {
+	if a.Host == "" {
+		return errors.New("registryLogout requires a host")
+	}
+
+	err := m.runHelm(ctx, []string{"registry", "logout", a.Host}, nil)
+	if err != nil {
+		return errors.Wrapf(err, "could not log out of registry %s", a.Host)
+	}
+	return nil
+}
+
+// packageChart packages a chart directory into a versioned chart archive.
+func (m *Mixin) packageChart(ctx context.Context, a PackageArguments) error {
+	if a.Chart == "" {
+		return errors.New("package requires a chart")
+	}
+
+	args := []string{"package", a.Chart}
+	if a.Destination != "" {
+		args = append(args, "--destination", a.Destination)
+	}
+	if a.Version != "" {
+		args = append(args, "--version", a.Version)
+	}
+	if a.AppVersion != "" {
+		args = append(args, "--app-version", a.AppVersion)
+	}
+	if a.Sign {
+		args = append(args, "--sign")
+	}
+	if a.Key != "" {
+		args = append(args, "--key", a.Key)
+	}
+	if a.Keyring != "" {
+		args = append(args, "--keyring", a.Keyring)
+	}
+
+	err := m.runHelm(ctx, args, nil)
+	if err != nil {
+		return errors.Wrapf(err, "could not package chart %s", a.Chart)
+	}
+	return nil
+}
+
+// isOCIRemote returns true when the remote of a push is an OCI registry instead of a ChartMuseum repository.
+func isOCIRemote(remote string) bool {
+	return strings.HasPrefix(remote, "oci://")
+}
+
+// pushChart pushes a packaged chart to an OCI registry, or to a ChartMuseum repository with the cm-push plugin.
+func (m *Mixin) pushChart(ctx context.Context, a PushArguments) error {
+	if a.Chart == "" || a.Remote == "" {
+		return errors.New("push requires a chart and a remote")
+	}
+
+	var args []string
+	if isOCIRemote(a.Remote) {
+		args = []string{"push", a.Chart, a.Remote}
+		if a.InsecureSkipTLSVerify {
+			args = append(args, "--insecure-skip-tls-verify")
+		}
+		if a.PlainHTTP {
+			args = append(args, "--plain-http")
+		}
+	} else {
+		args = []string{cmPushPlugin, a.Chart, a.Remote}
+		if a.InsecureSkipTLSVerify {
+			args = append(args, "--insecure")
+		}
+	}
+
+	err := m.runHelm(ctx, args, nil)
+	if err != nil {
+		return errors.Wrapf(err, "could not push chart %s to %s", a.Chart, a.Remote)
+	}
+	return nil
+}
+
+// pullChart downloads a chart, and optionally untars it, so that it can be inspected or modified before it is installed.
+func (m *Mixin) pullChart(ctx context.Context, a PullArguments) error {
+	if a.Chart == "" {
+		return errors.New("pull requires a chart")
+	}
+
+	args := []string{"pull", a.Chart}
+	if a.Version != "" {
+		args = append(args, "--version", a.Version)
+	}
+	if a.Repo != "" {
+		args = append(args, "--repo", a.Repo)
+	}
+	if a.Destination != "" {
+		args = append(args, "--destination", a.Destination)
+	}
+	if a.Untar {
+		args = append(args, "--untar")
+	}
+	if a.Verify {
+		args = append(args, "--verify")
+	}
+	if a.Keyring != "" {
+		args = append(args, "--keyring", a.Keyring)
+	}
+	if a.Prov {
+		args = append(args, "--prov")
+	}
+
+	err := m.runHelm(ctx, args, nil)
+	if err != nil {
+		return errors.Wrapf(err, "could not pull chart %s", a.Chart)
+	}
+
+	if a.Output == "" {
+		return nil
+	}
+	chartPath, err := m.pulledChartPath(a)
+	if err != nil {
+		return err
+	}
+	err = m.WriteMixinOutputToFile(a.Output, []byte(chartPath))
+	if err != nil {
+		return errors.Wrapf(err, "unable to write output '%s'", a.Output)
+	}
+	return nil
+}
+
+// pulledChartPath returns the path where helm pulled the chart: the chart directory when it was untarred,
+// otherwise the chart archive, which is named after the version that was resolved when none was requested.
+func (m *Mixin) pulledChartPath(a PullArguments) (string, error) {
+	dest := a.Destination
+	if dest == "" {
+		dest = "."
+	}
+	name := path.Base(a.Chart)
+	if a.Untar {
+		return filepath.Join(dest, name), nil
+	}
+	if a.Version != "" {
+		return filepath.Join(dest, name+"-"+a.Version+".tgz"), nil
+	}
+
+	entries, err := m.FileSystem.ReadDir(dest)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not list the pulled charts in %s", dest)
+	}
+	var archive string
+	var modTime int64
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), name+"-") || !strings.HasSuffix(entry.Name(), ".tgz") {
+			continue
+		}
+		if archive == "" || entry.ModTime().UnixNano() > modTime {
+			archive = entry.Name()
+			modTime = entry.ModTime().UnixNano()
+		}
+	}
+	if archive == "" {
+		return "", errors.Errorf("could not find the pulled chart %s in %s", name, dest)
+	}
+	return filepath.Join(dest, archive), nil
+}
+
+// showChart shows information about a chart, and checks its appVersion when a constraint is set.
+func (m *Mixin) showChart(ctx context.Context, a ShowArguments) error {
+	if a.Chart == "" {
+		return errors.New("show requires a chart")
+	}
+	subcommand := a.Subcommand
+	if subcommand == "" {
+		subcommand = "chart"
+	}
+	switch subcommand {
+	case "chart", "values", "readme", "crds":
+	default:
+		return errors.Errorf("invalid show subcommand %q, allowed values are chart, values, readme and crds", subcommand)
+	}
+	if a.AppVersionConstraint != "" && subcommand != "chart" {
+		return errors.New("appVersionConstraint can only be checked with the chart subcommand")
+	}
+
+	args := []string{"show", subcommand, a.Chart}
+	if a.Version != "" {
+		args = append(args, "--version", a.Version)
+	}
+	if a.Repo != "" {
+		args = append(args, "--repo", a.Repo)
+	}
+
+	stdout := &bytes.Buffer{}
+	err := m.runHelmWithStdout(ctx, args, nil, stdout)
+	if err != nil {
+		return errors.Wrapf(err, "could not show the %s of chart %s", subcommand, a.Chart)
+	}
+
+	if a.AppVersionConstraint != "" {
+		err = checkAppVersion(a.Chart, stdout.Bytes(), a.AppVersionConstraint)
+		if err != nil {
+			return err
+		}
+	}
+
+	if a.Output != "" {
+		err = m.WriteMixinOutputToFile(a.Output, stdout.Bytes())
+		if err != nil {
+			return errors.Wrapf(err, "unable to write output '%s'", a.Output)
+		}
+	}
+	return nil
+}
+
+// checkAppVersion validates that the appVersion in the Chart.yaml of a chart meets the semver constraint.
+func checkAppVersion(chart string, chartYaml []byte, constraint string) error {
+	var metadata struct {
+		AppVersion string `yaml:"appVersion"`
+	}
+	err := yaml.Unmarshal(chartYaml, &metadata)
+	if err != nil {
+		return errors.Wrapf(err, "could not parse the Chart.yaml of chart %s", chart)
+	}
+
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return errors.Wrapf(err, "unable to parse version constraint %q", constraint)
+	}
+	v, err := semver.NewVersion(metadata.AppVersion)
+	if err != nil {
+		return errors.Wrapf(err, "appVersion %q of chart %s cannot be parsed as semver", metadata.AppVersion, chart)
+	}
+	if !c.Check(v) {
+		return errors.Errorf("appVersion %q of chart %s does not meet constraint %q", metadata.AppVersion, chart, constraint)
+	}
+	return nil
+}
+
+// chartDependency builds, updates or lists the dependencies of a chart directory.
+// When an output is set, the dependencies are listed after they are resolved.
+func (m *Mixin) chartDependency(ctx context.Context, a DependencyArguments) error {
+	if a.Chart == "" {
+		return errors.New("dependency requires a chart")
+	}
+	subcommand := a.Subcommand
+	if subcommand == "" {
+		subcommand = "build"
+	}
+
+	switch subcommand {
+	case "build", "update":
+		args := []string{"dependency", subcommand, a.Chart}
+		if a.SkipRefresh {
+			args = append(args, "--skip-refresh")
+		}
+		err := m.runHelm(ctx, args, nil)
+		if err != nil {
+			return errors.Wrapf(err, "could not %s the dependencies of chart %s", subcommand, a.Chart)
+		}
+		if a.Output == "" {
+			return nil
+		}
+	case "list":
+	default:
+		return errors.Errorf("invalid dependency subcommand %q, allowed values are build, update and list", subcommand)
+	}
+
+	stdout := &bytes.Buffer{}
+	err := m.runHelmWithStdout(ctx, []string{"dependency", "list", a.Chart}, nil, stdout)
+	if err != nil {
+		return errors.Wrapf(err, "could not list the dependencies of chart %s", a.Chart)
+	}
+
+	if a.Output != "" {
+		err = m.WriteMixinOutputToFile(a.Output, stdout.Bytes())
+		if err != nil {
+			return errors.Wrapf(err, "unable to write output '%s'", a.Output)
+		}
+	}
+	return nil
+}
+
+// lintChart checks that a chart is well-formed with the values that it is installed with.
+func (m *Mixin) lintChart(ctx context.Context, a LintArguments) error {
+	if a.Chart == "" {
+		return errors.New("lint requires a chart")
+	}
+
+	args := []string{"lint", a.Chart}
+	if a.Strict {
+		args = append(args, "--strict")
+	}
+	for _, v := range a.Values {
+		args = append(args, "--values", v)
+	}
+	args = appendSetFlags(args, a.Set)
+
+	err := m.runHelm(ctx, args, nil)
+	if err != nil {
+		return errors.Wrapf(err, "chart %s failed linting", a.Chart)
+	}
+	return nil
+}
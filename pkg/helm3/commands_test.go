@@ -0,0 +1,392 @@
+package helm3
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"get.porter.sh/porter/pkg/portercontext"
+	"get.porter.sh/porter/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestMixin_UnmarshalRegistryLoginStep(t *testing.T) {
+	b, err := ioutil.ReadFile("testdata/install-input-registry-login.yaml")
+	require.NoError(t, err)
+
+	var action InstallAction
+	err = yaml.Unmarshal(b, &action)
+	require.NoError(t, err)
+	require.Len(t, action.Steps, 1)
+	step := action.Steps[0]
+
+	assert.True(t, step.hasCommand())
+	want := &RegistryLoginArguments{
+		Host:      "localhost:5000",
+		Username:  "myuser",
+		Password:  "mypass",
+		Insecure:  true,
+		PlainHTTP: true,
+	}
+	assert.Equal(t, want, step.RegistryLogin)
+}
+
+func TestMixin_InstallRegistryLogin(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 registry login localhost:5000 --username myuser --password-stdin --insecure --plain-http")
+
+	b, err := ioutil.ReadFile("testdata/install-input-registry-login.yaml")
+	require.NoError(t, err)
+
+	h := NewTestMixin(t)
+	h.In = bytes.NewReader(b)
+
+	err = h.Install(ctx)
+	require.NoError(t, err)
+	assert.NotContains(t, h.TestContext.GetOutput(), "mypass", "the password should not be printed")
+}
+
+func TestMixin_UninstallRegistryLogout(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 registry logout localhost:5000")
+
+	step := UninstallStep{
+		UninstallArguments: UninstallArguments{
+			Step: Step{
+				Description: "Log out of the chart registry",
+				Commands: Commands{
+					RegistryLogout: &RegistryLogoutArguments{Host: "localhost:5000"},
+				},
+			},
+		},
+	}
+	action := UninstallAction{Steps: []UninstallStep{step}}
+	b, err := yaml.Marshal(action)
+	require.NoError(t, err)
+
+	h := NewTestMixin(t)
+	h.In = bytes.NewReader(b)
+
+	err = h.Uninstall(ctx)
+	require.NoError(t, err)
+}
+
+func TestMixin_RegistryLoginRequiresHost(t *testing.T) {
+	h := NewTestMixin(t)
+
+	err := h.runCommand(context.Background(), Commands{RegistryLogin: &RegistryLoginArguments{Username: "myuser"}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "registryLogin requires a host")
+}
+
+func TestMixin_Package(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 package ./charts/mychart --destination /tmp --version 1.2.3 --app-version v1.2.3 --sign --key mykey --keyring /root/.gnupg/secring.gpg")
+
+	h := NewTestMixin(t)
+	err := h.runCommand(ctx, Commands{Package: &PackageArguments{
+		Chart:       "./charts/mychart",
+		Destination: "/tmp",
+		Version:     "1.2.3",
+		AppVersion:  "v1.2.3",
+		Sign:        true,
+		Key:         "mykey",
+		Keyring:     "/root/.gnupg/secring.gpg",
+	}})
+	require.NoError(t, err)
+}
+
+func TestMixin_Push(t *testing.T) {
+	testcases := []struct {
+		name    string
+		push    PushArguments
+		wantCmd string
+	}{
+		{"oci", PushArguments{Chart: "mychart-1.2.3.tgz", Remote: "oci://localhost:5000/charts", PlainHTTP: true},
+			"helm3 push mychart-1.2.3.tgz oci://localhost:5000/charts --plain-http"},
+		{"chartmuseum", PushArguments{Chart: "mychart-1.2.3.tgz", Remote: "chartmuseum", InsecureSkipTLSVerify: true},
+			"helm3 cm-push mychart-1.2.3.tgz chartmuseum --insecure"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			defer os.Unsetenv(test.ExpectedCommandEnv)
+			os.Setenv(test.ExpectedCommandEnv, tc.wantCmd)
+
+			h := NewTestMixin(t)
+			err := h.runCommand(ctx, Commands{Push: &tc.push})
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestMixin_Pull(t *testing.T) {
+	testcases := []struct {
+		name     string
+		pull     PullArguments
+		archive  string
+		wantCmd  string
+		wantPath string
+	}{
+		{"untar", PullArguments{Chart: "stable/mysql", Version: "1.6.9", Destination: "charts", Untar: true, Output: "chart-path"}, "",
+			"helm3 pull stable/mysql --version 1.6.9 --destination charts --untar", "charts/mysql"},
+		{"version", PullArguments{Chart: "oci://localhost:5000/charts/mysql", Version: "1.6.9", Verify: true, Keyring: "keyring.gpg", Output: "chart-path"}, "",
+			"helm3 pull oci://localhost:5000/charts/mysql --version 1.6.9 --verify --keyring keyring.gpg", "mysql-1.6.9.tgz"},
+		{"latest", PullArguments{Chart: "mysql", Repo: "https://charts.example.com", Destination: "charts", Prov: true, Output: "chart-path"}, "charts/mysql-1.6.9.tgz",
+			"helm3 pull mysql --repo https://charts.example.com --destination charts --prov", "charts/mysql-1.6.9.tgz"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			defer os.Unsetenv(test.ExpectedCommandEnv)
+			os.Setenv(test.ExpectedCommandEnv, tc.wantCmd)
+
+			h := NewTestMixin(t)
+			if tc.archive != "" {
+				h.FileSystem.WriteFile(tc.archive, []byte{}, 0644)
+			}
+
+			err := h.runCommand(ctx, Commands{Pull: &tc.pull})
+			require.NoError(t, err)
+
+			chartPath, err := h.FileSystem.ReadFile(path.Join(portercontext.MixinOutputsDir, "chart-path"))
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantPath, string(chartPath))
+		})
+	}
+}
+
+func TestMixin_Show(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	defer os.Unsetenv(test.ExpectedCommandOutputEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 show values stable/mysql --version 1.6.9")
+	os.Setenv(test.ExpectedCommandOutputEnv, "mysqlUser: admin\n")
+
+	h := NewTestMixin(t)
+	err := h.runCommand(ctx, Commands{Show: &ShowArguments{
+		Chart:      "stable/mysql",
+		Subcommand: "values",
+		Version:    "1.6.9",
+		Output:     "default-values",
+	}})
+	require.NoError(t, err)
+
+	values, err := h.FileSystem.ReadFile(path.Join(portercontext.MixinOutputsDir, "default-values"))
+	require.NoError(t, err)
+	assert.Equal(t, "mysqlUser: admin\n", string(values))
+}
+
+func TestMixin_ShowAppVersionConstraint(t *testing.T) {
+	testcases := []struct {
+		name       string
+		constraint string
+		wantError  string
+	}{
+		{"met", ">= 8.0", ""},
+		{"not met", "< 8.0", `appVersion "8.0.32" of chart stable/mysql does not meet constraint "< 8.0"`},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			defer os.Unsetenv(test.ExpectedCommandEnv)
+			defer os.Unsetenv(test.ExpectedCommandOutputEnv)
+			os.Setenv(test.ExpectedCommandEnv, "helm3 show chart stable/mysql")
+			os.Setenv(test.ExpectedCommandOutputEnv, "apiVersion: v2\nname: mysql\nversion: 1.6.9\nappVersion: 8.0.32\n")
+
+			h := NewTestMixin(t)
+			err := h.runCommand(ctx, Commands{Show: &ShowArguments{
+				Chart:                "stable/mysql",
+				AppVersionConstraint: tc.constraint,
+			}})
+			if tc.wantError == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tc.wantError)
+			}
+		})
+	}
+}
+
+func TestMixin_ShowInvalidSubcommand(t *testing.T) {
+	h := NewTestMixin(t)
+
+	err := h.runCommand(context.Background(), Commands{Show: &ShowArguments{Chart: "stable/mysql", Subcommand: "all", AppVersionConstraint: ">= 8.0"}})
+	require.EqualError(t, err, `invalid show subcommand "all", allowed values are chart, values, readme and crds`)
+}
+
+func TestMixin_Dependency(t *testing.T) {
+	testcases := []struct {
+		name       string
+		dependency DependencyArguments
+		wantCmd    string
+		wantOutput bool
+	}{
+		{"build", DependencyArguments{Chart: "./charts/umbrella"},
+			"helm3 dependency build ./charts/umbrella", false},
+		{"update with output", DependencyArguments{Chart: "./charts/umbrella", Subcommand: "update", SkipRefresh: true, Output: "dependencies"},
+			"helm3 dependency update ./charts/umbrella --skip-refresh\nhelm3 dependency list ./charts/umbrella", true},
+		{"list", DependencyArguments{Chart: "./charts/umbrella", Subcommand: "list", Output: "dependencies"},
+			"helm3 dependency list ./charts/umbrella", true},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			defer os.Unsetenv(test.ExpectedCommandEnv)
+			os.Setenv(test.ExpectedCommandEnv, tc.wantCmd)
+
+			h := NewTestMixin(t)
+			err := h.runCommand(ctx, Commands{Dependency: &tc.dependency})
+			require.NoError(t, err)
+
+			exists, _ := h.FileSystem.Exists(path.Join(portercontext.MixinOutputsDir, "dependencies"))
+			assert.Equal(t, tc.wantOutput, exists)
+		})
+	}
+}
+
+func TestMixin_Lint(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 lint ./charts/mychart --strict --values values/prod.yaml --set replicas=3")
+
+	h := NewTestMixin(t)
+	err := h.runCommand(ctx, Commands{Lint: &LintArguments{
+		Chart:  "./charts/mychart",
+		Strict: true,
+		Values: []string{"values/prod.yaml"},
+		Set:    map[string]string{"replicas": "3"},
+	}})
+	require.NoError(t, err)
+}
+
+func TestMixin_Export(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 template mysql stable/mysql --version 1.6.9 --namespace mysql --include-crds --values values.yaml --set replicas=2")
+	defer os.Unsetenv(test.ExpectedCommandOutputEnv)
+	os.Setenv(test.ExpectedCommandOutputEnv, `---
+# Source: mysql/templates/secret.yaml
+apiVersion: v1
+kind: Secret
+metadata:
+  name: mysql
+data:
+  password: cGFzc3dvcmQ=
+---
+# Source: mysql/templates/empty.yaml
+---
+# Source: mysql/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: mysql
+`)
+
+	h := NewTestMixin(t)
+	err := h.runCommand(ctx, Commands{Export: &ExportArguments{
+		Chart:         "stable/mysql",
+		Version:       "1.6.9",
+		Name:          "mysql",
+		Namespace:     "mysql",
+		Values:        []string{"values.yaml"},
+		Set:           map[string]string{"replicas": "2"},
+		Destination:   "gitops/mysql",
+		Kustomization: true,
+		Output:        "manifests",
+	}})
+	require.NoError(t, err)
+	assert.NotContains(t, h.TestContext.GetOutput(), "cGFzc3dvcmQ=", "the rendered manifests should not be printed")
+
+	secret, err := h.FileSystem.ReadFile("gitops/mysql/secret-mysql.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "# Source: mysql/templates/secret.yaml\napiVersion: v1\nkind: Secret\nmetadata:\n  name: mysql\ndata:\n  password: cGFzc3dvcmQ=\n", string(secret))
+	exists, err := h.FileSystem.Exists("gitops/mysql/service-mysql.yaml")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	kustomization, err := h.FileSystem.ReadFile("gitops/mysql/kustomization.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "apiVersion: kustomize.config.k8s.io/v1beta1\nkind: Kustomization\nresources:\n- secret-mysql.yaml\n- service-mysql.yaml\n", string(kustomization))
+
+	output, err := h.FileSystem.ReadFile(path.Join(portercontext.MixinOutputsDir, "manifests"))
+	require.NoError(t, err)
+	assert.Equal(t, "gitops/mysql", string(output))
+}
+
+func TestMixin_ExportKubeVersion(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 template stable/mysql --include-crds --kube-version v1.29.0 --api-versions monitoring.coreos.com/v1")
+	defer os.Unsetenv(test.ExpectedCommandOutputEnv)
+	os.Setenv(test.ExpectedCommandOutputEnv, "apiVersion: v1\nkind: Service\nmetadata:\n  name: mysql\n")
+
+	h := NewTestMixin(t)
+	err := h.runCommand(ctx, Commands{Export: &ExportArguments{
+		Chart:       "stable/mysql",
+		KubeVersion: "v1.29.0",
+		APIVersions: []string{"monitoring.coreos.com/v1"},
+		Destination: "gitops/mysql",
+	}})
+	require.NoError(t, err)
+	exists, err := h.FileSystem.Exists("gitops/mysql/service-mysql.yaml")
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestSplitManifests_DuplicateNames(t *testing.T) {
+	manifests, err := splitManifests([]byte("kind: ConfigMap\nmetadata:\n  name: app\n  namespace: a\n---\nkind: ConfigMap\nmetadata:\n  name: app\n  namespace: b\n---\nkind: ConfigMap\nmetadata:\n  name: app\n  namespace: b\n"))
+	require.NoError(t, err)
+
+	var files []string
+	for _, manifest := range manifests {
+		files = append(files, manifest.file)
+	}
+	assert.Equal(t, []string{"configmap-app.yaml", "b-configmap-app.yaml", "b-configmap-app-2.yaml"}, files)
+}
+
+func TestMixin_List(t *testing.T) {
+	testcases := []struct {
+		name    string
+		list    ListArguments
+		wantCmd string
+	}{
+		{"current installation", ListArguments{Namespace: "myapp", Output: "releases"},
+			"helm3 list --all --output json --selector porter.sh/installation=myapp,porter.sh/installation-namespace=dev --namespace myapp"},
+		{"other installation", ListArguments{Installation: "other", AllNamespaces: true, Output: "releases"},
+			"helm3 list --all --output json --selector porter.sh/installation=other --all-namespaces"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			defer os.Unsetenv(test.ExpectedCommandEnv)
+			os.Setenv(test.ExpectedCommandEnv, tc.wantCmd)
+			defer os.Unsetenv(test.ExpectedCommandOutputEnv)
+			os.Setenv(test.ExpectedCommandOutputEnv, `[{"name":"myapp","namespace":"myapp"}]`)
+
+			h := NewTestMixin(t)
+			h.Setenv(installationNameEnv, "myapp")
+			h.Setenv(installationNamespaceEnv, "dev")
+
+			err := h.runCommand(ctx, Commands{List: &tc.list})
+			require.NoError(t, err)
+
+			releases, err := h.FileSystem.ReadFile(path.Join(portercontext.MixinOutputsDir, "releases"))
+			require.NoError(t, err)
+			assert.Equal(t, `[{"name":"myapp","namespace":"myapp"}]`, string(releases))
+		})
+	}
+}
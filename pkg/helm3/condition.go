@@ -0,0 +1,35 @@
+package helm3
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// skipCondition returns true when the step must be skipped because its condition is false. Porter renders the
+// condition from the parameters of the bundle before the mixin runs, so it is a boolean, negated with a leading !.
+// A step without a condition is always run.
+func (m *Mixin) skipCondition(step Step) (bool, error) {
+	condition := strings.TrimSpace(step.Condition)
+	if condition == "" {
+		return false, nil
+	}
+
+	expr := condition
+	negate := strings.HasPrefix(expr, "!")
+	if negate {
+		expr = strings.TrimSpace(strings.TrimPrefix(expr, "!"))
+	}
+	value, err := strconv.ParseBool(expr)
+	if err != nil {
+		return false, errors.Errorf("invalid condition %q, it must be a boolean like true or false, optionally negated with !", condition)
+	}
+	if value != negate {
+		return false, nil
+	}
+
+	fmt.Fprintf(m.Out, "Skipping the step because its condition %q is false\n", condition)
+	return true, nil
+}
@@ -0,0 +1,58 @@
+package helm3
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ConfigShow prints the mixin configuration of the bundle, with the defaults of the mixin filled in
+// for the settings that porter.yaml leaves out.
+func (m *Mixin) ConfigShow(ctx context.Context) error {
+	input, err := m.loadBuildInput(ctx)
+	if err != nil {
+		return err
+	}
+
+	config := input.Config
+	if config.ClientVersion == "" {
+		config.ClientVersion = m.HelmClientVersion
+	}
+	if config.ClientVersionConstraint == "" {
+		config.ClientVersionConstraint = clientVersionConstraint
+	}
+	if config.ClientPlatform == "" {
+		config.ClientPlatform = m.HelmClientPlatform
+	}
+	if config.ClientArchitecture == "" {
+		config.ClientArchitecture = m.HelmClientArchitecture
+	}
+	if config.APIVersion == "" {
+		config.APIVersion = m.APIVersion
+	}
+
+	b, err := yaml.Marshal(struct {
+		Config MixinConfig `yaml:"config"`
+	}{config})
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(m.Out, string(b))
+	return nil
+}
+
+// ConfigValidate checks the mixin configuration and the steps of the bundle the same way as build,
+// without printing the Dockerfile lines.
+func (m *Mixin) ConfigValidate(ctx context.Context) error {
+	out := m.Out
+	m.Out = ioutil.Discard
+	err := m.buildDockerfile(ctx)
+	m.Out = out
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(m.Out, "The mixin configuration is valid")
+	return nil
+}
@@ -0,0 +1,46 @@
+package helm3
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMixin_ConfigShow(t *testing.T) {
+	m := NewTestMixin(t)
+	m.In = bytes.NewReader([]byte("config:\n  clientVersion: v3.14.4\n  defaultNamespace: myapp\n"))
+
+	err := m.ConfigShow(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, `config:
+  clientVersion: v3.14.4
+  clientVersionConstraint: ^v3.x
+  clientPlatform: linux
+  clientArchitecture: amd64
+  apiVersion: v1.22.1
+  defaultNamespace: myapp
+`, m.TestContext.GetOutput())
+}
+
+func TestMixin_ConfigValidate(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		m := NewTestMixin(t)
+		m.In = bytes.NewReader([]byte("config:\n  clientVersion: v3.14.4\n"))
+
+		err := m.ConfigValidate(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "The mixin configuration is valid\n", m.TestContext.GetOutput())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		m := NewTestMixin(t)
+		m.In = bytes.NewReader([]byte("config:\n  clientVersion: v2.17.0\n"))
+
+		err := m.ConfigValidate(context.Background())
+		require.EqualError(t, err, `supplied clientVersion "v2.17.0" does not meet semver constraint "^v3.x"`)
+		assert.Empty(t, m.TestContext.GetOutput())
+	})
+}
@@ -0,0 +1,78 @@
+package helm3
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// allowCRDRemovalEnv hands the allowCRDRemoval of the mixin configuration over to the invocation image
+const allowCRDRemovalEnv = "HELM3_MIXIN_ALLOW_CRD_REMOVAL"
+
+// checkCRDRemoval checks that the bundle confirmed the removal of the CRDs in the mixin configuration, because
+// deleting a CRD deletes all its custom resources in the whole cluster, also the ones of other releases.
+func (m *Mixin) checkCRDRemoval() error {
+	if allow := m.getBoolEnv(allowCRDRemovalEnv); allow == nil || !*allow {
+		return errors.New("removeCRDs deletes the CRDs, and all their custom resources, from the whole cluster, set allowCRDRemoval in the mixin configuration to confirm it")
+	}
+	return nil
+}
+
+// releaseCRDs returns the names of the CRDs shipped in the crds directory of the chart of the release,
+// or nothing when the release does not exist.
+func (m *Mixin) releaseCRDs(ctx context.Context, a helmArgs, env []string) ([]string, error) {
+	release, err := m.getReleaseStatus(ctx, a, env)
+	if err != nil || release == nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, file := range release.Chart.Files {
+		if !strings.HasPrefix(file.Name, "crds/") {
+			continue
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(file.Data))
+		for {
+			var crd hookResource
+			err := decoder.Decode(&crd)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, errors.Wrapf(err, "could not parse %s of the chart of release %s", file.Name, a.Release)
+			}
+			if crd.Kind == "CustomResourceDefinition" && crd.Metadata.Name != "" {
+				names = append(names, crd.Metadata.Name)
+			}
+		}
+	}
+	return names, nil
+}
+
+// removeCRDs deletes the CRDs with kubectl, which also deletes their custom resources, from the cluster that the
+// kube arguments of the step select, like helm.
+func (m *Mixin) removeCRDs(ctx context.Context, kube KubeArguments, release string, crds []string) error {
+	if len(crds) == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(m.Err, "Removing the CRDs of release %s\n", release)
+	args := append([]string{"delete", "customresourcedefinitions"}, crds...)
+	args = append(args, "--ignore-not-found")
+	args = append(args, kube.kubectlFlags()...)
+	cmd := m.NewCommand(ctx, "kubectl", args...)
+	cmd.Stdout = m.Err
+	cmd.Stderr = m.Err
+
+	prettyCmd := fmt.Sprintf("kubectl %s", strings.Join(maskCredentials(args), " "))
+	fmt.Fprintln(m.Err, prettyCmd)
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "couldn't run command %s", prettyCmd)
+	}
+	return nil
+}
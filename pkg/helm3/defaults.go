@@ -0,0 +1,120 @@
+package helm3
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Environment variables used to hand the runtime defaults from the mixin
+// configuration over to the invocation image. They are set by Build.
+const (
+	defaultNamespaceEnv       = "HELM3_MIXIN_DEFAULT_NAMESPACE"
+	defaultTimeoutEnv         = "HELM3_MIXIN_DEFAULT_TIMEOUT"
+	defaultAtomicEnv          = "HELM3_MIXIN_ATOMIC"
+	defaultWaitEnv            = "HELM3_MIXIN_WAIT"
+	defaultCreateNamespaceEnv = "HELM3_MIXIN_CREATE_NAMESPACE"
+	defaultDebugEnv           = "HELM3_MIXIN_DEBUG"
+	defaultBurstLimitEnv      = "HELM3_MIXIN_BURST_LIMIT"
+	defaultQPSEnv             = "HELM3_MIXIN_QPS"
+	updateReposEnv            = "HELM3_MIXIN_UPDATE_REPOS"
+)
+
+// defaultsEnv returns the ENV lines that embed the runtime defaults in the invocation image.
+func (c MixinConfig) defaultsEnv() []string {
+	var lines []string
+	if c.DefaultNamespace != "" {
+		lines = append(lines, fmt.Sprintf("ENV %s=%s", defaultNamespaceEnv, c.DefaultNamespace))
+	}
+	if c.DefaultTimeout != "" {
+		lines = append(lines, fmt.Sprintf("ENV %s=%s", defaultTimeoutEnv, c.DefaultTimeout))
+	}
+	if c.Atomic != nil {
+		lines = append(lines, fmt.Sprintf("ENV %s=%t", defaultAtomicEnv, *c.Atomic))
+	}
+	if c.Wait != nil {
+		lines = append(lines, fmt.Sprintf("ENV %s=%t", defaultWaitEnv, *c.Wait))
+	}
+	if c.CreateNamespace != nil {
+		lines = append(lines, fmt.Sprintf("ENV %s=%t", defaultCreateNamespaceEnv, *c.CreateNamespace))
+	}
+	if c.Debug != nil {
+		lines = append(lines, fmt.Sprintf("ENV %s=%t", defaultDebugEnv, *c.Debug))
+	}
+	if c.BurstLimit > 0 {
+		lines = append(lines, fmt.Sprintf("ENV %s=%d", defaultBurstLimitEnv, c.BurstLimit))
+	}
+	if c.QPS > 0 {
+		lines = append(lines, fmt.Sprintf("ENV %s=%g", defaultQPSEnv, c.QPS))
+	}
+	if c.UpdateReposAtRuntime {
+		lines = append(lines, fmt.Sprintf("ENV %s=%t", updateReposEnv, c.UpdateReposAtRuntime))
+	}
+	if c.HeartbeatInterval != "" {
+		lines = append(lines, fmt.Sprintf("ENV %s=%s", heartbeatIntervalEnv, c.HeartbeatInterval))
+	}
+	if c.AllowCRDRemoval {
+		lines = append(lines, fmt.Sprintf("ENV %s=%t", allowCRDRemovalEnv, c.AllowCRDRemoval))
+	}
+	if c.OwnershipLabels {
+		lines = append(lines, fmt.Sprintf("ENV %s=%t", ownershipLabelsEnv, c.OwnershipLabels))
+	}
+	if c.Offline {
+		lines = append(lines, fmt.Sprintf("ENV %s=%t", offlineEnv, c.Offline))
+	}
+	if c.TimingsOutput != "" {
+		lines = append(lines, fmt.Sprintf("ENV %s=%s", timingsOutputEnv, c.TimingsOutput))
+	}
+	if c.VerifyClientVersion != nil {
+		lines = append(lines, fmt.Sprintf("ENV %s=%t", verifyClientVersionEnv, *c.VerifyClientVersion))
+	}
+	return lines
+}
+
+// applyDefaults fills in the values that the step did not set with the
+// runtime defaults from the mixin configuration.
+func (m *Mixin) applyDefaults(a helmArgs) helmArgs {
+	if a.Namespace == "" {
+		a.Namespace = m.Getenv(defaultNamespaceEnv)
+	}
+	if a.Timeout == "" {
+		a.Timeout = m.Getenv(defaultTimeoutEnv)
+	}
+	if a.Atomic == nil {
+		a.Atomic = m.getBoolEnv(defaultAtomicEnv)
+	}
+	if a.CreateNamespace == nil {
+		a.CreateNamespace = m.getBoolEnv(defaultCreateNamespaceEnv)
+	}
+	if a.Wait == nil {
+		a.Wait = m.getBoolEnv(defaultWaitEnv)
+	}
+	if a.Debug == nil {
+		a.Debug = m.getBoolEnv(defaultDebugEnv)
+	}
+	if m.DebugMode {
+		// porter --debug also shows the verbose output of helm
+		debug := true
+		a.Debug = &debug
+	}
+	if a.ClientMajorVersion == 0 {
+		a.ClientMajorVersion = clientMajorVersion(m.Getenv(clientVersionEnvVar))
+	}
+	if a.BurstLimit == 0 {
+		a.BurstLimit, _ = strconv.Atoi(m.Getenv(defaultBurstLimitEnv))
+	}
+	if a.QPS == 0 {
+		qps, _ := strconv.ParseFloat(m.Getenv(defaultQPSEnv), 32)
+		a.QPS = float32(qps)
+	}
+	return a
+}
+
+// getBoolEnv returns the boolean value of the environment variable, or nil
+// when it is not set or cannot be parsed.
+func (m *Mixin) getBoolEnv(key string) *bool {
+	value, err := strconv.ParseBool(m.Getenv(key))
+	if err != nil {
+		return nil
+	}
+	return &value
+}
@@ -0,0 +1,344 @@
+package helm3
+
+import (
+	"context"
+
+	"get.porter.sh/porter/pkg/tracing"
+	"github.com/pkg/errors"
+)
+
+// ChartArguments are the arguments of the install and upgrade steps, that deploy a chart as a release
+type ChartArguments struct {
+	Namespace                string            `yaml:"namespace"`
+	Name                     string            `yaml:"name"`
+	Chart                    string            `yaml:"chart"`
+	Version                  string            `yaml:"version"`
+	Devel                    bool              `yaml:"devel"`
+	Verify                   bool              `yaml:"verify,omitempty"`
+	DependencyUpdate         bool              `yaml:"dependencyUpdate,omitempty"`
+	EnableDNS                bool              `yaml:"enableDNS,omitempty"`
+	SkipSchemaValidation     bool              `yaml:"skipSchemaValidation,omitempty"`
+	DisableOpenAPIValidation bool              `yaml:"disableOpenAPIValidation,omitempty"`
+	RenderSubchartNotes      bool              `yaml:"renderSubchartNotes,omitempty"`
+	HideNotes                bool              `yaml:"hideNotes,omitempty"`
+	TakeOwnership            bool              `yaml:"takeOwnership,omitempty"`
+	NoHooks                  bool              `yaml:"noHooks"`
+	Repo                     string            `yaml:"repo"`
+	Set                      map[string]string `yaml:"set"`
+	SkipCrds                 bool              `yaml:"skipCrds"`
+	Password                 string            `yaml:"password"`
+	Username                 string            `yaml:"username"`
+	PassCredentials          bool              `yaml:"passCredentials,omitempty"`
+	Values                   []string          `yaml:"values"`
+	Wait                     *bool             `yaml:"wait,omitempty"`
+	Timeout                  string            `yaml:"timeout"`
+	Debug                    *bool             `yaml:"debug,omitempty"`
+	Atomic                   *bool             `yaml:"atomic,omitempty"`
+	CreateNamespace          *bool             `yaml:"createNamespace,omitempty"`
+
+	StorageDriver       string `yaml:"storageDriver,omitempty"`
+	SQLConnectionString string `yaml:"sqlConnectionString,omitempty"`
+
+	// ReleaseNamespace is the namespace where helm stores the release, instead of the namespace of the step
+	ReleaseNamespace string `yaml:"releaseNamespace,omitempty"`
+
+	// Env holds environment variables that are only set on the helm command
+	Env map[string]string `yaml:"env,omitempty"`
+
+	KubeArguments `yaml:",inline"`
+
+	// BurstLimit is passed to helm, QPS and BurstLimit also tune the client used to collect outputs
+	BurstLimit int     `yaml:"burstLimit,omitempty"`
+	QPS        float32 `yaml:"qps,omitempty"`
+
+	// RelocateImages sets chart values to the relocated images when the bundle was copied to another registry
+	RelocateImages []ImageRelocation `yaml:"relocateImages,omitempty"`
+
+	// ImageMap sets chart values to the images declared in the bundle, keyed by the image name
+	ImageMap map[string]ImageValues `yaml:"imageMap,omitempty"`
+
+	// ValuesFrom are values files applied after Values, resolved from file parameters or paths
+	ValuesFrom []ValuesSource `yaml:"valuesFrom,omitempty"`
+
+	// ValuesLayers are applied after Values and ValuesFrom, in the order that they are declared
+	ValuesLayers []ValuesLayer `yaml:"valuesLayers,omitempty"`
+
+	// TemplateValues renders the values files as Go templates, with the environment variables available as .Env
+	TemplateValues bool `yaml:"templateValues,omitempty"`
+
+	// MergedValuesOutput is the name of an output that is set to the merged values files
+	MergedValuesOutput string `yaml:"mergedValuesOutput,omitempty"`
+
+	// PrintEffectiveValues prints the values that reach the chart, the values files and then the set values,
+	// with the sensitive values masked
+	PrintEffectiveValues bool `yaml:"printEffectiveValues,omitempty"`
+
+	// EffectiveValuesOutput is the name of an output that is set to the values printed by PrintEffectiveValues
+	EffectiveValuesOutput string `yaml:"effectiveValuesOutput,omitempty"`
+
+	// ChartMetadataOutput is the name of an output that is set to the chart, repository, version and digest
+	// of the chart that was deployed
+	ChartMetadataOutput string `yaml:"chartMetadataOutput,omitempty"`
+
+	// ValidateValues validates the values against the values.schema.json of the chart before running helm
+	ValidateValues bool `yaml:"validateValues,omitempty"`
+
+	// ChartDigest is the digest of the OCI manifest of an oci:// chart, or of the archive of a chart url,
+	// the chart is installed from the archive with this digest even when the chart is pushed again
+	ChartDigest string `yaml:"chartDigest,omitempty"`
+
+	// ChartVersionOutput is the name of an output that is set to the version of the chart, resolved when version is a range
+	ChartVersionOutput string `yaml:"chartVersionOutput,omitempty"`
+
+	// ManifestOutput is the name of an output that is set to the manifest applied by the release
+	ManifestOutput string `yaml:"manifestOutput,omitempty"`
+
+	// WaitStrategy is helm to wait with helm --wait, poll to poll the resources of the release after helm returned,
+	// printing their progress, or none to not wait
+	WaitStrategy string `yaml:"waitStrategy,omitempty"`
+
+	// WaitForLock retries the step during this duration, for example 5m, when another operation (install/upgrade/rollback)
+	// of the release is in progress, instead of failing immediately
+	WaitForLock string `yaml:"waitForLock,omitempty"`
+
+	// DependsOn are the names of the releases of the step that are installed, and ready, before this release
+	DependsOn []string `yaml:"dependsOn,omitempty"`
+
+	// Releases declare several releases in the step, executed in order, that override the arguments of the step
+	Releases []map[string]interface{} `yaml:"releases,omitempty"`
+
+	// Mode is helm, the default, or apply to render the chart with helm template and apply it with kubectl
+	Mode string `yaml:"mode,omitempty"`
+
+	// KubeVersion and APIVersions render the chart in apply mode for a target cluster, with helm template
+	// --kube-version and --api-versions, instead of the version and the APIs of the current cluster
+	KubeVersion string   `yaml:"kubeVersion,omitempty"`
+	APIVersions []string `yaml:"apiVersions,omitempty"`
+
+	// DeleteHookJobsBeforeRun deletes the completed and failed hook Jobs left by a previous run of the release
+	DeleteHookJobsBeforeRun bool `yaml:"deleteHookJobsBeforeRun,omitempty"`
+
+	// NamespaceLabels and NamespaceAnnotations are set on the namespace of the release when it is created
+	NamespaceLabels      map[string]string `yaml:"namespaceLabels,omitempty"`
+	NamespaceAnnotations map[string]string `yaml:"namespaceAnnotations,omitempty"`
+}
+
+// releaseHooks are what the install and upgrade steps add to the deployment of a release.
+type releaseHooks struct {
+	// releaseOptions are the options of the step that need a helm release, with whether the step sets them
+	releaseOptions map[string]bool
+
+	skipIfExists  bool
+	skipIfMissing bool
+
+	// prepare runs once the chart is resolved, before the release is deployed
+	prepare func(ctx context.Context, args helmArgs, env []string) error
+
+	// failed runs when the deployment failed, after the diagnostics were collected, and returns the error of the step
+	failed func(ctx context.Context, args helmArgs, env []string, err error) error
+}
+
+// runRelease deploys the chart of an install or upgrade step as a release. declared are the arguments of helm
+// declared by the step, the defaults of the mixin are applied to them.
+func (m *Mixin) runRelease(ctx context.Context, step Step, chart ChartArguments, declared helmArgs, hooks releaseHooks) error {
+	ctx, log := tracing.StartSpan(ctx)
+	defer log.EndSpan()
+
+	if err := checkReleaseNamespace(chart.Namespace, chart.ReleaseNamespace); err != nil {
+		return err
+	}
+	if err := validateWaitForLock(chart.WaitForLock); err != nil {
+		return err
+	}
+	if err := validateRenderVersions(chart.Mode, chart.KubeVersion, chart.APIVersions); err != nil {
+		return err
+	}
+	releaseOptions := map[string]bool{
+		"manifestOutput":          chart.ManifestOutput != "",
+		"deleteHookJobsBeforeRun": chart.DeleteHookJobsBeforeRun,
+		"waitStrategy poll":       chart.WaitStrategy == WaitPoll,
+	}
+	for name, ok := range hooks.releaseOptions {
+		releaseOptions[name] = ok
+	}
+	if err := validateMode(chart.Mode, releaseOptions); err != nil {
+		return err
+	}
+
+	declared, err := applyWaitStrategy(chart.WaitStrategy, chart.Atomic, m.applyDefaults(declared))
+	if err != nil {
+		return err
+	}
+	args := m.usePinnedIndex(m.useVendoredChart(declared))
+	if err := m.checkOffline(ctx, args, chart.ValuesFrom); err != nil {
+		return err
+	}
+	args.Labels = m.ownershipLabels()
+	args, err = m.applyImageMap(args, chart.ImageMap)
+	if err != nil {
+		return err
+	}
+	args, err = m.applyRelocations(args, chart.RelocateImages)
+	if err != nil {
+		return err
+	}
+
+	log.SetAttributes(releaseAttributes(args)...)
+	m.warnSkippedValidation(args)
+	valuesFrom, err := m.resolveValuesFrom(chart.ValuesFrom)
+	if err != nil {
+		return err
+	}
+	args.Values = valuesFiles(chart.Values, valuesFrom, chart.ValuesLayers)
+	m.logValuesOrder(chart.Values, valuesFrom, chart.ValuesLayers, args.Set)
+
+	args.Values, err = m.downloadValuesFiles(args.Values)
+	if err != nil {
+		return err
+	}
+
+	if chart.TemplateValues {
+		args.Values, err = m.templateValuesFiles(args.Values)
+		if err != nil {
+			return err
+		}
+	}
+	m.debugValues(args)
+
+	if chart.MergedValuesOutput != "" {
+		err = m.writeMergedValues(chart.MergedValuesOutput, args.Values)
+		if err != nil {
+			return err
+		}
+	}
+	if chart.PrintEffectiveValues || chart.EffectiveValuesOutput != "" {
+		err = m.writeEffectiveValues(args, chart.PrintEffectiveValues, chart.EffectiveValuesOutput)
+		if err != nil {
+			return err
+		}
+	}
+
+	kubeClient, err := m.getOutputsClient(args, step.Outputs)
+	if err != nil {
+		return errors.Wrap(err, "couldn't get kubernetes client")
+	}
+
+	env, err := buildHelmEnv(args)
+	if err != nil {
+		return err
+	}
+
+	skip, err := m.skipRelease(ctx, args, env, hooks.skipIfExists, hooks.skipIfMissing)
+	if err != nil {
+		return err
+	}
+	if skip {
+		if hooks.skipIfMissing {
+			// there is no release to collect the outputs from
+			return nil
+		}
+		return m.handleOutputs(ctx, kubeClient, args.KubeArguments, args.Namespace, step.Outputs)
+	}
+
+	err = m.updateChartRepo(ctx, args, env)
+	if err != nil {
+		return err
+	}
+	version, err := m.resolveChartVersion(ctx, args, env)
+	if err != nil {
+		return err
+	}
+	if version != args.Version {
+		args.Version = version
+		declared.Version = version
+	}
+	args, err = m.pinChartDigest(ctx, chart.ChartDigest, declared, args, env)
+	if err != nil {
+		return err
+	}
+	if chart.ValidateValues {
+		err = m.validateValues(ctx, args, env)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = m.buildChartDependencies(ctx, args, env)
+	if err != nil {
+		return err
+	}
+
+	if hooks.prepare != nil {
+		err = hooks.prepare(ctx, args, env)
+		if err != nil {
+			return err
+		}
+	}
+
+	if chart.DeleteHookJobsBeforeRun {
+		err = m.deleteHookJobs(ctx, kubeClient, args, env)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = m.createNamespace(ctx, kubeClient, args, chart.NamespaceLabels, chart.NamespaceAnnotations)
+	if err != nil {
+		return err
+	}
+
+	err = m.runExecHooks(ctx, "preExec", step.PreExec, step.ExecEnv, args, env)
+	if err != nil {
+		return err
+	}
+
+	if chart.Mode == ModeApply {
+		err = m.applyChart(ctx, kubeClient, args, env)
+	} else {
+		stopHeartbeat := m.startHeartbeat(ctx, kubeClient, args)
+		err = m.runHelmWaitingForLock(ctx, args, env, chart.WaitForLock)
+		stopHeartbeat()
+	}
+	if err == nil && chart.WaitStrategy == WaitPoll {
+		err = m.pollRelease(ctx, kubeClient, args, env)
+	}
+	if err != nil {
+		m.collectDiagnostics(ctx, kubeClient, args, env)
+		if hooks.failed != nil {
+			err = hooks.failed(ctx, args, env, err)
+		}
+		return log.Error(err)
+	}
+
+	err = m.runExecHooks(ctx, "postExec", step.PostExec, step.ExecEnv, args, env)
+	if err != nil {
+		return log.Error(err)
+	}
+
+	if chart.ChartMetadataOutput != "" {
+		err = m.writeChartProvenance(ctx, chart.ChartMetadataOutput, declared, args, env)
+		if err != nil {
+			return log.Error(err)
+		}
+	}
+
+	if chart.ChartVersionOutput != "" {
+		err = m.WriteMixinOutputToFile(chart.ChartVersionOutput, []byte(declared.Version))
+		if err != nil {
+			return log.Error(errors.Wrapf(err, "unable to write output '%s'", chart.ChartVersionOutput))
+		}
+	}
+
+	if chart.ManifestOutput != "" {
+		err = m.writeManifest(ctx, chart.ManifestOutput, args, env)
+		if err != nil {
+			return log.Error(err)
+		}
+	}
+
+	err = m.handleOutputs(ctx, kubeClient, args.KubeArguments, args.Namespace, step.Outputs)
+	if err != nil {
+		return log.Error(err)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package helm3
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8s "k8s.io/client-go/kubernetes"
+)
+
+// diagnosticsLogLines is the number of log lines printed for each pod that isn't ready
+const diagnosticsLogLines = "50"
+
+// collectDiagnostics prints the status of the release, the events of its namespace and the logs of its pods
+// that are not ready, so that a failed helm command, for example one that timed out waiting for the release,
+// can be investigated. Errors are printed instead of returned so that they don't hide the original failure.
+func (m *Mixin) collectDiagnostics(ctx context.Context, kubeClient k8s.Interface, a helmArgs, env []string) {
+	fmt.Fprintf(m.Err, "Collecting diagnostics for release %s\n", a.Release)
+
+	// helm status queries the same cluster with the same identity as the failed command,
+	// the token is passed by env in HELM_KUBETOKEN
+	statusArgs := buildHelmArgs(helmArgs{
+		Command:       []string{"status"},
+		Release:       a.Release,
+		Namespace:     a.Namespace,
+		KubeArguments: a.KubeArguments,
+	})
+	kubectlArgs := []string{}
+	if a.Namespace != "" {
+		kubectlArgs = append(kubectlArgs, "--namespace", a.Namespace)
+	}
+	kubectlArgs = append(kubectlArgs, a.kubectlFlags()...)
+	m.runDiagnostic(ctx, m.helmBinary(), statusArgs, env)
+	m.runDiagnostic(ctx, "kubectl", append([]string{"get", "events", "--sort-by", ".lastTimestamp"}, kubectlArgs...), nil)
+
+	if kubeClient == nil {
+		var err error
+		kubeClient, err = m.getKubernetesClient(a)
+		if err != nil {
+			fmt.Fprintf(m.Err, "could not get a kubernetes client to list the pods of release %s: %s\n", a.Release, err)
+			return
+		}
+	}
+	pods, err := m.getNotReadyPods(ctx, kubeClient, a)
+	if err != nil {
+		fmt.Fprintf(m.Err, "could not list the pods of release %s: %s\n", a.Release, err)
+		return
+	}
+	for _, pod := range pods {
+		args := append([]string{"logs", pod, "--all-containers", "--tail", diagnosticsLogLines}, kubectlArgs...)
+		m.runDiagnostic(ctx, "kubectl", args, nil)
+	}
+}
+
+// runDiagnostic runs a command that collects diagnostics, printing its output to the mixin's error output.
+// The command is printed with its credentials masked.
+func (m *Mixin) runDiagnostic(ctx context.Context, name string, args []string, env []string) {
+	cmd := m.NewCommand(ctx, name, args...)
+	cmd.Env = append(cmd.Env, env...)
+	cmd.Stdout = m.Err
+	cmd.Stderr = m.Err
+
+	prettyCmd := fmt.Sprintf("%s %s", name, strings.Join(maskCredentials(args), " "))
+	fmt.Fprintln(m.Err, prettyCmd)
+	if err := cmd.Run(); err != nil {
+		fmt.Fprintf(m.Err, "could not collect diagnostics with %s: %s\n", prettyCmd, err)
+	}
+}
+
+// getNotReadyPods returns the names of the pods of the release that did not complete and are not ready.
+func (m *Mixin) getNotReadyPods(ctx context.Context, kubeClient k8s.Interface, a helmArgs) ([]string, error) {
+	pods, err := kubeClient.CoreV1().Pods(a.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: "app.kubernetes.io/instance=" + a.Release,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not list pods in namespace %s", a.Namespace)
+	}
+
+	var names []string
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == corev1.PodSucceeded || isPodReady(pod) {
+			continue
+		}
+		names = append(names, pod.Name)
+	}
+	return names, nil
+}
+
+func isPodReady(pod corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package helm3
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"get.porter.sh/porter/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func testPod(name string, phase corev1.PodPhase, ready corev1.ConditionStatus) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "mydb",
+			Labels:    map[string]string{"app.kubernetes.io/instance": "mysql"},
+		},
+		Status: corev1.PodStatus{
+			Phase:      phase,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: ready}},
+		},
+	}
+}
+
+func TestMixin_CollectDiagnostics(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 status mysql --namespace mydb\n"+
+		"kubectl get events --sort-by .lastTimestamp --namespace mydb\n"+
+		"kubectl logs mysql-1 --all-containers --tail 50 --namespace mydb")
+
+	client := testclient.NewSimpleClientset(
+		testPod("mysql-0", corev1.PodRunning, corev1.ConditionTrue),
+		testPod("mysql-1", corev1.PodPending, corev1.ConditionFalse),
+		testPod("mysql-init", corev1.PodSucceeded, corev1.ConditionFalse),
+	)
+
+	h := NewTestMixin(t)
+	h.collectDiagnostics(ctx, client, helmArgs{Release: "mysql", Namespace: "mydb"}, nil)
+
+	stderr := h.TestContext.GetError()
+	assert.Contains(t, stderr, "Collecting diagnostics for release mysql")
+	assert.Contains(t, stderr, "kubectl logs mysql-1")
+	assert.NotContains(t, stderr, "could not collect diagnostics")
+}
+
+func TestMixin_CollectDiagnosticsMasksToken(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	defer os.Unsetenv(test.ExpectedCommandExitCodeEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 status mysql --namespace mydb\n"+
+		"kubectl get events --sort-by .lastTimestamp --namespace mydb --token mytoken")
+	os.Setenv(test.ExpectedCommandExitCodeEnv, "1")
+
+	h := NewTestMixin(t)
+	a := helmArgs{Release: "mysql", Namespace: "mydb"}
+	a.KubeToken = "mytoken"
+	h.collectDiagnostics(ctx, testclient.NewSimpleClientset(), a, nil)
+
+	stderr := h.TestContext.GetError()
+	assert.Contains(t, stderr, "kubectl get events --sort-by .lastTimestamp --namespace mydb --token *******")
+	assert.Contains(t, stderr, "could not collect diagnostics with kubectl get events")
+	assert.NotContains(t, stderr, "mytoken")
+}
+
+func TestMixin_CollectDiagnosticsKubeArguments(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 status mysql --namespace mydb --kube-context prod --kube-apiserver https://prod.example.com --kube-as-user admin --kube-as-group ops --kube-ca-file /cnab/app/ca.crt\n"+
+		"kubectl get events --sort-by .lastTimestamp --namespace mydb --context prod --server https://prod.example.com --token mytoken --as admin --as-group ops --certificate-authority /cnab/app/ca.crt")
+
+	h := NewTestMixin(t)
+	a := helmArgs{Release: "mysql", Namespace: "mydb"}
+	a.KubeArguments = KubeArguments{
+		KubeContext:   "prod",
+		KubeAPIServer: "https://prod.example.com",
+		KubeToken:     "mytoken",
+		KubeAsUser:    "admin",
+		KubeAsGroup:   []string{"ops"},
+		KubeCAFile:    "/cnab/app/ca.crt",
+	}
+	h.collectDiagnostics(ctx, testclient.NewSimpleClientset(), a, []string{"HELM_KUBETOKEN=mytoken"})
+
+	stderr := h.TestContext.GetError()
+	assert.Contains(t, stderr, "helm3 status mysql --namespace mydb --kube-context prod --kube-apiserver https://prod.example.com")
+	assert.NotContains(t, stderr, "could not collect diagnostics")
+	assert.NotContains(t, stderr, "mytoken")
+}
+
+func TestMixin_InstallFailureCollectsDiagnostics(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	defer os.Unsetenv(test.ExpectedCommandExitCodeEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 upgrade --install mysql stable/mysql --namespace mydb --wait --atomic --create-namespace\n"+
+		"helm3 status mysql --namespace mydb\n"+
+		"kubectl get events --sort-by .lastTimestamp --namespace mydb")
+	os.Setenv(test.ExpectedCommandExitCodeEnv, "1")
+
+	wait := true
+	step := InstallStep{
+		InstallArguments: InstallArguments{
+			Step: Step{Description: "Install MySQL"},
+			ChartArguments: ChartArguments{
+				Name:      "mysql",
+				Chart:     "stable/mysql",
+				Namespace: "mydb",
+				Wait:      &wait,
+			},
+		},
+	}
+	action := InstallAction{Steps: []InstallStep{step}}
+	b, err := yaml.Marshal(action)
+	require.NoError(t, err)
+
+	h := NewTestMixin(t)
+	h.Setenv(verifyClientVersionEnv, "false")
+	h.In = bytes.NewReader(b)
+
+	err = h.Install(ctx)
+	require.Error(t, err)
+	assert.Contains(t, h.TestContext.GetError(), "helm3 status mysql --namespace mydb")
+}
@@ -0,0 +1,158 @@
+package helm3
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"get.porter.sh/porter/pkg/tracing"
+	"github.com/pkg/errors"
+)
+
+// DoctorReport is the result of the checks of the doctor command
+type DoctorReport struct {
+	Checks []DoctorCheck `json:"checks"`
+}
+
+// DoctorCheck is a check of the environment that the mixin runs in
+type DoctorCheck struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message"`
+}
+
+// Doctor checks that helm, kubectl, the kubeconfig and the cluster are available to the mixin,
+// printing a report of the checks and failing when one of them failed.
+func (m *Mixin) Doctor(ctx context.Context) error {
+	ctx, log := tracing.StartSpan(ctx)
+	defer log.EndSpan()
+
+	report := DoctorReport{
+		Checks: []DoctorCheck{
+			m.checkHelm(ctx),
+			m.checkKubectl(ctx),
+			m.checkKubeconfig(),
+			m.checkCluster(),
+		},
+	}
+
+	if m.getOutputFormat() == OutputFormatJSON {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "could not marshal the doctor report")
+		}
+		fmt.Fprintln(m.Out, string(data))
+	} else {
+		for _, check := range report.Checks {
+			status := "OK"
+			if !check.OK {
+				status = "FAILED"
+			}
+			fmt.Fprintf(m.Out, "%-6s %s: %s\n", status, check.Name, check.Message)
+		}
+	}
+
+	var failed []string
+	for _, check := range report.Checks {
+		if !check.OK {
+			failed = append(failed, check.Name)
+		}
+	}
+	if len(failed) > 0 {
+		return log.Error(errors.Errorf("the %s checks failed", strings.Join(failed, ", ")))
+	}
+	return nil
+}
+
+// checkHelm checks that the helm client is installed, and that its version meets the constraint the invocation image was built for.
+func (m *Mixin) checkHelm(ctx context.Context) DoctorCheck {
+	check := DoctorCheck{Name: "helm3"}
+
+	version, err := m.helmVersion(ctx)
+	if err != nil {
+		check.Message = err.Error()
+		return check
+	}
+
+	constraint := m.runtimeClientVersionConstraint()
+	ok, err := validate(version, constraint)
+	if err != nil {
+		check.Message = err.Error()
+		return check
+	}
+	if !ok {
+		check.Message = fmt.Sprintf("version %s does not meet semver constraint %q", version, constraint)
+		return check
+	}
+
+	check.OK = true
+	check.Message = version
+	return check
+}
+
+// helmVersion returns the version of the helm client installed in the invocation image.
+func (m *Mixin) helmVersion(ctx context.Context) (string, error) {
+	output, err := m.NewCommand(ctx, m.helmBinary(), "version", "--template", "{{.Version}}").Output()
+	if err != nil {
+		return "", errors.Wrap(err, "could not run helm3")
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// checkKubectl checks that kubectl is installed.
+func (m *Mixin) checkKubectl(ctx context.Context) DoctorCheck {
+	check := DoctorCheck{Name: "kubectl"}
+
+	output, err := m.NewCommand(ctx, "kubectl", "version", "--client").Output()
+	if err != nil {
+		check.Message = fmt.Sprintf("could not run kubectl: %s", err)
+		return check
+	}
+
+	// Only keep the client version, older versions of kubectl also print the kustomize version
+	check.OK = true
+	check.Message = strings.SplitN(strings.TrimSpace(string(output)), "\n", 2)[0]
+	return check
+}
+
+// checkKubeconfig checks that the kubeconfig used by helm can be read.
+func (m *Mixin) checkKubeconfig() DoctorCheck {
+	check := DoctorCheck{Name: "kubeconfig"}
+
+	path := filepath.Join(m.Getenv("HOME"), ".kube", "config")
+	if kubeconfig := m.Getenv("KUBECONFIG"); kubeconfig != "" {
+		path = filepath.SplitList(kubeconfig)[0]
+	}
+
+	_, err := m.FileSystem.ReadFile(path)
+	if err != nil {
+		check.Message = fmt.Sprintf("could not read %s: %s", path, err)
+		return check
+	}
+
+	check.OK = true
+	check.Message = path
+	return check
+}
+
+// checkCluster checks that the Kubernetes API server is reachable.
+func (m *Mixin) checkCluster() DoctorCheck {
+	check := DoctorCheck{Name: "cluster"}
+
+	kubeClient, err := m.getKubernetesClient(m.applyDefaults(helmArgs{}))
+	if err != nil {
+		check.Message = err.Error()
+		return check
+	}
+	serverVersion, err := kubeClient.Discovery().ServerVersion()
+	if err != nil {
+		check.Message = fmt.Sprintf("could not reach the cluster: %s", err)
+		return check
+	}
+
+	check.OK = true
+	check.Message = "reachable, version " + serverVersion.GitVersion
+	return check
+}
@@ -0,0 +1,53 @@
+package helm3
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"get.porter.sh/porter/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMixin_Doctor(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	defer os.Unsetenv(test.ExpectedCommandOutputEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 version --template {{.Version}}\nkubectl version --client")
+	os.Setenv(test.ExpectedCommandOutputEnv, "v3.8.2")
+
+	h := NewTestMixin(t)
+	h.Setenv("KUBECONFIG", "/root/.kube/config")
+	h.FileSystem.WriteFile("/root/.kube/config", []byte("apiVersion: v1\nkind: Config\n"), 0600)
+	h.OutputFormat = OutputFormatJSON
+
+	err := h.Doctor(ctx)
+	require.NoError(t, err)
+
+	var report DoctorReport
+	require.NoError(t, json.Unmarshal([]byte(h.TestContext.GetOutput()), &report))
+	require.Len(t, report.Checks, 4)
+	for _, check := range report.Checks {
+		assert.True(t, check.OK, "check %s failed: %s", check.Name, check.Message)
+	}
+	assert.Equal(t, DoctorCheck{Name: "helm3", OK: true, Message: "v3.8.2"}, report.Checks[0])
+	assert.Equal(t, DoctorCheck{Name: "kubeconfig", OK: true, Message: "/root/.kube/config"}, report.Checks[2])
+}
+
+func TestMixin_DoctorFailedChecks(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	defer os.Unsetenv(test.ExpectedCommandOutputEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 version --template {{.Version}}\nkubectl version --client")
+	os.Setenv(test.ExpectedCommandOutputEnv, "v2.16.1")
+
+	h := NewTestMixin(t)
+	h.Setenv("KUBECONFIG", "/root/.kube/config")
+
+	err := h.Doctor(ctx)
+	require.EqualError(t, err, "the helm3, kubeconfig checks failed")
+	assert.Contains(t, h.TestContext.GetOutput(), `FAILED helm3: version v2.16.1 does not meet semver constraint "^v3.x"`)
+	assert.Contains(t, h.TestContext.GetOutput(), "OK     kubectl: v2.16.1")
+}
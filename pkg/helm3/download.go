@@ -0,0 +1,111 @@
+package helm3
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// downloadTimeout is the maximum duration of the download of a remote values file
+const downloadTimeout = time.Minute
+
+// isValuesURL returns true when a values file is a URL that is downloaded at runtime.
+func isValuesURL(file string) bool {
+	return strings.HasPrefix(file, "https://") || strings.HasPrefix(file, "http://")
+}
+
+// downloadValuesFiles downloads the values files that are URLs, returning the
+// values files with the URLs replaced by the paths of the downloaded files.
+func (m *Mixin) downloadValuesFiles(files []string) ([]string, error) {
+	result := make([]string, 0, len(files))
+	for _, file := range files {
+		if isValuesURL(file) {
+			var err error
+			file, err = m.downloadValuesFile(ValuesSource{URL: file})
+			if err != nil {
+				return nil, err
+			}
+		}
+		result = append(result, file)
+	}
+	return result, nil
+}
+
+// downloadValuesFile downloads a remote values file to a temporary file, checking its checksum when it is pinned,
+// and returns the path of the file.
+func (m *Mixin) downloadValuesFile(source ValuesSource) (string, error) {
+	client, err := m.newDownloadClient(source.CAFile)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := client.Get(source.URL)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not download values file %s", source.URL)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("could not download values file %s: %s", source.URL, resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not download values file %s", source.URL)
+	}
+
+	if source.Checksum != "" {
+		sum := sha256.Sum256(data)
+		got := "sha256:" + hex.EncodeToString(sum[:])
+		want := source.Checksum
+		if !strings.HasPrefix(want, "sha256:") {
+			want = "sha256:" + want
+		}
+		if got != want {
+			return "", errors.Errorf("checksum of values file %s is %s, expected %s", source.URL, got, want)
+		}
+	}
+
+	out, err := m.FileSystem.TempFile("", "values-*.yaml")
+	if err != nil {
+		return "", errors.Wrapf(err, "could not create the values file of %s", source.URL)
+	}
+	defer out.Close()
+	_, err = out.Write(data)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not write the values file of %s", source.URL)
+	}
+	return out.Name(), nil
+}
+
+// newDownloadClient returns the client used to download remote values files,
+// trusting the certificate authority of the CA file in addition to the system ones.
+func (m *Mixin) newDownloadClient(caFile string) (*http.Client, error) {
+	client := &http.Client{Timeout: downloadTimeout}
+	if caFile == "" {
+		return client, nil
+	}
+
+	ca, err := m.FileSystem.ReadFile(caFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read the CA file %s", caFile)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.Errorf("the CA file %s does not contain a PEM encoded certificate", caFile)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	client.Transport = transport
+	return client, nil
+}
@@ -0,0 +1,82 @@
+package helm3
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMixin_DownloadValuesFile(t *testing.T) {
+	values := "replicas: 3\n"
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/values.yaml" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(values))
+	}))
+	defer srv.Close()
+
+	sum := sha256.Sum256([]byte(values))
+	checksum := "sha256:" + hex.EncodeToString(sum[:])
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+
+	testcases := []struct {
+		name      string
+		source    ValuesSource
+		wantError string
+	}{
+		{
+			name:   "pinned checksum",
+			source: ValuesSource{URL: srv.URL + "/values.yaml", Checksum: checksum, CAFile: "/cnab/app/ca.crt"},
+		},
+		{
+			name:      "checksum mismatch",
+			source:    ValuesSource{URL: srv.URL + "/values.yaml", Checksum: "sha256:abc123", CAFile: "/cnab/app/ca.crt"},
+			wantError: "checksum of values file " + srv.URL + "/values.yaml is " + checksum + ", expected sha256:abc123",
+		},
+		{
+			name:      "not found",
+			source:    ValuesSource{URL: srv.URL + "/missing.yaml", CAFile: "/cnab/app/ca.crt"},
+			wantError: "could not download values file " + srv.URL + "/missing.yaml: 404 Not Found",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := NewTestMixin(t)
+			h.FileSystem.WriteFile("/cnab/app/ca.crt", ca, 0644)
+
+			file, err := h.downloadValuesFile(tc.source)
+			if tc.wantError != "" {
+				require.EqualError(t, err, tc.wantError)
+				return
+			}
+			require.NoError(t, err)
+
+			got, err := h.FileSystem.ReadFile(file)
+			require.NoError(t, err)
+			assert.Equal(t, values, string(got))
+		})
+	}
+}
+
+func TestMixin_DownloadValuesFiles(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("replicas: 3\n"))
+	}))
+	defer srv.Close()
+
+	h := NewTestMixin(t)
+	files, err := h.downloadValuesFiles([]string{"values/base.yaml", srv.URL + "/values.yaml"})
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	assert.Equal(t, "values/base.yaml", files[0])
+	assert.NotEqual(t, srv.URL+"/values.yaml", files[1], "the URL should be replaced by the downloaded file")
+}
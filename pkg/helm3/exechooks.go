@@ -0,0 +1,68 @@
+package helm3
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Environment variables that hand the context of the step over to the preExec and postExec commands
+const (
+	execReleaseEnv   = "HELM3_MIXIN_RELEASE"
+	execNamespaceEnv = "HELM3_MIXIN_NAMESPACE"
+)
+
+// ExecHooks are shell commands run in the invocation image around the helm command of a step, for glue like
+// creating a pull secret before the install, or patching a resource after it, that would otherwise need
+// separate exec mixin steps without the context of the step.
+type ExecHooks struct {
+	// PreExec commands are run before helm, a failing command fails the step before helm is run
+	PreExec []string `yaml:"preExec,omitempty"`
+
+	// PostExec commands are run after helm succeeded, before the outputs are collected
+	PostExec []string `yaml:"postExec,omitempty"`
+
+	// ExecEnv holds environment variables that are only set on the preExec and postExec commands, to pass them
+	// the credentials of the bundle instead of interpolating them in the commands
+	ExecEnv map[string]string `yaml:"execEnv,omitempty"`
+}
+
+// runExecHooks runs the preExec or postExec commands with sh, with the environment of the helm command, the
+// execEnv of the step, and the release and the namespace of the step. The commands are printed with their
+// credentials masked, and not at all when the step suppresses its output.
+func (m *Mixin) runExecHooks(ctx context.Context, hook string, commands []string, execEnv map[string]string, a helmArgs, env []string) error {
+	suppress := stepFromContext(ctx).SuppressOutput
+	for i, command := range commands {
+		cmd := m.NewCommand(ctx, "sh", "-c", command)
+		cmd.Env = append(cmd.Env, env...)
+		cmd.Env = append(cmd.Env, formatEnv(execEnv)...)
+		cmd.Env = append(cmd.Env, execReleaseEnv+"="+a.Release, execNamespaceEnv+"="+a.Namespace)
+		cmd.Stdout = m.Out
+		cmd.Stderr = m.Err
+		if suppress {
+			cmd.Stdout = io.Discard
+		} else {
+			fmt.Fprintf(m.Out, "%s: %s\n", hook, maskExecCommand(command, execEnv))
+		}
+
+		if err := cmd.Run(); err != nil {
+			return errors.Wrapf(err, "%s command %d of %d failed", hook, i+1, len(commands))
+		}
+	}
+	return nil
+}
+
+// maskExecCommand returns a preExec or postExec command with the values of the credential flags, and the values of
+// the sensitive variables of execEnv, masked, to print it.
+func maskExecCommand(command string, execEnv map[string]string) string {
+	masked := strings.Join(maskCredentials(strings.Fields(command)), " ")
+	for name, value := range execEnv {
+		if value != "" && isSensitiveValue(name) {
+			masked = strings.ReplaceAll(masked, value, "*******")
+		}
+	}
+	return masked
+}
@@ -26,17 +26,36 @@ func (m *Mixin) Execute(ctx context.Context) error {
 		return errors.Errorf("expected a single step, but got %d", len(action.Steps))
 	}
 	step := action.Steps[0]
+	ctx = withStep(ctx, step.Step)
+	if skip, err := m.skipCondition(step.Step); err != nil || skip {
+		return err
+	}
+	if step.hasCommand() {
+		return m.runCommand(ctx, step.Commands)
+	}
 
+	hookArgs := m.applyDefaults(helmArgs{Namespace: step.Namespace})
+	err = m.runExecHooks(ctx, "preExec", step.PreExec, step.ExecEnv, hookArgs, nil)
+	if err != nil {
+		return err
+	}
+
+	action.Steps[0].binary = m.helmBinary()
 	_, err = builder.ExecuteSingleStepAction(ctx, m.RuntimeConfig, action)
 	if err != nil {
-		return errors.Wrapf(err, "invocation of action %s failed", action)
+		return errors.Wrapf(err, "invocation of action %s failed", action.Name)
+	}
+
+	err = m.runExecHooks(ctx, "postExec", step.PostExec, step.ExecEnv, hookArgs, nil)
+	if err != nil {
+		return err
 	}
 
-	kubeClient, err := m.getKubernetesClient()
+	kubeClient, err := m.getOutputsClient(m.applyDefaults(helmArgs{}), step.Outputs)
 	if err != nil {
 		return errors.Wrap(err, "couldn't get kubernetes client")
 	}
 
-	err = m.handleOutputs(ctx, kubeClient, step.Namespace, step.Outputs)
+	err = m.handleOutputs(ctx, kubeClient, KubeArguments{}, step.Namespace, step.Outputs)
 	return err
 }
@@ -161,3 +161,24 @@ func TestMixin_Execute(t *testing.T) {
 	err := h.Execute(ctx)
 	require.NoError(t, err)
 }
+
+func TestMixin_ExecuteWithHelmBinary(t *testing.T) {
+	ctx := context.Background()
+
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm status mysql")
+
+	executeAction := Action{
+		Steps: []ExecuteSteps{
+			{ExecuteStep: ExecuteStep{Arguments: []string{"status", "mysql"}}},
+		},
+	}
+	b, _ := yaml.Marshal(executeAction)
+
+	h := NewTestMixin(t)
+	h.Setenv(helmBinaryEnv, "helm")
+	h.In = bytes.NewReader(b)
+
+	err := h.Execute(ctx)
+	require.NoError(t, err)
+}
@@ -0,0 +1,181 @@
+package helm3
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// ExportArguments are the arguments of the export command
+type ExportArguments struct {
+	Chart     string            `yaml:"chart"`
+	Version   string            `yaml:"version,omitempty"`
+	Repo      string            `yaml:"repo,omitempty"`
+	Name      string            `yaml:"name,omitempty"`
+	Namespace string            `yaml:"namespace,omitempty"`
+	Values    []string          `yaml:"values,omitempty"`
+	Set       map[string]string `yaml:"set,omitempty"`
+	SkipCrds  bool              `yaml:"skipCrds,omitempty"`
+
+	// KubeVersion and APIVersions render the chart for a target cluster instead of the current cluster,
+	// with helm template --kube-version and --api-versions
+	KubeVersion string   `yaml:"kubeVersion,omitempty"`
+	APIVersions []string `yaml:"apiVersions,omitempty"`
+
+	// Destination is the directory where the manifests are written, one file per resource
+	Destination string `yaml:"destination"`
+
+	// Kustomization also writes a kustomization.yaml listing the manifests
+	Kustomization bool `yaml:"kustomization,omitempty"`
+
+	// Output is the name of an output that is set to the path of the destination directory
+	Output string `yaml:"output,omitempty"`
+}
+
+// exportedManifest is a resource rendered by the chart, and the file it is exported to
+type exportedManifest struct {
+	file     string
+	manifest []byte
+}
+
+// unsafeFileChars are the characters replaced in the names of the exported files
+var unsafeFileChars = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+// exportChart renders the chart with helm template and writes the manifests to a directory, one file per resource,
+// so that a bundle can hand off the release to a GitOps repository instead of installing it.
+func (m *Mixin) exportChart(ctx context.Context, a ExportArguments) error {
+	if a.Chart == "" || a.Destination == "" {
+		return errors.New("export requires a chart and a destination")
+	}
+
+	args := []string{"template"}
+	if a.Name != "" {
+		args = append(args, a.Name)
+	}
+	args = append(args, a.Chart)
+	if a.Version != "" {
+		args = append(args, "--version", a.Version)
+	}
+	if a.Repo != "" {
+		args = append(args, "--repo", a.Repo)
+	}
+	if a.Namespace != "" {
+		args = append(args, "--namespace", a.Namespace)
+	}
+	if !a.SkipCrds {
+		args = append(args, "--include-crds")
+	}
+	if a.KubeVersion != "" {
+		args = append(args, "--kube-version", a.KubeVersion)
+	}
+	for _, v := range a.APIVersions {
+		args = append(args, "--api-versions", v)
+	}
+	for _, v := range a.Values {
+		args = append(args, "--values", v)
+	}
+	args = appendSetFlags(args, a.Set)
+
+	// the rendered manifest isn't printed, it contains the secrets of the release
+	step := stepFromContext(ctx)
+	step.SuppressOutput = true
+	rendered := &bytes.Buffer{}
+	err := m.runHelmWithStdout(withStep(ctx, step), args, nil, rendered)
+	if err != nil {
+		return errors.Wrapf(err, "could not render chart %s", a.Chart)
+	}
+
+	manifests, err := splitManifests(rendered.Bytes())
+	if err != nil {
+		return errors.Wrapf(err, "could not parse the manifests rendered by chart %s", a.Chart)
+	}
+
+	err = m.FileSystem.MkdirAll(a.Destination, 0755)
+	if err != nil {
+		return errors.Wrapf(err, "could not create directory %s", a.Destination)
+	}
+	files := make([]string, 0, len(manifests))
+	for _, manifest := range manifests {
+		err = m.FileSystem.WriteFile(filepath.Join(a.Destination, manifest.file), manifest.manifest, 0644)
+		if err != nil {
+			return errors.Wrapf(err, "could not write manifest %s", manifest.file)
+		}
+		files = append(files, manifest.file)
+	}
+	if a.Kustomization {
+		err = m.writeKustomization(a.Destination, files)
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(m.Out, "Exported %d manifests of chart %s to %s\n", len(manifests), a.Chart, a.Destination)
+
+	if a.Output != "" {
+		err = m.WriteMixinOutputToFile(a.Output, []byte(a.Destination))
+		if err != nil {
+			return errors.Wrapf(err, "unable to write output '%s'", a.Output)
+		}
+	}
+	return nil
+}
+
+// splitManifests splits the output of helm template into one manifest per resource, named after the kind and
+// the name of the resource, and the namespace when two resources only differ by their namespace.
+// Empty documents, like the templates that render nothing, are skipped.
+func splitManifests(rendered []byte) ([]exportedManifest, error) {
+	var manifests []exportedManifest
+	used := map[string]bool{}
+	for _, doc := range strings.Split("\n"+string(rendered), "\n---") {
+		var resource hookResource
+		err := yaml.Unmarshal([]byte(doc), &resource)
+		if err != nil {
+			return nil, err
+		}
+		if resource.Kind == "" {
+			continue
+		}
+
+		base := strings.ToLower(resource.Kind) + "-" + strings.ToLower(resource.Metadata.Name)
+		file := unsafeFileChars.ReplaceAllString(base, "-") + ".yaml"
+		if used[file] && resource.Metadata.Namespace != "" {
+			base = strings.ToLower(resource.Metadata.Namespace) + "-" + base
+			file = unsafeFileChars.ReplaceAllString(base, "-") + ".yaml"
+		}
+		for i := 2; used[file]; i++ {
+			file = fmt.Sprintf("%s-%d.yaml", unsafeFileChars.ReplaceAllString(base, "-"), i)
+		}
+		used[file] = true
+
+		manifest := strings.TrimLeft(doc, "\n")
+		if !strings.HasSuffix(manifest, "\n") {
+			manifest += "\n"
+		}
+		manifests = append(manifests, exportedManifest{file: file, manifest: []byte(manifest)})
+	}
+	return manifests, nil
+}
+
+// writeKustomization writes the kustomization.yaml that lists the exported manifests, in the order helm rendered them.
+func (m *Mixin) writeKustomization(dir string, files []string) error {
+	kustomization := struct {
+		APIVersion string   `yaml:"apiVersion"`
+		Kind       string   `yaml:"kind"`
+		Resources  []string `yaml:"resources"`
+	}{"kustomize.config.k8s.io/v1beta1", "Kustomization", files}
+
+	b, err := yaml.Marshal(kustomization)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal kustomization.yaml")
+	}
+	err = m.FileSystem.WriteFile(filepath.Join(dir, "kustomization.yaml"), b, 0644)
+	if err != nil {
+		return errors.Wrap(err, "could not write kustomization.yaml")
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package helm3
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// FailureClass is the class of a failed helm command, so that automation can branch on the failure
+// instead of parsing the output of helm
+type FailureClass string
+
+const (
+	FailureReleaseNotFound     FailureClass = "release-not-found"
+	FailureChartNotFound       FailureClass = "chart-not-found"
+	FailureSchemaValidation    FailureClass = "schema-validation"
+	FailureTimeout             FailureClass = "timeout"
+	FailureOperationInProgress FailureClass = "operation-in-progress"
+)
+
+// failureExitCodes are the exit codes of the mixin for each class of failure, other failures exit with 1
+var failureExitCodes = map[FailureClass]int{
+	FailureReleaseNotFound:     10,
+	FailureChartNotFound:       11,
+	FailureSchemaValidation:    12,
+	FailureTimeout:             13,
+	FailureOperationInProgress: 14,
+}
+
+// failurePatterns match the output of helm to a class of failure, they are checked in order
+var failurePatterns = []struct {
+	class    FailureClass
+	patterns []string
+}{
+	{FailureOperationInProgress, []string{"another operation (install/upgrade/rollback) is in progress"}},
+	{FailureSchemaValidation, []string{"values don't meet the specifications of the schema"}},
+	{FailureTimeout, []string{"timed out waiting for the condition", "context deadline exceeded"}},
+	{FailureChartNotFound, []string{"chart not found", "no chart version found", "no chart name found", "failed to download"}},
+	{FailureReleaseNotFound, []string{"release: not found", "release not loaded", "has no deployed releases"}},
+}
+
+// HelmError is a failed helm command, classified from its output
+type HelmError struct {
+	Class FailureClass
+	Err   error
+}
+
+func (e *HelmError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *HelmError) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode is the exit code of the mixin for the class of the failure
+func (e *HelmError) ExitCode() int {
+	return failureExitCodes[e.Class]
+}
+
+// classifyFailure returns the class of failure of a helm command from its output,
+// or an empty string when the failure isn't recognized.
+func classifyFailure(stderr string) FailureClass {
+	stderr = strings.ToLower(stderr)
+	for _, failure := range failurePatterns {
+		for _, pattern := range failure.patterns {
+			if strings.Contains(stderr, pattern) {
+				return failure.class
+			}
+		}
+	}
+	return ""
+}
+
+// classifyHelmError wraps the error of a failed helm command in a HelmError when its failure is recognized.
+func classifyHelmError(err error, stderr string) error {
+	if err == nil {
+		return nil
+	}
+	class := classifyFailure(stderr)
+	if class == "" {
+		return err
+	}
+	return &HelmError{Class: class, Err: err}
+}
+
+// ExitCode returns the exit code of the mixin for an error, the exit code of its class of failure
+// when it wraps a HelmError, otherwise 1.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var helmErr *HelmError
+	if errors.As(err, &helmErr) {
+		return helmErr.ExitCode()
+	}
+	return 1
+}
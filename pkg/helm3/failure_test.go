@@ -0,0 +1,75 @@
+package helm3
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"get.porter.sh/porter/pkg/test"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestClassifyFailure(t *testing.T) {
+	testcases := []struct {
+		stderr string
+		want   FailureClass
+	}{
+		{"Error: UPGRADE FAILED: release: not found", FailureReleaseNotFound},
+		{`Error: UPGRADE FAILED: "mysql" has no deployed releases`, FailureReleaseNotFound},
+		{`Error: chart "mysql" version "9.9.9" not found in https://charts.helm.sh/stable repository`, ""},
+		{"Error: failed to download \"stable/mysql\"", FailureChartNotFound},
+		{"Error: values don't meet the specifications of the schema(s) in the following chart(s):\nmysql:\n- replicas: Invalid type", FailureSchemaValidation},
+		{"Error: UPGRADE FAILED: timed out waiting for the condition", FailureTimeout},
+		{"Error: UPGRADE FAILED: another operation (install/upgrade/rollback) is in progress", FailureOperationInProgress},
+		{"Error: Kubernetes cluster unreachable", ""},
+	}
+	for _, tc := range testcases {
+		assert.Equal(t, tc.want, classifyFailure(tc.stderr), tc.stderr)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	assert.Equal(t, 0, ExitCode(nil))
+	assert.Equal(t, 1, ExitCode(errors.New("boom")))
+
+	err := classifyHelmError(errors.New("exit status 1"), "Error: UPGRADE FAILED: timed out waiting for the condition")
+	assert.Equal(t, 13, ExitCode(errors.Wrap(err, "upgrade failed")))
+	assert.Equal(t, "upgrade failed: exit status 1", errors.Wrap(err, "upgrade failed").Error())
+}
+
+func TestMixin_InstallClassifiesFailure(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	defer os.Unsetenv(test.ExpectedCommandOutputEnv)
+	defer os.Unsetenv(test.ExpectedCommandExitCodeEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 upgrade --install mysql stable/mysql --atomic --create-namespace")
+	os.Setenv(test.ExpectedCommandOutputEnv, "Error: INSTALLATION FAILED: another operation (install/upgrade/rollback) is in progress")
+	os.Setenv(test.ExpectedCommandExitCodeEnv, "1")
+
+	step := InstallStep{
+		InstallArguments: InstallArguments{
+			Step: Step{Description: "Install MySQL"},
+			ChartArguments: ChartArguments{
+				Name:  "mysql",
+				Chart: "stable/mysql",
+			},
+		},
+	}
+	b, err := yaml.Marshal(InstallAction{Steps: []InstallStep{step}})
+	require.NoError(t, err)
+
+	h := NewTestMixin(t)
+	h.Setenv(verifyClientVersionEnv, "false")
+	h.In = bytes.NewReader(b)
+
+	err = h.Install(ctx)
+	require.Error(t, err)
+	var helmErr *HelmError
+	require.True(t, errors.As(err, &helmErr), "the error should be a HelmError: %v", err)
+	assert.Equal(t, FailureOperationInProgress, helmErr.Class)
+	assert.Equal(t, 14, ExitCode(err))
+}
@@ -0,0 +1,488 @@
+package helm3
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// helmArgs describes a helm command run by one of the mixin's built-in steps.
+// Every flag is added by buildHelmArgs so that the steps stay consistent.
+type helmArgs struct {
+	KubeArguments
+
+	// Command is the helm subcommand, for example upgrade --install or uninstall.
+	Command []string
+	Release string
+	Chart   string
+
+	Namespace                string
+	Version                  string
+	ResetValues              bool
+	ReuseValues              bool
+	Wait                     *bool
+	Devel                    bool
+	Verify                   bool
+	DependencyUpdate         bool
+	EnableDNS                bool
+	SkipSchemaValidation     bool
+	DisableOpenAPIValidation bool
+	RenderSubchartNotes      bool
+	HideNotes                bool
+	TakeOwnership            bool
+	Values                   []string
+	SkipCrds                 bool
+	NoHooks                  bool
+	Repo                     string
+	Username                 string
+	Password                 string
+	PassCredentials          bool
+	Timeout                  string
+	Debug                    *bool
+	// Atomic and CreateNamespace default to true when nil.
+	// They only apply to commands that use a chart.
+	Atomic          *bool
+	CreateNamespace *bool
+	Set             map[string]string
+
+	// Labels are set on the release, they are not declared by the steps
+	Labels map[string]string
+
+	// StorageDriver, SQLConnectionString and Env are passed to helm as environment variables.
+	StorageDriver       string
+	SQLConnectionString string
+	Env                 map[string]string
+
+	// BurstLimit is passed to helm, QPS only applies to the mixin's Kubernetes client.
+	BurstLimit int
+	QPS        float32
+
+	// ClientMajorVersion selects the flags of the helm client, Helm v3 is used when it is not set.
+	ClientMajorVersion int
+
+	// RepositoryCache is the cache with the repository indexes pinned at build time
+	RepositoryCache string
+
+	// KubeVersion and APIVersions render the chart for a target cluster, they only apply to helm template
+	KubeVersion string
+	APIVersions []string
+}
+
+func (s ChartArguments) helmArgs() helmArgs {
+	return helmArgs{
+		KubeArguments:            s.KubeArguments,
+		Command:                  []string{"upgrade", "--install"},
+		Release:                  s.Name,
+		Chart:                    s.Chart,
+		Namespace:                releaseNamespace(s.Namespace, s.ReleaseNamespace),
+		Version:                  s.Version,
+		Wait:                     s.Wait,
+		Devel:                    s.Devel,
+		Verify:                   s.Verify,
+		DependencyUpdate:         s.DependencyUpdate,
+		EnableDNS:                s.EnableDNS,
+		SkipSchemaValidation:     s.SkipSchemaValidation,
+		DisableOpenAPIValidation: s.DisableOpenAPIValidation,
+		RenderSubchartNotes:      s.RenderSubchartNotes,
+		HideNotes:                s.HideNotes,
+		TakeOwnership:            s.TakeOwnership,
+		Values:                   valuesFiles(s.Values, nil, s.ValuesLayers),
+		SkipCrds:                 s.SkipCrds,
+		NoHooks:                  s.NoHooks,
+		Repo:                     s.Repo,
+		Username:                 s.Username,
+		Password:                 s.Password,
+		PassCredentials:          s.PassCredentials,
+		Timeout:                  s.Timeout,
+		Debug:                    s.Debug,
+		Atomic:                   s.Atomic,
+		CreateNamespace:          s.CreateNamespace,
+		Set:                      s.Set,
+		KubeVersion:              s.KubeVersion,
+		APIVersions:              s.APIVersions,
+
+		StorageDriver:       s.StorageDriver,
+		SQLConnectionString: s.SQLConnectionString,
+		Env:                 s.Env,
+
+		BurstLimit: s.BurstLimit,
+		QPS:        s.QPS,
+	}
+}
+
+func (s UpgradeArguments) helmArgs() helmArgs {
+	args := s.ChartArguments.helmArgs()
+	args.ResetValues = s.ResetValues
+	args.ReuseValues = s.ReuseValues
+	if s.RollbackOnFailure {
+		// rollbackOnFailure replaces atomic
+		atomic := false
+		args.Atomic = &atomic
+	}
+	return args
+}
+
+func (s UninstallArguments) helmArgs(release string) helmArgs {
+	return helmArgs{
+		KubeArguments: s.KubeArguments,
+		Command:       []string{"uninstall"},
+		Release:       release,
+		Namespace:     releaseNamespace(s.Namespace, s.ReleaseNamespace),
+		Wait:          s.Wait,
+		NoHooks:       s.NoHooks,
+		Timeout:       s.Timeout,
+		Debug:         s.Debug,
+
+		StorageDriver:       s.StorageDriver,
+		SQLConnectionString: s.SQLConnectionString,
+		Env:                 s.Env,
+
+		BurstLimit: s.BurstLimit,
+	}
+}
+
+// isTrue returns the value of an optional flag, false when it is not set.
+func isTrue(b *bool) bool {
+	return b != nil && *b
+}
+
+// buildHelmArgs returns the arguments to pass to the helm client, excluding the binary name.
+func buildHelmArgs(a helmArgs) []string {
+	args := append([]string{}, a.Command...)
+
+	if a.Release != "" {
+		args = append(args, a.Release)
+	}
+
+	if a.Chart != "" {
+		args = append(args, a.Chart)
+	}
+
+	if a.Namespace != "" {
+		args = append(args, "--namespace", a.Namespace)
+	}
+
+	if a.KubeContext != "" {
+		args = append(args, "--kube-context", a.KubeContext)
+	}
+
+	if a.KubeAPIServer != "" {
+		args = append(args, "--kube-apiserver", a.KubeAPIServer)
+	}
+
+	if a.KubeAsUser != "" {
+		args = append(args, "--kube-as-user", a.KubeAsUser)
+	}
+
+	for _, g := range a.KubeAsGroup {
+		args = append(args, "--kube-as-group", g)
+	}
+
+	if a.KubeCAFile != "" {
+		args = append(args, "--kube-ca-file", a.KubeCAFile)
+	}
+
+	if a.Version != "" {
+		args = append(args, "--version", a.Version)
+	}
+
+	if a.ResetValues {
+		args = append(args, "--reset-values")
+	}
+
+	if a.ReuseValues {
+		args = append(args, "--reuse-values")
+	}
+
+	if isTrue(a.Wait) {
+		args = append(args, "--wait")
+	}
+
+	if a.Devel {
+		args = append(args, "--devel")
+	}
+
+	for _, v := range a.Values {
+		args = append(args, "--values", v)
+	}
+
+	if a.SkipCrds {
+		args = append(args, "--skip-crds")
+	}
+
+	if a.NoHooks {
+		args = append(args, "--no-hooks")
+	}
+
+	if a.Verify {
+		args = append(args, "--verify")
+	}
+
+	if a.DependencyUpdate {
+		args = append(args, "--dependency-update")
+	}
+
+	if a.TakeOwnership {
+		args = append(args, "--take-ownership")
+	}
+
+	if a.HideNotes {
+		args = append(args, "--hide-notes")
+	}
+
+	if a.RenderSubchartNotes {
+		args = append(args, "--render-subchart-notes")
+	}
+
+	if a.DisableOpenAPIValidation {
+		args = append(args, "--disable-openapi-validation")
+	}
+
+	if a.SkipSchemaValidation {
+		args = append(args, "--skip-schema-validation")
+	}
+
+	if a.EnableDNS {
+		args = append(args, "--enable-dns")
+	}
+
+	if len(a.Labels) > 0 {
+		args = append(args, "--labels", formatLabels(a.Labels))
+	}
+
+	args = append(args, chartRepoFlags(a)...)
+
+	if a.RepositoryCache != "" {
+		args = append(args, "--repository-cache", a.RepositoryCache)
+	}
+
+	if a.Timeout != "" {
+		args = append(args, "--timeout", a.Timeout)
+	}
+
+	if a.BurstLimit > 0 {
+		args = append(args, "--burst-limit", strconv.Itoa(a.BurstLimit))
+	}
+
+	if a.KubeVersion != "" {
+		args = append(args, "--kube-version", a.KubeVersion)
+	}
+
+	for _, v := range a.APIVersions {
+		args = append(args, "--api-versions", v)
+	}
+
+	if isTrue(a.Debug) {
+		args = append(args, "--debug")
+	}
+
+	if a.Chart != "" {
+		if a.Atomic == nil || *a.Atomic {
+			// This will ensure the release is rolled back (or deleted on install) on failure.
+			// Helm v4 renamed --atomic to --rollback-on-failure.
+			if a.ClientMajorVersion >= 4 {
+				args = append(args, "--rollback-on-failure")
+			} else {
+				args = append(args, "--atomic")
+			}
+		}
+
+		if a.CreateNamespace == nil || *a.CreateNamespace {
+			// This will ensure the creation of the release namespace if not present.
+			args = append(args, "--create-namespace")
+		}
+	}
+
+	return appendSetFlags(args, a.Set)
+}
+
+// chartRepoFlags returns the flags that locate the chart in the repository of the step, with its credentials.
+// The credentials are masked when the command is printed.
+func chartRepoFlags(a helmArgs) []string {
+	var args []string
+	if a.Repo != "" {
+		args = append(args, "--repo", a.Repo)
+	}
+	if a.Username != "" {
+		args = append(args, "--username", a.Username)
+	}
+	if a.Password != "" {
+		args = append(args, "--password", a.Password)
+	}
+	if a.PassCredentials {
+		args = append(args, "--pass-credentials")
+	}
+	return args
+}
+
+// credentialFlags are the flags whose value is masked when a command is printed
+var credentialFlags = []string{"--username", "--password", "--token"}
+
+// maskCredentials returns the arguments of a command with the values of the credential flags, and of the --set flags
+// of sensitive values, masked, to print it.
+func maskCredentials(args []string) []string {
+	masked := make([]string, len(args))
+	for i, arg := range args {
+		masked[i] = arg
+		if i > 0 && args[i-1] == "--set" {
+			if k, _, ok := strings.Cut(arg, "="); ok && isSensitiveValue(k) {
+				masked[i] = k + "=*******"
+			}
+		}
+		for _, flag := range credentialFlags {
+			if i > 0 && args[i-1] == flag {
+				masked[i] = "*******"
+			} else if strings.HasPrefix(arg, flag+"=") {
+				masked[i] = flag + "=*******"
+			}
+		}
+	}
+	return masked
+}
+
+// buildHelmEnv returns the environment variables to set on the helm client, in KEY=VALUE form.
+func buildHelmEnv(a helmArgs) ([]string, error) {
+	env := formatEnv(a.Env)
+
+	if a.KubeToken != "" {
+		// Pass the token in the environment instead of --kube-token so that it isn't printed with the command
+		env = append(env, "HELM_KUBETOKEN="+a.KubeToken)
+	}
+
+	switch a.StorageDriver {
+	case "":
+	case "secret", "configmap", "memory":
+		env = append(env, "HELM_DRIVER="+a.StorageDriver)
+	case "sql":
+		if a.SQLConnectionString == "" {
+			return nil, errors.New("sqlConnectionString is required when the storageDriver is sql")
+		}
+		env = append(env, "HELM_DRIVER=sql", "HELM_DRIVER_SQL_CONNECTION_STRING="+a.SQLConnectionString)
+	default:
+		return nil, errors.Errorf("unsupported storageDriver %q, allowed values are: secret, configmap, memory, sql", a.StorageDriver)
+	}
+
+	return env, nil
+}
+
+// formatEnv converts the environment variables to KEY=VALUE form, sorted by key.
+func formatEnv(vars map[string]string) []string {
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var env []string
+	for _, k := range keys {
+		env = append(env, fmt.Sprintf("%s=%s", k, vars[k]))
+	}
+	return env
+}
+
+// appendSetFlags appends a --set flag for each value, sorted by key so that the command is consistent.
+func appendSetFlags(args []string, set map[string]string) []string {
+	setKeys := make([]string, 0, len(set))
+	for k := range set {
+		setKeys = append(setKeys, k)
+	}
+	sort.Strings(setKeys)
+
+	for _, k := range setKeys {
+		args = append(args, "--set", fmt.Sprintf("%s=%s", k, set[k]))
+	}
+	return args
+}
+
+// sensitiveValueWords are the words of a value name that mark its value as sensitive
+var sensitiveValueWords = map[string]bool{
+	"password": true, "passwd": true, "passphrase": true, "secret": true, "token": true, "credential": true,
+}
+
+// isSensitiveValue returns true when the value should be masked when it is printed. The name is a path of
+// segments separated by dots, such as auth.rootPassword, or an environment variable such as REGISTRY_PASSWORD.
+// Only whole words are matched, so that service.monkey or cert-manager.enabled are printed. A key is sensitive
+// when it ends a segment of several words, such as apiKey or ssh_key, or when it is the key of tls, as in tls.key.
+func isSensitiveValue(name string) bool {
+	previous := ""
+	for _, segment := range strings.Split(name, ".") {
+		words := splitWords(segment)
+		for i, word := range words {
+			word = strings.TrimSuffix(word, "s")
+			if sensitiveValueWords[word] {
+				return true
+			}
+			if word == "key" && i == len(words)-1 && (i > 0 || previous == "tls") {
+				return true
+			}
+		}
+		previous = strings.ToLower(segment)
+	}
+	return false
+}
+
+// splitWords splits a name in lowercase words at the underscores, the dashes and the camelCase boundaries.
+func splitWords(name string) []string {
+	var words []string
+	word := ""
+	for i, r := range name {
+		boundary := r == '_' || r == '-'
+		upper := r >= 'A' && r <= 'Z'
+		if boundary || (upper && i > 0 && isLowerOrDigit(name[i-1])) {
+			if word != "" {
+				words = append(words, word)
+			}
+			word = ""
+		}
+		if !boundary {
+			word += strings.ToLower(string(r))
+		}
+	}
+	if word != "" {
+		words = append(words, word)
+	}
+	return words
+}
+
+func isLowerOrDigit(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9')
+}
+
+// debugValues prints the values passed to helm for the release, masking the sensitive values.
+func (m *Mixin) debugValues(a helmArgs) {
+	if !m.DebugMode {
+		return
+	}
+
+	fmt.Fprintf(m.Err, "DEBUG: resolved values of release %s\n", a.Release)
+	for _, file := range a.Values {
+		fmt.Fprintf(m.Err, "DEBUG:   values file %s\n", file)
+	}
+
+	keys := make([]string, 0, len(a.Set))
+	for k := range a.Set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		value := a.Set[k]
+		if isSensitiveValue(k) {
+			value = "*******"
+		}
+		fmt.Fprintf(m.Err, "DEBUG:   %s=%s\n", k, value)
+	}
+}
+
+// warnSkippedValidation prints a warning when the step disables the validation of the chart,
+// because invalid resources or values are then only detected by the cluster, if at all.
+func (m *Mixin) warnSkippedValidation(a helmArgs) {
+	if a.DisableOpenAPIValidation {
+		fmt.Fprintf(m.Err, "WARNING: the OpenAPI validation of the templates of release %s is disabled\n", a.Release)
+	}
+	if a.SkipSchemaValidation {
+		fmt.Fprintf(m.Err, "WARNING: the JSON schema validation of the values of release %s is skipped\n", a.Release)
+	}
+}
@@ -0,0 +1,291 @@
+package helm3
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildHelmArgs(t *testing.T) {
+	valueTrue := true
+	valueFalse := false
+
+	testcases := []struct {
+		name     string
+		args     helmArgs
+		wantArgs string
+	}{
+		{
+			name:     "install defaults",
+			args:     InstallArguments{ChartArguments: ChartArguments{Name: "mysql", Chart: "stable/mysql"}}.helmArgs(),
+			wantArgs: "upgrade --install mysql stable/mysql --atomic --create-namespace",
+		},
+		{
+			name: "install with every flag",
+			args: InstallArguments{
+				ChartArguments: ChartArguments{
+					Name:             "mysql",
+					Chart:            "stable/mysql",
+					Namespace:        "db",
+					Version:          "1.6.2",
+					Wait:             &valueTrue,
+					Devel:            true,
+					Verify:           true,
+					DependencyUpdate: true,
+					Values:           []string{"a.yaml", "b.yaml"},
+					SkipCrds:         true,
+					NoHooks:          true,
+					Repo:             "https://charts.example.com",
+					Username:         "myuser",
+					Password:         "mypass",
+					Timeout:          "5m",
+					Debug:            &valueTrue,
+					Set:              map[string]string{"b": "2", "a": "1"},
+				},
+			}.helmArgs(),
+			wantArgs: "upgrade --install mysql stable/mysql --namespace db --version 1.6.2 --wait --devel " +
+				"--values a.yaml --values b.yaml --skip-crds --no-hooks --verify --dependency-update " +
+				"--repo https://charts.example.com --username myuser --password mypass --timeout 5m --debug " +
+				"--atomic --create-namespace --set a=1 --set b=2",
+		},
+		{
+			name: "install oci chart with credentials",
+			args: InstallArguments{
+				ChartArguments: ChartArguments{
+					Name:            "mysql",
+					Chart:           "oci://registry.example.com/charts/mysql",
+					Username:        "myuser",
+					Password:        "mypass",
+					PassCredentials: true,
+				},
+			}.helmArgs(),
+			wantArgs: "upgrade --install mysql oci://registry.example.com/charts/mysql --username myuser --password mypass --pass-credentials --atomic --create-namespace",
+		},
+		{
+			name: "install repo without credentials",
+			args: InstallArguments{
+				ChartArguments: ChartArguments{
+					Name:  "mysql",
+					Chart: "mysql",
+					Repo:  "https://charts.example.com",
+				},
+			}.helmArgs(),
+			wantArgs: "upgrade --install mysql mysql --repo https://charts.example.com --atomic --create-namespace",
+		},
+		{
+			name: "upgrade without atomic or create namespace",
+			args: UpgradeArguments{
+				ChartArguments: ChartArguments{
+					Name:            "mysql",
+					Chart:           "stable/mysql",
+					Atomic:          &valueFalse,
+					CreateNamespace: &valueFalse,
+				},
+				ResetValues: true,
+				ReuseValues: true,
+			}.helmArgs(),
+			wantArgs: "upgrade --install mysql stable/mysql --reset-values --reuse-values",
+		},
+		{
+			name: "upgrade matches install",
+			args: UpgradeArguments{
+				ChartArguments: ChartArguments{
+					Name:     "mysql",
+					Chart:    "stable/mysql",
+					Devel:    true,
+					SkipCrds: true,
+					NoHooks:  true,
+				},
+			}.helmArgs(),
+			wantArgs: "upgrade --install mysql stable/mysql --devel --skip-crds --no-hooks --atomic --create-namespace",
+		},
+		{
+			name: "upgrade on another cluster as a service account",
+			args: UpgradeArguments{
+				ChartArguments: ChartArguments{
+					Name:  "mysql",
+					Chart: "stable/mysql",
+					KubeArguments: KubeArguments{
+						KubeContext:   "prod",
+						KubeAPIServer: "https://prod:6443",
+						KubeToken:     "secret-token",
+						KubeAsUser:    "system:serviceaccount:ci:deployer",
+						KubeAsGroup:   []string{"ci", "deployers"},
+						KubeCAFile:    "/cnab/app/ca.crt",
+					},
+				},
+			}.helmArgs(),
+			wantArgs: "upgrade --install mysql stable/mysql --kube-context prod --kube-apiserver https://prod:6443 " +
+				"--kube-as-user system:serviceaccount:ci:deployer --kube-as-group ci --kube-as-group deployers " +
+				"--kube-ca-file /cnab/app/ca.crt --atomic --create-namespace",
+		},
+		{
+			name:     "install with a burst limit",
+			args:     InstallArguments{ChartArguments: ChartArguments{Name: "mysql", Chart: "stable/mysql", Timeout: "5m", BurstLimit: 200, QPS: 50}}.helmArgs(),
+			wantArgs: "upgrade --install mysql stable/mysql --timeout 5m --burst-limit 200 --atomic --create-namespace",
+		},
+		{
+			name:     "upgrade taking ownership of existing resources",
+			args:     UpgradeArguments{ChartArguments: ChartArguments{Name: "mysql", Chart: "stable/mysql", TakeOwnership: true}}.helmArgs(),
+			wantArgs: "upgrade --install mysql stable/mysql --take-ownership --atomic --create-namespace",
+		},
+		{
+			name:     "install with notes options",
+			args:     InstallArguments{ChartArguments: ChartArguments{Name: "mysql", Chart: "stable/mysql", HideNotes: true, RenderSubchartNotes: true}}.helmArgs(),
+			wantArgs: "upgrade --install mysql stable/mysql --hide-notes --render-subchart-notes --atomic --create-namespace",
+		},
+		{
+			name:     "upgrade without validation",
+			args:     UpgradeArguments{ChartArguments: ChartArguments{Name: "mysql", Chart: "stable/mysql", DisableOpenAPIValidation: true, SkipSchemaValidation: true}}.helmArgs(),
+			wantArgs: "upgrade --install mysql stable/mysql --disable-openapi-validation --skip-schema-validation --atomic --create-namespace",
+		},
+		{
+			name:     "install with DNS lookups",
+			args:     InstallArguments{ChartArguments: ChartArguments{Name: "mysql", Chart: "stable/mysql", EnableDNS: true}}.helmArgs(),
+			wantArgs: "upgrade --install mysql stable/mysql --enable-dns --atomic --create-namespace",
+		},
+		{
+			name: "install with helm v4",
+			args: func() helmArgs {
+				a := InstallArguments{ChartArguments: ChartArguments{Name: "mysql", Chart: "stable/mysql"}}.helmArgs()
+				a.ClientMajorVersion = 4
+				return a
+			}(),
+			wantArgs: "upgrade --install mysql stable/mysql --rollback-on-failure --create-namespace",
+		},
+		{
+			name:     "uninstall defaults",
+			args:     UninstallArguments{}.helmArgs("mysql"),
+			wantArgs: "uninstall mysql",
+		},
+		{
+			name: "uninstall with every flag",
+			args: UninstallArguments{
+				Namespace: "db",
+				Wait:      &valueTrue,
+				NoHooks:   true,
+				Timeout:   "5m",
+				Debug:     &valueTrue,
+			}.helmArgs("mysql"),
+			wantArgs: "uninstall mysql --namespace db --wait --no-hooks --timeout 5m --debug",
+		},
+		{
+			name:     "install with a release namespace",
+			args:     InstallArguments{ChartArguments: ChartArguments{Name: "crds", Chart: "./charts/crds", ReleaseNamespace: "releases"}}.helmArgs(),
+			wantArgs: "upgrade --install crds ./charts/crds --namespace releases --atomic --create-namespace",
+		},
+		{
+			name:     "uninstall with a release namespace",
+			args:     UninstallArguments{ReleaseNamespace: "releases"}.helmArgs("crds"),
+			wantArgs: "uninstall crds --namespace releases",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			gotArgs := buildHelmArgs(tc.args)
+			assert.Equal(t, tc.wantArgs, strings.Join(gotArgs, " "))
+		})
+	}
+}
+
+func TestMaskCredentials(t *testing.T) {
+	args := []string{"helm3", "pull", "mysql", "--repo", "https://charts.example.com", "--username", "myuser", "--password", "mypass", "--password=other"}
+
+	assert.Equal(t, "helm3 pull mysql --repo https://charts.example.com --username ******* --password ******* --password=*******",
+		strings.Join(maskCredentials(args), " "))
+
+	args = []string{"helm3", "upgrade", "--install", "mysql", "stable/mysql", "--set", "auth.rootPassword=topsecret", "--set", "auth.database=wordpress"}
+	assert.Equal(t, "helm3 upgrade --install mysql stable/mysql --set auth.rootPassword=******* --set auth.database=wordpress",
+		strings.Join(maskCredentials(args), " "))
+}
+
+func TestIsSensitiveValue(t *testing.T) {
+	for _, name := range []string{
+		"password", "auth.rootPassword", "mysqlPassword", "auth.apiToken", "REGISTRY_PASSWORD", "existingSecret",
+		"aws.secretAccessKey", "apiKey", "privateKey", "ssh_key", "signing-key", "tls.key", "credentials.json",
+	} {
+		assert.True(t, isSensitiveValue(name), name)
+	}
+	for _, name := range []string{
+		"service.monkey", "keyspace", "cert-manager.enabled", "ingress.tls.certResolver", "nodeAffinity.key",
+		"auth.database", "tls.crt", "key", "primary.keyRotation",
+	} {
+		assert.False(t, isSensitiveValue(name), name)
+	}
+}
+
+func TestBuildHelmEnv(t *testing.T) {
+	testcases := []struct {
+		name      string
+		args      helmArgs
+		wantEnv   []string
+		wantError string
+	}{
+		{
+			name:    "default storage driver",
+			args:    InstallArguments{}.helmArgs(),
+			wantEnv: nil,
+		},
+		{
+			name:    "configmap storage driver",
+			args:    UpgradeArguments{ChartArguments: ChartArguments{StorageDriver: "configmap"}}.helmArgs(),
+			wantEnv: []string{"HELM_DRIVER=configmap"},
+		},
+		{
+			name:    "sql storage driver",
+			args:    UninstallArguments{StorageDriver: "sql", SQLConnectionString: "postgresql://helm@db/helm"}.helmArgs("mysql"),
+			wantEnv: []string{"HELM_DRIVER=sql", "HELM_DRIVER_SQL_CONNECTION_STRING=postgresql://helm@db/helm"},
+		},
+		{
+			name: "step environment variables",
+			args: InstallArguments{
+				ChartArguments: ChartArguments{
+					StorageDriver: "secret",
+					Env:           map[string]string{"HTTPS_PROXY": "http://proxy:3128", "HELM_CACHE_HOME": "/tmp/helm"},
+				},
+			}.helmArgs(),
+			wantEnv: []string{"HELM_CACHE_HOME=/tmp/helm", "HTTPS_PROXY=http://proxy:3128", "HELM_DRIVER=secret"},
+		},
+		{
+			name:    "kube token",
+			args:    UninstallArguments{KubeArguments: KubeArguments{KubeToken: "secret-token"}}.helmArgs("mysql"),
+			wantEnv: []string{"HELM_KUBETOKEN=secret-token"},
+		},
+		{
+			name:      "sql storage driver without a connection string",
+			args:      InstallArguments{ChartArguments: ChartArguments{StorageDriver: "sql"}}.helmArgs(),
+			wantError: "sqlConnectionString is required when the storageDriver is sql",
+		},
+		{
+			name:      "unsupported storage driver",
+			args:      InstallArguments{ChartArguments: ChartArguments{StorageDriver: "etcd"}}.helmArgs(),
+			wantError: `unsupported storageDriver "etcd"`,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			gotEnv, err := buildHelmEnv(tc.args)
+			if tc.wantError != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.wantError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantEnv, gotEnv)
+		})
+	}
+}
+
+func TestMixin_WarnSkippedValidation(t *testing.T) {
+	h := NewTestMixin(t)
+	h.warnSkippedValidation(helmArgs{Release: "mysql"})
+	assert.Empty(t, h.TestContext.GetError())
+
+	h.warnSkippedValidation(helmArgs{Release: "mysql", DisableOpenAPIValidation: true, SkipSchemaValidation: true})
+	assert.Equal(t, "WARNING: the OpenAPI validation of the templates of release mysql is disabled\n"+
+		"WARNING: the JSON schema validation of the values of release mysql is skipped\n", h.TestContext.GetError())
+}
@@ -0,0 +1,140 @@
+package helm3
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// declaredReleasesEnv hands the releases declared by the steps of the bundle over to the invocation image,
+// it is set by Build when the bundle has a gc step
+const declaredReleasesEnv = "HELM3_MIXIN_DECLARED_RELEASES"
+
+// GCArguments are the arguments of the gc command
+type GCArguments struct {
+	// Keep are the releases that are kept in addition to the releases declared by the bundle, as NAME in any
+	// namespace or NAMESPACE/NAME, for example the releases whose name is a template
+	Keep []string `yaml:"keep,omitempty"`
+
+	// DryRun only prints the releases that would be uninstalled
+	DryRun  bool   `yaml:"dryRun,omitempty"`
+	Wait    *bool  `yaml:"wait,omitempty"`
+	Timeout string `yaml:"timeout,omitempty"`
+
+	// Output is the name of an output that is set to the names of the uninstalled releases, one per line
+	Output string `yaml:"output,omitempty"`
+}
+
+// ownedRelease is a release listed by helm list
+type ownedRelease struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Chart     string `json:"chart"`
+}
+
+// isTemplate returns true when a value of a step is a template of porter, only known at runtime.
+func isTemplate(value string) bool {
+	return strings.Contains(value, "${") || strings.Contains(value, "{{")
+}
+
+// declaredReleases returns the releases installed or upgraded by the steps of the bundle, when it has a gc step,
+// as NAMESPACE/NAME, or NAME when the namespace of the release is only known at runtime. The releases whose name is
+// a template are only known at runtime, they are not declared.
+func (input BuildInput) declaredReleases() ([]string, bool) {
+	hasGC := false
+	names := map[string]bool{}
+	for _, steps := range input.Actions {
+		for _, step := range steps {
+			if step.Helm3.GC != nil {
+				hasGC = true
+			}
+			for _, release := range step.releases() {
+				if release.Name == "" || release.Chart == "" || isTemplate(release.Name) {
+					continue
+				}
+				// helm stores the release in its release namespace
+				namespace := releaseNamespace(release.Namespace, release.ReleaseNamespace)
+				if namespace == "" {
+					namespace = input.Config.DefaultNamespace
+				}
+				if namespace == "" || isTemplate(namespace) {
+					names[release.Name] = true
+				} else {
+					names[namespace+"/"+release.Name] = true
+				}
+			}
+		}
+	}
+	if !hasGC {
+		return nil, false
+	}
+
+	releases := make([]string, 0, len(names))
+	for name := range names {
+		releases = append(releases, name)
+	}
+	sort.Strings(releases)
+	return releases, true
+}
+
+// collectGarbage uninstalls the releases owned by the installation that the bundle no longer declares,
+// for example after an upgrade of the bundle dropped a chart.
+func (m *Mixin) collectGarbage(ctx context.Context, a GCArguments) error {
+	keep := map[string]bool{}
+	for _, name := range append(strings.Split(m.Getenv(declaredReleasesEnv), ","), a.Keep...) {
+		if name != "" {
+			keep[name] = true
+		}
+	}
+	if len(keep) == 0 {
+		// every owned release would be uninstalled, it is more likely that the invocation image was built without them
+		return errors.New("gc does not know the releases declared by the bundle, rebuild the bundle or set keep")
+	}
+
+	out, err := m.ownedReleases(ctx, ListArguments{AllNamespaces: true})
+	if err != nil {
+		return err
+	}
+	var releases []ownedRelease
+	err = json.Unmarshal(out, &releases)
+	if err != nil {
+		return errors.Wrap(err, "could not parse the releases of the installation")
+	}
+
+	var uninstalled []string
+	for _, release := range releases {
+		if keep[release.Name] || keep[release.Namespace+"/"+release.Name] {
+			continue
+		}
+
+		if a.DryRun {
+			fmt.Fprintf(m.Out, "Release %s/%s (%s) is no longer declared by the bundle and would be uninstalled\n", release.Namespace, release.Name, release.Chart)
+			continue
+		}
+		fmt.Fprintf(m.Out, "Uninstalling release %s/%s (%s), it is no longer declared by the bundle\n", release.Namespace, release.Name, release.Chart)
+		args := m.applyDefaults(helmArgs{
+			Command:   []string{"uninstall"},
+			Release:   release.Name,
+			Namespace: release.Namespace,
+			Wait:      a.Wait,
+			Timeout:   a.Timeout,
+		})
+		err = m.runHelm(ctx, buildHelmArgs(args), nil)
+		if err != nil {
+			return errors.Wrapf(err, "could not uninstall release %s", release.Name)
+		}
+		uninstalled = append(uninstalled, release.Name)
+	}
+
+	if a.Output != "" {
+		err = m.WriteMixinOutputToFile(a.Output, []byte(strings.Join(uninstalled, "\n")))
+		if err != nil {
+			return errors.Wrapf(err, "unable to write output '%s'", a.Output)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package helm3
+
+import (
+	"context"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"get.porter.sh/porter/pkg/portercontext"
+	"get.porter.sh/porter/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestBuildInput_DeclaredReleases(t *testing.T) {
+	var input BuildInput
+	err := yaml.Unmarshal([]byte(`
+actions:
+  install:
+  - helm3:
+      name: mysql
+      chart: bitnami/mysql
+  - helm3:
+      name: "{{ bundle.parameters.release }}"
+      chart: bitnami/redis
+  - helm3:
+      name: "${ bundle.installation.name }-db"
+      chart: bitnami/postgresql
+  - helm3:
+      name: cache
+      namespace: "${ bundle.parameters.namespace }"
+      chart: bitnami/redis
+  upgrade:
+  - helm3:
+      name: mysql
+      chart: bitnami/mysql
+  - helm3:
+      name: web
+      namespace: frontend
+      chart: ./charts/web
+  - helm3:
+      name: api
+      namespace: backend
+      releaseNamespace: releases
+      chart: ./charts/api
+  - helm3:
+      chart: bitnami/keycloak
+      namespace: auth
+      releases:
+      - name: keycloak
+      - name: postgresql
+        chart: bitnami/postgresql
+  gc:
+  - helm3:
+      gc: {}
+`), &input)
+	require.NoError(t, err)
+
+	releases, ok := input.declaredReleases()
+	require.True(t, ok)
+	assert.Equal(t, []string{"auth/keycloak", "auth/postgresql", "cache", "frontend/web", "mysql", "releases/api"}, releases)
+
+	input.Config.DefaultNamespace = "myapp"
+	releases, _ = input.declaredReleases()
+	assert.Equal(t, []string{"auth/keycloak", "auth/postgresql", "cache", "frontend/web", "myapp/mysql", "releases/api"}, releases)
+
+	delete(input.Actions, "gc")
+	_, ok = input.declaredReleases()
+	assert.False(t, ok, "the releases should only be recorded when the bundle has a gc step")
+}
+
+func TestMixin_GC(t *testing.T) {
+	ctx := context.Background()
+	wait := true
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	os.Setenv(test.ExpectedCommandEnv, strings.Join([]string{
+		"helm3 list --all --output json --selector porter.sh/installation=myapp --all-namespaces",
+		"helm3 uninstall cache --namespace myapp --wait --timeout 5m",
+		"helm3 uninstall mysql --namespace legacy --wait --timeout 5m",
+	}, "\n"))
+	defer os.Unsetenv(test.ExpectedCommandOutputEnv)
+	os.Setenv(test.ExpectedCommandOutputEnv, `[{"name":"mysql","namespace":"myapp","chart":"mysql-9.4.1"},{"name":"mysql","namespace":"legacy","chart":"mysql-9.4.1"},`+
+		`{"name":"cache","namespace":"myapp","chart":"redis-17.3.7"},{"name":"myapp-web","namespace":"myapp","chart":"web-1.0.0"}]`)
+
+	h := NewTestMixin(t)
+	h.Setenv(installationNameEnv, "myapp")
+	h.Setenv(declaredReleasesEnv, "myapp/mysql")
+
+	err := h.runCommand(ctx, Commands{GC: &GCArguments{Keep: []string{"myapp-web"}, Wait: &wait, Timeout: "5m", Output: "uninstalled"}})
+	require.NoError(t, err)
+	assert.Contains(t, h.TestContext.GetOutput(), "Uninstalling release myapp/cache (redis-17.3.7), it is no longer declared by the bundle")
+
+	uninstalled, err := h.FileSystem.ReadFile(path.Join(portercontext.MixinOutputsDir, "uninstalled"))
+	require.NoError(t, err)
+	assert.Equal(t, "mysql\ncache", string(uninstalled))
+}
+
+func TestMixin_GCRequiresDeclaredReleases(t *testing.T) {
+	h := NewTestMixin(t)
+	h.Setenv(installationNameEnv, "myapp")
+
+	err := h.runCommand(context.Background(), Commands{GC: &GCArguments{}})
+	require.EqualError(t, err, "gc does not know the releases declared by the bundle, rebuild the bundle or set keep")
+}
@@ -0,0 +1,78 @@
+package helm3
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	k8s "k8s.io/client-go/kubernetes"
+)
+
+// heartbeatIntervalEnv hands the heartbeatInterval of the mixin configuration over to the invocation image
+const heartbeatIntervalEnv = "HELM3_MIXIN_HEARTBEAT_INTERVAL"
+
+// defaultHeartbeatInterval is used when the mixin configuration does not set heartbeatInterval
+const defaultHeartbeatInterval = time.Minute
+
+// heartbeatInterval returns how often a heartbeat is printed while helm waits for a release, zero disables it.
+func (m *Mixin) heartbeatInterval() time.Duration {
+	interval, err := time.ParseDuration(m.Getenv(heartbeatIntervalEnv))
+	if err != nil {
+		return defaultHeartbeatInterval
+	}
+	return interval
+}
+
+// startHeartbeat periodically prints the elapsed time and the pods of the release that are not ready
+// while helm waits for the release, so that CI systems don't kill a long --wait for inactivity.
+// The returned function stops the heartbeat.
+func (m *Mixin) startHeartbeat(ctx context.Context, kubeClient k8s.Interface, a helmArgs) func() {
+	interval := m.heartbeatInterval()
+	if !isTrue(a.Wait) || interval <= 0 {
+		return func() {}
+	}
+	if kubeClient == nil {
+		// the summary of the pods is best effort, the heartbeat is still printed without a client
+		if client, err := m.getKubernetesClient(a); err == nil {
+			kubeClient = client
+		}
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		start := time.Now()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				m.printHeartbeat(ctx, kubeClient, a, time.Since(start))
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// printHeartbeat prints a heartbeat line to the mixin's error output. The pods that are not ready are only
+// listed when the mixin has a Kubernetes client, errors listing them are ignored.
+func (m *Mixin) printHeartbeat(ctx context.Context, kubeClient k8s.Interface, a helmArgs, elapsed time.Duration) {
+	line := fmt.Sprintf("Waiting for release %s, %s elapsed", a.Release, elapsed.Round(time.Second))
+	if kubeClient != nil {
+		pods, err := m.getNotReadyPods(ctx, kubeClient, a)
+		if err == nil && len(pods) > 0 {
+			line += fmt.Sprintf(", not ready: %s", strings.Join(pods, ", "))
+		}
+	}
+	fmt.Fprintln(m.Err, line)
+}
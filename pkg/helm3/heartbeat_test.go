@@ -0,0 +1,60 @@
+package helm3
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestMixin_HeartbeatInterval(t *testing.T) {
+	h := NewTestMixin(t)
+	assert.Equal(t, defaultHeartbeatInterval, h.heartbeatInterval())
+
+	h.Setenv(heartbeatIntervalEnv, "30s")
+	assert.Equal(t, 30*time.Second, h.heartbeatInterval())
+
+	h.Setenv(heartbeatIntervalEnv, "0")
+	assert.Equal(t, time.Duration(0), h.heartbeatInterval())
+}
+
+func TestMixin_PrintHeartbeat(t *testing.T) {
+	ctx := context.Background()
+	client := testclient.NewSimpleClientset(
+		testPod("mysql-0", corev1.PodRunning, corev1.ConditionTrue),
+		testPod("mysql-1", corev1.PodPending, corev1.ConditionFalse),
+	)
+
+	h := NewTestMixin(t)
+	h.printHeartbeat(ctx, client, helmArgs{Release: "mysql", Namespace: "mydb"}, 90*time.Second)
+	h.printHeartbeat(ctx, nil, helmArgs{Release: "mysql", Namespace: "mydb"}, 2*time.Minute)
+
+	assert.Equal(t, "Waiting for release mysql, 1m30s elapsed, not ready: mysql-1\n"+
+		"Waiting for release mysql, 2m0s elapsed\n", h.TestContext.GetError())
+}
+
+func TestMixin_StartHeartbeat(t *testing.T) {
+	ctx := context.Background()
+	wait := true
+
+	t.Run("prints while waiting", func(t *testing.T) {
+		h := NewTestMixin(t)
+		h.Setenv(heartbeatIntervalEnv, "10ms")
+		stop := h.startHeartbeat(ctx, nil, helmArgs{Release: "mysql", Wait: &wait})
+		time.Sleep(50 * time.Millisecond)
+		stop()
+		assert.Contains(t, h.TestContext.GetError(), "Waiting for release mysql")
+	})
+
+	t.Run("disabled without wait", func(t *testing.T) {
+		h := NewTestMixin(t)
+		h.Setenv(heartbeatIntervalEnv, "10ms")
+		stop := h.startHeartbeat(ctx, nil, helmArgs{Release: "mysql"})
+		time.Sleep(50 * time.Millisecond)
+		stop()
+		assert.Empty(t, h.TestContext.GetError())
+	})
+}
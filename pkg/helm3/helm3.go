@@ -17,6 +17,9 @@ const defaultClientVersion string = "v3.8.2"
 const defaultClientPlatform string = "linux"
 const defaultClientArchitecture string = "amd64"
 
+// defaultAPIVersion is the version of kubectl installed in the invocation image
+const defaultAPIVersion string = "v1.22.1"
+
 // Helm is the logic behind the helm mixin
 type Mixin struct {
 	runtime.RuntimeConfig
@@ -24,6 +27,12 @@ type Mixin struct {
 	HelmClientVersion      string
 	HelmClientPlatform     string
 	HelmClientArchitecture string
+
+	// APIVersion is the version of kubectl installed in the invocation image
+	APIVersion string
+
+	// OutputFormat of the logs written by the install, upgrade and uninstall commands: text or json
+	OutputFormat string
 }
 
 // New helm mixin client, initialized with useful defaults.
@@ -34,6 +43,7 @@ func New() *Mixin {
 		HelmClientVersion:      defaultClientVersion,
 		HelmClientPlatform:     defaultClientPlatform,
 		HelmClientArchitecture: defaultClientArchitecture,
+		APIVersion:             defaultAPIVersion,
 	}
 }
 
@@ -80,6 +90,26 @@ func (m *Mixin) ValidatePayload(b []byte) error {
 	return nil
 }
 
-func (m *Mixin) getKubernetesClient() (k8s.Interface, error) {
-	return m.ClientFactory.GetClient()
+// getKubernetesClient returns the Kubernetes client of the mixin, for the cluster that the kube arguments of the
+// step select, like helm.
+func (m *Mixin) getKubernetesClient(a helmArgs) (k8s.Interface, error) {
+	return m.ClientFactory.GetClient(kubernetes.ClientOptions{
+		QPS:       a.QPS,
+		Burst:     a.BurstLimit,
+		Context:   a.KubeContext,
+		APIServer: a.KubeAPIServer,
+		Token:     a.KubeToken,
+		AsUser:    a.KubeAsUser,
+		AsGroups:  a.KubeAsGroup,
+		CAFile:    a.KubeCAFile,
+	})
+}
+
+// getOutputsClient returns the Kubernetes client used to collect the outputs of a step. It is nil when the step
+// has no outputs, so that steps that only need helm don't require a kubeconfig.
+func (m *Mixin) getOutputsClient(a helmArgs, outputs []HelmOutput) (k8s.Interface, error) {
+	if len(outputs) == 0 {
+		return nil, nil
+	}
+	return m.getKubernetesClient(a)
 }
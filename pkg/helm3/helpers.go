@@ -1,9 +1,11 @@
 package helm3
 
 import (
+	"errors"
 	"testing"
 
 	"get.porter.sh/porter/pkg/portercontext"
+	k8s "github.com/MChorfa/porter-helm3/pkg/kubernetes"
 	"k8s.io/client-go/kubernetes"
 	testclient "k8s.io/client-go/kubernetes/fake"
 )
@@ -18,10 +20,30 @@ type TestMixin struct {
 type testKubernetesFactory struct {
 }
 
-func (t *testKubernetesFactory) GetClient() (kubernetes.Interface, error) {
+func (t *testKubernetesFactory) GetClient(opts k8s.ClientOptions) (kubernetes.Interface, error) {
 	return testclient.NewSimpleClientset(), nil
 }
 
+// failingKubernetesFactory fails to create a client, like when the bundle doesn't have a kubeconfig.
+type failingKubernetesFactory struct {
+}
+
+func (t *failingKubernetesFactory) GetClient(opts k8s.ClientOptions) (kubernetes.Interface, error) {
+	return nil, errors.New("couldn't build kubernetes config")
+}
+
+// clientKubernetesFactory always returns the same client, so that the tests can check the objects it changed,
+// and the options that it was requested with.
+type clientKubernetesFactory struct {
+	client kubernetes.Interface
+	opts   k8s.ClientOptions
+}
+
+func (t *clientKubernetesFactory) GetClient(opts k8s.ClientOptions) (kubernetes.Interface, error) {
+	t.opts = opts
+	return t.client, nil
+}
+
 // NewTestMixin initializes a mixin test client, with the output buffered, and an in-memory file system.
 func NewTestMixin(t *testing.T) *TestMixin {
 	c := portercontext.NewTestContext(t)
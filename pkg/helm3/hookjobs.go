@@ -0,0 +1,121 @@
+package helm3
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8s "k8s.io/client-go/kubernetes"
+)
+
+// hookResource is the part of a hook manifest, from helm get hooks, that identifies the resource
+type hookResource struct {
+	Kind     string `yaml:"kind"`
+	Metadata struct {
+		Name      string `yaml:"name"`
+		Namespace string `yaml:"namespace"`
+	} `yaml:"metadata"`
+}
+
+// deleteHookJobs deletes the completed and failed Jobs of the hooks of the release before it is installed or upgraded,
+// because the Job left by a previous run of a chart without a hook-delete-policy fails the run with "job already exists".
+// Jobs that are still running are kept. Nothing is deleted when the release does not exist yet.
+func (m *Mixin) deleteHookJobs(ctx context.Context, kubeClient k8s.Interface, a helmArgs, env []string) error {
+	exists, err := m.releaseExists(ctx, a, env)
+	if err != nil || !exists {
+		return err
+	}
+
+	// the hooks are not printed, they can contain the secrets of the release
+	hooks, err := m.getReleaseData(ctx, []string{"get", "hooks"}, "hooks", a, env)
+	if err != nil {
+		return err
+	}
+	jobs, err := hookJobs(hooks, a.Namespace)
+	if err != nil {
+		return errors.Wrapf(err, "could not parse the hooks of release %s", a.Release)
+	}
+	if len(jobs) == 0 {
+		return nil
+	}
+
+	if kubeClient == nil {
+		kubeClient, err = m.getKubernetesClient(a)
+		if err != nil {
+			return errors.Wrap(err, "couldn't get kubernetes client")
+		}
+	}
+	for _, job := range jobs {
+		err = m.deleteFinishedJob(ctx, kubeClient, job.Metadata.Namespace, job.Metadata.Name, a.Release)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hookJobs returns the Jobs of the hook manifests, in the namespace of the release when the manifest doesn't set one.
+func hookJobs(hooks []byte, namespace string) ([]hookResource, error) {
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	var jobs []hookResource
+	decoder := yaml.NewDecoder(bytes.NewReader(hooks))
+	for {
+		var hook hookResource
+		err := decoder.Decode(&hook)
+		if err == io.EOF {
+			return jobs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hook.Kind != "Job" || hook.Metadata.Name == "" {
+			continue
+		}
+		if hook.Metadata.Namespace == "" {
+			hook.Metadata.Namespace = namespace
+		}
+		jobs = append(jobs, hook)
+	}
+}
+
+// deleteFinishedJob deletes a Job, and its pods, when it completed or failed.
+func (m *Mixin) deleteFinishedJob(ctx context.Context, kubeClient k8s.Interface, namespace, name, release string) error {
+	job, err := kubeClient.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "could not get hook job %s/%s of release %s", namespace, name, release)
+	}
+	if !isJobFinished(job) {
+		return nil
+	}
+
+	fmt.Fprintf(m.Err, "Deleting hook job %s/%s left by a previous run of release %s\n", namespace, name, release)
+	propagation := metav1.DeletePropagationBackground
+	err = kubeClient.BatchV1().Jobs(namespace).Delete(ctx, name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "could not delete hook job %s/%s of release %s", namespace, name, release)
+	}
+	return nil
+}
+
+// isJobFinished returns true when the Job completed or failed.
+func isJobFinished(job *batchv1.Job) bool {
+	for _, c := range job.Status.Conditions {
+		if (c.Type == batchv1.JobComplete || c.Type == batchv1.JobFailed) && c.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package helm3
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"get.porter.sh/porter/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+const testHooks = `---
+# Source: mysql/templates/migrate-job.yaml
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: mysql-migrate
+  annotations:
+    "helm.sh/hook": pre-upgrade
+---
+# Source: mysql/templates/backup-job.yaml
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: mysql-backup
+  namespace: backups
+  annotations:
+    "helm.sh/hook": pre-upgrade
+---
+# Source: mysql/templates/test-job.yaml
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: mysql-test
+  annotations:
+    "helm.sh/hook": test
+---
+# Source: mysql/templates/hook-config.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: mysql-hook-config
+  annotations:
+    "helm.sh/hook": pre-upgrade
+`
+
+func TestMixin_DeleteHookJobs(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	defer os.Unsetenv(test.ExpectedCommandOutputEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 status mysql --namespace mydb\nhelm3 get hooks mysql --namespace mydb")
+	os.Setenv(test.ExpectedCommandOutputEnv, testHooks)
+
+	newJob := func(name, namespace string, condition batchv1.JobConditionType) *batchv1.Job {
+		job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+		if condition != "" {
+			job.Status.Conditions = []batchv1.JobCondition{{Type: condition, Status: corev1.ConditionTrue}}
+		}
+		return job
+	}
+	client := testclient.NewSimpleClientset(
+		newJob("mysql-migrate", "mydb", batchv1.JobComplete),
+		newJob("mysql-backup", "backups", batchv1.JobFailed),
+		newJob("mysql-test", "mydb", ""),
+		newJob("other-job", "mydb", batchv1.JobComplete),
+	)
+
+	m := NewTestMixin(t)
+	err := m.deleteHookJobs(ctx, client, helmArgs{Release: "mysql", Namespace: "mydb"}, nil)
+	require.NoError(t, err)
+
+	_, err = client.BatchV1().Jobs("mydb").Get(ctx, "mysql-migrate", metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err), "the completed hook job should be deleted")
+	_, err = client.BatchV1().Jobs("backups").Get(ctx, "mysql-backup", metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err), "the failed hook job should be deleted from the namespace of its manifest")
+	_, err = client.BatchV1().Jobs("mydb").Get(ctx, "mysql-test", metav1.GetOptions{})
+	assert.NoError(t, err, "the running hook job should be kept")
+	_, err = client.BatchV1().Jobs("mydb").Get(ctx, "other-job", metav1.GetOptions{})
+	assert.NoError(t, err, "the jobs that are not hooks of the release should be kept")
+
+	gotErr := m.TestContext.GetError()
+	assert.Contains(t, gotErr, "Deleting hook job mydb/mysql-migrate left by a previous run of release mysql")
+	assert.Contains(t, gotErr, "Deleting hook job backups/mysql-backup left by a previous run of release mysql")
+}
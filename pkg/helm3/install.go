@@ -2,11 +2,9 @@ package helm3
 
 import (
 	"context"
-	"fmt"
 	"os/exec"
-	"sort"
-	"strings"
 
+	"get.porter.sh/porter/pkg/tracing"
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
 )
@@ -20,39 +18,23 @@ type InstallStep struct {
 }
 
 type InstallArguments struct {
-	Step `yaml:",inline"`
+	Step           `yaml:",inline"`
+	ChartArguments `yaml:",inline"`
 
-	Namespace       string            `yaml:"namespace"`
-	Name            string            `yaml:"name"`
-	Chart           string            `yaml:"chart"`
-	Devel           bool              `yaml:"devel"`
-	NoHooks         bool              `yaml:"noHooks"`
-	Repo            string            `yaml:"repo"`
-	Set             map[string]string `yaml:"set"`
-	SkipCrds        bool              `yaml:"skipCrds"`
-	Password        string            `yaml:"password"`
-	Username        string            `yaml:"username"`
-	Values          []string          `yaml:"values"`
-	Version         string            `yaml:"version"`
-	Wait            bool              `yaml:"wait"`
-	Timeout         string            `yaml:"timeout"`
-	Debug           bool              `yaml:"debug"`
-	Atomic          *bool             `yaml:"atomic,omitempty"`
-	CreateNamespace *bool             `yaml:"createNamespace,omitempty"`
+	// SkipIfExists skips installing the release when it already exists, the outputs are still collected
+	SkipIfExists bool `yaml:"skipIfExists,omitempty"`
 }
 
 func (m *Mixin) Install(ctx context.Context) error {
 
+	ctx, log := tracing.StartSpan(ctx)
+	defer log.EndSpan()
+
 	payload, err := m.getPayloadData()
 	if err != nil {
 		return err
 	}
 
-	kubeClient, err := m.getKubernetesClient()
-	if err != nil {
-		return errors.Wrap(err, "couldn't get kubernetes client")
-	}
-
 	var action InstallAction
 	err = yaml.Unmarshal(payload, &action)
 	if err != nil {
@@ -62,98 +44,59 @@ func (m *Mixin) Install(ctx context.Context) error {
 		return errors.Errorf("expected a single step, but got %d", len(action.Steps))
 	}
 	step := action.Steps[0]
-
-	cmd := m.NewCommand(ctx, "helm3")
-
-	cmd.Args = append(cmd.Args, "upgrade", "--install", step.Name, step.Chart)
-
-	if step.Namespace != "" {
-		cmd.Args = append(cmd.Args, "--namespace", step.Namespace)
-	}
-
-	if step.Version != "" {
-		cmd.Args = append(cmd.Args, "--version", step.Version)
-	}
-
-	if step.Wait {
-		cmd.Args = append(cmd.Args, "--wait")
-	}
-
-	if step.Devel {
-		cmd.Args = append(cmd.Args, "--devel")
-	}
-
-	for _, v := range step.Values {
-		cmd.Args = append(cmd.Args, "--values", v)
-	}
-
-	if step.SkipCrds {
-		cmd.Args = append(cmd.Args, "--skip-crds")
-	}
-
-	if step.NoHooks {
-		cmd.Args = append(cmd.Args, "--no-hooks")
-	}
-
-	if step.Repo != "" && step.Username != "" && step.Password != "" {
-		cmd.Args = append(cmd.Args, "--repo", step.Repo, "--username", step.Username, "--password", step.Password)
-	}
-
-	if step.Timeout != "" {
-		cmd.Args = append(cmd.Args, "--timeout", step.Timeout)
+	ctx = withStep(ctx, step.Step)
+	if skip, err := m.skipCondition(step.Step); err != nil || skip {
+		return err
 	}
-
-	if step.Debug {
-		cmd.Args = append(cmd.Args, "--debug")
+	if step.hasCommand() {
+		return m.runCommand(ctx, step.Commands)
 	}
-
-	if step.Atomic == nil || *step.Atomic {
-		// This will ensure the installation process deletes the installation on failure.
-		cmd.Args = append(cmd.Args, "--atomic")
+	if err := m.verifyClientVersion(ctx); err != nil {
+		return err
 	}
-
-	if step.CreateNamespace == nil || *step.CreateNamespace {
-		// This will ensure the creation of the release namespace if not present.
-		cmd.Args = append(cmd.Args, "--create-namespace")
+	if len(step.Releases) == 0 {
+		if len(step.DependsOn) > 0 {
+			return errors.New("dependsOn can only be set on the releases of a step")
+		}
+		return m.timed(step.Step, "install", step.Name, step.Chart, func() error {
+			return m.installRelease(ctx, step.InstallArguments)
+		})
 	}
 
-	// Set values
-	cmd.Args = HandleSettingChartValuesForInstall(step, cmd)
-
-	cmd.Stdout = m.Out
-	cmd.Stderr = m.Err
-
-	// format the command with all arguments
-	prettyCmd := fmt.Sprintf("%s %s", cmd.Path, strings.Join(cmd.Args, " "))
-	fmt.Fprintln(m.Out, prettyCmd)
-
-	// Here where really the command get executed
-	err = cmd.Start()
-	// Exit on error
-	if err != nil {
-		return fmt.Errorf("could not execute command, %s: %s", prettyCmd, err)
-	}
-	err = cmd.Wait()
-	// Exit on error
+	releases, err := step.releases()
 	if err != nil {
 		return err
 	}
-	err = m.handleOutputs(ctx, kubeClient, step.Namespace, step.Outputs)
-	return err
+	runs := make([]stepRelease, len(releases))
+	for i, release := range releases {
+		release := release
+		args := m.applyDefaults(release.helmArgs())
+		runs[i] = stepRelease{
+			Name:         release.Name,
+			DependsOn:    release.DependsOn,
+			Step:         release.Step,
+			Mode:         release.Mode,
+			WaitStrategy: release.WaitStrategy,
+			Args:         args,
+			run: func(ctx context.Context) error {
+				return m.timed(release.Step, "install", release.Name, release.Chart, func() error {
+					return m.installRelease(ctx, release)
+				})
+			},
+		}
+	}
+	return m.runReleases(ctx, "Installing", runs)
+}
+
+// installRelease runs the step for a single release.
+func (m *Mixin) installRelease(ctx context.Context, step InstallArguments) error {
+	return m.runRelease(ctx, step.Step, step.ChartArguments, step.helmArgs(), releaseHooks{
+		releaseOptions: map[string]bool{"skipIfExists": step.SkipIfExists},
+		skipIfExists:   step.SkipIfExists,
+	})
 }
 
 // Prepare set arguments
 func HandleSettingChartValuesForInstall(step InstallStep, cmd *exec.Cmd) []string {
-	// sort the set consistently
-	setKeys := make([]string, 0, len(step.Set))
-	for k := range step.Set {
-
-		setKeys = append(setKeys, k)
-	}
-	sort.Strings(setKeys)
-
-	for _, k := range setKeys {
-		cmd.Args = append(cmd.Args, "--set", fmt.Sprintf("%s=%s", k, step.Set[k]))
-	}
-	return cmd.Args
+	return appendSetFlags(cmd.Args, step.Set)
 }
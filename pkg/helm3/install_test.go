@@ -3,9 +3,14 @@ package helm3
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path"
+	"strings"
 	"testing"
 
 	"get.porter.sh/porter/pkg/test"
@@ -37,8 +42,8 @@ func TestMixin_UnmarshalInstallStep(t *testing.T) {
 
 	assert.Equal(t, "Install MySQL", step.Description)
 	assert.NotEmpty(t, step.Outputs)
-	assert.Equal(t, HelmOutput{"mysql-root-password", "porter-ci-mysql", "mysql-root-password", "", "", "", ""}, step.Outputs[0])
-	assert.Equal(t, HelmOutput{"mysql-cluster-ip", "", "", "service", "porter-ci-mysql-service", "default", "{.spec.clusterIP}"}, step.Outputs[2])
+	assert.Equal(t, HelmOutput{Name: "mysql-root-password", Secret: "porter-ci-mysql", Key: "mysql-root-password"}, step.Outputs[0])
+	assert.Equal(t, HelmOutput{Name: "mysql-cluster-ip", ResourceType: "service", ResourceName: "porter-ci-mysql-service", Namespace: "default", JSONPath: "{.spec.clusterIP}"}, step.Outputs[2])
 	assert.Equal(t, "stable/mysql", step.Chart)
 	assert.Equal(t, "0.10.2", step.Version)
 	assert.Equal(t, map[string]string{"mysqlDatabase": "mydb", "mysqlUser": "myuser",
@@ -125,13 +130,15 @@ func TestMixin_Install(t *testing.T) {
 			expectedCommand: fmt.Sprintf(`%s %s %s %s`, baseInstall, baseValues, baseAddFlags, baseSetArgs),
 			installStep: InstallStep{
 				InstallArguments: InstallArguments{
-					Step:      Step{Description: "Install Foo"},
-					Namespace: namespace,
-					Name:      name,
-					Chart:     chart,
-					Version:   version,
-					Set:       setArgs,
-					Values:    values,
+					Step: Step{Description: "Install Foo"},
+					ChartArguments: ChartArguments{
+						Namespace: namespace,
+						Name:      name,
+						Chart:     chart,
+						Version:   version,
+						Set:       setArgs,
+						Values:    values,
+					},
 				},
 			},
 		},
@@ -139,14 +146,16 @@ func TestMixin_Install(t *testing.T) {
 			expectedCommand: fmt.Sprintf(`%s %s %s %s %s`, baseInstall, baseValues, `--no-hooks`, baseAddFlags, baseSetArgs),
 			installStep: InstallStep{
 				InstallArguments: InstallArguments{
-					Step:      Step{Description: "Install Foo"},
-					Namespace: namespace,
-					Name:      name,
-					Chart:     chart,
-					Version:   version,
-					Set:       setArgs,
-					Values:    values,
-					NoHooks:   true,
+					Step: Step{Description: "Install Foo"},
+					ChartArguments: ChartArguments{
+						Namespace: namespace,
+						Name:      name,
+						Chart:     chart,
+						Version:   version,
+						Set:       setArgs,
+						Values:    values,
+						NoHooks:   true,
+					},
 				},
 			},
 		},
@@ -154,14 +163,16 @@ func TestMixin_Install(t *testing.T) {
 			expectedCommand: fmt.Sprintf(`%s %s %s %s %s`, baseInstall, baseValues, `--skip-crds`, baseAddFlags, baseSetArgs),
 			installStep: InstallStep{
 				InstallArguments: InstallArguments{
-					Step:      Step{Description: "Install Foo"},
-					Namespace: namespace,
-					Name:      name,
-					Chart:     chart,
-					Version:   version,
-					Set:       setArgs,
-					Values:    values,
-					SkipCrds:  true,
+					Step: Step{Description: "Install Foo"},
+					ChartArguments: ChartArguments{
+						Namespace: namespace,
+						Name:      name,
+						Chart:     chart,
+						Version:   version,
+						Set:       setArgs,
+						Values:    values,
+						SkipCrds:  true,
+					},
 				},
 			},
 		},
@@ -169,14 +180,16 @@ func TestMixin_Install(t *testing.T) {
 			expectedCommand: fmt.Sprintf(`%s %s %s %s %s`, baseInstall, `--devel`, baseValues, baseAddFlags, baseSetArgs),
 			installStep: InstallStep{
 				InstallArguments: InstallArguments{
-					Step:      Step{Description: "Install Foo"},
-					Namespace: namespace,
-					Name:      name,
-					Chart:     chart,
-					Version:   version,
-					Set:       setArgs,
-					Values:    values,
-					Devel:     true,
+					Step: Step{Description: "Install Foo"},
+					ChartArguments: ChartArguments{
+						Namespace: namespace,
+						Name:      name,
+						Chart:     chart,
+						Version:   version,
+						Set:       setArgs,
+						Values:    values,
+						Devel:     true,
+					},
 				},
 			},
 		},
@@ -184,14 +197,16 @@ func TestMixin_Install(t *testing.T) {
 			expectedCommand: fmt.Sprintf(`%s %s %s %s %s`, baseInstall, `--wait`, baseValues, baseAddFlags, baseSetArgs),
 			installStep: InstallStep{
 				InstallArguments: InstallArguments{
-					Step:      Step{Description: "Install Foo"},
-					Namespace: namespace,
-					Name:      name,
-					Chart:     chart,
-					Version:   version,
-					Set:       setArgs,
-					Values:    values,
-					Wait:      true,
+					Step: Step{Description: "Install Foo"},
+					ChartArguments: ChartArguments{
+						Namespace: namespace,
+						Name:      name,
+						Chart:     chart,
+						Version:   version,
+						Set:       setArgs,
+						Values:    values,
+						Wait:      &valueTrue,
+					},
 				},
 			},
 		},
@@ -199,15 +214,35 @@ func TestMixin_Install(t *testing.T) {
 			expectedCommand: fmt.Sprintf(`%s %s %s %s %s`, baseInstall, baseValues, `--timeout 600 --debug`, baseAddFlags, baseSetArgs),
 			installStep: InstallStep{
 				InstallArguments: InstallArguments{
-					Step:      Step{Description: "Install Foo"},
-					Namespace: namespace,
-					Name:      name,
-					Chart:     chart,
-					Version:   version,
-					Set:       setArgs,
-					Values:    values,
-					Timeout:   "600",
-					Debug:     true,
+					Step: Step{Description: "Install Foo"},
+					ChartArguments: ChartArguments{
+						Namespace: namespace,
+						Name:      name,
+						Chart:     chart,
+						Version:   version,
+						Set:       setArgs,
+						Values:    values,
+						Timeout:   "600",
+						Debug:     &valueTrue,
+					},
+				},
+			},
+		},
+		{
+			expectedCommand: fmt.Sprintf(`%s %s %s %s %s`, baseInstall, baseValues, `--verify --dependency-update`, baseAddFlags, baseSetArgs),
+			installStep: InstallStep{
+				InstallArguments: InstallArguments{
+					Step: Step{Description: "Install Foo"},
+					ChartArguments: ChartArguments{
+						Namespace:        namespace,
+						Name:             name,
+						Chart:            chart,
+						Version:          version,
+						Set:              setArgs,
+						Values:           values,
+						Verify:           true,
+						DependencyUpdate: true,
+					},
 				},
 			},
 		},
@@ -215,14 +250,16 @@ func TestMixin_Install(t *testing.T) {
 			expectedCommand: fmt.Sprintf(`%s %s %s %s`, baseInstall, baseValues, `--create-namespace`, baseSetArgs),
 			installStep: InstallStep{
 				InstallArguments: InstallArguments{
-					Step:      Step{Description: "Install Foo"},
-					Namespace: namespace,
-					Name:      name,
-					Chart:     chart,
-					Version:   version,
-					Set:       setArgs,
-					Values:    values,
-					Atomic:    &valueFalse,
+					Step: Step{Description: "Install Foo"},
+					ChartArguments: ChartArguments{
+						Namespace: namespace,
+						Name:      name,
+						Chart:     chart,
+						Version:   version,
+						Set:       setArgs,
+						Values:    values,
+						Atomic:    &valueFalse,
+					},
 				},
 			},
 		},
@@ -230,14 +267,16 @@ func TestMixin_Install(t *testing.T) {
 			expectedCommand: fmt.Sprintf(`%s %s %s %s`, baseInstall, baseValues, baseAddFlags, baseSetArgs),
 			installStep: InstallStep{
 				InstallArguments: InstallArguments{
-					Step:      Step{Description: "Install Foo"},
-					Namespace: namespace,
-					Name:      name,
-					Chart:     chart,
-					Version:   version,
-					Set:       setArgs,
-					Values:    values,
-					Atomic:    &valueTrue,
+					Step: Step{Description: "Install Foo"},
+					ChartArguments: ChartArguments{
+						Namespace: namespace,
+						Name:      name,
+						Chart:     chart,
+						Version:   version,
+						Set:       setArgs,
+						Values:    values,
+						Atomic:    &valueTrue,
+					},
 				},
 			},
 		},
@@ -253,6 +292,7 @@ func TestMixin_Install(t *testing.T) {
 			b, _ := yaml.Marshal(action)
 
 			h := NewTestMixin(t)
+			h.Setenv(verifyClientVersionEnv, "false")
 			h.In = bytes.NewReader(b)
 
 			err := h.Install(ctx)
@@ -261,3 +301,890 @@ func TestMixin_Install(t *testing.T) {
 		})
 	}
 }
+
+func TestMixin_InstallWithDefaults(t *testing.T) {
+	valueTrue := true
+	valueFalse := false
+
+	testcases := []struct {
+		name            string
+		expectedCommand string
+		installStep     InstallStep
+	}{
+		{
+			name:            "defaults are used when the step does not set a value",
+			expectedCommand: "helm3 upgrade --install mysql stable/mysql --namespace mynamespace --wait --timeout 10m --debug --create-namespace",
+			installStep: InstallStep{
+				InstallArguments: InstallArguments{
+					Step: Step{Description: "Install MySQL"},
+					ChartArguments: ChartArguments{
+						Name:  "mysql",
+						Chart: "stable/mysql",
+					},
+				},
+			},
+		},
+		{
+			name:            "step values override the defaults",
+			expectedCommand: "helm3 upgrade --install mysql stable/mysql --namespace db --wait --timeout 5m --debug --atomic --create-namespace",
+			installStep: InstallStep{
+				InstallArguments: InstallArguments{
+					Step: Step{Description: "Install MySQL"},
+					ChartArguments: ChartArguments{
+						Name:      "mysql",
+						Chart:     "stable/mysql",
+						Namespace: "db",
+						Timeout:   "5m",
+						Atomic:    &valueTrue,
+					},
+				},
+			},
+		},
+		{
+			name:            "step disables wait and debug enabled by the defaults",
+			expectedCommand: "helm3 upgrade --install mysql stable/mysql --namespace mynamespace --timeout 10m --create-namespace",
+			installStep: InstallStep{
+				InstallArguments: InstallArguments{
+					Step: Step{Description: "Install MySQL"},
+					ChartArguments: ChartArguments{
+						Name:  "mysql",
+						Chart: "stable/mysql",
+						Wait:  &valueFalse,
+						Debug: &valueFalse,
+					},
+				},
+			},
+		},
+	}
+
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			os.Setenv(test.ExpectedCommandEnv, tc.expectedCommand)
+
+			action := InstallAction{Steps: []InstallStep{tc.installStep}}
+			b, err := yaml.Marshal(action)
+			require.NoError(t, err)
+
+			h := NewTestMixin(t)
+			h.Setenv(verifyClientVersionEnv, "false")
+			h.Setenv(defaultNamespaceEnv, "mynamespace")
+			h.Setenv(defaultTimeoutEnv, "10m")
+			h.Setenv(defaultAtomicEnv, "false")
+			h.Setenv(defaultWaitEnv, "true")
+			h.Setenv(defaultDebugEnv, "true")
+			h.In = bytes.NewReader(b)
+
+			err = h.Install(ctx)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestMixin_InstallLocalChart(t *testing.T) {
+	testcases := []struct {
+		name             string
+		chart            string
+		expectedCommands []string
+	}{
+		{
+			name:  "chart with a lock file",
+			chart: "./charts/lockedchart",
+			expectedCommands: []string{
+				"helm3 dependency build ./charts/lockedchart",
+				"helm3 upgrade --install mychart ./charts/lockedchart --atomic --create-namespace",
+			},
+		},
+		{
+			name:  "chart without a lock file",
+			chart: "./charts/mychart",
+			expectedCommands: []string{
+				"helm3 dependency update ./charts/mychart",
+				"helm3 upgrade --install mychart ./charts/mychart --atomic --create-namespace",
+			},
+		},
+	}
+
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			os.Setenv(test.ExpectedCommandEnv, strings.Join(tc.expectedCommands, "\n"))
+
+			step := InstallStep{
+				InstallArguments: InstallArguments{
+					Step: Step{Description: "Install my chart"},
+					ChartArguments: ChartArguments{
+						Name:  "mychart",
+						Chart: tc.chart,
+					},
+				},
+			}
+			action := InstallAction{Steps: []InstallStep{step}}
+			b, err := yaml.Marshal(action)
+			require.NoError(t, err)
+
+			h := NewTestMixin(t)
+			h.Setenv(verifyClientVersionEnv, "false")
+			h.TestContext.AddTestDirectory("testdata/charts", "charts")
+			h.In = bytes.NewReader(b)
+
+			err = h.Install(ctx)
+			require.NoError(t, err)
+
+			gotOutput := h.TestContext.GetOutput()
+			assert.Contains(t, gotOutput, tc.expectedCommands[0])
+		})
+	}
+}
+
+func TestMixin_InstallVendoredChart(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 upgrade --install mysql /charts/stable/mysql-1.6.2.tgz --atomic --create-namespace")
+
+	step := InstallStep{
+		InstallArguments: InstallArguments{
+			Step: Step{Description: "Install MySQL"},
+			ChartArguments: ChartArguments{
+				Name:    "mysql",
+				Chart:   "stable/mysql",
+				Version: "1.6.2",
+			},
+		},
+	}
+	action := InstallAction{Steps: []InstallStep{step}}
+	b, err := yaml.Marshal(action)
+	require.NoError(t, err)
+
+	h := NewTestMixin(t)
+	h.Setenv(verifyClientVersionEnv, "false")
+	err = h.FileSystem.WriteFile("/charts/stable/mysql-1.6.2.tgz", []byte("chart"), 0644)
+	require.NoError(t, err)
+	h.In = bytes.NewReader(b)
+
+	err = h.Install(ctx)
+	require.NoError(t, err)
+}
+
+func TestMixin_InstallWithoutOutputsSkipsKubernetesClient(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 upgrade --install mysql stable/mysql --atomic --create-namespace")
+
+	step := InstallStep{
+		InstallArguments: InstallArguments{
+			Step: Step{Description: "Install MySQL"},
+			ChartArguments: ChartArguments{
+				Name:  "mysql",
+				Chart: "stable/mysql",
+			},
+		},
+	}
+
+	t.Run("without outputs", func(t *testing.T) {
+		b, err := yaml.Marshal(InstallAction{Steps: []InstallStep{step}})
+		require.NoError(t, err)
+
+		h := NewTestMixin(t)
+		h.Setenv(verifyClientVersionEnv, "false")
+		h.ClientFactory = &failingKubernetesFactory{}
+		h.In = bytes.NewReader(b)
+
+		err = h.Install(ctx)
+		require.NoError(t, err)
+	})
+
+	t.Run("with outputs", func(t *testing.T) {
+		step := step
+		step.Outputs = []HelmOutput{{Name: "password", Secret: "mysql", Key: "password"}}
+		b, err := yaml.Marshal(InstallAction{Steps: []InstallStep{step}})
+		require.NoError(t, err)
+
+		h := NewTestMixin(t)
+		h.Setenv(verifyClientVersionEnv, "false")
+		h.ClientFactory = &failingKubernetesFactory{}
+		h.In = bytes.NewReader(b)
+
+		err = h.Install(ctx)
+		require.EqualError(t, err, "couldn't get kubernetes client: couldn't build kubernetes config")
+	})
+}
+
+func TestMixin_InstallJSONOutput(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 upgrade --install mysql stable/mysql --atomic --create-namespace")
+
+	step := InstallStep{
+		InstallArguments: InstallArguments{
+			Step: Step{Description: "Install MySQL"},
+			ChartArguments: ChartArguments{
+				Name:  "mysql",
+				Chart: "stable/mysql",
+			},
+		},
+	}
+	action := InstallAction{Steps: []InstallStep{step}}
+	b, err := yaml.Marshal(action)
+	require.NoError(t, err)
+
+	h := NewTestMixin(t)
+	h.Setenv(verifyClientVersionEnv, "false")
+	h.OutputFormat = OutputFormatJSON
+	h.In = bytes.NewReader(b)
+
+	err = h.Install(ctx)
+	require.NoError(t, err)
+
+	var entry commandLog
+	err = json.Unmarshal([]byte(h.TestContext.GetOutput()), &entry)
+	require.NoError(t, err, "the output should be a single json log line")
+	assert.Equal(t, "Install MySQL", entry.Step)
+	assert.Equal(t, "helm3 upgrade --install mysql stable/mysql --atomic --create-namespace", entry.Command)
+	assert.Equal(t, 0, entry.ExitCode)
+}
+
+func TestMixin_ValidateOutputFormat(t *testing.T) {
+	h := NewTestMixin(t)
+	require.NoError(t, h.ValidateOutputFormat())
+
+	h.Setenv(outputFormatEnv, OutputFormatJSON)
+	assert.Equal(t, OutputFormatJSON, h.getOutputFormat())
+
+	h.OutputFormat = "yaml"
+	require.EqualError(t, h.ValidateOutputFormat(), `unsupported output format "yaml", allowed values are text and json`)
+}
+
+func TestMixin_InstallDebugMode(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 upgrade --install mysql stable/mysql --values /cnab/app/values/mysql.yaml --debug --atomic --create-namespace "+
+		"--set mysqlDatabase=wordpress --set mysqlPassword=topsecret")
+
+	step := InstallStep{
+		InstallArguments: InstallArguments{
+			Step: Step{Description: "Install MySQL"},
+			ChartArguments: ChartArguments{
+				Name:       "mysql",
+				Chart:      "stable/mysql",
+				ValuesFrom: []ValuesSource{{File: "/cnab/app/values/mysql.yaml"}},
+				Set: map[string]string{
+					"mysqlDatabase": "wordpress",
+					"mysqlPassword": "topsecret",
+				},
+			},
+		},
+	}
+	action := InstallAction{Steps: []InstallStep{step}}
+	b, err := yaml.Marshal(action)
+	require.NoError(t, err)
+
+	h := NewTestMixin(t)
+	h.Setenv(verifyClientVersionEnv, "false")
+	h.DebugMode = true
+	require.NoError(t, h.FileSystem.WriteFile("/cnab/app/values/mysql.yaml", []byte("replicas: 1\n"), 0644))
+	h.In = bytes.NewReader(b)
+
+	err = h.Install(ctx)
+	require.NoError(t, err)
+
+	stderr := h.TestContext.GetError()
+	assert.Contains(t, stderr, "DEBUG:   values file /cnab/app/values/mysql.yaml")
+	assert.Contains(t, stderr, "DEBUG:   mysqlDatabase=wordpress")
+	assert.Contains(t, stderr, "DEBUG:   mysqlPassword=*******")
+	assert.NotContains(t, stderr, "topsecret")
+}
+
+func TestMixin_InstallSuppressOutput(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	defer os.Unsetenv(test.ExpectedCommandOutputEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 upgrade --install mysql stable/mysql --atomic --create-namespace")
+	os.Setenv(test.ExpectedCommandOutputEnv, "NOTES: the root password is topsecret")
+
+	step := InstallStep{
+		InstallArguments: InstallArguments{
+			Step: Step{Description: "Install MySQL", SuppressOutput: true},
+			ChartArguments: ChartArguments{
+				Name:  "mysql",
+				Chart: "stable/mysql",
+			},
+		},
+	}
+	action := InstallAction{Steps: []InstallStep{step}}
+	b, err := yaml.Marshal(action)
+	require.NoError(t, err)
+
+	h := NewTestMixin(t)
+	h.Setenv(verifyClientVersionEnv, "false")
+	h.In = bytes.NewReader(b)
+
+	err = h.Install(ctx)
+	require.NoError(t, err)
+	assert.NotContains(t, h.TestContext.GetOutput(), "topsecret")
+}
+
+func TestMixin_InstallUpdateReposAtRuntime(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 repo update stable\n"+
+		"helm3 upgrade --install mysql stable/mysql --atomic --create-namespace")
+
+	step := InstallStep{
+		InstallArguments: InstallArguments{
+			Step: Step{Description: "Install MySQL"},
+			ChartArguments: ChartArguments{
+				Name:  "mysql",
+				Chart: "stable/mysql",
+			},
+		},
+	}
+	b, err := yaml.Marshal(InstallAction{Steps: []InstallStep{step}})
+	require.NoError(t, err)
+
+	h := NewTestMixin(t)
+	h.Setenv(verifyClientVersionEnv, "false")
+	h.Setenv(updateReposEnv, "true")
+	h.In = bytes.NewReader(b)
+
+	err = h.Install(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, h.TestContext.GetOutput(), "helm3 repo update stable")
+}
+
+func TestMixin_InstallPinnedRepository(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 upgrade --install mysql stable/mysql --repository-cache /var/lib/helm3-mixin/repository-cache --atomic --create-namespace")
+
+	step := InstallStep{
+		InstallArguments: InstallArguments{
+			Step: Step{Description: "Install MySQL"},
+			ChartArguments: ChartArguments{
+				Name:  "mysql",
+				Chart: "stable/mysql",
+			},
+		},
+	}
+	b, err := yaml.Marshal(InstallAction{Steps: []InstallStep{step}})
+	require.NoError(t, err)
+
+	h := NewTestMixin(t)
+	h.Setenv(verifyClientVersionEnv, "false")
+	h.Setenv(pinnedReposEnv, "jetstack,stable")
+	// pinned repositories are not updated at runtime
+	h.Setenv(updateReposEnv, "true")
+	h.In = bytes.NewReader(b)
+
+	err = h.Install(ctx)
+	require.NoError(t, err)
+}
+
+func TestMixin_InstallWithHelmBinary(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	os.Setenv(test.ExpectedCommandEnv, "/opt/helm/bin/helm upgrade --install mysql stable/mysql --atomic --create-namespace")
+
+	step := InstallStep{
+		InstallArguments: InstallArguments{
+			Step: Step{Description: "Install MySQL"},
+			ChartArguments: ChartArguments{
+				Name:  "mysql",
+				Chart: "stable/mysql",
+			},
+		},
+	}
+	b, err := yaml.Marshal(InstallAction{Steps: []InstallStep{step}})
+	require.NoError(t, err)
+
+	h := NewTestMixin(t)
+	h.Setenv(verifyClientVersionEnv, "false")
+	h.Setenv(helmBinaryEnv, "/opt/helm/bin/helm")
+	h.In = bytes.NewReader(b)
+
+	err = h.Install(ctx)
+	require.NoError(t, err)
+}
+
+func TestMixin_InstallVerifiesClientVersion(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	defer os.Unsetenv(test.ExpectedCommandOutputEnv)
+	os.Setenv(test.ExpectedCommandOutputEnv, "v2.17.0")
+
+	step := InstallStep{
+		InstallArguments: InstallArguments{
+			Step: Step{Description: "Install my chart"},
+			ChartArguments: ChartArguments{
+				Name:  "mychart",
+				Chart: "stable/mychart",
+			},
+		},
+	}
+	action := InstallAction{Steps: []InstallStep{step}}
+	b, err := yaml.Marshal(action)
+	require.NoError(t, err)
+
+	t.Run("mismatched client", func(t *testing.T) {
+		os.Setenv(test.ExpectedCommandEnv, "helm3 version --template {{.Version}}")
+
+		h := NewTestMixin(t)
+		h.In = bytes.NewReader(b)
+
+		err := h.Install(ctx)
+		require.EqualError(t, err, `the helm client of the invocation image is v2.17.0, which does not meet the semver constraint "^v3.x", check that the Dockerfile does not replace helm3`)
+	})
+
+	t.Run("matching client", func(t *testing.T) {
+		os.Setenv(test.ExpectedCommandEnv, "helm3 version --template {{.Version}}\nhelm3 upgrade --install mychart stable/mychart --atomic --create-namespace")
+		os.Setenv(test.ExpectedCommandOutputEnv, "v3.8.2")
+
+		h := NewTestMixin(t)
+		h.In = bytes.NewReader(b)
+
+		require.NoError(t, h.Install(ctx))
+	})
+}
+
+func TestMixin_InstallExecHooks(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	os.Setenv(test.ExpectedCommandEnv, strings.Join([]string{
+		`sh -c kubectl create secret generic myapp-config --namespace "$HELM3_MIXIN_NAMESPACE"`,
+		`sh -c echo "$REGISTRY_PASSWORD" | docker login registry.example.com --username admin --password-stdin`,
+		`sh -c docker login registry.example.com --username admin --password s3cr3t`,
+		"helm3 upgrade --install myapp stable/myapp --namespace myapp --atomic --create-namespace",
+		`sh -c kubectl annotate deployment "$HELM3_MIXIN_RELEASE" --namespace "$HELM3_MIXIN_NAMESPACE" installed-by=porter`,
+	}, "\n"))
+
+	step := InstallStep{
+		InstallArguments: InstallArguments{
+			Step: Step{
+				Description: "Install my app",
+				ExecHooks: ExecHooks{
+					PreExec: []string{
+						`kubectl create secret generic myapp-config --namespace "$HELM3_MIXIN_NAMESPACE"`,
+						`echo "$REGISTRY_PASSWORD" | docker login registry.example.com --username admin --password-stdin`,
+						`docker login registry.example.com --username admin --password s3cr3t`,
+					},
+					PostExec: []string{`kubectl annotate deployment "$HELM3_MIXIN_RELEASE" --namespace "$HELM3_MIXIN_NAMESPACE" installed-by=porter`},
+					ExecEnv:  map[string]string{"REGISTRY_PASSWORD": "s3cr3t"},
+				},
+			},
+			ChartArguments: ChartArguments{
+				Name:      "myapp",
+				Namespace: "myapp",
+				Chart:     "stable/myapp",
+			},
+		},
+	}
+	action := InstallAction{Steps: []InstallStep{step}}
+	b, err := yaml.Marshal(action)
+	require.NoError(t, err)
+
+	h := NewTestMixin(t)
+	h.Setenv(verifyClientVersionEnv, "false")
+	h.In = bytes.NewReader(b)
+
+	err = h.Install(ctx)
+	require.NoError(t, err)
+	stdout := h.TestContext.GetOutput()
+	assert.Contains(t, stdout, `preExec: kubectl create secret generic myapp-config --namespace "$HELM3_MIXIN_NAMESPACE"`)
+	assert.Contains(t, stdout, `preExec: echo "$REGISTRY_PASSWORD" | docker login registry.example.com --username ******* --password-stdin`)
+	assert.Contains(t, stdout, `preExec: docker login registry.example.com --username ******* --password *******`)
+	assert.NotContains(t, stdout, "s3cr3t")
+}
+
+func TestMaskExecCommand(t *testing.T) {
+	execEnv := map[string]string{"REGISTRY_PASSWORD": "s3cr3t", "REGISTRY": "registry.example.com"}
+
+	assert.Equal(t, "kubectl create secret docker-registry regcred --docker-server=registry.example.com --docker-password=*******",
+		maskExecCommand("kubectl create secret docker-registry regcred --docker-server=registry.example.com --docker-password=s3cr3t", execEnv))
+	assert.Equal(t, "helm3 registry login registry.example.com --username ******* --password *******",
+		maskExecCommand("helm3 registry login registry.example.com --username admin --password other", execEnv))
+}
+
+func TestMixin_InstallApplyMode(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	os.Setenv(test.ExpectedCommandEnv, strings.Join([]string{
+		"helm3 template myapp stable/myapp --namespace myapp --no-hooks --include-crds",
+		"kubectl apply --server-side --field-manager helm3-mixin --prune --applyset configmaps/helm3-mixin-myapp --namespace myapp --filename -",
+	}, "\n"))
+	defer os.Unsetenv(test.ExpectedCommandOutputEnv)
+	os.Setenv(test.ExpectedCommandOutputEnv, "apiVersion: v1\nkind: Secret\n")
+
+	step := InstallStep{
+		InstallArguments: InstallArguments{
+			Step: Step{Description: "Install my app"},
+			ChartArguments: ChartArguments{
+				Name:      "myapp",
+				Namespace: "myapp",
+				Chart:     "stable/myapp",
+				Mode:      ModeApply,
+			},
+		},
+	}
+	action := InstallAction{Steps: []InstallStep{step}}
+	b, err := yaml.Marshal(action)
+	require.NoError(t, err)
+
+	h := NewTestMixin(t)
+	h.Setenv(verifyClientVersionEnv, "false")
+	h.In = bytes.NewReader(b)
+
+	err = h.Install(ctx)
+	require.NoError(t, err)
+	// only the output of kubectl is printed, not the rendered manifest
+	assert.Equal(t, 1, strings.Count(h.TestContext.GetOutput(), "kind: Secret"))
+}
+
+func TestMixin_InstallApplyModeRequiresRelease(t *testing.T) {
+	ctx := context.Background()
+
+	step := InstallStep{
+		InstallArguments: InstallArguments{
+			Step: Step{Description: "Install my app"},
+			ChartArguments: ChartArguments{
+				Name:  "myapp",
+				Chart: "stable/myapp",
+				Mode:  ModeApply,
+			},
+			SkipIfExists: true,
+		},
+	}
+	action := InstallAction{Steps: []InstallStep{step}}
+	b, err := yaml.Marshal(action)
+	require.NoError(t, err)
+
+	h := NewTestMixin(t)
+	h.Setenv(verifyClientVersionEnv, "false")
+	h.In = bytes.NewReader(b)
+
+	err = h.Install(ctx)
+	require.EqualError(t, err, "skipIfExists cannot be used with mode apply, because there is no helm release")
+}
+
+func TestMixin_InstallApplyModeKubeVersion(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	os.Setenv(test.ExpectedCommandEnv, strings.Join([]string{
+		"helm3 template myapp stable/myapp --namespace myapp --no-hooks --kube-version v1.29.0 " +
+			"--api-versions monitoring.coreos.com/v1 --api-versions cert-manager.io/v1 --include-crds",
+		"kubectl apply --server-side --field-manager helm3-mixin --prune --applyset configmaps/helm3-mixin-myapp --namespace myapp --filename -",
+	}, "\n"))
+
+	step := InstallStep{
+		InstallArguments: InstallArguments{
+			Step: Step{Description: "Install my app"},
+			ChartArguments: ChartArguments{
+				Name:        "myapp",
+				Namespace:   "myapp",
+				Chart:       "stable/myapp",
+				Mode:        ModeApply,
+				KubeVersion: "v1.29.0",
+				APIVersions: []string{"monitoring.coreos.com/v1", "cert-manager.io/v1"},
+			},
+		},
+	}
+	b, err := yaml.Marshal(InstallAction{Steps: []InstallStep{step}})
+	require.NoError(t, err)
+
+	h := NewTestMixin(t)
+	h.Setenv(verifyClientVersionEnv, "false")
+	h.In = bytes.NewReader(b)
+
+	err = h.Install(ctx)
+	require.NoError(t, err)
+
+	step.Mode = ModeHelm
+	b, err = yaml.Marshal(InstallAction{Steps: []InstallStep{step}})
+	require.NoError(t, err)
+	h.In = bytes.NewReader(b)
+
+	err = h.Install(ctx)
+	require.EqualError(t, err, "kubeVersion and apiVersions can only be used with mode apply, helm renders the release for the version of the cluster")
+}
+
+func TestMixin_InstallOwnershipLabels(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 upgrade --install myapp stable/myapp --namespace myapp --labels porter.sh/bundle-version=1.2.0_build.1,porter.sh/installation=myapp,porter.sh/run=01H8Z --atomic --create-namespace")
+
+	step := InstallStep{
+		InstallArguments: InstallArguments{
+			Step: Step{Description: "Install my app"},
+			ChartArguments: ChartArguments{
+				Name:      "myapp",
+				Namespace: "myapp",
+				Chart:     "stable/myapp",
+			},
+		},
+	}
+	action := InstallAction{Steps: []InstallStep{step}}
+	b, err := yaml.Marshal(action)
+	require.NoError(t, err)
+
+	h := NewTestMixin(t)
+	h.Setenv(verifyClientVersionEnv, "false")
+	h.Setenv(ownershipLabelsEnv, "true")
+	h.Setenv(installationNameEnv, "myapp")
+	h.Setenv(bundleVersionEnv, "1.2.0+build.1")
+	h.Setenv(runEnv, "01H8Z")
+	h.In = bytes.NewReader(b)
+
+	err = h.Install(ctx)
+	require.NoError(t, err)
+}
+
+func TestMixin_InstallChartDigest(t *testing.T) {
+	const digest = "sha256:5f3c0a8f1a2e5b0e7d3c6a9b8f4e2d1c0b9a8f7e6d5c4b3a2f1e0d9c8b7a6f5e"
+
+	testcases := []struct {
+		name        string
+		chart       string
+		pulled      string
+		wantCommand string
+		wantErr     string
+	}{
+		{"matching digest", "oci://registry.example.com/charts/mysql", digest,
+			"helm3 upgrade --install mysql /tmp/helm3-mixin/pinned-charts/mysql-9.4.3.tgz --namespace mysql --atomic --create-namespace", ""},
+		{"pushed again", "oci://registry.example.com/charts/mysql", "sha256:0123abcd", "",
+			"chart oci://registry.example.com/charts/mysql has the digest sha256:0123abcd instead of the chartDigest " + digest + " of the step, it was pushed again"},
+		{"repository chart", "bitnami/mysql", "", "", "chartDigest can only be set for oci:// charts and chart urls, not bitnami/mysql"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			commands := []string{}
+			if tc.pulled != "" {
+				commands = append(commands, "helm3 pull oci://registry.example.com/charts/mysql --destination /tmp/helm3-mixin/pinned-charts --version 9.4.3")
+			}
+			if tc.wantCommand != "" {
+				commands = append(commands, tc.wantCommand)
+			}
+			defer os.Unsetenv(test.ExpectedCommandEnv)
+			os.Setenv(test.ExpectedCommandEnv, strings.Join(commands, "\n"))
+			defer os.Unsetenv(test.ExpectedCommandOutputEnv)
+			os.Setenv(test.ExpectedCommandOutputEnv, "Digest: "+tc.pulled+"\n")
+
+			step := InstallStep{
+				InstallArguments: InstallArguments{
+					Step: Step{Description: "Install MySQL"},
+					ChartArguments: ChartArguments{
+						Name:        "mysql",
+						Namespace:   "mysql",
+						Chart:       tc.chart,
+						Version:     "9.4.3",
+						ChartDigest: digest,
+					},
+				},
+			}
+			action := InstallAction{Steps: []InstallStep{step}}
+			b, err := yaml.Marshal(action)
+			require.NoError(t, err)
+
+			h := NewTestMixin(t)
+			h.Setenv(verifyClientVersionEnv, "false")
+			h.In = bytes.NewReader(b)
+			require.NoError(t, h.FileSystem.WriteFile(path.Join(pinnedChartsDir, "mysql-9.4.3.tgz"), []byte("chart"), 0644))
+
+			err = h.Install(ctx)
+			if tc.wantErr != "" {
+				require.EqualError(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestMixin_InstallChartURLDigest(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	os.Setenv(test.ExpectedCommandEnv, strings.Join([]string{
+		"helm3 pull https://example.com/charts/redis-17.3.7.tgz --destination /tmp/helm3-mixin/pinned-charts",
+		"helm3 upgrade --install redis /tmp/helm3-mixin/pinned-charts/redis-17.3.7.tgz --namespace redis --atomic --create-namespace",
+	}, "\n"))
+
+	sum := sha256.Sum256([]byte("chart"))
+	step := InstallStep{
+		InstallArguments: InstallArguments{
+			Step: Step{Description: "Install Redis"},
+			ChartArguments: ChartArguments{
+				Name:        "redis",
+				Namespace:   "redis",
+				Chart:       "https://example.com/charts/redis-17.3.7.tgz",
+				ChartDigest: "sha256:" + hex.EncodeToString(sum[:]),
+			},
+		},
+	}
+	action := InstallAction{Steps: []InstallStep{step}}
+	b, err := yaml.Marshal(action)
+	require.NoError(t, err)
+
+	h := NewTestMixin(t)
+	h.Setenv(verifyClientVersionEnv, "false")
+	h.Setenv(updateReposEnv, "true")
+	h.In = bytes.NewReader(b)
+	require.NoError(t, h.FileSystem.WriteFile(path.Join(pinnedChartsDir, "redis-17.3.7.tgz"), []byte("chart"), 0644))
+
+	err = h.Install(ctx)
+	require.NoError(t, err)
+}
+
+func TestMixin_InstallMasksCredentials(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 upgrade --install mysql mysql --repo https://charts.example.com --username myuser --password mypass --atomic --create-namespace")
+
+	step := InstallStep{
+		InstallArguments: InstallArguments{
+			Step: Step{Description: "Install MySQL"},
+			ChartArguments: ChartArguments{
+				Name:     "mysql",
+				Chart:    "mysql",
+				Repo:     "https://charts.example.com",
+				Username: "myuser",
+				Password: "mypass",
+			},
+		},
+	}
+	action := InstallAction{Steps: []InstallStep{step}}
+	b, err := yaml.Marshal(action)
+	require.NoError(t, err)
+
+	h := NewTestMixin(t)
+	h.Setenv(verifyClientVersionEnv, "false")
+	h.In = bytes.NewReader(b)
+
+	err = h.Install(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, h.TestContext.GetOutput(), "upgrade --install mysql mysql --repo https://charts.example.com --username ******* --password ******* --atomic --create-namespace")
+	assert.NotContains(t, h.TestContext.GetOutput(), "mypass")
+}
+
+func TestMixin_InstallCondition(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 upgrade --install myapp stable/myapp --atomic --create-namespace")
+
+	testcases := []struct {
+		condition string
+		skipped   bool
+		wantErr   string
+	}{
+		{condition: "false", skipped: true},
+		{condition: " !true ", skipped: true},
+		{condition: "true"},
+		{condition: "!false"},
+		{condition: "${ bundle.parameters.install-myapp }", wantErr: `invalid condition "${ bundle.parameters.install-myapp }"`},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.condition, func(t *testing.T) {
+			step := InstallStep{
+				InstallArguments: InstallArguments{
+					Step: Step{Description: "Install my app", Condition: tc.condition},
+					ChartArguments: ChartArguments{
+						Name:  "myapp",
+						Chart: "stable/myapp",
+					},
+				},
+			}
+			action := InstallAction{Steps: []InstallStep{step}}
+			b, err := yaml.Marshal(action)
+			require.NoError(t, err)
+
+			h := NewTestMixin(t)
+			h.Setenv(verifyClientVersionEnv, "false")
+			h.In = bytes.NewReader(b)
+
+			err = h.Install(ctx)
+			if tc.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			skipped := strings.Contains(h.TestContext.GetOutput(), "Skipping the step because its condition")
+			assert.Equal(t, tc.skipped, skipped)
+		})
+	}
+}
+
+func TestMixin_InstallReleases(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	os.Setenv(test.ExpectedCommandEnv, strings.Join([]string{
+		"helm3 upgrade --install postgresql bitnami/postgresql --namespace platform --version 15.5.0 --wait --timeout 10m --atomic --create-namespace",
+		"helm3 upgrade --install keycloak bitnami/keycloak --namespace platform --wait --timeout 15m --atomic --create-namespace --set postgresql.enabled=false",
+	}, "\n"))
+
+	b := []byte(`install:
+- helm3:
+    description: Install the platform
+    namespace: platform
+    wait: true
+    timeout: 10m
+    releases:
+    - name: postgresql
+      chart: bitnami/postgresql
+      version: 15.5.0
+    - name: keycloak
+      chart: bitnami/keycloak
+      timeout: 15m
+      set:
+        postgresql.enabled: "false"
+    - name: ingress-nginx
+      chart: ingress-nginx/ingress-nginx
+      condition: "false"
+`)
+	h := NewTestMixin(t)
+	h.Setenv(verifyClientVersionEnv, "false")
+	h.In = bytes.NewReader(b)
+
+	err := h.Install(ctx)
+	require.NoError(t, err)
+	output := h.TestContext.GetOutput()
+	assert.Contains(t, output, "Installing release postgresql (1 of 3)\n")
+	assert.Contains(t, output, "Installing release keycloak (2 of 3)\n")
+	assert.NotContains(t, output, "Installing release ingress-nginx")
+}
+
+func TestInstallArguments_Releases(t *testing.T) {
+	step := InstallArguments{
+		ChartArguments: ChartArguments{
+			Namespace: "platform",
+			Chart:     "bitnami/postgresql",
+			Set:       map[string]string{"auth.enabled": "true"},
+			Releases: []map[string]interface{}{
+				{"name": "db"},
+				{"name": "keycloak", "chart": "bitnami/keycloak", "set": map[interface{}]interface{}{"replicas": "2"}},
+			},
+		},
+	}
+	releases, err := step.releases()
+	require.NoError(t, err)
+	require.Len(t, releases, 2)
+	assert.Equal(t, "platform", releases[0].Namespace)
+	assert.Equal(t, "bitnami/postgresql", releases[0].Chart)
+	assert.Equal(t, map[string]string{"auth.enabled": "true"}, releases[0].Set)
+	assert.Equal(t, "bitnami/keycloak", releases[1].Chart)
+	assert.Equal(t, map[string]string{"replicas": "2"}, releases[1].Set)
+
+	step.Releases = []map[string]interface{}{{"chart": "bitnami/keycloak"}}
+	_, err = step.releases()
+	assert.EqualError(t, err, "release 1 of the step must set a name")
+
+	step.Releases = []map[string]interface{}{{"name": "db", "chrt": "bitnami/keycloak"}}
+	_, err = step.releases()
+	assert.Contains(t, err.Error(), "invalid release 1 of the step")
+
+	step.Releases = []map[string]interface{}{{"name": "db"}}
+	step.Outputs = []HelmOutput{{Name: "password", Secret: "db", Key: "password"}}
+	_, err = step.releases()
+	assert.EqualError(t, err, "a step with releases cannot declare outputs, declare them in its releases")
+}
@@ -0,0 +1,103 @@
+package helm3
+
+import (
+	"fmt"
+
+	"github.com/Masterminds/semver"
+	"github.com/pkg/errors"
+)
+
+// apiVersionAuto selects the version of kubectl from the Kubernetes versions that the helm client supports
+const apiVersionAuto = "auto"
+
+// applyAPIVersionConstraint is the version of kubectl needed by apply mode, the first one with kubectl apply --applyset
+const applyAPIVersionConstraint = ">= 1.27.0-0"
+
+// helmKubernetesMinor returns the latest minor version of Kubernetes that a helm client is built against,
+// following the version skew policy of helm: helm supports that version and the three minor versions before it.
+func helmKubernetesMinor(helmVersion *semver.Version) (int64, error) {
+	minor := helmVersion.Minor()
+	switch helmVersion.Major() {
+	case 3:
+		if minor <= 2 {
+			return 16 + minor, nil
+		}
+		return 15 + minor, nil
+	case 4:
+		return 34 + minor, nil
+	}
+	return 0, errors.Errorf("the Kubernetes versions supported by helm %s are unknown, set apiVersion to the version of kubectl", helmVersion.Original())
+}
+
+// resolveAPIVersion returns the version of kubectl to install in the invocation image. With apiVersion auto, or
+// when only the clusterVersion is set, kubectl has the minor version of the target cluster, or else the latest minor
+// version of Kubernetes supported by the helm client. An explicit apiVersion must be within one minor version of
+// the clusterVersion, the skew that kubectl supports.
+func (m *Mixin) resolveAPIVersion(config MixinConfig) (string, error) {
+	var cluster *semver.Version
+	if config.ClusterVersion != "" {
+		var err error
+		cluster, err = semver.NewVersion(config.ClusterVersion)
+		if err != nil {
+			return "", errors.Wrapf(err, "supplied clusterVersion %q cannot be parsed as semver", config.ClusterVersion)
+		}
+	}
+
+	if config.APIVersion != "" && config.APIVersion != apiVersionAuto {
+		kubectl, err := semver.NewVersion(config.APIVersion)
+		if err != nil {
+			return "", errors.Wrapf(err, "supplied apiVersion %q cannot be parsed as semver", config.APIVersion)
+		}
+		if cluster != nil {
+			skew := kubectl.Minor() - cluster.Minor()
+			if kubectl.Major() != cluster.Major() || skew > 1 || skew < -1 {
+				return "", errors.Errorf("apiVersion %s is more than one minor version away from clusterVersion %s, "+
+					"kubectl only supports a skew of one minor version with the cluster", config.APIVersion, config.ClusterVersion)
+			}
+		}
+		return config.APIVersion, nil
+	}
+
+	if cluster != nil {
+		return fmt.Sprintf("v%d.%d.0", cluster.Major(), cluster.Minor()), nil
+	}
+	if config.APIVersion == "" {
+		return m.APIVersion, nil
+	}
+
+	helmVersion, err := semver.NewVersion(m.HelmClientVersion)
+	if err != nil {
+		return "", errors.Wrapf(err, "client version %q cannot be parsed as semver", m.HelmClientVersion)
+	}
+	minor, err := helmKubernetesMinor(helmVersion)
+	if err != nil {
+		return "", err
+	}
+	apiVersion := fmt.Sprintf("v1.%d.0", minor)
+	fmt.Fprintf(m.Err, "Resolved apiVersion auto to %s for helm %s\n", apiVersion, m.HelmClientVersion)
+	return apiVersion, nil
+}
+
+// validateApplyAPIVersion checks that the kubectl installed in the invocation image supports apply mode,
+// when a step of the bundle uses it.
+func validateApplyAPIVersion(input BuildInput, apiVersion string) error {
+	for _, steps := range input.Actions {
+		for _, step := range steps {
+			for _, release := range step.releases() {
+				if release.Mode != ModeApply {
+					continue
+				}
+				ok, err := validate(apiVersion, applyAPIVersionConstraint)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					return errors.Errorf("mode %s needs kubectl v1.27 or later for kubectl apply --applyset, but apiVersion is %s, set apiVersion to v1.27.0 or later",
+						ModeApply, apiVersion)
+				}
+				return nil
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package helm3
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMixin_ResolveAPIVersion(t *testing.T) {
+	testcases := []struct {
+		name          string
+		clientVersion string
+		config        MixinConfig
+		want          string
+		wantError     string
+	}{
+		{name: "default", want: "v1.22.1"},
+		{name: "pinned", config: MixinConfig{APIVersion: "v1.28.4"}, want: "v1.28.4"},
+		{name: "auto", clientVersion: "v3.14.4", config: MixinConfig{APIVersion: "auto"}, want: "v1.29.0"},
+		{name: "auto with an old helm", clientVersion: "v3.1.3", config: MixinConfig{APIVersion: "auto"}, want: "v1.17.0"},
+		{name: "auto with helm v4", clientVersion: "v4.0.0", config: MixinConfig{APIVersion: "auto"}, want: "v1.34.0"},
+		{name: "cluster", config: MixinConfig{ClusterVersion: "v1.28"}, want: "v1.28.0"},
+		{name: "auto with a cluster", clientVersion: "v3.14.4", config: MixinConfig{APIVersion: "auto", ClusterVersion: "1.27.3"}, want: "v1.27.0"},
+		{name: "pinned within the skew", config: MixinConfig{APIVersion: "v1.29.1", ClusterVersion: "v1.28"}, want: "v1.29.1"},
+		{
+			name:      "pinned outside the skew",
+			config:    MixinConfig{APIVersion: "v1.30.0", ClusterVersion: "v1.28"},
+			wantError: "apiVersion v1.30.0 is more than one minor version away from clusterVersion v1.28, kubectl only supports a skew of one minor version with the cluster",
+		},
+		{
+			name:      "invalid cluster",
+			config:    MixinConfig{ClusterVersion: "latest"},
+			wantError: `supplied clusterVersion "latest" cannot be parsed as semver: Invalid Semantic Version`,
+		},
+		{
+			name:          "auto with an unknown helm",
+			clientVersion: "v5.0.0",
+			config:        MixinConfig{APIVersion: "auto"},
+			wantError:     "the Kubernetes versions supported by helm v5.0.0 are unknown, set apiVersion to the version of kubectl",
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := NewTestMixin(t)
+			if tc.clientVersion != "" {
+				m.HelmClientVersion = tc.clientVersion
+			}
+
+			got, err := m.resolveAPIVersion(tc.config)
+			if tc.wantError != "" {
+				require.EqualError(t, err, tc.wantError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestMixin_BuildAPIVersionAuto(t *testing.T) {
+	m := NewTestMixin(t)
+	m.In = bytes.NewReader([]byte("config:\n  clientVersion: v3.14.4\n  apiVersion: auto\n"))
+
+	err := m.Build(context.Background())
+	require.NoError(t, err)
+	assert.Contains(t, m.TestContext.GetOutput(), "/release/v1.29.0/bin/linux/amd64/kubectl")
+	assert.Contains(t, m.TestContext.GetError(), "Resolved apiVersion auto to v1.29.0 for helm v3.14.4")
+}
+
+func TestMixin_BuildApplyModeAPIVersion(t *testing.T) {
+	input := "actions:\n  install:\n  - helm3:\n      name: myapp\n      chart: bitnami/nginx\n      mode: apply\n"
+
+	t.Run("default kubectl", func(t *testing.T) {
+		m := NewTestMixin(t)
+		m.In = bytes.NewReader([]byte("config:\n  clientVersion: v3.14.4\n" + input))
+
+		err := m.Build(context.Background())
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "mode apply needs kubectl v1.27 or later for kubectl apply --applyset, but apiVersion is v1.22.1")
+	})
+
+	t.Run("kubectl with applysets", func(t *testing.T) {
+		m := NewTestMixin(t)
+		m.In = bytes.NewReader([]byte("config:\n  clientVersion: v3.14.4\n  apiVersion: v1.28.4\n" + input))
+
+		err := m.Build(context.Background())
+		require.NoError(t, err)
+		assert.Contains(t, m.TestContext.GetOutput(), "/release/v1.28.4/bin/linux/amd64/kubectl")
+	})
+
+	t.Run("release in apply mode", func(t *testing.T) {
+		m := NewTestMixin(t)
+		m.In = bytes.NewReader([]byte("config:\n  clientVersion: v3.14.4\nactions:\n  install:\n  - helm3:\n      chart: bitnami/nginx\n" +
+			"      releases:\n        - name: web\n        - name: api\n          mode: apply\n"))
+
+		err := m.Build(context.Background())
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "mode apply needs kubectl v1.27 or later")
+	})
+}
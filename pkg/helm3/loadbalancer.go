@@ -0,0 +1,106 @@
+package helm3
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// defaultAddressTimeout is how long an output waits for the address of a load balancer when it does not set a timeout
+const defaultAddressTimeout = 5 * time.Minute
+
+// addressPollInterval is how often the address of a load balancer is checked while an output waits for it
+var addressPollInterval = 5 * time.Second
+
+// getLoadBalancerAddress waits until the cloud provider assigned an address to the load balancer of a Service
+// or an Ingress, and returns its IP or hostname. Installs succeed before the load balancer is provisioned,
+// so reading the status right away would give an empty output.
+func (m *Mixin) getLoadBalancerAddress(ctx context.Context, client kubernetes.Interface, resourceType, name, namespace, timeout string) ([]byte, error) {
+	if namespace == "" {
+		namespace = "default"
+	}
+	wait := defaultAddressTimeout
+	if timeout != "" {
+		var err error
+		if wait, err = time.ParseDuration(timeout); err != nil {
+			return nil, errors.Wrapf(err, "invalid timeout %q for the address of %s %s/%s", timeout, resourceType, namespace, name)
+		}
+	}
+	if m.DebugMode {
+		fmt.Fprintf(os.Stderr, "Waiting up to %s for the address of %s %s/%s\n", wait, resourceType, namespace, name)
+	}
+
+	deadline := time.Now().Add(wait)
+	for {
+		address, err := getAddress(ctx, client, resourceType, name, namespace)
+		if err != nil {
+			return nil, err
+		}
+		if address != "" {
+			return []byte(address), nil
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, errors.Errorf("timed out after %s waiting for the address of %s %s/%s", wait, resourceType, namespace, name)
+		}
+		if remaining > addressPollInterval {
+			remaining = addressPollInterval
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(remaining):
+		}
+	}
+}
+
+// getAddress returns the IP or the hostname of the first load balancer ingress of a Service or an Ingress,
+// or an empty string when the load balancer is not provisioned yet.
+func getAddress(ctx context.Context, client kubernetes.Interface, resourceType, name, namespace string) (string, error) {
+	switch strings.ToLower(resourceType) {
+	case "service", "services", "svc":
+		svc, err := client.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", wrapAddressError(err, resourceType, name, namespace)
+		}
+		for _, ingress := range svc.Status.LoadBalancer.Ingress {
+			if ingress.IP != "" {
+				return ingress.IP, nil
+			}
+			if ingress.Hostname != "" {
+				return ingress.Hostname, nil
+			}
+		}
+	case "ingress", "ingresses", "ing":
+		ing, err := client.NetworkingV1().Ingresses(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", wrapAddressError(err, resourceType, name, namespace)
+		}
+		for _, ingress := range ing.Status.LoadBalancer.Ingress {
+			if ingress.IP != "" {
+				return ingress.IP, nil
+			}
+			if ingress.Hostname != "" {
+				return ingress.Hostname, nil
+			}
+		}
+	default:
+		return "", errors.Errorf("unsupported resourceType %q for the address of a load balancer, allowed values are service, ingress", resourceType)
+	}
+	return "", nil
+}
+
+func wrapAddressError(err error, resourceType, name, namespace string) error {
+	if apierrors.IsNotFound(err) {
+		return errors.Errorf("couldn't find %s %s/%s", resourceType, namespace, name)
+	}
+	return errors.Wrapf(err, "error getting %s %s/%s", resourceType, namespace, name)
+}
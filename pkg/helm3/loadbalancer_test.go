@@ -0,0 +1,78 @@
+package helm3
+
+import (
+	"context"
+	"path"
+	"testing"
+	"time"
+
+	"get.porter.sh/porter/pkg/portercontext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestMixin_HandleOutputsWaitForAddress(t *testing.T) {
+	ctx := context.Background()
+	client := testclient.NewSimpleClientset(
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "myapp", Namespace: "mynamespace"},
+			Status: corev1.ServiceStatus{LoadBalancer: corev1.LoadBalancerStatus{
+				Ingress: []corev1.LoadBalancerIngress{{IP: "203.0.113.10"}},
+			}},
+		},
+		&networkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Name: "myapp", Namespace: "mynamespace"},
+			Status: networkingv1.IngressStatus{LoadBalancer: networkingv1.IngressLoadBalancerStatus{
+				Ingress: []networkingv1.IngressLoadBalancerIngress{{Hostname: "myapp.elb.example.com"}},
+			}},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "pending", Namespace: "mynamespace"},
+		},
+	)
+
+	testcases := []struct {
+		name         string
+		resourceType string
+		want         string
+	}{
+		{name: "service", resourceType: "service", want: "203.0.113.10"},
+		{name: "ingress", resourceType: "ingress", want: "myapp.elb.example.com"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := NewTestMixin(t)
+			outputs := []HelmOutput{{Name: "address", ResourceType: tc.resourceType, ResourceName: "myapp", WaitForAddress: true}}
+
+			err := m.handleOutputs(ctx, client, KubeArguments{}, "mynamespace", outputs)
+			require.NoError(t, err)
+
+			value, err := m.FileSystem.ReadFile(path.Join(portercontext.MixinOutputsDir, "address"))
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, string(value))
+		})
+	}
+
+	t.Run("timeout", func(t *testing.T) {
+		defer func(interval time.Duration) { addressPollInterval = interval }(addressPollInterval)
+		addressPollInterval = time.Millisecond
+
+		m := NewTestMixin(t)
+		outputs := []HelmOutput{{Name: "address", ResourceType: "service", ResourceName: "pending", WaitForAddress: true, Timeout: "10ms"}}
+
+		err := m.handleOutputs(ctx, client, KubeArguments{}, "mynamespace", outputs)
+		require.EqualError(t, err, "timed out after 10ms waiting for the address of service mynamespace/pending")
+	})
+
+	t.Run("unsupported resource type", func(t *testing.T) {
+		m := NewTestMixin(t)
+		outputs := []HelmOutput{{Name: "address", ResourceType: "pod", ResourceName: "myapp", WaitForAddress: true}}
+
+		err := m.handleOutputs(ctx, client, KubeArguments{}, "mynamespace", outputs)
+		require.EqualError(t, err, `unsupported resourceType "pod" for the address of a load balancer, allowed values are service, ingress`)
+	})
+}
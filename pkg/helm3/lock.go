@@ -0,0 +1,52 @@
+package helm3
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// lockRetryInterval is the interval between the attempts of a step that waits for the lock of its release
+var lockRetryInterval = 10 * time.Second
+
+// validateWaitForLock returns an error when waitForLock is not a duration.
+func validateWaitForLock(waitForLock string) error {
+	if waitForLock == "" {
+		return nil
+	}
+	if _, err := time.ParseDuration(waitForLock); err != nil {
+		return errors.Wrapf(err, "waitForLock %q is not a valid duration", waitForLock)
+	}
+	return nil
+}
+
+// runHelmWaitingForLock runs helm for the release, and when waitForLock is set and another operation holds the lock
+// of the release, retries until the other operation completed or waitForLock elapsed.
+func (m *Mixin) runHelmWaitingForLock(ctx context.Context, a helmArgs, env []string, waitForLock string) error {
+	err := m.runHelm(ctx, buildHelmArgs(a), env)
+	if waitForLock == "" {
+		return err
+	}
+
+	wait, _ := time.ParseDuration(waitForLock)
+	deadline := time.Now().Add(wait)
+	for {
+		var helmErr *HelmError
+		if !errors.As(err, &helmErr) || helmErr.Class != FailureOperationInProgress {
+			return err
+		}
+		if time.Now().Add(lockRetryInterval).After(deadline) {
+			return errors.Wrapf(err, "release %s is still locked by another operation after %s", a.Release, waitForLock)
+		}
+
+		fmt.Fprintf(m.Err, "Release %s is locked by another operation, retrying in %s\n", a.Release, lockRetryInterval)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(lockRetryInterval):
+		}
+		err = m.runHelm(ctx, buildHelmArgs(a), env)
+	}
+}
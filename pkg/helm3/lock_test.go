@@ -0,0 +1,61 @@
+package helm3
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"get.porter.sh/porter/pkg/test"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestMixin_InstallWaitForLock(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	defer os.Unsetenv(test.ExpectedCommandOutputEnv)
+	defer os.Unsetenv(test.ExpectedCommandExitCodeEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 upgrade --install mysql stable/mysql --atomic --create-namespace")
+	os.Setenv(test.ExpectedCommandOutputEnv, "Error: INSTALLATION FAILED: another operation (install/upgrade/rollback) is in progress")
+	os.Setenv(test.ExpectedCommandExitCodeEnv, "1")
+
+	interval := lockRetryInterval
+	lockRetryInterval = 10 * time.Millisecond
+	defer func() { lockRetryInterval = interval }()
+
+	step := InstallStep{
+		InstallArguments: InstallArguments{
+			Step: Step{Description: "Install MySQL"},
+			ChartArguments: ChartArguments{
+				Name:        "mysql",
+				Chart:       "stable/mysql",
+				WaitForLock: "25ms",
+			},
+		},
+	}
+	b, err := yaml.Marshal(InstallAction{Steps: []InstallStep{step}})
+	require.NoError(t, err)
+
+	h := NewTestMixin(t)
+	h.Setenv(verifyClientVersionEnv, "false")
+	h.In = bytes.NewReader(b)
+
+	err = h.Install(ctx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "release mysql is still locked by another operation after 25ms")
+	assert.Contains(t, h.TestContext.GetError(), "Release mysql is locked by another operation, retrying in 10ms\n")
+	var helmErr *HelmError
+	require.True(t, errors.As(err, &helmErr), "the error should be a HelmError: %v", err)
+	assert.Equal(t, FailureOperationInProgress, helmErr.Class)
+	assert.Equal(t, 14, ExitCode(err))
+}
+
+func TestValidateWaitForLock(t *testing.T) {
+	assert.NoError(t, validateWaitForLock(""))
+	assert.NoError(t, validateWaitForLock("5m"))
+	assert.EqualError(t, validateWaitForLock("5"), `waitForLock "5" is not a valid duration: time: missing unit in duration "5"`)
+}
@@ -0,0 +1,90 @@
+package helm3
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Output formats of the logs written by the install, upgrade and uninstall commands
+const (
+	OutputFormatText = "text"
+	OutputFormatJSON = "json"
+
+	// outputFormatEnv selects the output format when the --output flag isn't set
+	outputFormatEnv = "PORTER_MIXIN_OUTPUT_FORMAT"
+)
+
+// commandLog is the structured log line written for each helm command in the json output format
+type commandLog struct {
+	Step       string `json:"step,omitempty"`
+	Command    string `json:"command"`
+	DurationMs int64  `json:"durationMs"`
+	ExitCode   int    `json:"exitCode"`
+	Failure    string `json:"failure,omitempty"`
+	Stdout     string `json:"stdout,omitempty"`
+	Stderr     string `json:"stderr,omitempty"`
+}
+
+type stepContextKey struct{}
+
+// withStep records the step being executed, so that the helm commands are logged for the step.
+func withStep(ctx context.Context, step Step) context.Context {
+	return context.WithValue(ctx, stepContextKey{}, step)
+}
+
+func stepFromContext(ctx context.Context) Step {
+	step, _ := ctx.Value(stepContextKey{}).(Step)
+	return step
+}
+
+// getOutputFormat returns the output format set with --output, or with the environment variable.
+func (m *Mixin) getOutputFormat() string {
+	if m.OutputFormat != "" {
+		return m.OutputFormat
+	}
+	if format := m.Getenv(outputFormatEnv); format != "" {
+		return format
+	}
+	return OutputFormatText
+}
+
+// ValidateOutputFormat checks that the output format is supported.
+func (m *Mixin) ValidateOutputFormat() error {
+	switch format := m.getOutputFormat(); format {
+	case OutputFormatText, OutputFormatJSON:
+		return nil
+	default:
+		return errors.Errorf("unsupported output format %q, allowed values are %s and %s", format, OutputFormatText, OutputFormatJSON)
+	}
+}
+
+// logCommand writes the structured log line of a helm command that was executed.
+func (m *Mixin) logCommand(ctx context.Context, command string, duration time.Duration, err error, stdout, stderr string) {
+	step := stepFromContext(ctx)
+	if step.SuppressOutput {
+		stdout = ""
+	}
+
+	entry := commandLog{
+		Step:       step.Description,
+		Command:    command,
+		DurationMs: duration.Milliseconds(),
+		ExitCode:   exitCode(err),
+		Stdout:     stdout,
+		Stderr:     stderr,
+	}
+	if err != nil {
+		entry.Failure = string(classifyFailure(stdout + stderr))
+	}
+
+	line, jsonErr := json.Marshal(entry)
+	if jsonErr != nil {
+		fmt.Fprintf(m.Err, "could not log command %s: %s\n", command, jsonErr)
+		return
+	}
+	fmt.Fprintln(m.Out, string(line))
+}
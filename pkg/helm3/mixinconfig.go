@@ -0,0 +1,96 @@
+package helm3
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Errors of yaml for the fields that are not in the type they are decoded into, and for the fields set twice
+var (
+	unknownFieldError   = regexp.MustCompile(`^(line \d+): field (\S+) not found in type helm3\.(\w+)$`)
+	duplicateFieldError = regexp.MustCompile(`^(line \d+): field (\S+) already set in type helm3\.\w+$`)
+)
+
+// configTypes are the types of the mixin configuration, keyed by their name in the errors of yaml
+var configTypes = map[string]reflect.Type{
+	"MixinConfig":     reflect.TypeOf(MixinConfig{}),
+	"Repository":      reflect.TypeOf(Repository{}),
+	"Plugin":          reflect.TypeOf(Plugin{}),
+	"ExtraBuildLines": reflect.TypeOf(ExtraBuildLines{}),
+	"Platform":        reflect.TypeOf(Platform{}),
+}
+
+// validateConfig returns an error for the keys of the mixin configuration that the mixin doesn't know, like a typo
+// in the name of an option, which would otherwise be ignored, and for the keys that are set twice. The errors have
+// the line of the key in the build input, and suggest the known key closest to an unknown key.
+func validateConfig(contents []byte) error {
+	var input struct {
+		Config MixinConfig            `yaml:"config"`
+		Other  map[string]interface{} `yaml:",inline"`
+	}
+	err := yaml.UnmarshalStrict(contents, &input)
+	if err == nil {
+		return nil
+	}
+	typeErr, ok := err.(*yaml.TypeError)
+	if !ok {
+		return errors.Wrap(err, "invalid helm3 mixin configuration")
+	}
+
+	problems := make([]string, 0, len(typeErr.Errors))
+	for _, problem := range typeErr.Errors {
+		if match := unknownFieldError.FindStringSubmatch(problem); match != nil {
+			problem = match[1] + ": unknown field " + match[2]
+			if suggestion := closestField(configTypes[match[3]], match[2]); suggestion != "" {
+				problem += ", did you mean " + suggestion + "?"
+			}
+		} else if match := duplicateFieldError.FindStringSubmatch(problem); match != nil {
+			problem = match[1] + ": field " + match[2] + " is set more than once"
+		}
+		problems = append(problems, problem)
+	}
+	return errors.Errorf("invalid helm3 mixin configuration:\n  %s", strings.Join(problems, "\n  "))
+}
+
+// closestField returns the yaml key of the type closest to the unknown key, when it is a likely typo of it.
+func closestField(t reflect.Type, key string) string {
+	if t == nil {
+		return ""
+	}
+	best, bestDistance := "", len(key)/3+1
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		if distance := editDistance(strings.ToLower(key), strings.ToLower(name)); distance < bestDistance {
+			best, bestDistance = name, distance
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between two strings.
+func editDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
@@ -0,0 +1,51 @@
+package helm3
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateConfig(t *testing.T) {
+	require.NoError(t, validateConfig([]byte(`config:
+  clientVersion: v3.12.0
+  repositories:
+    stable:
+      url: https://charts.helm.sh/stable
+actions:
+  install:
+  - helm3:
+      name: mysql
+      anything: goes
+`)), "the actions are not validated")
+
+	err := validateConfig([]byte(`config:
+  clientVersio: v3.12.0
+  repositories:
+    stable:
+      url: https://charts.helm.sh/stable
+      vendorchart: true
+      skipUpdate: true
+      skipUpdate: false
+  somethingElse: true
+`))
+	require.Error(t, err)
+	assert.Equal(t, `invalid helm3 mixin configuration:
+  line 2: unknown field clientVersio, did you mean clientVersion?
+  line 6: unknown field vendorchart, did you mean vendorCharts?
+  line 8: field skipUpdate is set more than once
+  line 9: unknown field somethingElse`, err.Error())
+}
+
+func TestMixin_BuildInvalidConfig(t *testing.T) {
+	m := NewTestMixin(t)
+	m.In = bytes.NewReader([]byte("config:\n  defaultNamspace: myapp\n"))
+
+	err := m.Build(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "line 2: unknown field defaultNamspace, did you mean defaultNamespace?")
+	assert.Empty(t, m.TestContext.GetOutput())
+}
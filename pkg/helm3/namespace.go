@@ -0,0 +1,150 @@
+package helm3
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8s "k8s.io/client-go/kubernetes"
+)
+
+// releaseNamespace returns the namespace passed to helm, where helm stores the information of the release: the
+// releaseNamespace of the step when it is set, instead of its namespace.
+func releaseNamespace(namespace string, releaseNamespace string) string {
+	if releaseNamespace != "" {
+		return releaseNamespace
+	}
+	return namespace
+}
+
+// checkReleaseNamespace returns an error when the step sets both a namespace and a different releaseNamespace.
+// Helm creates the namespaced resources of a chart in the namespace of the release, so a chart stored in another
+// namespace than the namespace of its resources must set the namespace of its resources itself.
+func checkReleaseNamespace(namespace string, releaseNamespace string) error {
+	if namespace != "" && releaseNamespace != "" && namespace != releaseNamespace {
+		return errors.Errorf("namespace %s and releaseNamespace %s cannot both be set, helm creates the resources of the chart that don't set their namespace in the namespace of the release", namespace, releaseNamespace)
+	}
+	return nil
+}
+
+// createNamespace creates the namespace of the release with the namespaceLabels and namespaceAnnotations of the step
+// before helm runs, so that labels like pod-security.kubernetes.io/enforce or istio-injection apply to the pods of
+// the release, which they wouldn't if they were added after helm created the namespace with --create-namespace.
+// Namespaces that already exist are left as is, and nothing is done when createNamespace is false.
+func (m *Mixin) createNamespace(ctx context.Context, kubeClient k8s.Interface, a helmArgs, labels map[string]string, annotations map[string]string) error {
+	if len(labels) == 0 && len(annotations) == 0 {
+		return nil
+	}
+	return m.ensureNamespace(ctx, kubeClient, a, labels, annotations)
+}
+
+// ensureNamespace creates the namespace of the release, with the labels and annotations, when it doesn't exist
+// and createNamespace isn't false.
+func (m *Mixin) ensureNamespace(ctx context.Context, kubeClient k8s.Interface, a helmArgs, labels map[string]string, annotations map[string]string) error {
+	if a.Namespace == "" || (a.CreateNamespace != nil && !*a.CreateNamespace) {
+		return nil
+	}
+
+	var err error
+	if kubeClient == nil {
+		kubeClient, err = m.getKubernetesClient(a)
+		if err != nil {
+			return errors.Wrap(err, "couldn't get kubernetes client")
+		}
+	}
+
+	_, err = kubeClient.CoreV1().Namespaces().Get(ctx, a.Namespace, metav1.GetOptions{})
+	if err == nil {
+		return nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "could not get namespace %s", a.Namespace)
+	}
+
+	fmt.Fprintf(m.Err, "Creating namespace %s of release %s\n", a.Namespace, a.Release)
+	namespace := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        a.Namespace,
+			Labels:      labels,
+			Annotations: annotations,
+		},
+	}
+	_, err = kubeClient.CoreV1().Namespaces().Create(ctx, namespace, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return errors.Wrapf(err, "could not create namespace %s", a.Namespace)
+	}
+	return nil
+}
+
+// protectedNamespaces are never deleted by deleteNamespace, because the cluster does not work without them
+var protectedNamespaces = []string{"default", "kube-system", "kube-public", "kube-node-lease"}
+
+// defaultNamespaceDeletionTimeout is how long the deletion of a namespace is waited for when the step has no timeout
+const defaultNamespaceDeletionTimeout = 5 * time.Minute
+
+// namespacePollInterval is how often the namespace is checked while its deletion is waited for
+var namespacePollInterval = 2 * time.Second
+
+// deleteNamespace deletes the namespace of the releases after they were uninstalled, so that the bundles that own
+// their namespace leave nothing behind. With wait, it waits until the namespace is terminated, up to the timeout.
+func (m *Mixin) deleteNamespace(ctx context.Context, a helmArgs) error {
+	if a.Namespace == "" {
+		return errors.New("deleteNamespace requires the namespace of the releases, set with namespace or defaultNamespace")
+	}
+	for _, protected := range protectedNamespaces {
+		if a.Namespace == protected {
+			return errors.Errorf("namespace %s cannot be deleted with deleteNamespace", a.Namespace)
+		}
+	}
+
+	kubeClient, err := m.getKubernetesClient(a)
+	if err != nil {
+		return errors.Wrap(err, "couldn't get kubernetes client")
+	}
+
+	fmt.Fprintf(m.Err, "Deleting namespace %s\n", a.Namespace)
+	err = kubeClient.CoreV1().Namespaces().Delete(ctx, a.Namespace, metav1.DeleteOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "could not delete namespace %s", a.Namespace)
+	}
+	if !isTrue(a.Wait) {
+		return nil
+	}
+
+	timeout := defaultNamespaceDeletionTimeout
+	if a.Timeout != "" {
+		if timeout, err = time.ParseDuration(a.Timeout); err != nil {
+			return errors.Wrapf(err, "invalid timeout %q", a.Timeout)
+		}
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		_, err = kubeClient.CoreV1().Namespaces().Get(ctx, a.Namespace, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "could not get namespace %s", a.Namespace)
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return errors.Errorf("timed out after %s waiting for namespace %s to be deleted", timeout, a.Namespace)
+		}
+		if remaining > namespacePollInterval {
+			remaining = namespacePollInterval
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(remaining):
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package helm3
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestMixin_CreateNamespace(t *testing.T) {
+	ctx := context.Background()
+	labels := map[string]string{"pod-security.kubernetes.io/enforce": "restricted"}
+	annotations := map[string]string{"owner": "platform-team"}
+
+	t.Run("missing namespace", func(t *testing.T) {
+		client := testclient.NewSimpleClientset()
+		m := NewTestMixin(t)
+
+		err := m.createNamespace(ctx, client, helmArgs{Release: "myapp", Namespace: "myapp"}, labels, annotations)
+		require.NoError(t, err)
+
+		ns, err := client.CoreV1().Namespaces().Get(ctx, "myapp", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, labels, ns.Labels)
+		assert.Equal(t, annotations, ns.Annotations)
+	})
+
+	t.Run("existing namespace", func(t *testing.T) {
+		client := testclient.NewSimpleClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "myapp"}})
+		m := NewTestMixin(t)
+
+		err := m.createNamespace(ctx, client, helmArgs{Release: "myapp", Namespace: "myapp"}, labels, annotations)
+		require.NoError(t, err)
+
+		ns, err := client.CoreV1().Namespaces().Get(ctx, "myapp", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, ns.Labels, "an existing namespace should not be changed")
+	})
+
+	t.Run("createNamespace false", func(t *testing.T) {
+		client := testclient.NewSimpleClientset()
+		m := NewTestMixin(t)
+		createNamespace := false
+
+		err := m.createNamespace(ctx, client, helmArgs{Release: "myapp", Namespace: "myapp", CreateNamespace: &createNamespace}, labels, annotations)
+		require.NoError(t, err)
+
+		_, err = client.CoreV1().Namespaces().Get(ctx, "myapp", metav1.GetOptions{})
+		assert.True(t, apierrors.IsNotFound(err), "the namespace should not be created")
+	})
+}
+
+func TestMixin_DeleteNamespace(t *testing.T) {
+	ctx := context.Background()
+	wait := true
+
+	t.Run("owned namespace", func(t *testing.T) {
+		client := testclient.NewSimpleClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "myapp"}})
+		m := NewTestMixin(t)
+		m.ClientFactory = &clientKubernetesFactory{client: client}
+
+		err := m.deleteNamespace(ctx, helmArgs{Namespace: "myapp", Wait: &wait, Timeout: "1s"})
+		require.NoError(t, err)
+
+		_, err = client.CoreV1().Namespaces().Get(ctx, "myapp", metav1.GetOptions{})
+		assert.True(t, apierrors.IsNotFound(err), "the namespace should be deleted")
+		assert.Contains(t, m.TestContext.GetError(), "Deleting namespace myapp")
+	})
+
+	t.Run("missing namespace", func(t *testing.T) {
+		m := NewTestMixin(t)
+		m.ClientFactory = &clientKubernetesFactory{client: testclient.NewSimpleClientset()}
+
+		err := m.deleteNamespace(ctx, helmArgs{Namespace: "myapp"})
+		require.NoError(t, err)
+	})
+
+	t.Run("protected namespace", func(t *testing.T) {
+		m := NewTestMixin(t)
+
+		err := m.deleteNamespace(ctx, helmArgs{Namespace: "kube-system"})
+		require.EqualError(t, err, "namespace kube-system cannot be deleted with deleteNamespace")
+	})
+
+	t.Run("no namespace", func(t *testing.T) {
+		m := NewTestMixin(t)
+
+		err := m.deleteNamespace(ctx, helmArgs{})
+		require.EqualError(t, err, "deleteNamespace requires the namespace of the releases, set with namespace or defaultNamespace")
+	})
+}
+
+func TestCheckReleaseNamespace(t *testing.T) {
+	assert.NoError(t, checkReleaseNamespace("", "releases"))
+	assert.NoError(t, checkReleaseNamespace("releases", "releases"))
+	assert.NoError(t, checkReleaseNamespace("db", ""))
+	err := checkReleaseNamespace("db", "releases")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "namespace db and releaseNamespace releases cannot both be set")
+}
@@ -0,0 +1,154 @@
+package helm3
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// offlineEnv hands the offline setting of the mixin configuration over to the invocation image
+const offlineEnv = "HELM3_MIXIN_OFFLINE"
+
+// isOffline returns true when the mixin configuration or the step being executed forbid the operations that need
+// the network.
+func (m *Mixin) isOffline(ctx context.Context) bool {
+	if stepFromContext(ctx).Offline {
+		return true
+	}
+	offline := m.getBoolEnv(offlineEnv)
+	return offline != nil && *offline
+}
+
+// offlineError returns the error of an offline step that needs the network for the operations.
+func offlineError(operations []string) error {
+	return errors.Errorf("the step is offline, but it needs the network to %s", strings.Join(operations, ", "))
+}
+
+// checkOffline returns an error when the step is offline and the release needs the network: to pull a chart that
+// is not vendored or local, to update its dependencies or its repository, or to download values files. a are the
+// arguments of helm after the vendored chart was selected, valuesFrom the values files of the step not yet resolved.
+func (m *Mixin) checkOffline(ctx context.Context, a helmArgs, valuesFrom []ValuesSource) error {
+	if !m.isOffline(ctx) {
+		return nil
+	}
+
+	var operations []string
+	switch {
+	case a.Chart == "":
+	case isChartURL(a.Chart):
+		operations = append(operations, fmt.Sprintf("download chart %s", a.Chart))
+	case isOCIRemote(a.Chart):
+		operations = append(operations, fmt.Sprintf("pull chart %s from its registry", a.Chart))
+	case !isLocalChartPath(a.Chart):
+		operations = append(operations, fmt.Sprintf("pull chart %s from its repository, vendor it with vendorCharts", a.Chart))
+	default:
+		for _, dependency := range m.remoteChartDependencies(a.Chart) {
+			operations = append(operations, fmt.Sprintf("download the dependency %s of chart %s", dependency, a.Chart))
+		}
+	}
+	if a.DependencyUpdate {
+		operations = append(operations, fmt.Sprintf("update the dependencies of chart %s", a.Chart))
+	}
+	if update := m.getBoolEnv(updateReposEnv); update != nil && *update && chartRepoName(a) != "" && a.RepositoryCache == "" {
+		operations = append(operations, fmt.Sprintf("update repository %s", chartRepoName(a)))
+	}
+	for _, file := range a.Values {
+		if isValuesURL(file) {
+			operations = append(operations, fmt.Sprintf("download values file %s", file))
+		}
+	}
+	for _, source := range valuesFrom {
+		if source.URL != "" {
+			operations = append(operations, fmt.Sprintf("download values file %s", source.URL))
+		}
+	}
+
+	if len(operations) > 0 {
+		return offlineError(operations)
+	}
+	return nil
+}
+
+// remoteChartDependencies returns the names of the dependencies of a chart directory that are downloaded from a
+// repository, instead of a file:// path.
+func (m *Mixin) remoteChartDependencies(chart string) []string {
+	chartFile, err := m.FileSystem.ReadFile(filepath.Join(chart, "Chart.yaml"))
+	if err != nil {
+		return nil
+	}
+	var metadata struct {
+		Dependencies []struct {
+			Name       string `yaml:"name"`
+			Repository string `yaml:"repository"`
+		} `yaml:"dependencies"`
+	}
+	if err := yaml.Unmarshal(chartFile, &metadata); err != nil {
+		return nil
+	}
+
+	var names []string
+	for _, dependency := range metadata.Dependencies {
+		if dependency.Repository != "" && !strings.HasPrefix(dependency.Repository, "file://") {
+			names = append(names, dependency.Name)
+		}
+	}
+	return names
+}
+
+// networkOperations returns the operations of the command that need the network.
+func (c Commands) networkOperations() []string {
+	switch {
+	case c.RegistryLogin != nil:
+		return []string{fmt.Sprintf("log in to registry %s", c.RegistryLogin.Host)}
+	case c.Push != nil:
+		return []string{fmt.Sprintf("push chart %s to %s", c.Push.Chart, c.Push.Remote)}
+	case c.Pull != nil:
+		return []string{fmt.Sprintf("pull chart %s", c.Pull.Chart)}
+	case c.Show != nil && !isLocalChartPath(c.Show.Chart):
+		return []string{fmt.Sprintf("show chart %s", c.Show.Chart)}
+	case c.Export != nil && !isLocalChartPath(c.Export.Chart):
+		return []string{fmt.Sprintf("render chart %s", c.Export.Chart)}
+	case c.Dependency != nil && c.Dependency.Subcommand != "list":
+		return []string{fmt.Sprintf("download the dependencies of chart %s", c.Dependency.Chart)}
+	}
+	return nil
+}
+
+// checkOffline returns an error when the mixin is offline and the bundle needs the network when it runs: to
+// update the repositories, or to pull a chart that is not vendored in the invocation image.
+func (input BuildInput) checkOffline(vendored []vendoredChart) error {
+	if !input.Config.Offline {
+		return nil
+	}
+	if input.Config.UpdateReposAtRuntime {
+		return errors.New("updateReposAtRuntime cannot be set when the mixin is offline")
+	}
+
+	isVendored := map[vendoredChart]bool{}
+	for _, chart := range vendored {
+		isVendored[chart] = true
+	}
+	actions := make([]string, 0, len(input.Actions))
+	for action := range input.Actions {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+
+	for _, action := range actions {
+		for _, step := range input.Actions[action] {
+			for _, release := range step.releases() {
+				chart := release.Chart
+				if chart == "" || isLocalChartPath(chart) || isVendored[vendoredChart{Chart: chart, Version: release.Version}] {
+					continue
+				}
+				return errors.Errorf("chart %s of the %s action is pulled when the bundle runs, but the mixin is offline, vendor it with vendorCharts or use a local chart", chart, action)
+			}
+		}
+	}
+	return nil
+}
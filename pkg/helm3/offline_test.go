@@ -0,0 +1,94 @@
+package helm3
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestMixin_CheckOffline(t *testing.T) {
+	ctx := context.Background()
+	offlineCtx := withStep(ctx, Step{Offline: true})
+
+	h := NewTestMixin(t)
+	require.NoError(t, h.checkOffline(ctx, helmArgs{Chart: "stable/mysql"}, nil), "steps are online by default")
+	require.NoError(t, h.checkOffline(offlineCtx, helmArgs{Chart: "/cnab/app/charts/stable/mysql-1.6.2.tgz"}, nil))
+
+	err := h.checkOffline(offlineCtx, helmArgs{Chart: "stable/mysql", DependencyUpdate: true}, nil)
+	assert.EqualError(t, err, "the step is offline, but it needs the network to pull chart stable/mysql from its repository, "+
+		"vendor it with vendorCharts, update the dependencies of chart stable/mysql")
+
+	err = h.checkOffline(offlineCtx, helmArgs{Chart: "oci://registry.example.com/charts/mysql"}, nil)
+	assert.EqualError(t, err, "the step is offline, but it needs the network to pull chart oci://registry.example.com/charts/mysql from its registry")
+
+	require.NoError(t, h.FileSystem.WriteFile("/cnab/app/charts/web/Chart.yaml", []byte(`name: web
+dependencies:
+- name: common
+  repository: file://../common
+- name: redis
+  repository: https://charts.bitnami.com/bitnami
+`), 0644))
+	err = h.checkOffline(offlineCtx, helmArgs{Chart: "/cnab/app/charts/web"}, nil)
+	assert.EqualError(t, err, "the step is offline, but it needs the network to download the dependency redis of chart /cnab/app/charts/web")
+
+	h.Setenv(offlineEnv, "true")
+	h.Setenv(updateReposEnv, "true")
+	err = h.checkOffline(ctx, helmArgs{Chart: "stable/mysql", RepositoryCache: pinnedRepositoryCacheDir}, nil)
+	assert.Contains(t, err.Error(), "pull chart stable/mysql from its repository")
+	assert.NotContains(t, err.Error(), "update repository", "pinned repositories are not updated")
+
+	err = h.checkOffline(offlineCtx, helmArgs{Chart: "/cnab/app/charts/stable/mysql-1.6.2.tgz", Values: []string{"values/base.yaml", "https://config.example.com/mysql.yaml"}},
+		[]ValuesSource{{File: "values/prod.yaml"}, {URL: "https://config.example.com/prod.yaml"}})
+	assert.EqualError(t, err, "the step is offline, but it needs the network to download values file https://config.example.com/mysql.yaml, "+
+		"download values file https://config.example.com/prod.yaml")
+}
+
+func TestMixin_OfflineCommand(t *testing.T) {
+	ctx := context.Background()
+	action := InstallAction{Steps: []InstallStep{{InstallArguments: InstallArguments{
+		Step: Step{
+			Description: "Pull mysql",
+			Offline:     true,
+			Commands:    Commands{Pull: &PullArguments{Chart: "stable/mysql"}},
+		},
+	}}}}
+	b, err := yaml.Marshal(action)
+	require.NoError(t, err)
+
+	h := NewTestMixin(t)
+	h.In = bytes.NewReader(b)
+
+	err = h.Install(ctx)
+	assert.EqualError(t, err, "the step is offline, but it needs the network to pull chart stable/mysql")
+}
+
+func TestBuildInput_CheckOffline(t *testing.T) {
+	var input BuildInput
+	err := yaml.Unmarshal([]byte(`
+config:
+  offline: true
+actions:
+  install:
+  - helm3:
+      name: web
+      chart: ./charts/web
+  - helm3:
+      name: mysql
+      chart: stable/mysql
+      version: 1.6.2
+`), &input)
+	require.NoError(t, err)
+
+	err = input.checkOffline(nil)
+	assert.EqualError(t, err, "chart stable/mysql of the install action is pulled when the bundle runs, but the mixin is offline, vendor it with vendorCharts or use a local chart")
+
+	assert.NoError(t, input.checkOffline([]vendoredChart{{Chart: "stable/mysql", Version: "1.6.2"}}))
+
+	input.Config.UpdateReposAtRuntime = true
+	err = input.checkOffline([]vendoredChart{{Chart: "stable/mysql", Version: "1.6.2"}})
+	assert.EqualError(t, err, "updateReposAtRuntime cannot be set when the mixin is offline")
+}
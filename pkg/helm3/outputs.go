@@ -2,11 +2,15 @@ package helm3
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 
+	"get.porter.sh/porter/pkg/tracing"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
@@ -31,60 +35,178 @@ func (m *Mixin) getSecret(ctx context.Context, client kubernetes.Interface, name
 	return val, nil
 }
 
-func (m *Mixin) getOutput(ctx context.Context, resourceType, resourceName, namespace, jsonPath string) ([]byte, error) {
+// getSelectedSecret returns the key of the first secret, sorted by name, that matches the label selector,
+// for charts that generate the name of the secret.
+func (m *Mixin) getSelectedSecret(ctx context.Context, client kubernetes.Interface, namespace, selector, key string) ([]byte, error) {
+	if namespace == "" {
+		namespace = "default"
+	}
+	if m.DebugMode {
+		fmt.Fprintf(os.Stderr, "Retrieving the secret in %s matching %s and using key %s as an output\n", namespace, selector, key)
+	}
+
+	secrets, err := client.CoreV1().Secrets(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error listing the secrets in %s matching %s", namespace, selector)
+	}
+	if len(secrets.Items) == 0 {
+		return nil, errors.Errorf("couldn't find a secret in %s matching %s", namespace, selector)
+	}
+	sort.Slice(secrets.Items, func(i, j int) bool {
+		return secrets.Items[i].Name < secrets.Items[j].Name
+	})
+	secret := secrets.Items[0]
+	val, ok := secret.Data[key]
+	if !ok {
+		return nil, fmt.Errorf("couldn't find key %s in secret %s/%s", key, namespace, secret.Name)
+	}
+	return val, nil
+}
+
+// getConfigMap returns the key of a config map
+func (m *Mixin) getConfigMap(ctx context.Context, client kubernetes.Interface, namespace, name, key string) ([]byte, error) {
+	if namespace == "" {
+		namespace = "default"
+	}
+	if m.DebugMode {
+		fmt.Fprintf(os.Stderr, "Retrieving config map %s/%s and using key %s as an output\n", namespace, name, key)
+	}
+
+	configMap, err := client.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting config map %s/%s", namespace, name)
+	}
+	if val, ok := configMap.Data[key]; ok {
+		return []byte(val), nil
+	}
+	if val, ok := configMap.BinaryData[key]; ok {
+		return val, nil
+	}
+	return nil, fmt.Errorf("couldn't find key %s in config map %s/%s", key, namespace, name)
+}
+
+func (m *Mixin) getOutput(ctx context.Context, kube KubeArguments, resourceType, resourceName, namespace, jsonPath string) ([]byte, error) {
 	args := []string{"get", resourceType, resourceName}
 	args = append(args, fmt.Sprintf("-o=jsonpath=%s", jsonPath))
 	if namespace != "" {
 		args = append(args, fmt.Sprintf("--namespace=%s", namespace))
 	}
+	args = append(args, kube.kubectlFlags()...)
 	cmd := m.NewCommand(ctx, "kubectl", args...)
 	cmd.Stderr = m.Err
 	out, err := cmd.Output()
 	if err != nil {
-		prettyCmd := fmt.Sprintf("%s%s", cmd.Dir, strings.Join(cmd.Args, " "))
+		prettyCmd := fmt.Sprintf("%s%s", cmd.Dir, strings.Join(maskCredentials(cmd.Args), " "))
 		return nil, errors.Wrap(err, fmt.Sprintf("couldn't run command %s", prettyCmd))
 	}
 	return out, nil
 }
 
-func (m *Mixin) handleOutputs(ctx context.Context, client kubernetes.Interface, namespace string, outputs []HelmOutput) error {
-	var outputError error
+// handleOutputs writes the outputs of a step, read from the cluster selected by the kube arguments of the step.
+func (m *Mixin) handleOutputs(ctx context.Context, client kubernetes.Interface, kube KubeArguments, namespace string, outputs []HelmOutput) error {
+	ctx, log := tracing.StartSpan(ctx, attribute.Int("outputs", len(outputs)))
+	defer log.EndSpan()
+
 	//Now get the outputs
 	for _, output := range outputs {
+		val, ok, err := m.getOutputValue(ctx, client, kube, namespace, output)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
 
-		if output.Secret != "" && output.Key != "" {
-			// Override namespace if output.Namespace is set
-			if output.Namespace != "" {
-				namespace = output.Namespace
-			}
+		if err := m.Context.WriteMixinOutputToFile(output.Name, val); err != nil {
+			return errors.Wrapf(err, "unable to write output '%s'", output.Name)
+		}
+		m.debugOutput(output, val)
+	}
+	return nil
+}
 
-			val, err := m.getSecret(ctx, client, namespace, output.Secret, output.Key)
+// debugOutput prints the value of an output that was written, masking the sensitive outputs.
+func (m *Mixin) debugOutput(output HelmOutput, val []byte) {
+	if !m.DebugMode {
+		return
+	}
 
-			if err != nil {
-				return err
-			}
+	if output.Path != "" {
+		// files are not printed, they can be large or binary
+		fmt.Fprintf(m.Err, "DEBUG: output %s written from %s (%d bytes)\n", output.Name, output.Path, len(val))
+		return
+	}
 
-			outputError = m.Context.WriteMixinOutputToFile(output.Name, val)
-		}
+	value := string(val)
+	if output.isSensitive() {
+		value = "*******"
+	}
+	fmt.Fprintf(m.Err, "DEBUG: output %s=%s\n", output.Name, value)
+}
 
-		if output.ResourceType != "" && output.ResourceName != "" && output.JSONPath != "" {
-			bytes, err := m.getOutput(ctx,
-				output.ResourceType,
-				output.ResourceName,
-				output.Namespace,
-				output.JSONPath,
-			)
-			if err != nil {
-				return err
-			}
+// getFileOutput returns the contents of a file produced by the step
+func (m *Mixin) getFileOutput(path string) ([]byte, error) {
+	data, err := m.FileSystem.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't read the output file %s", path)
+	}
+	return data, nil
+}
 
-			outputError = m.Context.WriteMixinOutputToFile(output.Name, bytes)
+// getOutputValue returns the value of an output from the source that it selects, or false when it does not select one.
+func (m *Mixin) getOutputValue(ctx context.Context, client kubernetes.Interface, kube KubeArguments, namespace string, output HelmOutput) ([]byte, bool, error) {
+	// Override namespace if output.Namespace is set
+	if output.Namespace != "" {
+		namespace = output.Namespace
+	}
 
+	var val []byte
+	var err error
+	switch {
+	case len(output.Fields) > 0:
+		val, err = m.getCompositeOutput(ctx, client, kube, namespace, output)
+	case output.Secret != "" && output.Key != "":
+		val, err = m.getSecret(ctx, client, namespace, output.Secret, output.Key)
+	case output.SecretSelector != "" && output.Key != "":
+		val, err = m.getSelectedSecret(ctx, client, namespace, output.SecretSelector, output.Key)
+	case output.ConfigMap != "" && output.Key != "":
+		val, err = m.getConfigMap(ctx, client, namespace, output.ConfigMap, output.Key)
+	case output.WaitForAddress && output.ResourceType != "" && output.ResourceName != "":
+		val, err = m.getLoadBalancerAddress(ctx, client, output.ResourceType, output.ResourceName, namespace, output.Timeout)
+	case output.ResourceType != "" && output.ResourceName != "" && output.JSONPath != "":
+		val, err = m.getOutput(ctx, kube, output.ResourceType, output.ResourceName, output.Namespace, output.JSONPath)
+	case output.Path != "":
+		val, err = m.getFileOutput(output.Path)
+	default:
+		return nil, false, nil
+	}
+	return val, true, err
+}
+
+// getCompositeOutput returns a JSON object with the value of each field of the output, for example to build
+// a connection string from the host of a service and the password of a secret. The fields inherit the
+// namespace of the output.
+func (m *Mixin) getCompositeOutput(ctx context.Context, client kubernetes.Interface, kube KubeArguments, namespace string, output HelmOutput) ([]byte, error) {
+	fields := make(map[string]json.RawMessage, len(output.Fields))
+	for name, field := range output.Fields {
+		if field.Namespace == "" {
+			field.Namespace = output.Namespace
+		}
+		val, ok, err := m.getOutputValue(ctx, client, kube, namespace, field)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to get field %s of output '%s'", name, output.Name)
+		}
+		if !ok {
+			return nil, errors.Errorf("field %s of output '%s' does not select a secret, configMap, resource or path", name, output.Name)
 		}
 
-		if outputError != nil {
-			return errors.Wrapf(outputError, "unable to write output '%s'", output.Name)
+		if len(field.Fields) == 0 {
+			// Values are strings, only nested fields are objects
+			if val, err = json.Marshal(string(val)); err != nil {
+				return nil, errors.Wrapf(err, "unable to encode field %s of output '%s'", name, output.Name)
+			}
 		}
+		fields[name] = val
 	}
-	return nil
+	return json.Marshal(fields)
 }
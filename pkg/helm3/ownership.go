@@ -0,0 +1,141 @@
+package helm3
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ownershipLabelsEnv hands the ownershipLabels of the mixin configuration over to the invocation image
+const ownershipLabelsEnv = "HELM3_MIXIN_OWNERSHIP_LABELS"
+
+// Labels set on the releases, linking them to the Porter installation that owns them
+const (
+	installationLabel          = "porter.sh/installation"
+	installationNamespaceLabel = "porter.sh/installation-namespace"
+	bundleVersionLabel         = "porter.sh/bundle-version"
+	runLabel                   = "porter.sh/run"
+)
+
+// Environment variables of the invocation image that describe the installation and the run
+const (
+	installationNameEnv      = "CNAB_INSTALLATION_NAME"
+	installationNamespaceEnv = "PORTER_INSTALLATION_NAMESPACE"
+	bundleVersionEnv         = "CNAB_BUNDLE_VERSION"
+	runEnv                   = "CNAB_REVISION"
+)
+
+// invalidLabelChars are the characters replaced in the values of the labels
+var invalidLabelChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// ListArguments are the arguments of the list command
+type ListArguments struct {
+	// Installation is the name of the installation that owns the releases, it defaults to the current installation
+	Installation string `yaml:"installation,omitempty"`
+
+	// InstallationNamespace is the namespace of the installation, it defaults to the namespace of the current installation
+	InstallationNamespace string `yaml:"installationNamespace,omitempty"`
+
+	Namespace     string `yaml:"namespace,omitempty"`
+	AllNamespaces bool   `yaml:"allNamespaces,omitempty"`
+
+	// Output is the name of an output that is set to the releases, as listed by helm in JSON
+	Output string `yaml:"output,omitempty"`
+}
+
+// labelValue returns a valid label value: the characters that labels don't allow are replaced,
+// and the value is truncated to 63 characters.
+func labelValue(value string) string {
+	value = invalidLabelChars.ReplaceAllString(value, "_")
+	if len(value) > 63 {
+		value = value[:63]
+	}
+	return strings.Trim(value, "_.-")
+}
+
+// ownershipLabels returns the labels that link a release to the Porter installation, when ownershipLabels is set
+// in the mixin configuration. The labels whose value is unknown are not set.
+func (m *Mixin) ownershipLabels() map[string]string {
+	if enabled := m.getBoolEnv(ownershipLabelsEnv); enabled == nil || !*enabled {
+		return nil
+	}
+
+	labels := map[string]string{}
+	for label, env := range map[string]string{
+		installationLabel:          installationNameEnv,
+		installationNamespaceLabel: installationNamespaceEnv,
+		bundleVersionLabel:         bundleVersionEnv,
+		runLabel:                   runEnv,
+	} {
+		if value := labelValue(m.Getenv(env)); value != "" {
+			labels[label] = value
+		}
+	}
+	if len(labels) == 0 {
+		return nil
+	}
+	return labels
+}
+
+// formatLabels returns the labels in the KEY=VALUE,KEY=VALUE form of helm, sorted by key.
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// listReleases lists the releases owned by an installation, from their ownership labels.
+func (m *Mixin) listReleases(ctx context.Context, a ListArguments) error {
+	releases, err := m.ownedReleases(ctx, a)
+	if err != nil {
+		return err
+	}
+
+	if a.Output != "" {
+		err = m.WriteMixinOutputToFile(a.Output, releases)
+		if err != nil {
+			return errors.Wrapf(err, "unable to write output '%s'", a.Output)
+		}
+	}
+	return nil
+}
+
+// ownedReleases returns the releases owned by an installation, as listed by helm in JSON.
+func (m *Mixin) ownedReleases(ctx context.Context, a ListArguments) ([]byte, error) {
+	installation := a.Installation
+	namespace := a.InstallationNamespace
+	if installation == "" {
+		installation = m.Getenv(installationNameEnv)
+		if namespace == "" {
+			namespace = m.Getenv(installationNamespaceEnv)
+		}
+	}
+	if installation == "" {
+		return nil, errors.New("list requires an installation")
+	}
+
+	selector := installationLabel + "=" + labelValue(installation)
+	if namespace != "" {
+		selector += "," + installationNamespaceLabel + "=" + labelValue(namespace)
+	}
+	args := []string{"list", "--all", "--output", "json", "--selector", selector}
+	if a.AllNamespaces {
+		args = append(args, "--all-namespaces")
+	} else if a.Namespace != "" {
+		args = append(args, "--namespace", a.Namespace)
+	}
+
+	stdout := &bytes.Buffer{}
+	err := m.runHelmWithStdout(ctx, args, nil, stdout)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not list the releases of installation %s", installation)
+	}
+	return stdout.Bytes(), nil
+}
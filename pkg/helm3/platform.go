@@ -0,0 +1,226 @@
+package helm3
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Image platforms select how helm and kubectl are installed in the invocation image
+const (
+	// ImagePlatformDefault downloads helm and kubectl with curl, on a Debian based image
+	ImagePlatformDefault = ""
+
+	// ImagePlatformCopyFromImage copies helm and kubectl from their container images,
+	// without depending on apt or curl in the invocation image
+	ImagePlatformCopyFromImage = "copy-from-image"
+
+	// ImagePlatformWindows downloads helm and kubectl with PowerShell, on a Windows based image
+	ImagePlatformWindows = "windows"
+)
+
+// Platform is a custom image platform declared in the mixin configuration, selected with imagePlatform, for base
+// images that the built-in platforms don't support, like Alpine or distroless images.
+type Platform struct {
+	Name string `yaml:"name"`
+
+	// Init are the Dockerfile lines that install helm as helm3 and kubectl. The placeholders {{helmVersion}},
+	// {{kubectlVersion}}, {{clientPlatform}} and {{clientArchitecture}} are replaced with the versions, the platform
+	// and the architecture of the clients.
+	Init []string `yaml:"init"`
+}
+
+// validatePlatforms checks that the custom platforms have a unique name, that is not the name of a built-in
+// platform, and init lines.
+func validatePlatforms(platforms []Platform) error {
+	names := map[string]bool{}
+	for i, platform := range platforms {
+		switch {
+		case platform.Name == "":
+			return errors.Errorf("platform %d must set a name", i+1)
+		case platform.Name == ImagePlatformCopyFromImage || platform.Name == ImagePlatformWindows:
+			return errors.Errorf("platform %s has the name of a built-in image platform", platform.Name)
+		case names[platform.Name]:
+			return errors.Errorf("platform %s is declared more than once", platform.Name)
+		case len(platform.Init) == 0:
+			return errors.Errorf("platform %s must set the init lines that install helm3 and kubectl", platform.Name)
+		}
+		names[platform.Name] = true
+	}
+	return nil
+}
+
+// customPlatform returns the custom platform selected with imagePlatform, or nil.
+func (c MixinConfig) customPlatform() *Platform {
+	for i := range c.Platforms {
+		if c.Platforms[i].Name == c.ImagePlatform {
+			return &c.Platforms[i]
+		}
+	}
+	return nil
+}
+
+// writeCustomClientInstall writes the init lines of a custom platform.
+func (m *Mixin) writeCustomClientInstall(platform Platform) {
+	replacer := strings.NewReplacer(
+		"{{helmVersion}}", m.HelmClientVersion,
+		"{{kubectlVersion}}", m.APIVersion,
+		"{{clientPlatform}}", m.HelmClientPlatform,
+		"{{clientArchitecture}}", m.HelmClientArchitecture,
+	)
+	init := make([]string, 0, len(platform.Init))
+	for _, line := range platform.Init {
+		init = append(init, replacer.Replace(line))
+	}
+	m.writeBundleLines(init)
+}
+
+// windowsClientDir is where helm and kubectl are installed in a Windows invocation image
+const windowsClientDir = `C:\helm3`
+
+// buildCacheDir is the BuildKit cache mount where the helm and kubectl downloads are kept between builds
+const buildCacheDir = "/var/cache/helm3-mixin"
+
+// clientArchitectures are the architectures that helm and kubectl are released for,
+// arm is arm/v7. i386 is accepted as an alias of 386.
+var clientArchitectures = []string{"amd64", "arm64", "arm", "386", "s390x", "ppc64le"}
+
+// validateClientArchitecture returns the name of the architecture in the helm and kubectl artifacts,
+// or an error when they are not released for the architecture.
+func validateClientArchitecture(arch string) (string, error) {
+	if arch == "i386" {
+		return "386", nil
+	}
+	for _, supported := range clientArchitectures {
+		if arch == supported {
+			return arch, nil
+		}
+	}
+	return "", errors.Errorf("unsupported clientArchitecture %q, allowed values are %s", arch, strings.Join(clientArchitectures, ", "))
+}
+
+// writeClientInstall writes the Dockerfile lines that install helm and kubectl for the image platform.
+// When helmBinary is set, helm3 is linked to that binary instead of installing helm.
+func (m *Mixin) writeClientInstall(config MixinConfig) error {
+	installHelm := config.HelmBinary == ""
+	switch config.ImagePlatform {
+	case ImagePlatformDefault:
+		m.writeDownloadClientInstall(config.DisableBuildCache, installHelm)
+	case ImagePlatformCopyFromImage:
+		m.writeCopyClientInstall(installHelm)
+	case ImagePlatformWindows:
+		m.writeWindowsClientInstall()
+	default:
+		platform := config.customPlatform()
+		if platform == nil {
+			return unsupportedImagePlatform(config)
+		}
+		m.writeCustomClientInstall(*platform)
+	}
+	if !installHelm {
+		// The build and the runtime run helm3, whichever binary it is
+		fmt.Fprintf(m.Out, "RUN ln -sf \"$(command -v %s)\" /usr/local/bin/helm3\n", config.HelmBinary)
+	}
+	return nil
+}
+
+func unsupportedImagePlatform(config MixinConfig) error {
+	allowed := []string{strconv.Quote(ImagePlatformCopyFromImage)}
+	for _, platform := range config.Platforms {
+		allowed = append(allowed, strconv.Quote(platform.Name))
+	}
+	return errors.Errorf("unsupported imagePlatform %q, allowed values are %s and %q",
+		config.ImagePlatform, strings.Join(allowed, ", "), ImagePlatformWindows)
+}
+
+// validateImagePlatform checks that the image platform is known, and that the features of the build
+// that run Linux commands are not used with a Windows invocation image.
+func validateImagePlatform(config MixinConfig, vendoredCharts []vendoredChart) error {
+	if err := validatePlatforms(config.Platforms); err != nil {
+		return err
+	}
+	switch config.ImagePlatform {
+	case ImagePlatformDefault, ImagePlatformCopyFromImage:
+		return nil
+	case ImagePlatformWindows:
+	default:
+		if config.customPlatform() == nil {
+			return unsupportedImagePlatform(config)
+		}
+		return nil
+	}
+
+	if len(vendoredCharts) > 0 {
+		return errors.New("vendored charts are not supported with imagePlatform windows")
+	}
+	if len(config.ExtraCACerts) > 0 {
+		return errors.New("extraCACerts are not supported with imagePlatform windows")
+	}
+	if config.HelmBinary != "" {
+		return errors.New("helmBinary is not supported with imagePlatform windows")
+	}
+	return nil
+}
+
+// writeDownloadClientInstall downloads helm and kubectl with curl, keeping the downloads in the build cache unless it is disabled.
+// The helm archive contains a directory named after the platform and architecture, for example linux-amd64.
+func (m *Mixin) writeDownloadClientInstall(disableBuildCache bool, installHelm bool) {
+	dist := m.HelmClientPlatform + "-" + m.HelmClientArchitecture
+	kubectlURL := fmt.Sprintf("https://storage.googleapis.com/kubernetes-release/release/%s/bin/%s/%s/kubectl",
+		m.APIVersion, m.HelmClientPlatform, m.HelmClientArchitecture)
+
+	fmt.Fprint(m.Out, "ENV HELM_EXPERIMENTAL_OCI=1")
+	fmt.Fprintf(m.Out, "\nRUN apt-get update && apt-get install -y curl")
+	if disableBuildCache {
+		if installHelm {
+			fmt.Fprintf(m.Out, "\nRUN curl https://get.helm.sh/helm-%s-%s.tar.gz --output helm3.tar.gz", m.HelmClientVersion, dist)
+			fmt.Fprintf(m.Out, "\nRUN tar -xvf helm3.tar.gz && rm helm3.tar.gz")
+			fmt.Fprintf(m.Out, "\nRUN mv %s/helm /usr/local/bin/helm3", dist)
+		}
+		fmt.Fprintf(m.Out, "\nRUN curl -o kubectl %s &&\\", kubectlURL)
+		fmt.Fprintf(m.Out, "\n    mv kubectl /usr/local/bin && chmod a+x /usr/local/bin/kubectl\n")
+	} else {
+		// Keep the downloads in a BuildKit cache mount, keyed by their version,
+		// so that rebuilding the invocation image doesn't download them again.
+		// A download is only moved into the cache once it is complete.
+		if installHelm {
+			helmArchive := fmt.Sprintf("helm-%s-%s.tar.gz", m.HelmClientVersion, dist)
+			fmt.Fprintf(m.Out, "\nRUN --mount=type=cache,target=%[1]s \\"+
+				"\n    (test -f %[1]s/%[2]s || (curl --fail https://get.helm.sh/%[2]s --output %[1]s/%[2]s.tmp && mv %[1]s/%[2]s.tmp %[1]s/%[2]s)) &&\\"+
+				"\n    tar -xvf %[1]s/%[2]s && mv %[3]s/helm /usr/local/bin/helm3 && rm -r %[3]s",
+				buildCacheDir, helmArchive, dist)
+		}
+		fmt.Fprintf(m.Out, "\nRUN --mount=type=cache,target=%[1]s \\"+
+			"\n    (test -f %[1]s/%[2]s || (curl --fail -o %[1]s/%[2]s.tmp %[3]s && mv %[1]s/%[2]s.tmp %[1]s/%[2]s)) &&\\"+
+			"\n    cp %[1]s/%[2]s /usr/local/bin/kubectl && chmod a+x /usr/local/bin/kubectl\n",
+			buildCacheDir, "kubectl-"+m.APIVersion+"-"+dist, kubectlURL)
+	}
+}
+
+// writeCopyClientInstall copies helm from the alpine/helm image and kubectl from the bitnami/kubectl image,
+// which are tagged with the version without its v prefix.
+func (m *Mixin) writeCopyClientInstall(installHelm bool) {
+	fmt.Fprintln(m.Out, "ENV HELM_EXPERIMENTAL_OCI=1")
+	if installHelm {
+		fmt.Fprintf(m.Out, "COPY --from=alpine/helm:%s /usr/bin/helm /usr/local/bin/helm3\n", strings.TrimPrefix(m.HelmClientVersion, "v"))
+	}
+	fmt.Fprintf(m.Out, "COPY --from=bitnami/kubectl:%s /opt/bitnami/kubectl/bin/kubectl /usr/local/bin/kubectl\n", strings.TrimPrefix(m.APIVersion, "v"))
+}
+
+// writeWindowsClientInstall downloads helm and kubectl with PowerShell into a directory that is added to the PATH.
+func (m *Mixin) writeWindowsClientInstall() {
+	dist := "windows-" + m.HelmClientArchitecture
+	fmt.Fprintln(m.Out, "ENV HELM_EXPERIMENTAL_OCI=1")
+	fmt.Fprintln(m.Out, `SHELL ["powershell", "-Command", "$ErrorActionPreference = 'Stop'; $ProgressPreference = 'SilentlyContinue';"]`)
+	fmt.Fprintf(m.Out, "RUN New-Item -ItemType Directory -Force -Path %[1]s | Out-Null; \\\n"+
+		"    Invoke-WebRequest -Uri https://get.helm.sh/helm-%[2]s-%[3]s.zip -OutFile helm3.zip; \\\n"+
+		"    Expand-Archive helm3.zip -DestinationPath helm3; \\\n"+
+		"    Move-Item helm3\\%[3]s\\helm.exe %[1]s\\helm3.exe; \\\n"+
+		"    Remove-Item -Recurse helm3, helm3.zip\n",
+		windowsClientDir, m.HelmClientVersion, dist)
+	fmt.Fprintf(m.Out, "RUN Invoke-WebRequest -Uri https://storage.googleapis.com/kubernetes-release/release/%s/bin/windows/%s/kubectl.exe -OutFile %s\\kubectl.exe\n",
+		m.APIVersion, m.HelmClientArchitecture, windowsClientDir)
+	fmt.Fprintf(m.Out, "RUN setx /M PATH $($env:PATH + ';%s')\n", windowsClientDir)
+}
@@ -0,0 +1,103 @@
+package helm3
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// mapKubeAPIsPlugin is the helm plugin used by fixDeprecatedAPIs to update the
+// removed apiVersions stored in a release.
+const (
+	mapKubeAPIsPlugin = "mapkubeapis"
+	mapKubeAPIsURL    = "https://github.com/helm/helm-mapkubeapis"
+)
+
+// cmPushPlugin is the helm plugin used to push charts to a ChartMuseum repository.
+const (
+	cmPushPlugin = "cm-push"
+	cmPushURL    = "https://github.com/chartmuseum/helm-push"
+)
+
+// Plugin is a helm plugin installed in the invocation image at build time
+type Plugin struct {
+	URL     string `yaml:"url,omitempty"`
+	Version string `yaml:"version,omitempty"`
+}
+
+// pluginCommands returns the Dockerfile lines that install the helm plugins, sorted by name.
+// The mapkubeapis plugin is added when a step fixes deprecated APIs, and the cm-push plugin when a step
+// pushes to a ChartMuseum repository, unless the plugin is configured.
+func (input BuildInput) pluginCommands() ([]string, error) {
+	plugins := make(map[string]Plugin, len(input.Config.Plugins))
+	for name, plugin := range input.Config.Plugins {
+		if plugin.URL == "" {
+			return nil, errors.Errorf("plugin %s must set a url", name)
+		}
+		plugins[name] = plugin
+	}
+
+	if _, ok := plugins[mapKubeAPIsPlugin]; !ok {
+		for _, steps := range input.Actions {
+			for _, step := range steps {
+				for _, release := range step.releases() {
+					if release.FixDeprecatedAPIs != nil && *release.FixDeprecatedAPIs {
+						plugins[mapKubeAPIsPlugin] = Plugin{URL: mapKubeAPIsURL}
+					}
+				}
+			}
+		}
+	}
+
+	if _, ok := plugins[cmPushPlugin]; !ok {
+		for _, steps := range input.Actions {
+			for _, step := range steps {
+				if step.Helm3.Push != nil && !isOCIRemote(step.Helm3.Push.Remote) {
+					plugins[cmPushPlugin] = Plugin{URL: cmPushURL}
+				}
+			}
+		}
+	}
+
+	names := make([]string, 0, len(plugins))
+	for name := range plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lines := make([]string, 0, len(names))
+	for _, name := range names {
+		plugin := plugins[name]
+		line := fmt.Sprintf("RUN helm3 plugin install %s", plugin.URL)
+		if plugin.Version != "" {
+			line += " --version " + plugin.Version
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// fixDeprecatedAPIs runs the mapkubeapis plugin against the release, replacing the apiVersions
+// that were removed from the cluster so that the release can be upgraded. There is nothing to fix
+// when the release is installed by the upgrade.
+func (m *Mixin) fixDeprecatedAPIs(ctx context.Context, a helmArgs, env []string) error {
+	exists, err := m.releaseExists(ctx, a, env)
+	if err != nil || !exists {
+		return err
+	}
+
+	// helm passes its kube flags to the plugin
+	mapkubeapis := helmArgs{
+		Command:       []string{mapKubeAPIsPlugin},
+		Release:       a.Release,
+		Namespace:     a.Namespace,
+		KubeArguments: a.KubeArguments,
+	}
+	err = m.runHelm(ctx, buildHelmArgs(mapkubeapis), env)
+	if err != nil {
+		return errors.Wrapf(err, "could not fix the deprecated APIs of release %s", a.Release)
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package helm3
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// pulledChartsDir is where the chart is pulled to compute its digest, when it isn't vendored in the invocation image
+const pulledChartsDir = "/tmp/helm3-mixin/charts"
+
+// pinnedChartsDir is where the charts with a chartDigest are pulled, to install them from the archive that was verified
+const pinnedChartsDir = "/tmp/helm3-mixin/pinned-charts"
+
+// ChartProvenance is the supply-chain metadata of the chart that was deployed by a step
+type ChartProvenance struct {
+	Chart   string `json:"chart"`
+	Repo    string `json:"repo,omitempty"`
+	Version string `json:"version,omitempty"`
+
+	// Digest is the sha256 digest of the chart archive, it is empty for chart directories
+	Digest string `json:"digest,omitempty"`
+
+	// ManifestDigest is the digest of the OCI manifest of the chart, for charts pulled from an OCI registry
+	ManifestDigest string `json:"manifestDigest,omitempty"`
+
+	// Verified is true when helm verified the chart against its provenance file
+	Verified bool `json:"verified"`
+}
+
+// repoEntry is an entry of helm repo list --output json
+type repoEntry struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// writeChartProvenance writes the metadata of the chart deployed by a step to an output.
+// step holds the chart as it was declared by the step, a holds the chart that was deployed,
+// which is the archive downloaded at build time when the chart was vendored.
+func (m *Mixin) writeChartProvenance(ctx context.Context, output string, step helmArgs, a helmArgs, env []string) error {
+	provenance := ChartProvenance{
+		Chart:    step.Chart,
+		Repo:     step.Repo,
+		Version:  step.Version,
+		Verified: step.Verify,
+	}
+
+	if provenance.Repo == "" && !isLocalChartPath(step.Chart) && !isOCIRemote(step.Chart) && !isChartURL(step.Chart) {
+		repo, err := m.getRepoURL(ctx, step.Chart, env)
+		if err != nil {
+			return err
+		}
+		provenance.Repo = repo
+	}
+
+	var err error
+	switch {
+	case strings.HasSuffix(a.Chart, ".tgz"):
+		provenance.Digest, err = m.getFileDigest(a.Chart)
+	case isLocalChartPath(a.Chart):
+		// chart directories don't have a digest
+	default:
+		provenance.Digest, provenance.ManifestDigest, err = m.pullChartDigest(ctx, a, env)
+	}
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(provenance, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "could not marshal the chart metadata")
+	}
+	err = m.WriteMixinOutputToFile(output, data)
+	if err != nil {
+		return errors.Wrapf(err, "unable to write output '%s'", output)
+	}
+	return nil
+}
+
+// getRepoURL returns the url of the repository of a chart referenced as REPO/CHART, or an empty string
+// when the repository isn't configured.
+func (m *Mixin) getRepoURL(ctx context.Context, chart string, env []string) (string, error) {
+	name := strings.SplitN(chart, "/", 2)[0]
+
+	output := &bytes.Buffer{}
+	err := m.runHelmWithStdout(ctx, []string{"repo", "list", "--output", "json"}, env, output)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not list the repositories to find the url of chart %s", chart)
+	}
+
+	var repos []repoEntry
+	if err := json.Unmarshal(output.Bytes(), &repos); err != nil {
+		return "", errors.Wrap(err, "could not parse the repositories listed by helm")
+	}
+	for _, repo := range repos {
+		if repo.Name == name {
+			return repo.URL, nil
+		}
+	}
+	return "", nil
+}
+
+// pullChartDigest pulls the chart and returns the digest of the archive, and the digest of its OCI manifest
+// when the chart is pulled from an OCI registry.
+func (m *Mixin) pullChartDigest(ctx context.Context, a helmArgs, env []string) (string, string, error) {
+	defer m.FileSystem.RemoveAll(pulledChartsDir)
+
+	archive, manifestDigest, err := m.pullChartArchive(ctx, a, env, pulledChartsDir)
+	if err != nil {
+		return "", "", err
+	}
+	digest, err := m.getFileDigest(archive)
+	return digest, manifestDigest, err
+}
+
+// pullChartArchive pulls the chart to a directory, and returns the path of the archive and the digest of its
+// OCI manifest when the chart is pulled from an OCI registry.
+func (m *Mixin) pullChartArchive(ctx context.Context, a helmArgs, env []string, dir string) (string, string, error) {
+	err := m.FileSystem.MkdirAll(dir, 0700)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "could not create directory %s", dir)
+	}
+
+	args := []string{"pull", a.Chart, "--destination", dir}
+	if a.Version != "" {
+		args = append(args, "--version", a.Version)
+	}
+	if a.Devel {
+		args = append(args, "--devel")
+	}
+	if a.RepositoryCache != "" {
+		args = append(args, "--repository-cache", a.RepositoryCache)
+	}
+	args = append(args, chartRepoFlags(a)...)
+
+	output := &bytes.Buffer{}
+	err = m.runHelmWithOutput(ctx, args, env, output)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "could not pull chart %s", a.Chart)
+	}
+
+	var manifestDigest string
+	for _, line := range strings.Split(output.String(), "\n") {
+		if digest := strings.TrimPrefix(line, "Digest: "); digest != line {
+			manifestDigest = strings.TrimSpace(digest)
+		}
+	}
+
+	files, err := m.FileSystem.ReadDir(dir)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "could not read directory %s", dir)
+	}
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), ".tgz") {
+			return filepath.Join(dir, file.Name()), manifestDigest, nil
+		}
+	}
+	return "", "", errors.Errorf("helm did not pull an archive of chart %s", a.Chart)
+}
+
+// pinChartDigest pulls an oci:// chart, or the archive of a chart url, checks that its digest is the chartDigest
+// of the step, and installs the pulled archive, so that the release doesn't change when the chart is pushed again.
+// The digest of an oci:// chart is the digest of its OCI manifest, the digest of a chart url is the digest of the archive.
+// Vendored charts were pulled when the invocation image was built, they are not pulled again.
+func (m *Mixin) pinChartDigest(ctx context.Context, digest string, declared helmArgs, a helmArgs, env []string) (helmArgs, error) {
+	if digest == "" {
+		return a, nil
+	}
+	if !isOCIRemote(declared.Chart) && !isChartURL(declared.Chart) {
+		return a, errors.Errorf("chartDigest can only be set for oci:// charts and chart urls, not %s", declared.Chart)
+	}
+	if !strings.HasPrefix(digest, "sha256:") {
+		return a, errors.Errorf("invalid chartDigest %q, it must be a sha256: digest", digest)
+	}
+	if !isOCIRemote(a.Chart) && !isChartURL(a.Chart) {
+		return a, nil
+	}
+
+	archive, pulledDigest, err := m.pullChartArchive(ctx, a, env, pinnedChartsDir)
+	if err != nil {
+		return a, err
+	}
+	if isChartURL(a.Chart) {
+		pulledDigest, err = m.getFileDigest(archive)
+		if err != nil {
+			return a, err
+		}
+	}
+	if pulledDigest != digest {
+		return a, errors.Errorf("chart %s has the digest %s instead of the chartDigest %s of the step, it was pushed again", a.Chart, pulledDigest, digest)
+	}
+
+	a.Chart = archive
+	a.Version = ""
+	return a, nil
+}
+
+// getFileDigest returns the sha256 digest of a file, like the digest of the chart in the index of a repository.
+func (m *Mixin) getFileDigest(file string) (string, error) {
+	data, err := m.FileSystem.ReadFile(file)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not read chart archive %s", file)
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
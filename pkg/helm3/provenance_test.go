@@ -0,0 +1,92 @@
+package helm3
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+
+	"get.porter.sh/porter/pkg/portercontext"
+	"get.porter.sh/porter/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestMixin_InstallChartMetadataOutput(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	defer os.Unsetenv(test.ExpectedCommandOutputEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 upgrade --install mysql /charts/stable/mysql-1.6.2.tgz --atomic --create-namespace\n"+
+		"helm3 repo list --output json")
+	os.Setenv(test.ExpectedCommandOutputEnv, `[{"name":"stable","url":"https://charts.helm.sh/stable"}]`)
+
+	step := InstallStep{
+		InstallArguments: InstallArguments{
+			Step: Step{Description: "Install MySQL"},
+			ChartArguments: ChartArguments{
+				Name:                "mysql",
+				Chart:               "stable/mysql",
+				Version:             "1.6.2",
+				ChartMetadataOutput: "chart",
+			},
+		},
+	}
+	b, err := yaml.Marshal(InstallAction{Steps: []InstallStep{step}})
+	require.NoError(t, err)
+
+	h := NewTestMixin(t)
+	h.Setenv(verifyClientVersionEnv, "false")
+	h.FileSystem.WriteFile("/charts/stable/mysql-1.6.2.tgz", []byte("chart"), 0644)
+	h.In = bytes.NewReader(b)
+
+	err = h.Install(ctx)
+	require.NoError(t, err)
+
+	data, err := h.FileSystem.ReadFile(path.Join(portercontext.MixinOutputsDir, "chart"))
+	require.NoError(t, err)
+	var provenance ChartProvenance
+	require.NoError(t, json.Unmarshal(data, &provenance))
+
+	sum := sha256.Sum256([]byte("chart"))
+	assert.Equal(t, ChartProvenance{
+		Chart:   "stable/mysql",
+		Repo:    "https://charts.helm.sh/stable",
+		Version: "1.6.2",
+		Digest:  "sha256:" + hex.EncodeToString(sum[:]),
+	}, provenance)
+}
+
+func TestMixin_PullChartDigest(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	defer os.Unsetenv(test.ExpectedCommandOutputEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 pull oci://example.com/charts/mysql --destination /tmp/helm3-mixin/charts --version 1.6.2")
+	os.Setenv(test.ExpectedCommandOutputEnv, "Pulled: example.com/charts/mysql:1.6.2\nDigest: sha256:0123abcd\n")
+
+	h := NewTestMixin(t)
+	h.FileSystem.WriteFile(path.Join(pulledChartsDir, "mysql-1.6.2.tgz"), []byte("chart"), 0644)
+
+	digest, manifestDigest, err := h.pullChartDigest(ctx, helmArgs{Chart: "oci://example.com/charts/mysql", Version: "1.6.2"}, nil)
+	require.NoError(t, err)
+
+	sum := sha256.Sum256([]byte("chart"))
+	assert.Equal(t, "sha256:"+hex.EncodeToString(sum[:]), digest)
+	assert.Equal(t, "sha256:0123abcd", manifestDigest)
+	exists, _ := h.FileSystem.Exists(pulledChartsDir)
+	assert.False(t, exists, "the pulled chart should be removed")
+}
+
+func TestMixin_PullChartDigestWithoutArchive(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 pull mysql --destination /tmp/helm3-mixin/charts --repo https://charts.helm.sh/stable")
+
+	h := NewTestMixin(t)
+	_, _, err := h.pullChartDigest(ctx, helmArgs{Chart: "mysql", Repo: "https://charts.helm.sh/stable"}, nil)
+	require.EqualError(t, err, "helm did not pull an archive of chart mysql")
+}
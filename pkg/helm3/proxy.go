@@ -0,0 +1,59 @@
+package helm3
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// caCertsDir is where update-ca-certificates picks up the extra CA certificates
+const caCertsDir = "/usr/local/share/ca-certificates"
+
+// proxyEnv returns the ENV lines that configure the proxy for the build and for helm at runtime.
+// Both cases are set because tools disagree on which one they read, for example curl only reads http_proxy.
+func (c MixinConfig) proxyEnv() []string {
+	var lines []string
+	for _, v := range []struct{ name, value string }{
+		{"HTTP_PROXY", c.HTTPProxy},
+		{"HTTPS_PROXY", c.HTTPSProxy},
+		{"NO_PROXY", c.NoProxy},
+	} {
+		if v.value == "" {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("ENV %s=%s %s=%s", v.name, v.value, strings.ToLower(v.name), v.value))
+	}
+	return lines
+}
+
+// writeExtraCACerts writes the Dockerfile lines that add the extra CA certificates to the trust store of the
+// invocation image. The certificates are paths in the bundle directory, which is the build context.
+func (m *Mixin) writeExtraCACerts(config MixinConfig) error {
+	if len(config.ExtraCACerts) == 0 {
+		return nil
+	}
+
+	for _, cert := range config.ExtraCACerts {
+		exists, err := m.FileSystem.Exists(cert)
+		if err != nil {
+			return errors.Wrapf(err, "could not check CA certificate %s", cert)
+		}
+		if !exists {
+			return errors.Errorf("CA certificate %s does not exist", cert)
+		}
+	}
+
+	for _, cert := range config.ExtraCACerts {
+		// update-ca-certificates only picks up files with the crt extension
+		name := strings.TrimSuffix(filepath.Base(cert), filepath.Ext(cert)) + ".crt"
+		fmt.Fprintf(m.Out, "COPY %s %s/%s\n", cert, caCertsDir, name)
+	}
+	if config.ImagePlatform == ImagePlatformDefault {
+		fmt.Fprintln(m.Out, "RUN apt-get update && apt-get install -y ca-certificates && update-ca-certificates")
+	} else {
+		fmt.Fprintln(m.Out, "RUN update-ca-certificates")
+	}
+	return nil
+}
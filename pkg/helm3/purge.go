@@ -0,0 +1,129 @@
+package helm3
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8s "k8s.io/client-go/kubernetes"
+)
+
+// PurgeResource selects the resources that are left in the cluster after the releases were uninstalled,
+// for example the PersistentVolumeClaims of a StatefulSet, which helm does not delete.
+type PurgeResource struct {
+	// Kind of the resources, for example persistentvolumeclaims, secrets or the plural of a custom resource
+	Kind string `yaml:"kind"`
+
+	// Selector is the label selector of the resources, it is required so that a namespace isn't emptied by mistake
+	Selector string `yaml:"selector"`
+
+	// Namespace of the resources, it defaults to the namespace of the releases
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+// purgeResources deletes the resources selected by the purge block of the uninstall step. PersistentVolumeClaims,
+// Secrets and ConfigMaps are deleted with the Kubernetes client, the other kinds, like custom resources, with kubectl.
+func (m *Mixin) purgeResources(ctx context.Context, a helmArgs, purge []PurgeResource) error {
+	for _, p := range purge {
+		if p.Kind == "" || p.Selector == "" {
+			return errors.Errorf("purge requires the kind and the selector of the resources, got kind %q and selector %q", p.Kind, p.Selector)
+		}
+	}
+
+	var kubeClient k8s.Interface
+	for _, p := range purge {
+		namespace := p.Namespace
+		if namespace == "" {
+			namespace = a.Namespace
+		}
+		if namespace == "" {
+			namespace = "default"
+		}
+
+		kind := strings.ToLower(p.Kind)
+		switch kind {
+		case "persistentvolumeclaims", "persistentvolumeclaim", "pvc", "secrets", "secret", "configmaps", "configmap", "cm":
+			if kubeClient == nil {
+				var err error
+				kubeClient, err = m.getKubernetesClient(a)
+				if err != nil {
+					return errors.Wrap(err, "couldn't get kubernetes client")
+				}
+			}
+			if err := m.purgeWithClient(ctx, kubeClient, kind, namespace, p.Selector); err != nil {
+				return err
+			}
+		default:
+			if err := m.purgeWithKubectl(ctx, a.KubeArguments, p.Kind, namespace, p.Selector); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// purgeWithClient deletes the PersistentVolumeClaims, Secrets or ConfigMaps that match the selector.
+func (m *Mixin) purgeWithClient(ctx context.Context, kubeClient k8s.Interface, kind, namespace, selector string) error {
+	list := metav1.ListOptions{LabelSelector: selector}
+	var names []string
+	var deleteFn func(ctx context.Context, name string, opts metav1.DeleteOptions) error
+	switch kind {
+	case "persistentvolumeclaims", "persistentvolumeclaim", "pvc":
+		kind = "persistentvolumeclaim"
+		claims, err := kubeClient.CoreV1().PersistentVolumeClaims(namespace).List(ctx, list)
+		if err != nil {
+			return errors.Wrapf(err, "could not list the persistentvolumeclaims in %s matching %s", namespace, selector)
+		}
+		for _, claim := range claims.Items {
+			names = append(names, claim.Name)
+		}
+		deleteFn = kubeClient.CoreV1().PersistentVolumeClaims(namespace).Delete
+	case "secrets", "secret":
+		kind = "secret"
+		secrets, err := kubeClient.CoreV1().Secrets(namespace).List(ctx, list)
+		if err != nil {
+			return errors.Wrapf(err, "could not list the secrets in %s matching %s", namespace, selector)
+		}
+		for _, secret := range secrets.Items {
+			names = append(names, secret.Name)
+		}
+		deleteFn = kubeClient.CoreV1().Secrets(namespace).Delete
+	default:
+		kind = "configmap"
+		configMaps, err := kubeClient.CoreV1().ConfigMaps(namespace).List(ctx, list)
+		if err != nil {
+			return errors.Wrapf(err, "could not list the configmaps in %s matching %s", namespace, selector)
+		}
+		for _, configMap := range configMaps.Items {
+			names = append(names, configMap.Name)
+		}
+		deleteFn = kubeClient.CoreV1().ConfigMaps(namespace).Delete
+	}
+
+	for _, name := range names {
+		fmt.Fprintf(m.Err, "Purging %s %s/%s\n", kind, namespace, name)
+		if err := deleteFn(ctx, name, metav1.DeleteOptions{}); err != nil {
+			return errors.Wrapf(err, "could not delete %s %s/%s", kind, namespace, name)
+		}
+	}
+	return nil
+}
+
+// purgeWithKubectl deletes the resources of the other kinds that match the selector with kubectl,
+// which knows the custom resources of the cluster, in the cluster that the kube arguments of the step select.
+func (m *Mixin) purgeWithKubectl(ctx context.Context, kube KubeArguments, kind, namespace, selector string) error {
+	args := []string{"delete", kind, fmt.Sprintf("--selector=%s", selector), fmt.Sprintf("--namespace=%s", namespace), "--ignore-not-found"}
+	args = append(args, kube.kubectlFlags()...)
+	cmd := m.NewCommand(ctx, "kubectl", args...)
+	cmd.Stdout = m.Err
+	cmd.Stderr = m.Err
+
+	prettyCmd := fmt.Sprintf("kubectl %s", strings.Join(maskCredentials(args), " "))
+	fmt.Fprintln(m.Err, prettyCmd)
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "couldn't run command %s", prettyCmd)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package helm3
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"get.porter.sh/porter/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestMixin_PurgeResources(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+
+	t.Run("purge", func(t *testing.T) {
+		os.Setenv(test.ExpectedCommandEnv, "kubectl delete backups.example.com --selector=app.kubernetes.io/instance=mydb --namespace=mydb --ignore-not-found "+
+			"--context staging --token abc123")
+		newClaim := func(name, instance string) *corev1.PersistentVolumeClaim {
+			return &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "mydb",
+				Labels:    map[string]string{"app.kubernetes.io/instance": instance},
+			}}
+		}
+		client := testclient.NewSimpleClientset(newClaim("data-mydb-0", "mydb"), newClaim("data-other-0", "other"))
+		m := NewTestMixin(t)
+		factory := &clientKubernetesFactory{client: client}
+		m.ClientFactory = factory
+
+		purge := []PurgeResource{
+			{Kind: "persistentvolumeclaims", Selector: "app.kubernetes.io/instance=mydb"},
+			{Kind: "backups.example.com", Selector: "app.kubernetes.io/instance=mydb"},
+		}
+		kube := KubeArguments{KubeContext: "staging", KubeToken: "abc123"}
+		err := m.purgeResources(ctx, helmArgs{Namespace: "mydb", KubeArguments: kube}, purge)
+		require.NoError(t, err)
+		assert.Equal(t, "staging", factory.opts.Context, "the claims should be purged from the cluster of the step")
+
+		_, err = client.CoreV1().PersistentVolumeClaims("mydb").Get(ctx, "data-mydb-0", metav1.GetOptions{})
+		assert.True(t, apierrors.IsNotFound(err), "the claim of the release should be purged")
+		_, err = client.CoreV1().PersistentVolumeClaims("mydb").Get(ctx, "data-other-0", metav1.GetOptions{})
+		assert.NoError(t, err, "the claims that don't match the selector should be kept")
+		assert.Contains(t, m.TestContext.GetError(), "Purging persistentvolumeclaim mydb/data-mydb-0")
+		assert.Contains(t, m.TestContext.GetError(), "--context staging --token *******\n", "the token should be masked")
+	})
+
+	t.Run("missing selector", func(t *testing.T) {
+		m := NewTestMixin(t)
+
+		err := m.purgeResources(ctx, helmArgs{Namespace: "mydb"}, []PurgeResource{{Kind: "secrets"}})
+		require.EqualError(t, err, `purge requires the kind and the selector of the resources, got kind "secrets" and selector ""`)
+	})
+}
@@ -0,0 +1,191 @@
+package helm3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+)
+
+// releaseExists checks with helm status whether the release is installed.
+func (m *Mixin) releaseExists(ctx context.Context, a helmArgs, env []string) (bool, error) {
+	status := helmArgs{
+		Command:       []string{"status"},
+		Release:       a.Release,
+		Namespace:     a.Namespace,
+		KubeArguments: a.KubeArguments,
+	}
+
+	cmd := m.NewCommand(ctx, m.helmBinary(), buildHelmArgs(status)...)
+	cmd.Env = append(cmd.Env, env...)
+	output := &bytes.Buffer{}
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	err := cmd.Run()
+	if err == nil {
+		return true, nil
+	}
+	if strings.Contains(strings.ToLower(output.String()), "not found") {
+		return false, nil
+	}
+	return false, errors.Wrapf(err, "could not check if release %s exists: %s", a.Release, strings.TrimSpace(output.String()))
+}
+
+// releaseStatus is the part of helm status --output json that holds the chart of the deployed release
+type releaseStatus struct {
+	Chart struct {
+		Metadata struct {
+			Version string `json:"version"`
+		} `json:"metadata"`
+
+		// Files are the files of the chart that are not templates, including its crds directory
+		Files []struct {
+			Name string `json:"name"`
+			Data []byte `json:"data"`
+		} `json:"files"`
+	} `json:"chart"`
+}
+
+// getReleaseStatus returns the status of the release, or nil when the release does not exist.
+// The status isn't printed because it contains the values of the release.
+func (m *Mixin) getReleaseStatus(ctx context.Context, a helmArgs, env []string) (*releaseStatus, error) {
+	status := helmArgs{
+		Command:       []string{"status", "--output", "json"},
+		Release:       a.Release,
+		Namespace:     a.Namespace,
+		KubeArguments: a.KubeArguments,
+	}
+
+	cmd := m.NewCommand(ctx, m.helmBinary(), buildHelmArgs(status)...)
+	cmd.Env = append(cmd.Env, env...)
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := cmd.Run(); err != nil {
+		output := stdout.String() + stderr.String()
+		if strings.Contains(strings.ToLower(output), "not found") {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "could not get the status of release %s: %s", a.Release, strings.TrimSpace(stderr.String()))
+	}
+
+	var release releaseStatus
+	if err := json.Unmarshal(stdout.Bytes(), &release); err != nil {
+		return nil, errors.Wrapf(err, "could not parse the status of release %s", a.Release)
+	}
+	return &release, nil
+}
+
+// skipRelease returns true when the step should be skipped because the release exists and skipIfExists is set,
+// or because the release is missing and skipIfMissing is set.
+func (m *Mixin) skipRelease(ctx context.Context, a helmArgs, env []string, skipIfExists bool, skipIfMissing bool) (bool, error) {
+	if !skipIfExists && !skipIfMissing {
+		return false, nil
+	}
+
+	exists, err := m.releaseExists(ctx, a, env)
+	if err != nil {
+		return false, err
+	}
+	if exists && skipIfExists {
+		fmt.Fprintf(m.Out, "Skipping the step because release %s already exists\n", a.Release)
+		return true, nil
+	}
+	if !exists && skipIfMissing {
+		fmt.Fprintf(m.Out, "Skipping the step because release %s does not exist\n", a.Release)
+		return true, nil
+	}
+	return false, nil
+}
+
+// writeManifest writes the manifest of the release, as rendered and applied by helm, to an output.
+func (m *Mixin) writeManifest(ctx context.Context, output string, a helmArgs, env []string) error {
+	return m.writeReleaseData(ctx, output, []string{"get", "manifest"}, "manifest", a, env)
+}
+
+// backupRelease writes the values and the manifest of the release to the RELEASE-values-backup and
+// RELEASE-manifest-backup outputs before it is upgraded. Nothing is written when the release does not exist yet.
+func (m *Mixin) backupRelease(ctx context.Context, a helmArgs, env []string) error {
+	exists, err := m.releaseExists(ctx, a, env)
+	if err != nil || !exists {
+		return err
+	}
+
+	err = m.writeReleaseData(ctx, a.Release+"-values-backup", []string{"get", "values", "--all", "--output", "yaml"}, "values", a, env)
+	if err != nil {
+		return err
+	}
+	return m.writeReleaseData(ctx, a.Release+"-manifest-backup", []string{"get", "manifest"}, "manifest", a, env)
+}
+
+// writeReleaseData writes the output of a helm get command for the release to an output. The output of the command
+// isn't printed because the values and the manifest of a release contain its secrets.
+func (m *Mixin) writeReleaseData(ctx context.Context, output string, command []string, what string, a helmArgs, env []string) error {
+	data, err := m.getReleaseData(ctx, command, what, a, env)
+	if err != nil {
+		return err
+	}
+
+	err = m.WriteMixinOutputToFile(output, data)
+	if err != nil {
+		return errors.Wrapf(err, "unable to write output '%s'", output)
+	}
+	return nil
+}
+
+// getReleaseData returns the output of a helm get command for the release, without printing it.
+func (m *Mixin) getReleaseData(ctx context.Context, command []string, what string, a helmArgs, env []string) ([]byte, error) {
+	get := helmArgs{
+		Command:       command,
+		Release:       a.Release,
+		Namespace:     a.Namespace,
+		KubeArguments: a.KubeArguments,
+	}
+
+	cmd := m.NewCommand(ctx, m.helmBinary(), buildHelmArgs(get)...)
+	cmd.Env = append(cmd.Env, env...)
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not get the %s of release %s: %s", what, a.Release, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// rollbackAfterFailure rolls the release back to its previous revision after a failed upgrade, keeping the failed
+// revision in the history of the release so that it can be investigated. The release is left as is when it did not
+// exist before the upgrade, because there is no revision to roll back to.
+func (m *Mixin) rollbackAfterFailure(ctx context.Context, a helmArgs, env []string, existed bool, upgradeErr error) error {
+	if !existed {
+		fmt.Fprintf(m.Err, "Not rolling back release %s, it did not exist before the upgrade\n", a.Release)
+		return upgradeErr
+	}
+
+	fmt.Fprintf(m.Err, "Rolling back release %s to its previous revision\n", a.Release)
+	rollback := helmArgs{
+		Command:            []string{"rollback"},
+		Release:            a.Release,
+		Namespace:          a.Namespace,
+		KubeArguments:      a.KubeArguments,
+		Wait:               a.Wait,
+		Timeout:            a.Timeout,
+		Debug:              a.Debug,
+		ClientMajorVersion: a.ClientMajorVersion,
+	}
+	err := m.runHelm(ctx, buildHelmArgs(rollback), env)
+	if err != nil {
+		return multierror.Append(upgradeErr, errors.Wrapf(err, "could not roll back release %s", a.Release))
+	}
+	return errors.Wrapf(upgradeErr, "upgrade of release %s failed and it was rolled back to its previous revision", a.Release)
+}
@@ -0,0 +1,264 @@
+package helm3
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path"
+	"testing"
+
+	"get.porter.sh/porter/pkg/portercontext"
+	"get.porter.sh/porter/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestMixin_InstallSkipIfExists(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 status mysql --namespace mydb")
+
+	step := InstallStep{
+		InstallArguments: InstallArguments{
+			Step: Step{Description: "Install MySQL"},
+			ChartArguments: ChartArguments{
+				Name:      "mysql",
+				Chart:     "stable/mysql",
+				Namespace: "mydb",
+			},
+			SkipIfExists: true,
+		},
+	}
+	action := InstallAction{Steps: []InstallStep{step}}
+	b, err := yaml.Marshal(action)
+	require.NoError(t, err)
+
+	h := NewTestMixin(t)
+	h.Setenv(verifyClientVersionEnv, "false")
+	h.In = bytes.NewReader(b)
+
+	err = h.Install(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, h.TestContext.GetOutput(), "Skipping the step because release mysql already exists")
+}
+
+func TestMixin_UpgradeSkipIfMissing(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	defer os.Unsetenv(test.ExpectedCommandExitCodeEnv)
+	defer os.Unsetenv(test.ExpectedCommandOutputEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 status mysql --namespace mydb")
+	os.Setenv(test.ExpectedCommandExitCodeEnv, "1")
+	os.Setenv(test.ExpectedCommandOutputEnv, "Error: release: not found")
+
+	step := UpgradeStep{
+		UpgradeArguments: UpgradeArguments{
+			Step: Step{Description: "Upgrade MySQL"},
+			ChartArguments: ChartArguments{
+				Name:      "mysql",
+				Chart:     "stable/mysql",
+				Namespace: "mydb",
+			},
+			SkipIfMissing: true,
+		},
+	}
+	action := UpgradeAction{Steps: []UpgradeStep{step}}
+	b, err := yaml.Marshal(action)
+	require.NoError(t, err)
+
+	h := NewTestMixin(t)
+	h.Setenv(verifyClientVersionEnv, "false")
+	h.In = bytes.NewReader(b)
+
+	err = h.Upgrade(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, h.TestContext.GetOutput(), "Skipping the step because release mysql does not exist")
+}
+
+func TestMixin_ReleaseExistsError(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	defer os.Unsetenv(test.ExpectedCommandExitCodeEnv)
+	defer os.Unsetenv(test.ExpectedCommandOutputEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 status mysql")
+	os.Setenv(test.ExpectedCommandExitCodeEnv, "1")
+	os.Setenv(test.ExpectedCommandOutputEnv, "Error: Kubernetes cluster unreachable")
+
+	h := NewTestMixin(t)
+	_, err := h.releaseExists(ctx, helmArgs{Release: "mysql"}, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "could not check if release mysql exists: Error: Kubernetes cluster unreachable")
+}
+
+func TestMixin_UpgradeManifestOutput(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	defer os.Unsetenv(test.ExpectedCommandOutputEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 upgrade --install mysql stable/mysql --namespace mydb --atomic --create-namespace\n"+
+		"helm3 get manifest mysql --namespace mydb")
+	os.Setenv(test.ExpectedCommandOutputEnv, "---\nkind: Service\n")
+
+	step := UpgradeStep{
+		UpgradeArguments: UpgradeArguments{
+			Step: Step{Description: "Upgrade MySQL"},
+			ChartArguments: ChartArguments{
+				Namespace:      "mydb",
+				Name:           "mysql",
+				Chart:          "stable/mysql",
+				ManifestOutput: "manifest",
+			},
+		},
+	}
+	b, err := yaml.Marshal(UpgradeAction{Steps: []UpgradeStep{step}})
+	require.NoError(t, err)
+
+	h := NewTestMixin(t)
+	h.Setenv(verifyClientVersionEnv, "false")
+	h.In = bytes.NewReader(b)
+
+	err = h.Upgrade(ctx)
+	require.NoError(t, err)
+
+	manifest, err := h.FileSystem.ReadFile(path.Join(portercontext.MixinOutputsDir, "manifest"))
+	require.NoError(t, err)
+	assert.Equal(t, "---\nkind: Service\n", string(manifest))
+}
+
+func TestMixin_UpgradeBackupBeforeUpgrade(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	defer os.Unsetenv(test.ExpectedCommandOutputEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 status mysql --namespace mydb\n"+
+		"helm3 get values --all --output yaml mysql --namespace mydb\n"+
+		"helm3 get manifest mysql --namespace mydb\n"+
+		"helm3 upgrade --install mysql stable/mysql --namespace mydb --atomic --create-namespace")
+	os.Setenv(test.ExpectedCommandOutputEnv, "replicas: 1\n")
+
+	step := UpgradeStep{
+		UpgradeArguments: UpgradeArguments{
+			Step: Step{Description: "Upgrade MySQL"},
+			ChartArguments: ChartArguments{
+				Namespace: "mydb",
+				Name:      "mysql",
+				Chart:     "stable/mysql",
+			},
+			BackupBeforeUpgrade: true,
+		},
+	}
+	b, err := yaml.Marshal(UpgradeAction{Steps: []UpgradeStep{step}})
+	require.NoError(t, err)
+
+	h := NewTestMixin(t)
+	h.Setenv(verifyClientVersionEnv, "false")
+	h.In = bytes.NewReader(b)
+
+	err = h.Upgrade(ctx)
+	require.NoError(t, err)
+
+	for _, output := range []string{"mysql-values-backup", "mysql-manifest-backup"} {
+		backup, err := h.FileSystem.ReadFile(path.Join(portercontext.MixinOutputsDir, output))
+		require.NoError(t, err, "output %s was not written", output)
+		assert.Equal(t, "replicas: 1\n", string(backup))
+	}
+}
+
+func TestMixin_UpgradeBackupBeforeUpgradeMissingRelease(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	defer os.Unsetenv(test.ExpectedCommandOutputEnv)
+	defer os.Unsetenv(test.ExpectedCommandExitCodeEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 status mysql --namespace mydb")
+	os.Setenv(test.ExpectedCommandOutputEnv, "Error: release: not found")
+	os.Setenv(test.ExpectedCommandExitCodeEnv, "1")
+
+	h := NewTestMixin(t)
+	err := h.backupRelease(ctx, helmArgs{Release: "mysql", Namespace: "mydb"}, nil)
+	require.NoError(t, err)
+
+	exists, _ := h.FileSystem.Exists(path.Join(portercontext.MixinOutputsDir, "mysql-values-backup"))
+	assert.False(t, exists, "nothing should be saved when the release does not exist")
+}
+
+func TestMixin_RollbackAfterFailure(t *testing.T) {
+	ctx := context.Background()
+	upgradeErr := errors.New("timed out waiting for the condition")
+	wait := true
+
+	t.Run("rolls back the release", func(t *testing.T) {
+		defer os.Unsetenv(test.ExpectedCommandEnv)
+		os.Setenv(test.ExpectedCommandEnv, "helm3 rollback mysql --namespace mydb --wait --timeout 5m")
+
+		h := NewTestMixin(t)
+		err := h.rollbackAfterFailure(ctx, helmArgs{Release: "mysql", Namespace: "mydb", Wait: &wait, Timeout: "5m"}, nil, true, upgradeErr)
+		require.EqualError(t, err, "upgrade of release mysql failed and it was rolled back to its previous revision: timed out waiting for the condition")
+		assert.Contains(t, h.TestContext.GetError(), "Rolling back release mysql to its previous revision")
+	})
+
+	t.Run("new release", func(t *testing.T) {
+		h := NewTestMixin(t)
+		err := h.rollbackAfterFailure(ctx, helmArgs{Release: "mysql", Namespace: "mydb"}, nil, false, upgradeErr)
+		require.Equal(t, upgradeErr, err)
+		assert.Contains(t, h.TestContext.GetError(), "Not rolling back release mysql, it did not exist before the upgrade")
+	})
+}
+
+func TestMixin_UpgradeRollbackOnFailure(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	defer os.Unsetenv(test.ExpectedCommandOutputEnv)
+	defer os.Unsetenv(test.ExpectedCommandExitCodeEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 status mysql --namespace mydb\n"+
+		"helm3 upgrade --install mysql stable/mysql --namespace mydb --create-namespace\n"+
+		"helm3 status mysql --namespace mydb\n"+
+		"kubectl get events --sort-by .lastTimestamp --namespace mydb")
+	os.Setenv(test.ExpectedCommandOutputEnv, "Error: release: not found")
+	os.Setenv(test.ExpectedCommandExitCodeEnv, "1")
+
+	step := UpgradeStep{
+		UpgradeArguments: UpgradeArguments{
+			Step: Step{Description: "Upgrade MySQL"},
+			ChartArguments: ChartArguments{
+				Namespace: "mydb",
+				Name:      "mysql",
+				Chart:     "stable/mysql",
+			},
+			RollbackOnFailure: true,
+		},
+	}
+	b, err := yaml.Marshal(UpgradeAction{Steps: []UpgradeStep{step}})
+	require.NoError(t, err)
+
+	h := NewTestMixin(t)
+	h.Setenv(verifyClientVersionEnv, "false")
+	h.In = bytes.NewReader(b)
+
+	err = h.Upgrade(ctx)
+	require.Error(t, err)
+	assert.Contains(t, h.TestContext.GetError(), "Not rolling back release mysql")
+}
+
+func TestMixin_UpgradeRollbackOnFailureWithAtomic(t *testing.T) {
+	atomic := true
+	step := UpgradeStep{
+		UpgradeArguments: UpgradeArguments{
+			Step: Step{Description: "Upgrade MySQL"},
+			ChartArguments: ChartArguments{
+				Name:   "mysql",
+				Chart:  "stable/mysql",
+				Atomic: &atomic,
+			},
+			RollbackOnFailure: true,
+		},
+	}
+	b, err := yaml.Marshal(UpgradeAction{Steps: []UpgradeStep{step}})
+	require.NoError(t, err)
+
+	h := NewTestMixin(t)
+	h.Setenv(verifyClientVersionEnv, "false")
+	h.In = bytes.NewReader(b)
+
+	err = h.Upgrade(context.Background())
+	require.EqualError(t, err, "atomic and rollbackOnFailure cannot both be set, rollbackOnFailure replaces atomic")
+}
@@ -0,0 +1,209 @@
+package helm3
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// releaseDefaultsExcluded are the arguments of a step that are not defaults of its releases: the outputs and the
+// dependencies are declared by each release, and the condition of the step is evaluated before its releases.
+var releaseDefaultsExcluded = []string{"releases", "outputs", "condition", "dependsOn"}
+
+// releaseArguments sets args to the arguments of a release declared in the releases of a step. The arguments of
+// the step are the defaults of the release, and the release overrides them with its own arguments, replacing
+// maps and lists like set and values instead of merging them.
+func releaseArguments(step interface{}, release map[string]interface{}, args interface{}) error {
+	if _, ok := release["releases"]; ok {
+		return errors.New("releases cannot be nested")
+	}
+
+	b, err := yaml.Marshal(step)
+	if err != nil {
+		return err
+	}
+	merged := map[string]interface{}{}
+	if err := yaml.Unmarshal(b, &merged); err != nil {
+		return err
+	}
+	for _, key := range releaseDefaultsExcluded {
+		delete(merged, key)
+	}
+	for key, value := range release {
+		merged[key] = value
+	}
+
+	b, err = yaml.Marshal(merged)
+	if err != nil {
+		return err
+	}
+	return yaml.UnmarshalStrict(b, args)
+}
+
+// checkReleases returns an error when the step sets outputs, that are only declared by the releases of a step.
+func checkReleases(step Step) error {
+	if len(step.Outputs) > 0 {
+		return errors.New("a step with releases cannot declare outputs, declare them in its releases")
+	}
+	return nil
+}
+
+// releases returns the arguments of the releases of the install step.
+func (s InstallArguments) releases() ([]InstallArguments, error) {
+	if err := checkReleases(s.Step); err != nil {
+		return nil, err
+	}
+	releases := make([]InstallArguments, len(s.Releases))
+	for i, release := range s.Releases {
+		if err := releaseArguments(s, release, &releases[i]); err != nil {
+			return nil, errors.Wrapf(err, "invalid release %d of the step", i+1)
+		}
+		if releases[i].Name == "" {
+			return nil, errors.Errorf("release %d of the step must set a name", i+1)
+		}
+	}
+	return releases, nil
+}
+
+// releases returns the arguments of the releases of the upgrade step.
+func (s UpgradeArguments) releases() ([]UpgradeArguments, error) {
+	if err := checkReleases(s.Step); err != nil {
+		return nil, err
+	}
+	releases := make([]UpgradeArguments, len(s.Releases))
+	for i, release := range s.Releases {
+		if err := releaseArguments(s, release, &releases[i]); err != nil {
+			return nil, errors.Wrapf(err, "invalid release %d of the step", i+1)
+		}
+		if releases[i].Name == "" {
+			return nil, errors.Errorf("release %d of the step must set a name", i+1)
+		}
+	}
+	return releases, nil
+}
+
+// stepRelease is a release declared in the releases of an install or upgrade step.
+type stepRelease struct {
+	Name         string
+	DependsOn    []string
+	Step         Step
+	Mode         string
+	WaitStrategy string
+
+	// Args are the arguments of helm for the release, with the defaults of the mixin
+	Args helmArgs
+
+	run func(ctx context.Context) error
+}
+
+// waits returns true when helm waits for the resources of the release, or the release polls them.
+func (r stepRelease) waits() bool {
+	switch r.WaitStrategy {
+	case WaitHelm, WaitPoll:
+		return true
+	case WaitNone:
+		return false
+	}
+	return isTrue(r.Args.Wait) || r.Args.Atomic == nil || *r.Args.Atomic
+}
+
+// orderReleases returns the releases sorted so that each release comes after its dependencies, keeping the
+// order of the declaration otherwise. It fails when a release depends on an unknown release or on itself,
+// directly or through other releases.
+func orderReleases(releases []stepRelease) ([]stepRelease, error) {
+	index := make(map[string]int, len(releases))
+	for i, release := range releases {
+		if _, ok := index[release.Name]; ok {
+			return nil, errors.Errorf("release %s is declared more than once", release.Name)
+		}
+		index[release.Name] = i
+	}
+
+	remaining := make([]int, len(releases))
+	dependents := make([][]int, len(releases))
+	for i, release := range releases {
+		for _, dependency := range release.DependsOn {
+			j, ok := index[dependency]
+			if !ok {
+				return nil, errors.Errorf("release %s depends on %s, which is not a release of the step", release.Name, dependency)
+			}
+			remaining[i]++
+			dependents[j] = append(dependents[j], i)
+		}
+	}
+
+	ordered := make([]stepRelease, 0, len(releases))
+	done := make([]bool, len(releases))
+	for len(ordered) < len(releases) {
+		next := -1
+		for i := range releases {
+			if !done[i] && remaining[i] == 0 {
+				next = i
+				break
+			}
+		}
+		if next == -1 {
+			var cycle []string
+			for i, release := range releases {
+				if !done[i] {
+					cycle = append(cycle, release.Name)
+				}
+			}
+			return nil, errors.Errorf("the dependencies of releases %s form a cycle", strings.Join(cycle, ", "))
+		}
+
+		done[next] = true
+		ordered = append(ordered, releases[next])
+		for _, dependent := range dependents[next] {
+			remaining[dependent]--
+		}
+	}
+	return ordered, nil
+}
+
+// runReleases runs the releases of a step in the order of their dependencies, and stops at the first release
+// that fails. Helm waits for the resources of a release by default, a dependency that is installed without
+// waiting is polled until its resources are ready, before its dependents are installed.
+func (m *Mixin) runReleases(ctx context.Context, verb string, releases []stepRelease) error {
+	ordered, err := orderReleases(releases)
+	if err != nil {
+		return err
+	}
+	dependencies := map[string]bool{}
+	for _, release := range releases {
+		for _, dependency := range release.DependsOn {
+			dependencies[dependency] = true
+		}
+	}
+
+	for i, release := range ordered {
+		skip, err := m.skipCondition(release.Step)
+		if err != nil {
+			return errors.Wrapf(err, "release %s failed", release.Name)
+		}
+		if skip {
+			continue
+		}
+
+		fmt.Fprintf(m.Out, "%s release %s (%d of %d)\n", verb, release.Name, i+1, len(ordered))
+		if err := release.run(withStep(ctx, release.Step)); err != nil {
+			return errors.Wrapf(err, "release %s failed", release.Name)
+		}
+
+		// kubectl doesn't wait for the resources in apply mode, and there is no helm release to poll
+		if !dependencies[release.Name] || release.waits() || release.Mode == ModeApply {
+			continue
+		}
+		env, err := buildHelmEnv(release.Args)
+		if err != nil {
+			return err
+		}
+		if err := m.pollRelease(ctx, nil, release.Args, env); err != nil {
+			return errors.Wrapf(err, "release %s failed", release.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package helm3
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"get.porter.sh/porter/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestOrderReleases(t *testing.T) {
+	names := func(releases []stepRelease) []string {
+		var names []string
+		for _, release := range releases {
+			names = append(names, release.Name)
+		}
+		return names
+	}
+
+	ordered, err := orderReleases([]stepRelease{
+		{Name: "web", DependsOn: []string{"cert-manager", "db"}},
+		{Name: "db"},
+		{Name: "monitoring"},
+		{Name: "cert-manager"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"db", "monitoring", "cert-manager", "web"}, names(ordered))
+
+	_, err = orderReleases([]stepRelease{{Name: "web", DependsOn: []string{"db"}}})
+	assert.EqualError(t, err, "release web depends on db, which is not a release of the step")
+
+	_, err = orderReleases([]stepRelease{{Name: "web"}, {Name: "web"}})
+	assert.EqualError(t, err, "release web is declared more than once")
+
+	_, err = orderReleases([]stepRelease{
+		{Name: "monitoring"},
+		{Name: "web", DependsOn: []string{"db"}},
+		{Name: "db", DependsOn: []string{"web"}},
+	})
+	assert.EqualError(t, err, "the dependencies of releases web, db form a cycle")
+}
+
+func TestMixin_InstallReleasesDependsOn(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	os.Setenv(test.ExpectedCommandEnv, strings.Join([]string{
+		"helm3 upgrade --install cert-manager jetstack/cert-manager --namespace cert-manager --create-namespace",
+		"helm3 get manifest cert-manager --namespace cert-manager",
+		"helm3 upgrade --install web ./charts/web --create-namespace",
+	}, "\n"))
+	defer os.Unsetenv(test.ExpectedCommandOutputEnv)
+	os.Setenv(test.ExpectedCommandOutputEnv, "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: cert-manager\n")
+	interval := releasePollInterval
+	releasePollInterval = time.Millisecond
+	defer func() { releasePollInterval = interval }()
+
+	b := []byte(`install:
+- helm3:
+    description: Install the platform
+    atomic: false
+    releases:
+    - name: web
+      chart: ./charts/web
+      dependsOn:
+      - cert-manager
+    - name: cert-manager
+      chart: jetstack/cert-manager
+      namespace: cert-manager
+`)
+	h := NewTestMixin(t)
+	h.Setenv(verifyClientVersionEnv, "false")
+	h.In = bytes.NewReader(b)
+	h.ClientFactory = &clientKubernetesFactory{client: testclient.NewSimpleClientset(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "cert-manager", Namespace: "cert-manager"},
+		Status:     appsv1.DeploymentStatus{UpdatedReplicas: 1, AvailableReplicas: 1},
+	})}
+
+	err := h.Install(ctx)
+	require.NoError(t, err)
+	output := h.TestContext.GetOutput()
+	assert.Contains(t, output, "Installing release cert-manager (1 of 2)\n")
+	assert.Contains(t, output, "Installing release web (2 of 2)\n")
+	assert.Contains(t, h.TestContext.GetError(), "The resources of release cert-manager are ready\n")
+}
+
+func TestMixin_InstallDependsOnRequiresReleases(t *testing.T) {
+	b := []byte(`install:
+- helm3:
+    description: Install my app
+    name: web
+    chart: ./charts/web
+    dependsOn:
+    - db
+`)
+	h := NewTestMixin(t)
+	h.Setenv(verifyClientVersionEnv, "false")
+	h.In = bytes.NewReader(b)
+
+	err := h.Install(context.Background())
+	assert.EqualError(t, err, "dependsOn can only be set on the releases of a step")
+}
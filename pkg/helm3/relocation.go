@@ -0,0 +1,167 @@
+package helm3
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// relocationMappingPath is where the CNAB runtime provides the mapping of
+// the original image references to the relocated references, after a bundle
+// has been copied to another registry.
+const relocationMappingPath = "/cnab/app/relocation-mapping.json"
+
+// ImageValues are the chart value paths, for example image.repository,
+// that are set with the parts of an image reference.
+type ImageValues struct {
+	Repository string `yaml:"repository,omitempty"`
+	Tag        string `yaml:"tag,omitempty"`
+	Digest     string `yaml:"digest,omitempty"`
+	Reference  string `yaml:"reference,omitempty"`
+}
+
+// ImageRelocation sets chart values to the relocated reference of an image,
+// when the image was relocated.
+type ImageRelocation struct {
+	// Image is the original image reference, as declared in the bundle.
+	Image       string `yaml:"image"`
+	ImageValues `yaml:",inline"`
+}
+
+// imageReference is an image reference split into its parts.
+type imageReference struct {
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// parseImageReference splits an image reference, for example
+// localhost:5000/mysql:8.0@sha256:abc, into its repository, tag and digest.
+func parseImageReference(ref string) imageReference {
+	var image imageReference
+	if i := strings.Index(ref, "@"); i >= 0 {
+		image.Digest = ref[i+1:]
+		ref = ref[:i]
+	}
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		image.Tag = ref[i+1:]
+		ref = ref[:i]
+	}
+	image.Repository = ref
+	return image
+}
+
+// setValues returns the values to set on the chart for the reference.
+func (v ImageValues) setValues(ref string) map[string]string {
+	image := parseImageReference(ref)
+	values := map[string]string{}
+	if v.Repository != "" {
+		values[v.Repository] = image.Repository
+	}
+	if v.Tag != "" && image.Tag != "" {
+		values[v.Tag] = image.Tag
+	}
+	if v.Digest != "" && image.Digest != "" {
+		values[v.Digest] = image.Digest
+	}
+	if v.Reference != "" {
+		values[v.Reference] = ref
+	}
+	return values
+}
+
+// loadRelocationMapping reads the relocation mapping of the bundle,
+// returning an empty mapping when the bundle was not relocated.
+func (m *Mixin) loadRelocationMapping() (map[string]string, error) {
+	mapping := map[string]string{}
+
+	exists, _ := m.FileSystem.Exists(relocationMappingPath)
+	if !exists {
+		return mapping, nil
+	}
+
+	data, err := m.FileSystem.ReadFile(relocationMappingPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read the relocation mapping %s", relocationMappingPath)
+	}
+	err = json.Unmarshal(data, &mapping)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not parse the relocation mapping %s", relocationMappingPath)
+	}
+	return mapping, nil
+}
+
+// applyRelocations sets the chart values of the relocated images, overriding the values set by the step.
+func (m *Mixin) applyRelocations(a helmArgs, relocations []ImageRelocation) (helmArgs, error) {
+	if len(relocations) == 0 {
+		return a, nil
+	}
+
+	mapping, err := m.loadRelocationMapping()
+	if err != nil {
+		return a, err
+	}
+
+	set := copySet(a.Set)
+	for _, relocation := range relocations {
+		relocated, ok := mapping[relocation.Image]
+		if !ok {
+			continue
+		}
+		for k, v := range relocation.setValues(relocated) {
+			set[k] = v
+		}
+	}
+	a.Set = set
+	return a, nil
+}
+
+// applyImageMap sets the chart values bound to the images of the bundle, overriding the values set by the step.
+// The relocated image is used when the bundle was copied to another registry, otherwise the image
+// is pinned to its digest when it is known.
+func (m *Mixin) applyImageMap(a helmArgs, imageMap map[string]ImageValues) (helmArgs, error) {
+	if len(imageMap) == 0 {
+		return a, nil
+	}
+
+	bun, err := m.loadBundle()
+	if err != nil {
+		return a, err
+	}
+	mapping, err := m.loadRelocationMapping()
+	if err != nil {
+		return a, err
+	}
+
+	set := copySet(a.Set)
+	for name, values := range imageMap {
+		image, ok := bun.Images[name]
+		if !ok {
+			return a, errors.Errorf("image %s is not declared in the images section of the bundle", name)
+		}
+
+		ref, relocated := mapping[image.Image]
+		if !relocated {
+			ref = image.Image
+			if image.ContentDigest != "" && !strings.Contains(ref, "@") {
+				ref = ref + "@" + image.ContentDigest
+			}
+		}
+
+		for k, v := range values.setValues(ref) {
+			set[k] = v
+		}
+	}
+	a.Set = set
+	return a, nil
+}
+
+// copySet returns a copy of the values so that they can be changed without changing the step.
+func copySet(values map[string]string) map[string]string {
+	set := make(map[string]string, len(values))
+	for k, v := range values {
+		set[k] = v
+	}
+	return set
+}
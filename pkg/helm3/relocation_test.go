@@ -0,0 +1,148 @@
+package helm3
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"get.porter.sh/porter/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestParseImageReference(t *testing.T) {
+	testcases := []struct {
+		ref  string
+		want imageReference
+	}{
+		{"mysql", imageReference{Repository: "mysql"}},
+		{"docker.io/library/mysql:8.0", imageReference{Repository: "docker.io/library/mysql", Tag: "8.0"}},
+		{"localhost:5000/mysql", imageReference{Repository: "localhost:5000/mysql"}},
+		{"localhost:5000/mysql:8.0@sha256:abc123", imageReference{Repository: "localhost:5000/mysql", Tag: "8.0", Digest: "sha256:abc123"}},
+		{"registry.example.com/bundles/mysql@sha256:abc123", imageReference{Repository: "registry.example.com/bundles/mysql", Digest: "sha256:abc123"}},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.ref, func(t *testing.T) {
+			assert.Equal(t, tc.want, parseImageReference(tc.ref))
+		})
+	}
+}
+
+func TestMixin_InstallRelocatedImages(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 upgrade --install mysql stable/mysql --atomic --create-namespace "+
+		"--set image.digest=sha256:abc123 --set image.repository=registry.example.com/bundles/mysql --set metrics.enabled=true")
+
+	step := InstallStep{
+		InstallArguments: InstallArguments{
+			Step: Step{Description: "Install MySQL"},
+			ChartArguments: ChartArguments{
+				Name:  "mysql",
+				Chart: "stable/mysql",
+				Set: map[string]string{
+					"image.repository": "docker.io/library/mysql",
+					"metrics.enabled":  "true",
+				},
+				RelocateImages: []ImageRelocation{
+					{
+						Image:       "docker.io/library/mysql:8.0",
+						ImageValues: ImageValues{Repository: "image.repository", Tag: "image.tag", Digest: "image.digest"},
+					},
+					{
+						Image:       "docker.io/prom/mysqld-exporter:v0.14.0",
+						ImageValues: ImageValues{Repository: "metrics.image.repository"},
+					},
+				},
+			},
+		},
+	}
+	action := InstallAction{Steps: []InstallStep{step}}
+	b, err := yaml.Marshal(action)
+	require.NoError(t, err)
+
+	h := NewTestMixin(t)
+	h.Setenv(verifyClientVersionEnv, "false")
+	mapping := `{"docker.io/library/mysql:8.0": "registry.example.com/bundles/mysql@sha256:abc123"}`
+	err = h.FileSystem.WriteFile(relocationMappingPath, []byte(mapping), 0644)
+	require.NoError(t, err)
+	h.In = bytes.NewReader(b)
+
+	err = h.Install(ctx)
+	require.NoError(t, err)
+}
+
+func TestMixin_InstallImageMap(t *testing.T) {
+	bun := `{"images": {
+  "mysql": {"image": "docker.io/library/mysql:8.0", "contentDigest": "sha256:abc123"},
+  "exporter": {"image": "docker.io/prom/mysqld-exporter:v0.14.0", "contentDigest": "sha256:def456"}
+}}`
+
+	testcases := []struct {
+		name     string
+		mapping  string
+		expected string
+	}{
+		{
+			name: "pinned to digest",
+			expected: "helm3 upgrade --install mysql stable/mysql --atomic --create-namespace " +
+				"--set image.digest=sha256:abc123 --set image.repository=docker.io/library/mysql --set image.tag=8.0 " +
+				"--set metrics.image=docker.io/prom/mysqld-exporter:v0.14.0@sha256:def456",
+		},
+		{
+			name:    "relocated",
+			mapping: `{"docker.io/library/mysql:8.0": "registry.example.com/bundles/mysql@sha256:abc123"}`,
+			expected: "helm3 upgrade --install mysql stable/mysql --atomic --create-namespace " +
+				"--set image.digest=sha256:abc123 --set image.repository=registry.example.com/bundles/mysql --set image.tag=latest " +
+				"--set metrics.image=docker.io/prom/mysqld-exporter:v0.14.0@sha256:def456",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			defer os.Unsetenv(test.ExpectedCommandEnv)
+			os.Setenv(test.ExpectedCommandEnv, tc.expected)
+
+			step := InstallStep{
+				InstallArguments: InstallArguments{
+					Step: Step{Description: "Install MySQL"},
+					ChartArguments: ChartArguments{
+						Name:  "mysql",
+						Chart: "stable/mysql",
+						Set:   map[string]string{"image.tag": "latest"},
+						ImageMap: map[string]ImageValues{
+							"mysql":    {Repository: "image.repository", Tag: "image.tag", Digest: "image.digest"},
+							"exporter": {Reference: "metrics.image"},
+						},
+					},
+				},
+			}
+			action := InstallAction{Steps: []InstallStep{step}}
+			b, err := yaml.Marshal(action)
+			require.NoError(t, err)
+
+			h := NewTestMixin(t)
+			h.Setenv(verifyClientVersionEnv, "false")
+			require.NoError(t, h.FileSystem.WriteFile(bundlePath, []byte(bun), 0644))
+			if tc.mapping != "" {
+				require.NoError(t, h.FileSystem.WriteFile(relocationMappingPath, []byte(tc.mapping), 0644))
+			}
+			h.In = bytes.NewReader(b)
+
+			err = h.Install(ctx)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestMixin_ImageMapUnknownImage(t *testing.T) {
+	h := NewTestMixin(t)
+	require.NoError(t, h.FileSystem.WriteFile(bundlePath, []byte(`{"images": {}}`), 0644))
+
+	_, err := h.applyImageMap(helmArgs{}, map[string]ImageValues{"mysql": {Repository: "image.repository"}})
+	require.EqualError(t, err, "image mysql is not declared in the images section of the bundle")
+}
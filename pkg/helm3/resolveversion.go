@@ -0,0 +1,89 @@
+package helm3
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/pkg/errors"
+)
+
+// helmReleasesIndexURL lists the archives of the helm releases published on get.helm.sh for a minor version
+const helmReleasesIndexURL = "https://get.helm.sh/?comp=list&restype=container&prefix=helm-%s."
+
+// patchWildcard matches a client version that selects the latest patch release of a minor version, for example v3.14.x
+var patchWildcard = regexp.MustCompile(`^v?(\d+\.\d+)\.[xX*]$`)
+
+// resolveClientVersion returns the client version to install. When the configured version is a patch wildcard,
+// it is resolved to the latest patch release of the minor version published for the client platform and
+// architecture, in the index of get.helm.sh or in the clientVersionIndex of the configuration.
+func (m *Mixin) resolveClientVersion(config MixinConfig) (string, error) {
+	match := patchWildcard.FindStringSubmatch(config.ClientVersion)
+	if match == nil {
+		return config.ClientVersion, nil
+	}
+	minor := "v" + match[1]
+	if config.Offline {
+		return "", errors.Errorf("the mixin is offline, but it needs the network to resolve clientVersion %q", config.ClientVersion)
+	}
+
+	platform := config.ClientPlatform
+	if platform == "" {
+		platform = m.HelmClientPlatform
+	}
+	// The architecture is matched against the names of the helm archives, so i386 is listed as 386
+	arch := m.HelmClientArchitecture
+	if config.ClientArchitecture != "" {
+		var err error
+		if arch, err = validateClientArchitecture(config.ClientArchitecture); err != nil {
+			return "", err
+		}
+	}
+
+	index := config.ClientVersionIndex
+	if index == "" {
+		index = fmt.Sprintf(helmReleasesIndexURL, minor)
+	}
+	client, err := m.newDownloadClient("")
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Get(index)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not resolve clientVersion %q", config.ClientVersion)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("could not resolve clientVersion %q: %s returned %s", config.ClientVersion, index, resp.Status)
+	}
+	listing, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not resolve clientVersion %q", config.ClientVersion)
+	}
+
+	// Only the releases with an archive for the platform of the client are candidates,
+	// the release candidates don't match since their version is followed by -rc
+	archive := regexp.MustCompile(`helm-(` + regexp.QuoteMeta(minor) + `\.\d+)-` +
+		regexp.QuoteMeta(platform) + "-" + regexp.QuoteMeta(arch) + `\.`)
+	var latest *semver.Version
+	for _, found := range archive.FindAllStringSubmatch(string(listing), -1) {
+		v, err := semver.NewVersion(found[1])
+		if err != nil {
+			continue
+		}
+		if latest == nil || v.GreaterThan(latest) {
+			latest = v
+		}
+	}
+	if latest == nil {
+		return "", errors.Errorf("could not resolve clientVersion %q: no %s-%s release of helm %s is listed in %s",
+			config.ClientVersion, platform, arch, minor, index)
+	}
+
+	resolved := "v" + strings.TrimPrefix(latest.Original(), "v")
+	fmt.Fprintf(m.Err, "Resolved clientVersion %s to %s\n", config.ClientVersion, resolved)
+	return resolved, nil
+}
@@ -0,0 +1,88 @@
+package helm3
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMixin_ResolveClientVersion(t *testing.T) {
+	listing := `<EnumerationResults><Blobs>
+<Blob><Name>helm-v3.14.0-linux-amd64.tar.gz</Name></Blob>
+<Blob><Name>helm-v3.14.3-linux-amd64.tar.gz</Name></Blob>
+<Blob><Name>helm-v3.14.4-linux-amd64.tar.gz</Name></Blob>
+<Blob><Name>helm-v3.14.4-linux-amd64.tar.gz.sha256sum</Name></Blob>
+<Blob><Name>helm-v3.14.10-linux-arm64.tar.gz</Name></Blob>
+<Blob><Name>helm-v3.14.7-linux-386.tar.gz</Name></Blob>
+<Blob><Name>helm-v3.14.5-rc.1-linux-amd64.tar.gz</Name></Blob>
+<Blob><Name>helm-v3.15.0-linux-amd64.tar.gz</Name></Blob>
+</Blobs></EnumerationResults>`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/index" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(listing))
+	}))
+	defer srv.Close()
+
+	testcases := []struct {
+		name      string
+		config    MixinConfig
+		want      string
+		wantError string
+	}{
+		{name: "pinned version", config: MixinConfig{ClientVersion: "v3.14.1"}, want: "v3.14.1"},
+		{name: "default version", config: MixinConfig{}, want: ""},
+		{name: "latest patch", config: MixinConfig{ClientVersion: "v3.14.x"}, want: "v3.14.4"},
+		{name: "latest patch without v", config: MixinConfig{ClientVersion: "3.14.x"}, want: "v3.14.4"},
+		{name: "latest patch of the architecture", config: MixinConfig{ClientVersion: "v3.14.x", ClientArchitecture: "arm64"}, want: "v3.14.10"},
+		{name: "latest patch of the i386 architecture", config: MixinConfig{ClientVersion: "v3.14.x", ClientArchitecture: "i386"}, want: "v3.14.7"},
+		{
+			name:      "unsupported architecture",
+			config:    MixinConfig{ClientVersion: "v3.14.x", ClientArchitecture: "sparc"},
+			wantError: `unsupported clientArchitecture "sparc", allowed values are ` + strings.Join(clientArchitectures, ", "),
+		},
+		{
+			name:      "no release",
+			config:    MixinConfig{ClientVersion: "v3.16.x"},
+			wantError: fmt.Sprintf(`could not resolve clientVersion "v3.16.x": no linux-amd64 release of helm v3.16 is listed in %s/index`, srv.URL),
+		},
+		{
+			name:      "offline",
+			config:    MixinConfig{ClientVersion: "v3.14.x", Offline: true},
+			wantError: `the mixin is offline, but it needs the network to resolve clientVersion "v3.14.x"`,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := NewTestMixin(t)
+			tc.config.ClientVersionIndex = srv.URL + "/index"
+
+			got, err := m.resolveClientVersion(tc.config)
+			if tc.wantError != "" {
+				require.EqualError(t, err, tc.wantError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+
+	t.Run("build pins the resolved version", func(t *testing.T) {
+		m := NewTestMixin(t)
+		m.In = bytes.NewReader([]byte(fmt.Sprintf("config:\n  clientVersion: v3.14.x\n  clientVersionIndex: %s/index\n", srv.URL)))
+
+		err := m.Build(context.Background())
+		require.NoError(t, err)
+		assert.Contains(t, m.TestContext.GetOutput(), "https://get.helm.sh/helm-v3.14.4-linux-amd64.tar.gz")
+		assert.Contains(t, m.TestContext.GetError(), "Resolved clientVersion v3.14.x to v3.14.4")
+	})
+}
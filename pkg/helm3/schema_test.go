@@ -47,6 +47,7 @@ func TestMixin_ValidateSchema(t *testing.T) {
 		{"install", "testdata/uninstall-input.yaml", ""},
 		{"invalid property", "testdata/invalid-input.yaml", "Additional property args is not allowed"},
 		{"mixin config", "testdata/config-input.yaml", ""},
+		{"registry login", "testdata/install-input-registry-login.yaml", ""},
 	}
 
 	for _, tc := range testcases {
@@ -3,6 +3,23 @@ package helm3
 type Step struct {
 	Description string       `yaml:"description"`
 	Outputs     []HelmOutput `yaml:"outputs,omitempty"`
+
+	// SuppressOutput hides the output of helm, which can contain sensitive values, from the logs
+	SuppressOutput bool `yaml:"suppress-output,omitempty"`
+
+	// Condition skips the step when it is false, for example "${ bundle.parameters.install-ingress }"
+	Condition string `yaml:"condition,omitempty"`
+
+	// Offline fails the step when it needs the network, like the offline setting of the mixin
+	Offline bool `yaml:"offline,omitempty"`
+
+	Commands `yaml:",inline"`
+
+	ExecHooks `yaml:",inline"`
+}
+
+func (s Step) SuppressesOutput() bool {
+	return s.SuppressOutput
 }
 
 type HelmOutput struct {
@@ -13,4 +30,76 @@ type HelmOutput struct {
 	ResourceName string `yaml:"resourceName,omitempty"`
 	Namespace    string `yaml:"namespace,omitempty"`
 	JSONPath     string `yaml:"jsonPath,omitempty"`
+
+	// SecretSelector is a label selector for the secret, used instead of the secret name when the chart generates it
+	SecretSelector string `yaml:"secretSelector,omitempty"`
+
+	// WaitForAddress waits for the load balancer address of the service or ingress set with ResourceType and ResourceName
+	WaitForAddress bool `yaml:"waitForAddress,omitempty"`
+
+	// Timeout is how long WaitForAddress waits for the address, it defaults to 5m
+	Timeout string `yaml:"timeout,omitempty"`
+
+	// ConfigMap is the name of a config map, whose Key is used as the output
+	ConfigMap string `yaml:"configMap,omitempty"`
+
+	// Fields assemble the output as a JSON object, each field selects its value like an output
+	Fields map[string]HelmOutput `yaml:"fields,omitempty"`
+
+	// Path is a file produced by the step in the invocation image, for example a generated kubeconfig,
+	// whose contents are used as the output
+	Path string `yaml:"path,omitempty"`
+
+	// Sensitive outputs are written to the output files, but their values are never printed
+	Sensitive bool `yaml:"sensitive,omitempty"`
+}
+
+// isSensitive returns true when the value of the output must not be printed: the output, or one of its fields,
+// is marked sensitive, or its name looks like a credential.
+func (o HelmOutput) isSensitive() bool {
+	if o.Sensitive || isSensitiveValue(o.Name) {
+		return true
+	}
+	for name, field := range o.Fields {
+		if field.isSensitive() || isSensitiveValue(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// KubeArguments select the cluster and the identity used by helm,
+// instead of the current context of the kubeconfig.
+type KubeArguments struct {
+	KubeContext   string   `yaml:"kubeContext,omitempty"`
+	KubeAPIServer string   `yaml:"kubeApiServer,omitempty"`
+	KubeToken     string   `yaml:"kubeToken,omitempty"`
+	KubeAsUser    string   `yaml:"kubeAsUser,omitempty"`
+	KubeAsGroup   []string `yaml:"kubeAsGroup,omitempty"`
+	KubeCAFile    string   `yaml:"kubeCaFile,omitempty"`
+}
+
+// kubectlFlags returns the flags that select the same cluster and identity as helm for kubectl.
+// The token is masked when the command is printed.
+func (k KubeArguments) kubectlFlags() []string {
+	var args []string
+	if k.KubeContext != "" {
+		args = append(args, "--context", k.KubeContext)
+	}
+	if k.KubeAPIServer != "" {
+		args = append(args, "--server", k.KubeAPIServer)
+	}
+	if k.KubeToken != "" {
+		args = append(args, "--token", k.KubeToken)
+	}
+	if k.KubeAsUser != "" {
+		args = append(args, "--as", k.KubeAsUser)
+	}
+	for _, g := range k.KubeAsGroup {
+		args = append(args, "--as-group", g)
+	}
+	if k.KubeCAFile != "" {
+		args = append(args, "--certificate-authority", k.KubeCAFile)
+	}
+	return args
 }
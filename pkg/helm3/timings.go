@@ -0,0 +1,91 @@
+package helm3
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// timingsOutputEnv is the name of the output that receives the timings of the releases, set by Build
+// from the timingsOutput of the mixin configuration
+const timingsOutputEnv = "HELM3_MIXIN_TIMINGS_OUTPUT"
+
+// timingsFile accumulates the timings of the steps of the action, since each step runs the mixin in a new process
+var timingsFile = filepath.Join(os.TempDir(), "helm3-mixin-timings.json")
+
+// timingsClock returns the current time, it is replaced by the tests
+var timingsClock = time.Now
+
+// ReleaseTiming is the duration and the result of a release in the timings output
+type ReleaseTiming struct {
+	Step     string  `json:"step,omitempty"`
+	Command  string  `json:"command"`
+	Release  string  `json:"release"`
+	Chart    string  `json:"chart,omitempty"`
+	Duration float64 `json:"durationSeconds"`
+	Result   string  `json:"result"`
+}
+
+// timed runs a release of a step, and when the mixin configuration sets timingsOutput, prints the timings of
+// the releases of the action so far and writes them to the output.
+func (m *Mixin) timed(step Step, command, release, chart string, run func() error) error {
+	output := m.Getenv(timingsOutputEnv)
+	if output == "" {
+		return run()
+	}
+
+	start := timingsClock()
+	err := run()
+	timing := ReleaseTiming{
+		Step:     step.Description,
+		Command:  command,
+		Release:  release,
+		Chart:    chart,
+		Duration: timingsClock().Sub(start).Round(time.Millisecond).Seconds(),
+		Result:   "succeeded",
+	}
+	if err != nil {
+		timing.Result = "failed"
+	}
+	// The timings are informational, they don't fail the step
+	if recordErr := m.recordTiming(output, timing); recordErr != nil {
+		fmt.Fprintf(m.Err, "WARNING: %s\n", recordErr)
+	}
+	return err
+}
+
+// recordTiming appends the timing of a release to the timings of the action, prints them and writes them to the output.
+func (m *Mixin) recordTiming(output string, timing ReleaseTiming) error {
+	var timings []ReleaseTiming
+	if data, err := m.FileSystem.ReadFile(timingsFile); err == nil {
+		if err := json.Unmarshal(data, &timings); err != nil {
+			return errors.Wrapf(err, "could not read the timings of the action from %s", timingsFile)
+		}
+	}
+	timings = append(timings, timing)
+
+	data, err := json.Marshal(timings)
+	if err != nil {
+		return errors.Wrap(err, "could not record the timings of the action")
+	}
+	if err := m.FileSystem.WriteFile(timingsFile, data, 0600); err != nil {
+		return errors.Wrapf(err, "could not record the timings of the action in %s", timingsFile)
+	}
+	if err := m.WriteMixinOutputToFile(output, data); err != nil {
+		return errors.Wrapf(err, "unable to write output '%s'", output)
+	}
+
+	fmt.Fprintln(m.Err, "Timings of the action:")
+	w := tabwriter.NewWriter(m.Err, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STEP\tCOMMAND\tRELEASE\tCHART\tDURATION\tRESULT")
+	for _, t := range timings {
+		duration := time.Duration(t.Duration * float64(time.Second)).Round(time.Millisecond)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", t.Step, t.Command, t.Release, t.Chart, duration, t.Result)
+	}
+	return w.Flush()
+}
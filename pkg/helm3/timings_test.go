@@ -0,0 +1,99 @@
+package helm3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	portercontext "get.porter.sh/porter/pkg/portercontext"
+	"get.porter.sh/porter/pkg/test"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTimingsClock advances the clock of the timings by a second each time it is read
+func fakeTimingsClock(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	timingsClock = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	t.Cleanup(func() { timingsClock = time.Now })
+}
+
+func TestMixin_InstallTimings(t *testing.T) {
+	fakeTimingsClock(t)
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	os.Setenv(test.ExpectedCommandEnv, strings.Join([]string{
+		"helm3 upgrade --install postgresql bitnami/postgresql --namespace platform --atomic --create-namespace",
+		"helm3 upgrade --install keycloak bitnami/keycloak --namespace platform --atomic --create-namespace",
+	}, "\n"))
+
+	h := NewTestMixin(t)
+	h.Setenv(verifyClientVersionEnv, "false")
+	h.Setenv(timingsOutputEnv, "timings")
+	h.In = bytes.NewReader([]byte(`install:
+- helm3:
+    description: Install the platform
+    namespace: platform
+    releases:
+    - name: postgresql
+      chart: bitnami/postgresql
+    - name: keycloak
+      chart: bitnami/keycloak
+`))
+
+	err := h.Install(context.Background())
+	require.NoError(t, err)
+	assert.Contains(t, h.TestContext.GetError(), `Timings of the action:
+STEP                  COMMAND  RELEASE     CHART               DURATION  RESULT
+Install the platform  install  postgresql  bitnami/postgresql  1s        succeeded
+Install the platform  install  keycloak    bitnami/keycloak    1s        succeeded
+`)
+
+	data, err := h.FileSystem.ReadFile(path.Join(portercontext.MixinOutputsDir, "timings"))
+	require.NoError(t, err)
+	var timings []ReleaseTiming
+	require.NoError(t, json.Unmarshal(data, &timings))
+	assert.Equal(t, []ReleaseTiming{
+		{Step: "Install the platform", Command: "install", Release: "postgresql", Chart: "bitnami/postgresql", Duration: 1, Result: "succeeded"},
+		{Step: "Install the platform", Command: "install", Release: "keycloak", Chart: "bitnami/keycloak", Duration: 1, Result: "succeeded"},
+	}, timings)
+}
+
+func TestMixin_Timed(t *testing.T) {
+	fakeTimingsClock(t)
+
+	t.Run("disabled", func(t *testing.T) {
+		h := NewTestMixin(t)
+		err := h.timed(Step{}, "uninstall", "mysql", "", func() error { return nil })
+		require.NoError(t, err)
+		assert.Empty(t, h.TestContext.GetError())
+		exists, _ := h.FileSystem.Exists(timingsFile)
+		assert.False(t, exists)
+	})
+
+	t.Run("accumulates the steps of the action", func(t *testing.T) {
+		h := NewTestMixin(t)
+		h.Setenv(timingsOutputEnv, "timings")
+
+		err := h.timed(Step{Description: "Install MySQL"}, "install", "mysql", "bitnami/mysql", func() error { return nil })
+		require.NoError(t, err)
+		err = h.timed(Step{Description: "Uninstall MySQL"}, "uninstall", "mysql", "", func() error { return errors.New("timed out") })
+		require.EqualError(t, err, "timed out")
+
+		data, err := h.FileSystem.ReadFile(path.Join(portercontext.MixinOutputsDir, "timings"))
+		require.NoError(t, err)
+		assert.JSONEq(t, `[
+  {"step": "Install MySQL", "command": "install", "release": "mysql", "chart": "bitnami/mysql", "durationSeconds": 1, "result": "succeeded"},
+  {"step": "Uninstall MySQL", "command": "uninstall", "release": "mysql", "durationSeconds": 1, "result": "failed"}
+]`, string(data))
+		assert.Contains(t, h.TestContext.GetError(), "Uninstall MySQL  uninstall  mysql                   1s        failed\n")
+	})
+}
@@ -0,0 +1,64 @@
+package helm3
+
+import (
+	"context"
+	"os/exec"
+	"strconv"
+
+	"get.porter.sh/porter/pkg/portercontext"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Standard OpenTelemetry environment variables used to export the spans of the mixin
+const (
+	otelEndpointEnv = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	otelProtocolEnv = "OTEL_EXPORTER_OTLP_PROTOCOL"
+	otelInsecureEnv = "OTEL_EXPORTER_OTLP_INSECURE"
+	otelServiceEnv  = "OTEL_SERVICE_NAME"
+)
+
+// ConfigureTelemetry enables exporting the spans of the mixin when an OpenTelemetry endpoint is configured
+// with the standard OTEL_EXPORTER_OTLP_* environment variables.
+func (m *Mixin) ConfigureTelemetry(ctx context.Context) context.Context {
+	endpoint := m.Getenv(otelEndpointEnv)
+	if endpoint == "" {
+		return ctx
+	}
+
+	serviceName := m.Getenv(otelServiceEnv)
+	if serviceName == "" {
+		serviceName = "helm3"
+	}
+	insecure, _ := strconv.ParseBool(m.Getenv(otelInsecureEnv))
+
+	return m.ConfigureLogging(ctx, portercontext.LogConfiguration{
+		TelemetryEnabled:     true,
+		TelemetryEndpoint:    endpoint,
+		TelemetryProtocol:    m.Getenv(otelProtocolEnv),
+		TelemetryInsecure:    insecure,
+		TelemetryServiceName: serviceName,
+	})
+}
+
+// releaseAttributes are the span attributes that identify the release of a step
+func releaseAttributes(a helmArgs) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("chart", a.Chart),
+		attribute.String("release", a.Release),
+		attribute.String("namespace", a.Namespace),
+	}
+}
+
+// exitCode returns the exit code of a command from the error returned when running it,
+// or -1 when the command could not be started.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
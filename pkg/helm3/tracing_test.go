@@ -0,0 +1,61 @@
+package helm3
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"testing"
+
+	"get.porter.sh/porter/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestMixin_ConfigureTelemetry(t *testing.T) {
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "parent")
+
+	m := NewTestMixin(t)
+	assert.Equal(t, ctx, m.ConfigureTelemetry(ctx), "the spans should not be exported without an OTLP endpoint")
+
+	m.Setenv(otelEndpointEnv, "http://localhost:4318")
+	m.Setenv(otelInsecureEnv, "true")
+	assert.Equal(t, "parent", m.ConfigureTelemetry(ctx).Value(ctxKey{}), "the context of the command should be kept")
+}
+
+func TestReleaseAttributes(t *testing.T) {
+	attrs := releaseAttributes(helmArgs{Chart: "stable/mysql", Release: "mysql", Namespace: "mydb"})
+	assert.Equal(t, []attribute.KeyValue{
+		attribute.String("chart", "stable/mysql"),
+		attribute.String("release", "mysql"),
+		attribute.String("namespace", "mydb"),
+	}, attrs)
+}
+
+func TestCommandExitCode(t *testing.T) {
+	assert.Equal(t, 0, exitCode(nil))
+	assert.Equal(t, 3, exitCode(exec.Command("sh", "-c", "exit 3").Run()))
+	assert.Equal(t, -1, exitCode(exec.Command("/does/not/exist").Run()), "a command that could not be started has no exit code")
+}
+
+func TestMixin_RunHelmExitCode(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	defer os.Unsetenv(test.ExpectedCommandExitCodeEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 status mysql")
+	os.Setenv(test.ExpectedCommandExitCodeEnv, "2")
+
+	m := NewTestMixin(t)
+	m.OutputFormat = OutputFormatJSON
+
+	err := m.runHelm(ctx, []string{"status", "mysql"}, nil)
+	require.Error(t, err)
+	assert.Equal(t, 2, exitCode(err))
+
+	var entry commandLog
+	require.NoError(t, json.Unmarshal([]byte(m.TestContext.GetOutput()), &entry))
+	assert.Equal(t, "helm3 status mysql", entry.Command)
+	assert.Equal(t, 2, entry.ExitCode)
+}
@@ -4,9 +4,9 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"io"
 	"strings"
 
+	"get.porter.sh/porter/pkg/tracing"
 	"github.com/hashicorp/go-multierror"
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
@@ -27,13 +27,42 @@ type UninstallArguments struct {
 	Namespace string   `yaml:"namespace,omitempty"`
 	Releases  []string `yaml:"releases"`
 	NoHooks   bool     `yaml:"noHooks"`
-	Wait      bool     `yaml:"wait"`
+	Wait      *bool    `yaml:"wait,omitempty"`
 	Timeout   string   `yaml:"timeout"`
-	Debug     bool     `yaml:"debug"`
+	Debug     *bool    `yaml:"debug,omitempty"`
+
+	StorageDriver       string `yaml:"storageDriver,omitempty"`
+	SQLConnectionString string `yaml:"sqlConnectionString,omitempty"`
+
+	// ReleaseNamespace is the namespace where helm stores the releases, instead of the namespace of the step
+	ReleaseNamespace string `yaml:"releaseNamespace,omitempty"`
+
+	// Env holds environment variables that are only set on the helm command
+	Env map[string]string `yaml:"env,omitempty"`
+
+	KubeArguments `yaml:",inline"`
+
+	BurstLimit int `yaml:"burstLimit,omitempty"`
+
+	// SkipIfMissing skips the releases that do not exist, instead of running helm uninstall
+	SkipIfMissing bool `yaml:"skipIfMissing,omitempty"`
+
+	// RemoveCRDs deletes the CRDs shipped in the crds directory of the chart after the release was uninstalled,
+	// it requires allowCRDRemoval in the mixin configuration
+	RemoveCRDs bool `yaml:"removeCRDs,omitempty"`
+
+	// Purge deletes the resources left after the releases were uninstalled, like the PersistentVolumeClaims of a StatefulSet
+	Purge []PurgeResource `yaml:"purge,omitempty"`
+
+	// DeleteNamespace deletes the namespace after the releases were uninstalled, waiting for it to be terminated with Wait
+	DeleteNamespace bool `yaml:"deleteNamespace,omitempty"`
 }
 
 // Uninstall deletes a provided set of Helm releases, supplying optional flags/params
 func (m *Mixin) Uninstall(ctx context.Context) error {
+	ctx, log := tracing.StartSpan(ctx)
+	defer log.EndSpan()
+
 	payload, err := m.getPayloadData()
 	if err != nil {
 		return err
@@ -48,55 +77,99 @@ func (m *Mixin) Uninstall(ctx context.Context) error {
 		return errors.Errorf("expected a single step, but got %d", len(action.Steps))
 	}
 	step := action.Steps[0]
+	ctx = withStep(ctx, step.Step)
+	if skip, err := m.skipCondition(step.Step); err != nil || skip {
+		return err
+	}
+	if step.hasCommand() {
+		return m.runCommand(ctx, step.Commands)
+	}
+
+	if err := checkReleaseNamespace(step.Namespace, step.ReleaseNamespace); err != nil {
+		return err
+	}
+	if step.RemoveCRDs {
+		if err := m.checkCRDRemoval(); err != nil {
+			return err
+		}
+	}
+
+	// the exec hooks get the releases of the step, separated by spaces
+	args := m.applyDefaults(step.helmArgs(strings.Join(step.Releases, " ")))
+	env, err := buildHelmEnv(args)
+	if err != nil {
+		return err
+	}
+	err = m.runExecHooks(ctx, "preExec", step.PreExec, step.ExecEnv, args, env)
+	if err != nil {
+		return err
+	}
 
 	// Delete each release one at a time, because helm stops on first error
 	// This gives us more fine-grained error recovery and handling
 	var result error
 	for _, release := range step.Releases {
-		err = m.delete(ctx, release, step.Namespace, step.NoHooks, step.Wait, step.Timeout, step.Debug)
+		err = m.timed(step.Step, "uninstall", release, "", func() error {
+			return m.delete(ctx, step.UninstallArguments, release)
+		})
 		if err != nil {
 			result = multierror.Append(result, err)
 		}
 	}
-	return result
-}
-
-func (m *Mixin) delete(ctx context.Context, release string, namespace string, noHooks bool, wait bool, timeout string, debug bool) error {
-	cmd := m.NewCommand(ctx, "helm3", "uninstall")
-
-	cmd.Args = append(cmd.Args, release)
-
-	if namespace != "" {
-		cmd.Args = append(cmd.Args, "--namespace", namespace)
+	if result != nil {
+		return log.Error(result)
 	}
 
-	if noHooks {
-		cmd.Args = append(cmd.Args, "--no-hooks")
+	err = m.runExecHooks(ctx, "postExec", step.PostExec, step.ExecEnv, args, env)
+	if err != nil {
+		return log.Error(err)
 	}
 
-	if wait {
-		cmd.Args = append(cmd.Args, "--wait")
+	if len(step.Purge) > 0 {
+		err = m.purgeResources(ctx, args, step.Purge)
+		if err != nil {
+			return log.Error(err)
+		}
 	}
 
-	if timeout != "" {
-		cmd.Args = append(cmd.Args, "--timeout", timeout)
+	if step.DeleteNamespace {
+		err = m.deleteNamespace(ctx, args)
+		if err != nil {
+			return log.Error(err)
+		}
 	}
+	return nil
+}
 
-	if debug {
-		cmd.Args = append(cmd.Args, "--debug")
-	}
-	output := &bytes.Buffer{}
-	cmd.Stdout = io.MultiWriter(m.Out, output)
-	cmd.Stderr = io.MultiWriter(m.Err, output)
+func (m *Mixin) delete(ctx context.Context, step UninstallArguments, release string) error {
+	args := m.applyDefaults(step.helmArgs(release))
 
-	prettyCmd := fmt.Sprintf("%s %s", cmd.Path, strings.Join(cmd.Args, " "))
-	fmt.Fprintln(m.Out, prettyCmd)
+	ctx, log := tracing.StartSpanWithName(ctx, "delete", releaseAttributes(args)...)
+	defer log.EndSpan()
 
-	err := cmd.Start()
+	env, err := buildHelmEnv(args)
 	if err != nil {
-		return fmt.Errorf("could not execute command, %s: %s", prettyCmd, err)
+		return err
+	}
+
+	skip, err := m.skipRelease(ctx, args, env, false, step.SkipIfMissing)
+	if err != nil || skip {
+		return err
+	}
+
+	// the CRDs are read from the release before it is uninstalled
+	var crds []string
+	if step.RemoveCRDs {
+		crds, err = m.releaseCRDs(ctx, args, env)
+		if err != nil {
+			return err
+		}
 	}
-	err = cmd.Wait()
+
+	output := &bytes.Buffer{}
+	stopHeartbeat := m.startHeartbeat(ctx, nil, args)
+	err = m.runHelmWithOutput(ctx, buildHelmArgs(args), env, output)
+	stopHeartbeat()
 	if err != nil {
 		// Gracefully handle the error being a release not loaded or found
 		outputBuffer := strings.ToLower(output.String())
@@ -112,5 +185,5 @@ func (m *Mixin) delete(ctx context.Context, release string, namespace string, no
 		return err
 	}
 
-	return nil
+	return m.removeCRDs(ctx, args.KubeArguments, release, crds)
 }
@@ -30,7 +30,7 @@ func TestMixin_UnmarshalUninstallStep(t *testing.T) {
 
 	assert.Equal(t, "Uninstall MySQL", step.Description)
 	assert.Equal(t, []string{"porter-ci-mysql"}, step.Releases)
-	assert.Equal(t, true, step.Wait)
+	assert.Equal(t, true, *step.Wait)
 	assert.Equal(t, true, step.NoHooks)
 }
 
@@ -63,14 +63,14 @@ func TestMixin_Uninstall(t *testing.T) {
 			},
 		},
 		{
-			expectedCommand: "helm3 uninstall foo --namespace my-namespace --no-hooks --wait",
+			expectedCommand: "helm3 uninstall foo --namespace my-namespace --wait --no-hooks",
 			uninstallStep: UninstallStep{
 				UninstallArguments: UninstallArguments{
 					Step:      Step{Description: "Uninstall Foo"},
 					Releases:  releases,
 					Namespace: namespace,
 					NoHooks:   noHooks,
-					Wait:      wait,
+					Wait:      &wait,
 				},
 			},
 		},
@@ -83,7 +83,7 @@ func TestMixin_Uninstall(t *testing.T) {
 					Namespace: namespace,
 					NoHooks:   noHooks,
 					Timeout:   "600",
-					Debug:     true,
+					Debug:     &wait,
 				},
 			},
 		},
@@ -107,3 +107,47 @@ func TestMixin_Uninstall(t *testing.T) {
 		})
 	}
 }
+
+func TestMixin_UninstallRemoveCRDs(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	defer os.Unsetenv(test.ExpectedCommandOutputEnv)
+	// the status of the release holds the files of its chart, the data of crds/backups.yaml is base64 encoded
+	os.Setenv(test.ExpectedCommandOutputEnv, `{"chart":{"files":[{"name":"crds/backups.yaml","data":"YXBpVmVyc2lvbjogYXBpZXh0ZW5zaW9ucy5rOHMuaW8vdjEKa2luZDogQ3VzdG9tUmVzb3VyY2VEZWZpbml0aW9uCm1ldGFkYXRhOgogIG5hbWU6IGJhY2t1cHMuZXhhbXBsZS5jb20K"},{"name":"README.md","data":""}]}}`)
+
+	step := UninstallStep{
+		UninstallArguments: UninstallArguments{
+			Step:       Step{Description: "Uninstall MySQL"},
+			Releases:   []string{"mysql"},
+			Namespace:  "mydb",
+			RemoveCRDs: true,
+			KubeArguments: KubeArguments{
+				KubeContext: "staging",
+			},
+		},
+	}
+	action := UninstallAction{Steps: []UninstallStep{step}}
+	b, err := yaml.Marshal(action)
+	require.NoError(t, err)
+
+	t.Run("confirmed", func(t *testing.T) {
+		os.Setenv(test.ExpectedCommandEnv, "helm3 status --output json mysql --namespace mydb --kube-context staging\n"+
+			"helm3 uninstall mysql --namespace mydb --kube-context staging\n"+
+			"kubectl delete customresourcedefinitions backups.example.com --ignore-not-found --context staging")
+		h := NewTestMixin(t)
+		h.Setenv(allowCRDRemovalEnv, "true")
+		h.In = bytes.NewReader(b)
+
+		err := h.Uninstall(ctx)
+		require.NoError(t, err)
+		assert.Contains(t, h.TestContext.GetError(), "Removing the CRDs of release mysql")
+	})
+
+	t.Run("not confirmed", func(t *testing.T) {
+		h := NewTestMixin(t)
+		h.In = bytes.NewReader(b)
+
+		err := h.Uninstall(ctx)
+		require.EqualError(t, err, "removeCRDs deletes the CRDs, and all their custom resources, from the whole cluster, set allowCRDRemoval in the mixin configuration to confirm it")
+	})
+}
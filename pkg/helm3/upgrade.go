@@ -2,11 +2,9 @@ package helm3
 
 import (
 	"context"
-	"fmt"
 	"os/exec"
-	"sort"
-	"strings"
 
+	"get.porter.sh/porter/pkg/tracing"
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
 )
@@ -22,40 +20,45 @@ type UpgradeStep struct {
 
 // UpgradeArguments represent the arguments available to the Upgrade step
 type UpgradeArguments struct {
-	Step `yaml:",inline"`
-
-	Namespace       string            `yaml:"namespace"`
-	Name            string            `yaml:"name"`
-	Chart           string            `yaml:"chart"`
-	Version         string            `yaml:"version"`
-	NoHooks         bool              `yaml:"nohooks"`
-	Set             map[string]string `yaml:"set"`
-	Values          []string          `yaml:"values"`
-	Wait            bool              `yaml:"wait"`
-	ResetValues     bool              `yaml:"resetValues"`
-	ReuseValues     bool              `yaml:"reuseValues"`
-	Repo            string            `yaml:"repo"`
-	SkipCrds        bool              `yaml:"skipCrds"`
-	Password        string            `yaml:"password"`
-	Username        string            `yaml:"username"`
-	Timeout         string            `yaml:"timeout"`
-	Debug           bool              `yaml:"debug"`
-	Atomic          *bool             `yaml:"atomic,omitempty"`
-	CreateNamespace *bool             `yaml:"createNamespace,omitempty"`
+	Step           `yaml:",inline"`
+	ChartArguments `yaml:",inline"`
+
+	ResetValues bool `yaml:"resetValues"`
+	ReuseValues bool `yaml:"reuseValues"`
+
+	// BackupBeforeUpgrade saves the values and the manifest of the release in outputs before upgrading it
+	BackupBeforeUpgrade bool `yaml:"backupBeforeUpgrade,omitempty"`
+
+	// RollbackOnFailure replaces --atomic: the failed revision is kept, diagnostics are collected
+	// and then the release is rolled back to its previous revision
+	RollbackOnFailure bool `yaml:"rollbackOnFailure,omitempty"`
+
+	// FixDeprecatedAPIs runs the mapkubeapis plugin against the release before upgrading it
+	FixDeprecatedAPIs bool `yaml:"fixDeprecatedAPIs,omitempty"`
+
+	// SkipIfMissing skips the upgrade when the release does not exist, instead of installing it
+	SkipIfMissing bool `yaml:"skipIfMissing,omitempty"`
+
+	// MinCurrentChartVersion is the oldest chart version of the deployed release that can be upgraded
+	MinCurrentChartVersion string `yaml:"minCurrentChartVersion,omitempty"`
+
+	// MaxVersionSkew is how many major chart versions an upgrade can cross, for example 1 to upgrade from 2.x to 3.x
+	MaxVersionSkew *int `yaml:"maxVersionSkew,omitempty"`
+
+	// UpgradePathPolicy is fail or warn, what the upgrade does when the upgrade path is not supported, it defaults to fail
+	UpgradePathPolicy string `yaml:"upgradePathPolicy,omitempty"`
 }
 
 // Upgrade issues a helm upgrade command for a release using the provided UpgradeArguments
 func (m *Mixin) Upgrade(ctx context.Context) error {
+	ctx, log := tracing.StartSpan(ctx)
+	defer log.EndSpan()
+
 	payload, err := m.getPayloadData()
 	if err != nil {
 		return err
 	}
 
-	kubeClient, err := m.getKubernetesClient()
-	if err != nil {
-		return errors.Wrap(err, "couldn't get kubernetes client")
-	}
-
 	var action UpgradeAction
 	err = yaml.Unmarshal(payload, &action)
 	if err != nil {
@@ -65,84 +68,101 @@ func (m *Mixin) Upgrade(ctx context.Context) error {
 		return errors.Errorf("expected a single step, but got %d", len(action.Steps))
 	}
 	step := action.Steps[0]
-
-	cmd := m.NewCommand(ctx, "helm3", "upgrade", "--install", step.Name, step.Chart)
-
-	if step.Namespace != "" {
-		cmd.Args = append(cmd.Args, "--namespace", step.Namespace)
-	}
-
-	if step.Version != "" {
-		cmd.Args = append(cmd.Args, "--version", step.Version)
-	}
-
-	if step.ResetValues {
-		cmd.Args = append(cmd.Args, "--reset-values")
-	}
-
-	if step.ReuseValues {
-		cmd.Args = append(cmd.Args, "--reuse-values")
-	}
-
-	if step.Wait {
-		cmd.Args = append(cmd.Args, "--wait")
-	}
-
-	for _, v := range step.Values {
-		cmd.Args = append(cmd.Args, "--values", v)
-	}
-
-	if step.Timeout != "" {
-		cmd.Args = append(cmd.Args, "--timeout", step.Timeout)
+	ctx = withStep(ctx, step.Step)
+	if skip, err := m.skipCondition(step.Step); err != nil || skip {
+		return err
 	}
-
-	if step.Debug {
-		cmd.Args = append(cmd.Args, "--debug")
+	if step.hasCommand() {
+		return m.runCommand(ctx, step.Commands)
 	}
-
-	if step.Atomic == nil || *step.Atomic {
-		// This will upgrade process rolls back changes made in case of failed upgrade.
-		cmd.Args = append(cmd.Args, "--atomic")
+	if err := m.verifyClientVersion(ctx); err != nil {
+		return err
 	}
-
-	if step.CreateNamespace == nil || *step.CreateNamespace {
-		// This will ensure the creation of the release namespace if not present.
-		cmd.Args = append(cmd.Args, "--create-namespace")
+	if len(step.Releases) == 0 {
+		if len(step.DependsOn) > 0 {
+			return errors.New("dependsOn can only be set on the releases of a step")
+		}
+		return m.timed(step.Step, "upgrade", step.Name, step.Chart, func() error {
+			return m.upgradeRelease(ctx, step.UpgradeArguments)
+		})
 	}
 
-	cmd.Args = HandleSettingChartValuesForUpgrade(step, cmd)
-
-	cmd.Stdout = m.Out
-	cmd.Stderr = m.Err
-
-	prettyCmd := fmt.Sprintf("%s %s", cmd.Path, strings.Join(cmd.Args, " "))
-	fmt.Fprintln(m.Out, prettyCmd)
-
-	err = cmd.Start()
-	if err != nil {
-		return fmt.Errorf("could not execute command, %s: %s", prettyCmd, err)
-	}
-	err = cmd.Wait()
+	releases, err := step.releases()
 	if err != nil {
 		return err
 	}
+	runs := make([]stepRelease, len(releases))
+	for i, release := range releases {
+		release := release
+		args := m.applyDefaults(release.helmArgs())
+		runs[i] = stepRelease{
+			Name:         release.Name,
+			DependsOn:    release.DependsOn,
+			Step:         release.Step,
+			Mode:         release.Mode,
+			WaitStrategy: release.WaitStrategy,
+			Args:         args,
+			run: func(ctx context.Context) error {
+				return m.timed(release.Step, "upgrade", release.Name, release.Chart, func() error {
+					return m.upgradeRelease(ctx, release)
+				})
+			},
+		}
+	}
+	return m.runReleases(ctx, "Upgrading", runs)
+}
 
-	err = m.handleOutputs(ctx, kubeClient, step.Namespace, step.Outputs)
-	return err
+// upgradeRelease runs the step for a single release.
+func (m *Mixin) upgradeRelease(ctx context.Context, step UpgradeArguments) error {
+	if step.RollbackOnFailure && step.Atomic != nil && *step.Atomic {
+		return errors.New("atomic and rollbackOnFailure cannot both be set, rollbackOnFailure replaces atomic")
+	}
+
+	// the release can only be rolled back when it has a revision from before the upgrade
+	existed := false
+	return m.runRelease(ctx, step.Step, step.ChartArguments, step.helmArgs(), releaseHooks{
+		releaseOptions: map[string]bool{
+			"skipIfMissing":          step.SkipIfMissing,
+			"backupBeforeUpgrade":    step.BackupBeforeUpgrade,
+			"rollbackOnFailure":      step.RollbackOnFailure,
+			"fixDeprecatedAPIs":      step.FixDeprecatedAPIs,
+			"minCurrentChartVersion": step.MinCurrentChartVersion != "",
+			"maxVersionSkew":         step.MaxVersionSkew != nil,
+		},
+		skipIfMissing: step.SkipIfMissing,
+		prepare: func(ctx context.Context, args helmArgs, env []string) error {
+			var err error
+			if step.RollbackOnFailure {
+				existed, err = m.releaseExists(ctx, args, env)
+				if err != nil {
+					return err
+				}
+			}
+			if step.BackupBeforeUpgrade {
+				err = m.backupRelease(ctx, args, env)
+				if err != nil {
+					return err
+				}
+			}
+			err = m.checkUpgradePath(ctx, step, args, env)
+			if err != nil {
+				return err
+			}
+			if step.FixDeprecatedAPIs {
+				return m.fixDeprecatedAPIs(ctx, args, env)
+			}
+			return nil
+		},
+		failed: func(ctx context.Context, args helmArgs, env []string, err error) error {
+			if step.RollbackOnFailure {
+				return m.rollbackAfterFailure(ctx, args, env, existed, err)
+			}
+			return err
+		},
+	})
 }
 
 // Prepare set arguments
 func HandleSettingChartValuesForUpgrade(step UpgradeStep, cmd *exec.Cmd) []string {
-	// sort the set consistently
-	setKeys := make([]string, 0, len(step.Set))
-	for k := range step.Set {
-
-		setKeys = append(setKeys, k)
-	}
-	sort.Strings(setKeys)
-
-	for _, k := range setKeys {
-		cmd.Args = append(cmd.Args, "--set", fmt.Sprintf("%s=%s", k, step.Set[k]))
-	}
-	return cmd.Args
+	return appendSetFlags(cmd.Args, step.Set)
 }
@@ -6,8 +6,11 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path"
+	"strings"
 	"testing"
 
+	"get.porter.sh/porter/pkg/portercontext"
 	"get.porter.sh/porter/pkg/test"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -31,13 +34,14 @@ func TestMixin_UnmarshalUpgradeStep(t *testing.T) {
 
 	assert.Equal(t, "Upgrade MySQL", step.Description)
 	assert.NotEmpty(t, step.Outputs)
-	assert.Equal(t, HelmOutput{"mysql-root-password", "porter-ci-mysql", "mysql-root-password", "", "", "", ""}, step.Outputs[0])
-	assert.Equal(t, HelmOutput{"mysql-cluster-ip", "", "", "service", "porter-ci-mysql-service", "default", "{.spec.clusterIP}"}, step.Outputs[2])
+	assert.Equal(t, HelmOutput{Name: "mysql-root-password", Secret: "porter-ci-mysql", Key: "mysql-root-password"}, step.Outputs[0])
+	assert.Equal(t, HelmOutput{Name: "mysql-cluster-ip", ResourceType: "service", ResourceName: "porter-ci-mysql-service", Namespace: "default", JSONPath: "{.spec.clusterIP}"}, step.Outputs[2])
 	assert.Equal(t, "stable/mysql", step.Chart)
 	assert.Equal(t, "0.10.2", step.Version)
-	assert.True(t, step.Wait)
+	assert.True(t, *step.Wait)
 	assert.True(t, step.ResetValues)
 	assert.True(t, step.ResetValues)
+	assert.True(t, step.NoHooks)
 	assert.Equal(t, map[string]string{"mysqlDatabase": "mydb", "mysqlUser": "myuser",
 		"livenessProbe.initialDelaySeconds": "30", "persistence.enabled": "true"}, step.Set)
 	assert.Nil(t, step.Atomic)
@@ -122,13 +126,15 @@ func TestMixin_Upgrade(t *testing.T) {
 			expectedCommand: fmt.Sprintf(`%s %s %s %s`, baseUpgrade, baseValues, baseAddFlags, baseSetArgs),
 			upgradeStep: UpgradeStep{
 				UpgradeArguments: UpgradeArguments{
-					Step:      Step{Description: "Upgrade Foo"},
-					Namespace: namespace,
-					Name:      name,
-					Chart:     chart,
-					Version:   version,
-					Set:       setArgs,
-					Values:    values,
+					Step: Step{Description: "Upgrade Foo"},
+					ChartArguments: ChartArguments{
+						Namespace: namespace,
+						Name:      name,
+						Chart:     chart,
+						Version:   version,
+						Set:       setArgs,
+						Values:    values,
+					},
 				},
 			},
 		},
@@ -136,13 +142,15 @@ func TestMixin_Upgrade(t *testing.T) {
 			expectedCommand: fmt.Sprintf(`%s %s %s %s %s`, baseUpgrade, `--reset-values`, baseValues, baseAddFlags, baseSetArgs),
 			upgradeStep: UpgradeStep{
 				UpgradeArguments: UpgradeArguments{
-					Step:        Step{Description: "Upgrade Foo"},
-					Namespace:   namespace,
-					Name:        name,
-					Chart:       chart,
-					Version:     version,
-					Set:         setArgs,
-					Values:      values,
+					Step: Step{Description: "Upgrade Foo"},
+					ChartArguments: ChartArguments{
+						Namespace: namespace,
+						Name:      name,
+						Chart:     chart,
+						Version:   version,
+						Set:       setArgs,
+						Values:    values,
+					},
 					ResetValues: true,
 				},
 			},
@@ -151,13 +159,15 @@ func TestMixin_Upgrade(t *testing.T) {
 			expectedCommand: fmt.Sprintf(`%s %s %s %s %s`, baseUpgrade, `--reuse-values`, baseValues, baseAddFlags, baseSetArgs),
 			upgradeStep: UpgradeStep{
 				UpgradeArguments: UpgradeArguments{
-					Step:        Step{Description: "Upgrade Foo"},
-					Namespace:   namespace,
-					Name:        name,
-					Chart:       chart,
-					Version:     version,
-					Set:         setArgs,
-					Values:      values,
+					Step: Step{Description: "Upgrade Foo"},
+					ChartArguments: ChartArguments{
+						Namespace: namespace,
+						Name:      name,
+						Chart:     chart,
+						Version:   version,
+						Set:       setArgs,
+						Values:    values,
+					},
 					ReuseValues: true,
 				},
 			},
@@ -166,14 +176,16 @@ func TestMixin_Upgrade(t *testing.T) {
 			expectedCommand: fmt.Sprintf(`%s %s %s %s %s`, baseUpgrade, `--wait`, baseValues, baseAddFlags, baseSetArgs),
 			upgradeStep: UpgradeStep{
 				UpgradeArguments: UpgradeArguments{
-					Step:      Step{Description: "Upgrade Foo"},
-					Namespace: namespace,
-					Name:      name,
-					Chart:     chart,
-					Version:   version,
-					Set:       setArgs,
-					Values:    values,
-					Wait:      true,
+					Step: Step{Description: "Upgrade Foo"},
+					ChartArguments: ChartArguments{
+						Namespace: namespace,
+						Name:      name,
+						Chart:     chart,
+						Version:   version,
+						Set:       setArgs,
+						Values:    values,
+						Wait:      &valueTrue,
+					},
 				},
 			},
 		},
@@ -181,15 +193,90 @@ func TestMixin_Upgrade(t *testing.T) {
 			expectedCommand: fmt.Sprintf(`%s %s %s %s %s`, baseUpgrade, baseValues, `--timeout 600 --debug`, baseAddFlags, baseSetArgs),
 			upgradeStep: UpgradeStep{
 				UpgradeArguments: UpgradeArguments{
-					Step:      Step{Description: "Upgrade Foo"},
-					Namespace: namespace,
-					Name:      name,
-					Chart:     chart,
-					Version:   version,
-					Set:       setArgs,
-					Values:    values,
-					Timeout:   "600",
-					Debug:     true,
+					Step: Step{Description: "Upgrade Foo"},
+					ChartArguments: ChartArguments{
+						Namespace: namespace,
+						Name:      name,
+						Chart:     chart,
+						Version:   version,
+						Set:       setArgs,
+						Values:    values,
+						Timeout:   "600",
+						Debug:     &valueTrue,
+					},
+				},
+			},
+		},
+		{
+			expectedCommand: fmt.Sprintf(`%s %s %s %s %s`, baseUpgrade, `--devel`, baseValues, baseAddFlags, baseSetArgs),
+			upgradeStep: UpgradeStep{
+				UpgradeArguments: UpgradeArguments{
+					Step: Step{Description: "Upgrade Foo"},
+					ChartArguments: ChartArguments{
+						Namespace: namespace,
+						Name:      name,
+						Chart:     chart,
+						Version:   version,
+						Set:       setArgs,
+						Values:    values,
+						Devel:     true,
+					},
+				},
+			},
+		},
+		{
+			expectedCommand: fmt.Sprintf(`%s %s %s %s %s`, baseUpgrade, baseValues, `--skip-crds --no-hooks --verify --dependency-update`, baseAddFlags, baseSetArgs),
+			upgradeStep: UpgradeStep{
+				UpgradeArguments: UpgradeArguments{
+					Step: Step{Description: "Upgrade Foo"},
+					ChartArguments: ChartArguments{
+						Namespace:        namespace,
+						Name:             name,
+						Chart:            chart,
+						Version:          version,
+						Set:              setArgs,
+						Values:           values,
+						SkipCrds:         true,
+						NoHooks:          true,
+						Verify:           true,
+						DependencyUpdate: true,
+					},
+				},
+			},
+		},
+		{
+			expectedCommand: fmt.Sprintf(`%s %s %s %s %s`, baseUpgrade, baseValues, `--repo https://charts.example.com --username myuser --password mypass`, baseAddFlags, baseSetArgs),
+			upgradeStep: UpgradeStep{
+				UpgradeArguments: UpgradeArguments{
+					Step: Step{Description: "Upgrade Foo"},
+					ChartArguments: ChartArguments{
+						Namespace: namespace,
+						Name:      name,
+						Chart:     chart,
+						Version:   version,
+						Set:       setArgs,
+						Values:    values,
+						Repo:      "https://charts.example.com",
+						Username:  "myuser",
+						Password:  "mypass",
+					},
+				},
+			},
+		},
+		{
+			expectedCommand: fmt.Sprintf("helm3 status %s --namespace %s\nhelm3 mapkubeapis %s --namespace %s\n%s %s %s %s", name, namespace, name, namespace, baseUpgrade, baseValues, baseAddFlags, baseSetArgs),
+			upgradeStep: UpgradeStep{
+				UpgradeArguments: UpgradeArguments{
+					Step: Step{Description: "Upgrade Foo"},
+					ChartArguments: ChartArguments{
+						Namespace: namespace,
+						Name:      name,
+						Chart:     chart,
+						Version:   version,
+						Set:       setArgs,
+						Values:    values,
+					},
+					FixDeprecatedAPIs: true,
 				},
 			},
 		},
@@ -197,14 +284,16 @@ func TestMixin_Upgrade(t *testing.T) {
 			expectedCommand: fmt.Sprintf(`%s %s %s %s`, baseUpgrade, baseValues, `--create-namespace`, baseSetArgs),
 			upgradeStep: UpgradeStep{
 				UpgradeArguments: UpgradeArguments{
-					Step:      Step{Description: "Upgrade Foo"},
-					Namespace: namespace,
-					Name:      name,
-					Chart:     chart,
-					Version:   version,
-					Set:       setArgs,
-					Values:    values,
-					Atomic:    &valueFalse,
+					Step: Step{Description: "Upgrade Foo"},
+					ChartArguments: ChartArguments{
+						Namespace: namespace,
+						Name:      name,
+						Chart:     chart,
+						Version:   version,
+						Set:       setArgs,
+						Values:    values,
+						Atomic:    &valueFalse,
+					},
 				},
 			},
 		},
@@ -212,14 +301,16 @@ func TestMixin_Upgrade(t *testing.T) {
 			expectedCommand: fmt.Sprintf(`%s %s %s %s`, baseUpgrade, baseValues, baseAddFlags, baseSetArgs),
 			upgradeStep: UpgradeStep{
 				UpgradeArguments: UpgradeArguments{
-					Step:      Step{Description: "Upgrade Foo"},
-					Namespace: namespace,
-					Name:      name,
-					Chart:     chart,
-					Version:   version,
-					Set:       setArgs,
-					Values:    values,
-					Atomic:    &valueTrue,
+					Step: Step{Description: "Upgrade Foo"},
+					ChartArguments: ChartArguments{
+						Namespace: namespace,
+						Name:      name,
+						Chart:     chart,
+						Version:   version,
+						Set:       setArgs,
+						Values:    values,
+						Atomic:    &valueTrue,
+					},
 				},
 			},
 		},
@@ -236,6 +327,7 @@ func TestMixin_Upgrade(t *testing.T) {
 			require.NoError(t, err)
 
 			h := NewTestMixin(t)
+			h.Setenv(verifyClientVersionEnv, "false")
 			h.In = bytes.NewReader(b)
 
 			err = h.Upgrade(ctx)
@@ -244,3 +336,71 @@ func TestMixin_Upgrade(t *testing.T) {
 		})
 	}
 }
+
+func TestMixin_UpgradeChartVersionRange(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	os.Setenv(test.ExpectedCommandEnv, strings.Join([]string{
+		"helm3 search repo bitnami/mysql --versions --version ~9.4.x --output json",
+		"helm3 upgrade --install mysql bitnami/mysql --namespace mysql --version 9.4.3 --atomic --create-namespace",
+	}, "\n"))
+	defer os.Unsetenv(test.ExpectedCommandOutputEnv)
+	os.Setenv(test.ExpectedCommandOutputEnv, `[{"name":"bitnami/mysql","version":"9.4.1"},{"name":"bitnami/mysql","version":"9.4.3"},{"name":"bitnami/mysql-operator","version":"9.4.9"}]`)
+
+	step := UpgradeStep{
+		UpgradeArguments: UpgradeArguments{
+			Step: Step{Description: "Upgrade MySQL"},
+			ChartArguments: ChartArguments{
+				Name:               "mysql",
+				Namespace:          "mysql",
+				Chart:              "bitnami/mysql",
+				Version:            "~9.4.x",
+				ChartVersionOutput: "chart-version",
+			},
+		},
+	}
+	action := UpgradeAction{Steps: []UpgradeStep{step}}
+	b, err := yaml.Marshal(action)
+	require.NoError(t, err)
+
+	h := NewTestMixin(t)
+	h.Setenv(verifyClientVersionEnv, "false")
+	h.In = bytes.NewReader(b)
+
+	err = h.Upgrade(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, h.TestContext.GetOutput(), "Resolved version ~9.4.x of chart bitnami/mysql to 9.4.3")
+
+	version, err := h.FileSystem.ReadFile(path.Join(portercontext.MixinOutputsDir, "chart-version"))
+	require.NoError(t, err)
+	assert.Equal(t, "9.4.3", string(version))
+}
+
+func TestMixin_FixDeprecatedAPIs(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+
+	t.Run("kube arguments", func(t *testing.T) {
+		os.Setenv(test.ExpectedCommandEnv, strings.Join([]string{
+			"helm3 status mysql --namespace mydb --kube-context staging --kube-apiserver https://staging.example.com:6443",
+			"helm3 mapkubeapis mysql --namespace mydb --kube-context staging --kube-apiserver https://staging.example.com:6443",
+		}, "\n"))
+
+		h := NewTestMixin(t)
+		kube := KubeArguments{KubeContext: "staging", KubeAPIServer: "https://staging.example.com:6443"}
+		err := h.fixDeprecatedAPIs(ctx, helmArgs{Release: "mysql", Namespace: "mydb", KubeArguments: kube}, nil)
+		require.NoError(t, err)
+	})
+
+	t.Run("missing release", func(t *testing.T) {
+		defer os.Unsetenv(test.ExpectedCommandOutputEnv)
+		defer os.Unsetenv(test.ExpectedCommandExitCodeEnv)
+		os.Setenv(test.ExpectedCommandEnv, "helm3 status mysql --namespace mydb")
+		os.Setenv(test.ExpectedCommandOutputEnv, "Error: release: not found")
+		os.Setenv(test.ExpectedCommandExitCodeEnv, "1")
+
+		h := NewTestMixin(t)
+		err := h.fixDeprecatedAPIs(ctx, helmArgs{Release: "mysql", Namespace: "mydb"}, nil)
+		require.NoError(t, err, "there is nothing to fix when the upgrade installs the release")
+	})
+}
@@ -0,0 +1,122 @@
+package helm3
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Policies of the upgrade step when the upgrade path of the chart is not supported
+const (
+	UpgradePathFail = "fail"
+	UpgradePathWarn = "warn"
+)
+
+// exactVersion matches a chart version that is not a range, so that it can be compared without asking helm
+var exactVersion = regexp.MustCompile(`^v?\d+\.\d+\.\d+(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`)
+
+// checkUpgradePath checks, before the upgrade, that the chart version of the deployed release can be upgraded
+// to the chart version of the step: it must not be older than minCurrentChartVersion, and the upgrade must not
+// cross more major versions than maxVersionSkew. Nothing is checked when the release does not exist yet.
+func (m *Mixin) checkUpgradePath(ctx context.Context, step UpgradeArguments, a helmArgs, env []string) error {
+	if step.MinCurrentChartVersion == "" && step.MaxVersionSkew == nil {
+		return nil
+	}
+	switch step.UpgradePathPolicy {
+	case "", UpgradePathFail, UpgradePathWarn:
+	default:
+		return errors.Errorf("unsupported upgradePathPolicy %q, allowed values are %s and %s", step.UpgradePathPolicy, UpgradePathFail, UpgradePathWarn)
+	}
+
+	current, err := m.deployedChartVersion(ctx, a, env)
+	if err != nil || current == nil {
+		return err
+	}
+
+	var problems []string
+	if step.MinCurrentChartVersion != "" {
+		min, err := semver.NewVersion(step.MinCurrentChartVersion)
+		if err != nil {
+			return errors.Wrapf(err, "invalid minCurrentChartVersion %q", step.MinCurrentChartVersion)
+		}
+		if current.LessThan(min) {
+			problems = append(problems, fmt.Sprintf("the deployed chart version %s is older than minCurrentChartVersion %s", current, min))
+		}
+	}
+	if step.MaxVersionSkew != nil {
+		target, err := m.targetChartVersion(ctx, a, env)
+		if err != nil {
+			return err
+		}
+		if skew := int(target.Major()) - int(current.Major()); skew > *step.MaxVersionSkew {
+			problems = append(problems, fmt.Sprintf("upgrading from chart version %s to %s crosses %d major versions, more than maxVersionSkew %d",
+				current, target, skew, *step.MaxVersionSkew))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+
+	msg := fmt.Sprintf("unsupported upgrade path for release %s: %s", a.Release, strings.Join(problems, ", "))
+	if step.UpgradePathPolicy == UpgradePathWarn {
+		fmt.Fprintf(m.Err, "WARNING: %s\n", msg)
+		return nil
+	}
+	return errors.New(msg)
+}
+
+// deployedChartVersion returns the chart version of the deployed release, or nil when the release does not exist.
+func (m *Mixin) deployedChartVersion(ctx context.Context, a helmArgs, env []string) (*semver.Version, error) {
+	release, err := m.getReleaseStatus(ctx, a, env)
+	if err != nil || release == nil {
+		return nil, err
+	}
+	version, err := semver.NewVersion(release.Chart.Metadata.Version)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid chart version %q of the deployed release %s", release.Chart.Metadata.Version, a.Release)
+	}
+	return version, nil
+}
+
+// targetChartVersion returns the chart version that the release is upgraded to: the version of the step when
+// it is an exact version, or else the version of the chart resolved by helm.
+func (m *Mixin) targetChartVersion(ctx context.Context, a helmArgs, env []string) (*semver.Version, error) {
+	if exactVersion.MatchString(a.Version) && !isLocalChartPath(a.Chart) {
+		return semver.NewVersion(a.Version)
+	}
+
+	args := []string{"show", "chart", a.Chart}
+	if a.Version != "" && !isLocalChartPath(a.Chart) {
+		args = append(args, "--version", a.Version)
+	}
+	if a.Devel {
+		args = append(args, "--devel")
+	}
+	if a.RepositoryCache != "" {
+		args = append(args, "--repository-cache", a.RepositoryCache)
+	}
+	args = append(args, chartRepoFlags(a)...)
+
+	output := &bytes.Buffer{}
+	if err := m.runHelmWithStdout(ctx, args, env, output); err != nil {
+		return nil, errors.Wrapf(err, "could not get the version of chart %s", a.Chart)
+	}
+
+	var chart struct {
+		Version string `yaml:"version"`
+	}
+	if err := yaml.Unmarshal(output.Bytes(), &chart); err != nil {
+		return nil, errors.Wrapf(err, "could not parse the metadata of chart %s", a.Chart)
+	}
+	version, err := semver.NewVersion(chart.Version)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid version %q of chart %s", chart.Version, a.Chart)
+	}
+	return version, nil
+}
@@ -0,0 +1,82 @@
+package helm3
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"get.porter.sh/porter/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMixin_CheckUpgradePath(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	defer os.Unsetenv(test.ExpectedCommandOutputEnv)
+	// the status of the release and the metadata of the chart are both read from this output
+	os.Setenv(test.ExpectedCommandOutputEnv, `{"version":"4.0.0","chart":{"metadata":{"version":"2.3.0"}}}`)
+
+	skew := func(n int) *int { return &n }
+	args := helmArgs{Release: "mysql", Chart: "stable/mysql", Namespace: "mydb"}
+	exact := args
+	exact.Version = "3.1.0"
+
+	testcases := []struct {
+		name        string
+		step        UpgradeArguments
+		args        helmArgs
+		commands    string
+		wantErr     string
+		wantWarning string
+	}{
+		{
+			name:     "supported upgrade path",
+			step:     UpgradeArguments{MinCurrentChartVersion: "2.0.0", MaxVersionSkew: skew(1)},
+			args:     exact,
+			commands: "helm3 status --output json mysql --namespace mydb",
+		},
+		{
+			name:     "deployed chart too old",
+			step:     UpgradeArguments{MinCurrentChartVersion: "2.4.0"},
+			args:     exact,
+			commands: "helm3 status --output json mysql --namespace mydb",
+			wantErr:  "unsupported upgrade path for release mysql: the deployed chart version 2.3.0 is older than minCurrentChartVersion 2.4.0",
+		},
+		{
+			name:     "version range resolved by helm",
+			step:     UpgradeArguments{MaxVersionSkew: skew(1)},
+			args:     args,
+			commands: "helm3 status --output json mysql --namespace mydb\nhelm3 show chart stable/mysql",
+			wantErr:  "unsupported upgrade path for release mysql: upgrading from chart version 2.3.0 to 4.0.0 crosses 2 major versions, more than maxVersionSkew 1",
+		},
+		{
+			name:        "warn",
+			step:        UpgradeArguments{MinCurrentChartVersion: "2.4.0", UpgradePathPolicy: UpgradePathWarn},
+			args:        exact,
+			commands:    "helm3 status --output json mysql --namespace mydb",
+			wantWarning: "WARNING: unsupported upgrade path for release mysql: the deployed chart version 2.3.0 is older than minCurrentChartVersion 2.4.0",
+		},
+		{
+			name: "not checked",
+			args: exact,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			os.Setenv(test.ExpectedCommandEnv, tc.commands)
+			m := NewTestMixin(t)
+
+			err := m.checkUpgradePath(ctx, tc.step, tc.args, nil)
+			if tc.wantErr != "" {
+				require.EqualError(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			if tc.wantWarning != "" {
+				assert.Contains(t, m.TestContext.GetError(), tc.wantWarning)
+			}
+		})
+	}
+}
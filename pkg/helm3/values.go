@@ -0,0 +1,263 @@
+package helm3
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// ValuesLayer is a named group of values files, for example the values of an environment.
+// The layers are applied in the order that they are declared, after the values files of the step.
+type ValuesLayer struct {
+	Name  string   `yaml:"name"`
+	Files []string `yaml:"files"`
+}
+
+// ValuesSource is a values file, either a file parameter of the bundle, a path in the invocation image
+// or a URL that is downloaded at runtime.
+type ValuesSource struct {
+	// Parameter is the name of a file parameter of the bundle
+	Parameter string `yaml:"parameter,omitempty"`
+	File      string `yaml:"file,omitempty"`
+	URL       string `yaml:"url,omitempty"`
+
+	// Checksum pins the sha256 checksum of the file downloaded from the URL
+	Checksum string `yaml:"checksum,omitempty"`
+
+	// CAFile is a certificate authority trusted to download the file from the URL
+	CAFile string `yaml:"caFile,omitempty"`
+}
+
+// valuesFiles returns the values files in the order that they are passed to helm,
+// the values of a file override the values of the files before it.
+func valuesFiles(values []string, from []string, layers []ValuesLayer) []string {
+	files := append([]string{}, values...)
+	files = append(files, from...)
+	for _, layer := range layers {
+		files = append(files, layer.Files...)
+	}
+	return files
+}
+
+// resolveValuesFrom returns the paths of the values files of the sources, checking that they exist.
+func (m *Mixin) resolveValuesFrom(sources []ValuesSource) ([]string, error) {
+	if len(sources) == 0 {
+		return nil, nil
+	}
+
+	var bun bundle
+	files := make([]string, 0, len(sources))
+	for _, source := range sources {
+		if source.URL != "" {
+			file, err := m.downloadValuesFile(source)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, file)
+			continue
+		}
+
+		file := source.File
+		if source.Parameter != "" {
+			if bun.Parameters == nil {
+				var err error
+				bun, err = m.loadBundle()
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			param, ok := bun.Parameters[source.Parameter]
+			if !ok {
+				return nil, errors.Errorf("parameter %s is not defined in the bundle", source.Parameter)
+			}
+			if param.Destination.Path == "" {
+				return nil, errors.Errorf("parameter %s is not a file parameter, it does not have a path", source.Parameter)
+			}
+			file = param.Destination.Path
+		}
+		if file == "" {
+			return nil, errors.New("valuesFrom must set either a parameter, a file or a url")
+		}
+
+		exists, err := m.FileSystem.Exists(file)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not check values file %s", file)
+		}
+		if !exists {
+			return nil, errors.Errorf("values file %s does not exist", file)
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// logValuesOrder prints the order in which the values are applied, the last ones taking precedence.
+func (m *Mixin) logValuesOrder(values []string, from []string, layers []ValuesLayer, set map[string]string) {
+	if len(values) == 0 && len(from) == 0 && len(layers) == 0 {
+		return
+	}
+
+	fmt.Fprintln(m.Out, "Values are applied in this order, the last ones taking precedence:")
+	i := 1
+	for _, file := range values {
+		fmt.Fprintf(m.Out, "  %d. values: %s\n", i, file)
+		i++
+	}
+	for _, file := range from {
+		fmt.Fprintf(m.Out, "  %d. valuesFrom: %s\n", i, file)
+		i++
+	}
+	for _, layer := range layers {
+		for _, file := range layer.Files {
+			fmt.Fprintf(m.Out, "  %d. %s: %s\n", i, layer.Name, file)
+			i++
+		}
+	}
+	if len(set) > 0 {
+		keys := make([]string, 0, len(set))
+		for k := range set {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		fmt.Fprintf(m.Out, "  %d. set: %s\n", i, strings.Join(keys, ", "))
+	}
+}
+
+// writeMergedValues merges the values files in the order that helm applies them,
+// and saves the result, with the sensitive values masked, as an output of the step.
+func (m *Mixin) writeMergedValues(output string, files []string) error {
+	merged := map[interface{}]interface{}{}
+	err := m.mergeValuesFiles(merged, files)
+	if err != nil {
+		return err
+	}
+	maskSensitiveValues(merged)
+
+	data, err := yaml.Marshal(merged)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal the merged values")
+	}
+	err = m.WriteMixinOutputToFile(output, data)
+	if err != nil {
+		return errors.Wrapf(err, "unable to write output '%s'", output)
+	}
+	return nil
+}
+
+// mergeValuesFiles merges the values files into dst, in the order that helm applies them.
+func (m *Mixin) mergeValuesFiles(dst map[interface{}]interface{}, files []string) error {
+	for _, file := range files {
+		data, err := m.FileSystem.ReadFile(file)
+		if err != nil {
+			return errors.Wrapf(err, "could not read values file %s", file)
+		}
+
+		values := map[interface{}]interface{}{}
+		err = yaml.Unmarshal(data, &values)
+		if err != nil {
+			return errors.Wrapf(err, "could not parse values file %s", file)
+		}
+		mergeValues(dst, values)
+	}
+	return nil
+}
+
+// writeEffectiveValues prints, or saves as an output, the values that reach the chart: the values files merged
+// in the order that helm applies them, then the set values, with the sensitive values masked.
+func (m *Mixin) writeEffectiveValues(a helmArgs, print bool, output string) error {
+	values := map[interface{}]interface{}{}
+	err := m.mergeValuesFiles(values, a.Values)
+	if err != nil {
+		return err
+	}
+	for key, value := range a.Set {
+		setValue(values, key, value)
+	}
+	maskSensitiveValues(values)
+
+	data, err := yaml.Marshal(values)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal the effective values")
+	}
+	if print {
+		fmt.Fprintf(m.Out, "Effective values of release %s:\n%s", a.Release, data)
+	}
+	if output != "" {
+		err = m.WriteMixinOutputToFile(output, data)
+		if err != nil {
+			return errors.Wrapf(err, "unable to write output '%s'", output)
+		}
+	}
+	return nil
+}
+
+// maskSensitiveValues replaces the values whose key looks sensitive, like a password or a token, in place.
+func maskSensitiveValues(values map[interface{}]interface{}) {
+	for k, v := range values {
+		if isSensitiveValue(fmt.Sprint(k)) {
+			values[k] = "*******"
+			continue
+		}
+		switch child := v.(type) {
+		case map[interface{}]interface{}:
+			maskSensitiveValues(child)
+		case []interface{}:
+			for _, item := range child {
+				if m, ok := item.(map[interface{}]interface{}); ok {
+					maskSensitiveValues(m)
+				}
+			}
+		}
+	}
+}
+
+// mergeValues merges src into dst like helm merges values files: maps are merged
+// recursively and any other value replaces the value of dst.
+func mergeValues(dst, src map[interface{}]interface{}) {
+	for k, v := range src {
+		srcMap, srcIsMap := v.(map[interface{}]interface{})
+		dstMap, dstIsMap := dst[k].(map[interface{}]interface{})
+		if srcIsMap && dstIsMap {
+			mergeValues(dstMap, srcMap)
+			continue
+		}
+		dst[k] = v
+	}
+}
+
+// templateValuesFiles renders the values files as Go templates, with the environment variables of the
+// invocation image, which include the parameters and credentials of the bundle, available as .Env.
+// It returns the paths of the rendered files, in the same order.
+func (m *Mixin) templateValuesFiles(files []string) ([]string, error) {
+	data := map[string]interface{}{"Env": m.EnvironMap()}
+
+	rendered := make([]string, 0, len(files))
+	for _, file := range files {
+		contents, err := m.FileSystem.ReadFile(file)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not read values file %s", file)
+		}
+
+		tmpl, err := template.New(file).Option("missingkey=error").Parse(string(contents))
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not parse values file %s as a template", file)
+		}
+
+		out, err := m.FileSystem.TempFile("", "values-*.yaml")
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not create the rendered values file of %s", file)
+		}
+		err = tmpl.Execute(out, data)
+		out.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not render values file %s", file)
+		}
+		rendered = append(rendered, out.Name())
+	}
+	return rendered, nil
+}
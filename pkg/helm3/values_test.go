@@ -0,0 +1,174 @@
+package helm3
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path"
+	"testing"
+
+	"get.porter.sh/porter/pkg/portercontext"
+	"get.porter.sh/porter/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestMixin_InstallValuesLayers(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 upgrade --install mysql stable/mysql "+
+		"--values values/base.yaml --values values/prod.yaml --values values/instance.yaml "+
+		"--atomic --create-namespace --set mysqlUser=admin")
+
+	step := InstallStep{
+		InstallArguments: InstallArguments{
+			Step: Step{Description: "Install MySQL"},
+			ChartArguments: ChartArguments{
+				Name:   "mysql",
+				Chart:  "stable/mysql",
+				Values: []string{"values/base.yaml"},
+				ValuesLayers: []ValuesLayer{
+					{Name: "environment", Files: []string{"values/prod.yaml"}},
+					{Name: "instance", Files: []string{"values/instance.yaml"}},
+				},
+				Set:                map[string]string{"mysqlUser": "admin"},
+				MergedValuesOutput: "merged-values",
+			},
+		},
+	}
+	action := InstallAction{Steps: []InstallStep{step}}
+	b, err := yaml.Marshal(action)
+	require.NoError(t, err)
+
+	h := NewTestMixin(t)
+	h.Setenv(verifyClientVersionEnv, "false")
+	h.FileSystem.WriteFile("values/base.yaml", []byte("persistence:\n  enabled: true\n  size: 8Gi\nreplicas: 1\n"), 0644)
+	h.FileSystem.WriteFile("values/prod.yaml", []byte("persistence:\n  size: 100Gi\nreplicas: 3\n"), 0644)
+	h.FileSystem.WriteFile("values/instance.yaml", []byte("replicas: 5\nauth:\n  rootPassword: s3cr3t\n"), 0644)
+	h.In = bytes.NewReader(b)
+
+	err = h.Install(ctx)
+	require.NoError(t, err)
+
+	assert.Contains(t, h.TestContext.GetOutput(), `Values are applied in this order, the last ones taking precedence:
+  1. values: values/base.yaml
+  2. environment: values/prod.yaml
+  3. instance: values/instance.yaml
+  4. set: mysqlUser
+`)
+
+	merged, err := h.FileSystem.ReadFile(path.Join(portercontext.MixinOutputsDir, "merged-values"))
+	require.NoError(t, err)
+	assert.Equal(t, "auth:\n  rootPassword: '*******'\npersistence:\n  enabled: true\n  size: 100Gi\nreplicas: 5\n", string(merged))
+}
+
+func TestMixin_InstallEffectiveValues(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 upgrade --install mysql stable/mysql --values values/base.yaml "+
+		"--atomic --create-namespace --set auth.rootPassword=s3cr3t --set primary.replicas=3")
+
+	step := InstallStep{
+		InstallArguments: InstallArguments{
+			Step: Step{Description: "Install MySQL"},
+			ChartArguments: ChartArguments{
+				Name:                  "mysql",
+				Chart:                 "stable/mysql",
+				Values:                []string{"values/base.yaml"},
+				Set:                   map[string]string{"auth.rootPassword": "s3cr3t", "primary.replicas": "3"},
+				PrintEffectiveValues:  true,
+				EffectiveValuesOutput: "effective-values",
+			},
+		},
+	}
+	action := InstallAction{Steps: []InstallStep{step}}
+	b, err := yaml.Marshal(action)
+	require.NoError(t, err)
+
+	h := NewTestMixin(t)
+	h.Setenv(verifyClientVersionEnv, "false")
+	h.FileSystem.WriteFile("values/base.yaml", []byte("auth:\n  username: admin\n  apiToken: abc123\nprimary:\n  replicas: 1\n"), 0644)
+	h.In = bytes.NewReader(b)
+
+	err = h.Install(ctx)
+	require.NoError(t, err)
+
+	wantValues := "auth:\n  apiToken: '*******'\n  rootPassword: '*******'\n  username: admin\nprimary:\n  replicas: 3\n"
+	assert.Contains(t, h.TestContext.GetOutput(), "Effective values of release mysql:\n"+wantValues)
+	assert.NotContains(t, h.TestContext.GetOutput(), "abc123")
+
+	effective, err := h.FileSystem.ReadFile(path.Join(portercontext.MixinOutputsDir, "effective-values"))
+	require.NoError(t, err)
+	assert.Equal(t, wantValues, string(effective))
+}
+
+func TestMixin_TemplateValuesFiles(t *testing.T) {
+	h := NewTestMixin(t)
+	h.Setenv("MYSQL_USER", "admin")
+	h.FileSystem.WriteFile("values.yaml", []byte("mysqlUser: {{ .Env.MYSQL_USER }}\n"), 0644)
+
+	files, err := h.templateValuesFiles([]string{"values.yaml"})
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	rendered, err := h.FileSystem.ReadFile(files[0])
+	require.NoError(t, err)
+	assert.Equal(t, "mysqlUser: admin\n", string(rendered))
+
+	h.FileSystem.WriteFile("missing.yaml", []byte("mysqlUser: {{ .Env.MISSING_VARIABLE }}\n"), 0644)
+	_, err = h.templateValuesFiles([]string{"missing.yaml"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "could not render values file missing.yaml")
+}
+
+func TestMixin_ResolveValuesFrom(t *testing.T) {
+	bun := `{"parameters": {
+  "values-file": {"definition": "values-file", "destination": {"path": "/cnab/app/values.yaml"}},
+  "mysql-user": {"definition": "mysql-user", "destination": {"env": "MYSQL_USER"}}
+}}`
+
+	testcases := []struct {
+		name      string
+		sources   []ValuesSource
+		wantFiles []string
+		wantError string
+	}{
+		{
+			name:      "file parameter and path",
+			sources:   []ValuesSource{{Parameter: "values-file"}, {File: "values/prod.yaml"}},
+			wantFiles: []string{"/cnab/app/values.yaml", "values/prod.yaml"},
+		},
+		{
+			name:      "undefined parameter",
+			sources:   []ValuesSource{{Parameter: "missing"}},
+			wantError: "parameter missing is not defined in the bundle",
+		},
+		{
+			name:      "not a file parameter",
+			sources:   []ValuesSource{{Parameter: "mysql-user"}},
+			wantError: "parameter mysql-user is not a file parameter, it does not have a path",
+		},
+		{
+			name:      "missing file",
+			sources:   []ValuesSource{{File: "values/missing.yaml"}},
+			wantError: "values file values/missing.yaml does not exist",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := NewTestMixin(t)
+			h.FileSystem.WriteFile(bundlePath, []byte(bun), 0644)
+			h.FileSystem.WriteFile("/cnab/app/values.yaml", []byte("replicas: 1\n"), 0644)
+			h.FileSystem.WriteFile("values/prod.yaml", []byte("replicas: 3\n"), 0644)
+
+			files, err := h.resolveValuesFrom(tc.sources)
+			if tc.wantError != "" {
+				require.EqualError(t, err, tc.wantError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantFiles, files)
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package helm3
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/xeipuuv/gojsonschema"
+	"gopkg.in/yaml.v2"
+)
+
+// schemaChartsDir is where the chart is pulled to read its values schema, when it isn't a local chart or archive
+const schemaChartsDir = "/tmp/helm3-mixin/schema-charts"
+
+// chartValuesFiles are the files of a chart used to validate the values of a release
+type chartValuesFiles struct {
+	values []byte
+	schema []byte
+}
+
+// validateValues validates the values of the release, the default values of the chart merged with the values
+// files and the set values like helm merges them, against the values.schema.json of the chart, so that the
+// violations are reported before helm runs. Nothing is validated when the chart has no schema.
+func (m *Mixin) validateValues(ctx context.Context, a helmArgs, env []string) error {
+	if a.SkipSchemaValidation {
+		return errors.New("validateValues and skipSchemaValidation cannot both be set")
+	}
+	if a.ReuseValues {
+		fmt.Fprintf(m.Err, "WARNING: the values of release %s are not validated, they are merged with the values of the deployed release\n", a.Release)
+		return nil
+	}
+
+	files, err := m.readChartValuesFiles(ctx, a, env)
+	if err != nil {
+		return err
+	}
+	if len(files.schema) == 0 {
+		fmt.Fprintf(m.Out, "Chart %s has no values.schema.json, the values of release %s are not validated\n", a.Chart, a.Release)
+		return nil
+	}
+
+	values := map[interface{}]interface{}{}
+	err = yaml.Unmarshal(files.values, &values)
+	if err != nil {
+		return errors.Wrapf(err, "could not parse the default values of chart %s", a.Chart)
+	}
+	err = m.mergeValuesFiles(values, a.Values)
+	if err != nil {
+		return err
+	}
+	for key, value := range a.Set {
+		setValue(values, key, value)
+	}
+
+	schema, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(files.schema))
+	if err != nil {
+		return errors.Wrapf(err, "could not load the values.schema.json of chart %s", a.Chart)
+	}
+	result, err := schema.Validate(gojsonschema.NewGoLoader(jsonValues(values)))
+	if err != nil {
+		return errors.Wrapf(err, "could not validate the values of release %s", a.Release)
+	}
+	if result.Valid() {
+		return nil
+	}
+
+	violations := make([]string, 0, len(result.Errors()))
+	for _, violation := range result.Errors() {
+		violations = append(violations, fmt.Sprintf("  - %s: %s", violation.Field(), violation.Description()))
+	}
+	sort.Strings(violations)
+	return errors.Errorf("the values of release %s do not match the values.schema.json of chart %s:\n%s", a.Release, a.Chart, strings.Join(violations, "\n"))
+}
+
+// readChartValuesFiles reads the default values and the values schema of a chart directory or archive,
+// pulling the chart when it isn't local.
+func (m *Mixin) readChartValuesFiles(ctx context.Context, a helmArgs, env []string) (chartValuesFiles, error) {
+	var files chartValuesFiles
+	if isLocalChartPath(a.Chart) && !strings.HasSuffix(a.Chart, ".tgz") {
+		for _, file := range []struct {
+			name string
+			data *[]byte
+		}{{"values.yaml", &files.values}, {"values.schema.json", &files.schema}} {
+			path := filepath.Join(a.Chart, file.name)
+			if exists, _ := m.FileSystem.Exists(path); !exists {
+				continue
+			}
+			data, err := m.FileSystem.ReadFile(path)
+			if err != nil {
+				return files, errors.Wrapf(err, "could not read %s", path)
+			}
+			*file.data = data
+		}
+		return files, nil
+	}
+
+	archive := a.Chart
+	if !strings.HasSuffix(archive, ".tgz") {
+		defer m.FileSystem.RemoveAll(schemaChartsDir)
+		var err error
+		archive, _, err = m.pullChartArchive(ctx, a, env, schemaChartsDir)
+		if err != nil {
+			return files, err
+		}
+	}
+	data, err := m.FileSystem.ReadFile(archive)
+	if err != nil {
+		return files, errors.Wrapf(err, "could not read chart archive %s", archive)
+	}
+	files, err = readArchiveValuesFiles(data)
+	if err != nil {
+		return files, errors.Wrapf(err, "could not read chart archive %s", archive)
+	}
+	return files, nil
+}
+
+// readArchiveValuesFiles reads the values.yaml and values.schema.json at the root of the chart of an archive,
+// ignoring the files of the subcharts.
+func readArchiveValuesFiles(archive []byte) (chartValuesFiles, error) {
+	var files chartValuesFiles
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return files, err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return files, err
+		}
+
+		parts := strings.Split(strings.TrimPrefix(header.Name, "./"), "/")
+		if len(parts) != 2 {
+			continue
+		}
+		switch parts[1] {
+		case "values.yaml":
+			files.values, err = io.ReadAll(tr)
+		case "values.schema.json":
+			files.schema, err = io.ReadAll(tr)
+		}
+		if err != nil {
+			return files, err
+		}
+	}
+}
+
+// setValue sets a value like helm --set: the key is a path separated by dots, and true, false, null and
+// integers are converted like helm does. List indexes are not supported.
+func setValue(values map[interface{}]interface{}, key string, value string) {
+	parts := strings.Split(key, ".")
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := values[part].(map[interface{}]interface{})
+		if !ok {
+			child = map[interface{}]interface{}{}
+			values[part] = child
+		}
+		values = child
+	}
+
+	last := parts[len(parts)-1]
+	switch value {
+	case "true", "false":
+		values[last] = value == "true"
+	case "null":
+		values[last] = nil
+	default:
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			values[last] = i
+		} else {
+			values[last] = value
+		}
+	}
+}
+
+// jsonValues converts the maps parsed from YAML to maps with string keys, that can be validated as JSON.
+func jsonValues(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(value))
+		for k, child := range value {
+			m[fmt.Sprint(k)] = jsonValues(child)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(value))
+		for i, child := range value {
+			l[i] = jsonValues(child)
+		}
+		return l
+	default:
+		return v
+	}
+}
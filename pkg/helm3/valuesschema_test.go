@@ -0,0 +1,107 @@
+package helm3
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"testing"
+
+	"get.porter.sh/porter/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+// chartArchive returns a chart archive with the files, keyed by their path in the archive
+func chartArchive(t *testing.T, files map[string]string) []byte {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	for name, contents := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(contents))}))
+		_, err := tw.Write([]byte(contents))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func TestMixin_InstallValidateValues(t *testing.T) {
+	archive := chartArchive(t, map[string]string{
+		"mysql/Chart.yaml":  "name: mysql\nversion: 1.6.2\n",
+		"mysql/values.yaml": "auth:\n  rootPassword: changeme\nprimary:\n  replicas: 1\n",
+		"mysql/values.schema.json": `{
+  "type": "object",
+  "properties": {
+    "auth": {"type": "object", "properties": {"rootPassword": {"type": "string", "minLength": 8}}},
+    "primary": {"type": "object", "properties": {"replicas": {"type": "integer"}, "enabled": {"type": "boolean"}}}
+  }
+}`,
+		"mysql/charts/common/values.schema.json": `{"type": "object", "required": ["missing"]}`,
+	})
+
+	testcases := []struct {
+		name    string
+		values  string
+		set     map[string]string
+		wantErr string
+	}{
+		{"valid", "auth:\n  rootPassword: s3cr3t-password\n", map[string]string{"primary.replicas": "3", "primary.enabled": "true"}, ""},
+		{"invalid", "auth:\n  rootPassword: short\nprimary:\n  replicas: three\n", nil,
+			"the values of release mysql do not match the values.schema.json of chart /cnab/app/charts/mysql-1.6.2.tgz:\n" +
+				"  - auth.rootPassword: String length must be greater than or equal to 8\n" +
+				"  - primary.replicas: Invalid type. Expected: integer, given: string"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			defer os.Unsetenv(test.ExpectedCommandEnv)
+			if tc.wantErr == "" {
+				os.Setenv(test.ExpectedCommandEnv, "helm3 upgrade --install mysql /cnab/app/charts/mysql-1.6.2.tgz --namespace mysql --values /cnab/app/values.yaml --atomic --create-namespace --set primary.enabled=true --set primary.replicas=3")
+			}
+
+			step := InstallStep{
+				InstallArguments: InstallArguments{
+					Step: Step{Description: "Install MySQL"},
+					ChartArguments: ChartArguments{
+						Name:           "mysql",
+						Namespace:      "mysql",
+						Chart:          "/cnab/app/charts/mysql-1.6.2.tgz",
+						Values:         []string{"/cnab/app/values.yaml"},
+						Set:            tc.set,
+						ValidateValues: true,
+					},
+				},
+			}
+			action := InstallAction{Steps: []InstallStep{step}}
+			b, err := yaml.Marshal(action)
+			require.NoError(t, err)
+
+			h := NewTestMixin(t)
+			h.Setenv(verifyClientVersionEnv, "false")
+			h.In = bytes.NewReader(b)
+			require.NoError(t, h.FileSystem.WriteFile("/cnab/app/charts/mysql-1.6.2.tgz", archive, 0644))
+			require.NoError(t, h.FileSystem.WriteFile("/cnab/app/values.yaml", []byte(tc.values), 0644))
+
+			err = h.Install(ctx)
+			if tc.wantErr != "" {
+				require.EqualError(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestMixin_ValidateValuesWithoutSchema(t *testing.T) {
+	h := NewTestMixin(t)
+	require.NoError(t, h.FileSystem.WriteFile("/cnab/app/charts/mysql/values.yaml", []byte("replicas: 1\n"), 0644))
+
+	err := h.validateValues(context.Background(), helmArgs{Release: "mysql", Chart: "/cnab/app/charts/mysql"}, nil)
+	require.NoError(t, err)
+	assert.Contains(t, h.TestContext.GetOutput(), "Chart /cnab/app/charts/mysql has no values.schema.json, the values of release mysql are not validated")
+}
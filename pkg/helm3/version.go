@@ -1,14 +1,51 @@
 package helm3
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
 	"get.porter.sh/porter/pkg/mixin"
 	"get.porter.sh/porter/pkg/pkgmgmt"
 	"get.porter.sh/porter/pkg/porter/version"
+	"get.porter.sh/porter/pkg/printer"
 	"github.com/MChorfa/porter-helm3/pkg"
 )
 
-func (m *Mixin) PrintVersion(opts version.Options) error {
-	metadata := mixin.Metadata{
+// Defaults are the versions and the platforms that a release of the mixin ships with
+type Defaults struct {
+	DefaultClientVersion    string   `json:"defaultClientVersion"`
+	DefaultAPIVersion       string   `json:"defaultApiVersion"`
+	ClientVersionConstraint string   `json:"clientVersionConstraint"`
+	DefaultClientPlatform   string   `json:"defaultClientPlatform"`
+	ClientArchitectures     []string `json:"clientArchitectures"`
+	ImagePlatforms          []string `json:"imagePlatforms"`
+}
+
+func mixinDefaults() Defaults {
+	return Defaults{
+		DefaultClientVersion:    defaultClientVersion,
+		DefaultAPIVersion:       defaultAPIVersion,
+		ClientVersionConstraint: clientVersionConstraint,
+		DefaultClientPlatform:   defaultClientPlatform,
+		ClientArchitectures:     clientArchitectures,
+		ImagePlatforms:          []string{"default", ImagePlatformCopyFromImage, ImagePlatformWindows},
+	}
+}
+
+// VersionDetails is the version of the mixin with the defaults embedded in it,
+// and the version of the helm client when it is installed
+type VersionDetails struct {
+	mixin.Metadata
+	Defaults
+
+	// HelmVersion is the version of the helm client in the invocation image, it is only set at runtime
+	HelmVersion string `json:"helmVersion,omitempty"`
+}
+
+func (m *Mixin) metadata() mixin.Metadata {
+	return mixin.Metadata{
 		Name: "helm3",
 		VersionInfo: pkgmgmt.VersionInfo{
 			Version: pkg.Version,
@@ -16,5 +53,57 @@ func (m *Mixin) PrintVersion(opts version.Options) error {
 			Author:  "Mohamed Chorfa",
 		},
 	}
-	return version.PrintVersion(m.Context, opts, metadata)
+}
+
+func (m *Mixin) PrintVersion(opts version.Options) error {
+	return version.PrintVersion(m.Context, opts, m.metadata())
+}
+
+// PrintVersionDetails prints the version of the mixin with its defaults, and the version of helm when it is installed.
+func (m *Mixin) PrintVersionDetails(ctx context.Context, opts version.Options) error {
+	details := VersionDetails{
+		Metadata: m.metadata(),
+		Defaults: mixinDefaults(),
+	}
+	// helm is only installed in the invocation image, so it is not an error when it is missing
+	details.HelmVersion, _ = m.helmVersion(ctx)
+
+	if opts.Format == printer.FormatJson {
+		return printer.PrintJson(m.Out, details)
+	}
+
+	err := version.PrintVersion(m.Context, opts, details.Metadata)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(m.Out, "default client version: %s\n", details.DefaultClientVersion)
+	fmt.Fprintf(m.Out, "default api version: %s\n", details.DefaultAPIVersion)
+	fmt.Fprintf(m.Out, "client architectures: %s\n", strings.Join(details.ClientArchitectures, ", "))
+	fmt.Fprintf(m.Out, "image platforms: %s\n", strings.Join(details.ImagePlatforms, ", "))
+	if details.HelmVersion != "" {
+		fmt.Fprintf(m.Out, "helm version: %s\n", details.HelmVersion)
+	}
+	return nil
+}
+
+// PrintDefaults prints the default versions and the supported platforms of the mixin, so that tooling can
+// show what a release of the mixin ships without running a build.
+func (m *Mixin) PrintDefaults() error {
+	defaults := mixinDefaults()
+	if m.getOutputFormat() == OutputFormatJSON {
+		data, err := json.MarshalIndent(defaults, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(m.Out, string(data))
+		return nil
+	}
+
+	fmt.Fprintf(m.Out, "default client version: %s\n", defaults.DefaultClientVersion)
+	fmt.Fprintf(m.Out, "default api version: %s\n", defaults.DefaultAPIVersion)
+	fmt.Fprintf(m.Out, "client version constraint: %s\n", defaults.ClientVersionConstraint)
+	fmt.Fprintf(m.Out, "default client platform: %s\n", defaults.DefaultClientPlatform)
+	fmt.Fprintf(m.Out, "client architectures: %s\n", strings.Join(defaults.ClientArchitectures, ", "))
+	fmt.Fprintf(m.Out, "image platforms: %s\n", strings.Join(defaults.ImagePlatforms, ", "))
+	return nil
 }
@@ -1,11 +1,16 @@
 package helm3
 
 import (
+	"context"
+	"encoding/json"
+	"os"
 	"strings"
 	"testing"
 
 	"get.porter.sh/porter/pkg/porter/version"
 	"get.porter.sh/porter/pkg/printer"
+	"get.porter.sh/porter/pkg/test"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/MChorfa/porter-helm3/pkg"
@@ -53,3 +58,80 @@ func TestPrintJsonVersion(t *testing.T) {
 		t.Fatalf("invalid output:\nWANT:\t%q\nGOT:\t%q\n", wantOutput, gotOutput)
 	}
 }
+
+func TestPrintJsonVersionDetails(t *testing.T) {
+	pkg.Commit = "abc123"
+	pkg.Version = "v1.2.3"
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	defer os.Unsetenv(test.ExpectedCommandOutputEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 version --template {{.Version}}")
+	os.Setenv(test.ExpectedCommandOutputEnv, "v3.8.2")
+
+	m := NewTestMixin(t)
+
+	opts := version.Options{}
+	opts.RawFormat = string(printer.FormatJson)
+	err := opts.Validate()
+	require.NoError(t, err)
+	err = m.PrintVersionDetails(context.Background(), opts)
+	require.NoError(t, err)
+
+	var details map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(m.TestContext.GetOutput()), &details))
+	assert.Equal(t, "helm3", details["name"])
+	assert.Equal(t, "v1.2.3", details["version"])
+	assert.Equal(t, defaultClientVersion, details["defaultClientVersion"])
+	assert.Equal(t, defaultAPIVersion, details["defaultApiVersion"])
+	assert.Contains(t, details["clientArchitectures"], "arm64")
+	assert.Contains(t, details["imagePlatforms"], ImagePlatformWindows)
+	assert.Equal(t, "v3.8.2", details["helmVersion"])
+}
+
+func TestPrintVersionDetailsWithoutHelm(t *testing.T) {
+	pkg.Commit = "abc123"
+	pkg.Version = "v1.2.3"
+
+	m := NewTestMixin(t)
+
+	opts := version.Options{}
+	err := opts.Validate()
+	require.NoError(t, err)
+	err = m.PrintVersionDetails(context.Background(), opts)
+	require.NoError(t, err)
+
+	gotOutput := m.TestContext.GetOutput()
+	assert.Contains(t, gotOutput, "helm3 v1.2.3 (abc123) by Mohamed Chorfa")
+	assert.Contains(t, gotOutput, "default client version: "+defaultClientVersion)
+	assert.Contains(t, gotOutput, "default api version: "+defaultAPIVersion)
+	assert.NotContains(t, gotOutput, "helm version:")
+}
+
+func TestPrintDefaults(t *testing.T) {
+	t.Run("text", func(t *testing.T) {
+		m := NewTestMixin(t)
+
+		require.NoError(t, m.PrintDefaults())
+		assert.Equal(t, `default client version: v3.8.2
+default api version: v1.22.1
+client version constraint: ^v3.x
+default client platform: linux
+client architectures: amd64, arm64, arm, 386, s390x, ppc64le
+image platforms: default, copy-from-image, windows
+`, m.TestContext.GetOutput())
+	})
+
+	t.Run("json", func(t *testing.T) {
+		m := NewTestMixin(t)
+		m.OutputFormat = OutputFormatJSON
+
+		require.NoError(t, m.PrintDefaults())
+		var defaults map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(m.TestContext.GetOutput()), &defaults))
+		assert.Equal(t, defaultClientVersion, defaults["defaultClientVersion"])
+		assert.Equal(t, defaultAPIVersion, defaults["defaultApiVersion"])
+		assert.Equal(t, clientVersionConstraint, defaults["clientVersionConstraint"])
+		assert.Equal(t, "linux", defaults["defaultClientPlatform"])
+		assert.Contains(t, defaults["clientArchitectures"], "s390x")
+		assert.Contains(t, defaults["imagePlatforms"], ImagePlatformCopyFromImage)
+	})
+}
@@ -0,0 +1,205 @@
+package helm3
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8s "k8s.io/client-go/kubernetes"
+)
+
+// Wait strategies of the install and upgrade steps
+const (
+	// WaitHelm waits for the resources of the release with helm --wait
+	WaitHelm = "helm"
+
+	// WaitPoll returns from helm immediately, then polls the resources of the release and prints their progress
+	WaitPoll = "poll"
+
+	// WaitNone doesn't wait for the resources of the release
+	WaitNone = "none"
+)
+
+// defaultPollTimeout is how long the resources of a release are polled when the step doesn't set a timeout, like helm
+const defaultPollTimeout = 5 * time.Minute
+
+// releasePollInterval is how often the resources of a release are polled
+var releasePollInterval = 2 * time.Second
+
+// applyWaitStrategy sets the flags of helm for the wait strategy of the step. Helm waits for the resources with
+// atomic, so atomic must not be set by the step with the poll and none strategies, and it is disabled.
+func applyWaitStrategy(strategy string, stepAtomic *bool, a helmArgs) (helmArgs, error) {
+	switch strategy {
+	case "":
+	case WaitHelm:
+		wait := true
+		a.Wait = &wait
+	case WaitPoll, WaitNone:
+		if stepAtomic != nil && *stepAtomic {
+			return a, errors.Errorf("atomic makes helm wait for the resources, it cannot be set with waitStrategy %s", strategy)
+		}
+		no := false
+		a.Atomic = &no
+		a.Wait = &no
+	default:
+		return a, errors.Errorf("unsupported waitStrategy %q, allowed values are %s, %s and %s", strategy, WaitHelm, WaitPoll, WaitNone)
+	}
+	return a, nil
+}
+
+// pollRelease polls the workloads of the release until they are ready, printing their progress when it changes,
+// and fails when they are not ready before the timeout of the step, or when a Job of the release failed.
+func (m *Mixin) pollRelease(ctx context.Context, kubeClient k8s.Interface, a helmArgs, env []string) error {
+	timeout := defaultPollTimeout
+	if a.Timeout != "" {
+		var err error
+		timeout, err = time.ParseDuration(a.Timeout)
+		if err != nil {
+			return errors.Wrapf(err, "invalid timeout %q", a.Timeout)
+		}
+	}
+
+	manifest, err := m.getReleaseData(ctx, []string{"get", "manifest"}, "manifest", a, env)
+	if err != nil {
+		return err
+	}
+	resources, err := releaseWorkloads(manifest, a.Namespace)
+	if err != nil {
+		return errors.Wrapf(err, "could not parse the manifest of release %s", a.Release)
+	}
+	if len(resources) == 0 {
+		return nil
+	}
+	if kubeClient == nil {
+		kubeClient, err = m.getKubernetesClient(a)
+		if err != nil {
+			return errors.Wrap(err, "couldn't get kubernetes client")
+		}
+	}
+
+	fmt.Fprintf(m.Err, "Waiting for %d resources of release %s to be ready\n", len(resources), a.Release)
+	deadline := time.Now().Add(timeout)
+	printed := map[string]string{}
+	for {
+		var pending []string
+		for _, resource := range resources {
+			id := fmt.Sprintf("%s %s/%s", strings.ToLower(resource.Kind), resource.Metadata.Namespace, resource.Metadata.Name)
+			ready, progress, err := workloadProgress(ctx, kubeClient, resource)
+			if err != nil {
+				return errors.Wrapf(err, "%s is not ready", id)
+			}
+			if printed[id] != progress {
+				fmt.Fprintf(m.Err, "%s: %s\n", id, progress)
+				printed[id] = progress
+			}
+			if !ready {
+				pending = append(pending, id)
+			}
+		}
+		if len(pending) == 0 {
+			fmt.Fprintf(m.Err, "The resources of release %s are ready\n", a.Release)
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return errors.Errorf("timed out after %s waiting for the resources of release %s: %s", timeout, a.Release, strings.Join(pending, ", "))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(releasePollInterval):
+		}
+	}
+}
+
+// releaseWorkloads returns the Deployments, StatefulSets, DaemonSets and Jobs of the manifest of a release.
+func releaseWorkloads(manifest []byte, namespace string) ([]hookResource, error) {
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	var workloads []hookResource
+	decoder := yaml.NewDecoder(bytes.NewReader(manifest))
+	for {
+		var resource hookResource
+		err := decoder.Decode(&resource)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch resource.Kind {
+		case "Deployment", "StatefulSet", "DaemonSet", "Job":
+		default:
+			continue
+		}
+		if resource.Metadata.Namespace == "" {
+			resource.Metadata.Namespace = namespace
+		}
+		workloads = append(workloads, resource)
+	}
+	sort.SliceStable(workloads, func(i, j int) bool { return workloads[i].Kind < workloads[j].Kind })
+	return workloads, nil
+}
+
+// workloadProgress returns whether a workload is ready, and its progress, for example 1/3 ready.
+// A workload that doesn't exist yet is not ready.
+func workloadProgress(ctx context.Context, kubeClient k8s.Interface, w hookResource) (bool, string, error) {
+	namespace, name := w.Metadata.Namespace, w.Metadata.Name
+	replicas := func(r *int32) int32 {
+		if r == nil {
+			return 1
+		}
+		return *r
+	}
+
+	switch w.Kind {
+	case "Deployment":
+		d, err := kubeClient.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, "not found", nil
+		}
+		want := replicas(d.Spec.Replicas)
+		ready := d.Status.ObservedGeneration >= d.Generation && d.Status.UpdatedReplicas == want && d.Status.AvailableReplicas == want
+		return ready, fmt.Sprintf("%d/%d available, %d updated", d.Status.AvailableReplicas, want, d.Status.UpdatedReplicas), nil
+	case "StatefulSet":
+		s, err := kubeClient.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, "not found", nil
+		}
+		want := replicas(s.Spec.Replicas)
+		ready := s.Status.ObservedGeneration >= s.Generation && s.Status.ReadyReplicas == want && s.Status.UpdatedReplicas == want
+		return ready, fmt.Sprintf("%d/%d ready, %d updated", s.Status.ReadyReplicas, want, s.Status.UpdatedReplicas), nil
+	case "DaemonSet":
+		d, err := kubeClient.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, "not found", nil
+		}
+		want := d.Status.DesiredNumberScheduled
+		ready := d.Status.ObservedGeneration >= d.Generation && d.Status.NumberReady == want && d.Status.UpdatedNumberScheduled == want
+		return ready, fmt.Sprintf("%d/%d ready, %d updated", d.Status.NumberReady, want, d.Status.UpdatedNumberScheduled), nil
+	case "Job":
+		j, err := kubeClient.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, "not found", nil
+		}
+		for _, c := range j.Status.Conditions {
+			if c.Type == batchv1.JobFailed && c.Status == corev1.ConditionTrue {
+				return false, "failed", errors.Errorf("the job failed: %s", c.Message)
+			}
+		}
+		want := replicas(j.Spec.Completions)
+		return j.Status.Succeeded >= want, fmt.Sprintf("%d/%d succeeded", j.Status.Succeeded, want), nil
+	}
+	return true, "", nil
+}
@@ -0,0 +1,113 @@
+package helm3
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"get.porter.sh/porter/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestApplyWaitStrategy(t *testing.T) {
+	yes, no := true, false
+
+	a, err := applyWaitStrategy(WaitHelm, nil, helmArgs{})
+	require.NoError(t, err)
+	assert.True(t, *a.Wait)
+
+	for _, strategy := range []string{WaitPoll, WaitNone} {
+		a, err = applyWaitStrategy(strategy, &no, helmArgs{Wait: &yes, Atomic: &yes})
+		require.NoError(t, err)
+		assert.False(t, *a.Wait)
+		assert.False(t, *a.Atomic)
+
+		_, err = applyWaitStrategy(strategy, &yes, helmArgs{})
+		assert.EqualError(t, err, "atomic makes helm wait for the resources, it cannot be set with waitStrategy "+strategy)
+	}
+
+	a, err = applyWaitStrategy("", nil, helmArgs{Wait: &yes})
+	require.NoError(t, err)
+	assert.True(t, *a.Wait)
+
+	_, err = applyWaitStrategy("forever", nil, helmArgs{})
+	assert.EqualError(t, err, `unsupported waitStrategy "forever", allowed values are helm, poll and none`)
+}
+
+const pollManifest = `---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+  namespace: jobs
+`
+
+func TestMixin_PollRelease(t *testing.T) {
+	ctx := context.Background()
+	defer os.Unsetenv(test.ExpectedCommandEnv)
+	defer os.Unsetenv(test.ExpectedCommandOutputEnv)
+	os.Setenv(test.ExpectedCommandEnv, "helm3 get manifest web --namespace myapp")
+	os.Setenv(test.ExpectedCommandOutputEnv, pollManifest)
+	interval := releasePollInterval
+	releasePollInterval = time.Millisecond
+	defer func() { releasePollInterval = interval }()
+
+	replicas := int32(2)
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "myapp"},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		Status:     appsv1.DeploymentStatus{UpdatedReplicas: 2, AvailableReplicas: 2},
+	}
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "migrate", Namespace: "jobs"},
+		Status:     batchv1.JobStatus{Succeeded: 1},
+	}
+
+	t.Run("ready", func(t *testing.T) {
+		h := NewTestMixin(t)
+		client := testclient.NewSimpleClientset(deployment, job)
+		err := h.pollRelease(ctx, client, helmArgs{Release: "web", Namespace: "myapp"}, nil)
+		require.NoError(t, err)
+		stderr := h.TestContext.GetError()
+		assert.Contains(t, stderr, "Waiting for 2 resources of release web to be ready\n")
+		assert.Contains(t, stderr, "deployment myapp/web: 2/2 available, 2 updated\n")
+		assert.Contains(t, stderr, "job jobs/migrate: 1/1 succeeded\n")
+		assert.Contains(t, stderr, "The resources of release web are ready\n")
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		h := NewTestMixin(t)
+		client := testclient.NewSimpleClientset(job)
+		err := h.pollRelease(ctx, client, helmArgs{Release: "web", Namespace: "myapp", Timeout: "10ms"}, nil)
+		require.EqualError(t, err, "timed out after 10ms waiting for the resources of release web: deployment myapp/web")
+		assert.Contains(t, h.TestContext.GetError(), "deployment myapp/web: not found\n")
+	})
+
+	t.Run("failed job", func(t *testing.T) {
+		h := NewTestMixin(t)
+		failed := job.DeepCopy()
+		failed.Status = batchv1.JobStatus{Conditions: []batchv1.JobCondition{
+			{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Message: "BackoffLimitExceeded"},
+		}}
+		client := testclient.NewSimpleClientset(deployment, failed)
+		err := h.pollRelease(ctx, client, helmArgs{Release: "web", Namespace: "myapp"}, nil)
+		require.EqualError(t, err, "job jobs/migrate is not ready: the job failed: BackoffLimitExceeded")
+	})
+}
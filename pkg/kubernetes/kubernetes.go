@@ -13,7 +13,21 @@ import (
 
 // ClientFactory is an interface that knows how to create Kubernetes Clients
 type ClientFactory interface {
-	GetClient() (k8s.Interface, error)
+	GetClient(opts ClientOptions) (k8s.Interface, error)
+}
+
+// ClientOptions select the cluster of the Kubernetes Clients, like the kube flags of helm, and tune their rate limiting.
+// The kubeconfig and the client-go defaults are used for values that are not set.
+type ClientOptions struct {
+	QPS   float32
+	Burst int
+
+	Context   string
+	APIServer string
+	Token     string
+	AsUser    string
+	AsGroups  []string
+	CAFile    string
 }
 
 // ClientFactory struct
@@ -21,11 +35,24 @@ type clientFactory struct {
 }
 
 // GetClient: Read the config and create Kubernetes Clients
-func (f *clientFactory) GetClient() (k8s.Interface, error) {
-	config, err := clientcmd.DefaultClientConfig.ClientConfig()
+func (f *clientFactory) GetClient(opts ClientOptions) (k8s.Interface, error) {
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: opts.Context}
+	overrides.ClusterInfo.Server = opts.APIServer
+	overrides.ClusterInfo.CertificateAuthority = opts.CAFile
+	overrides.AuthInfo.Token = opts.Token
+	overrides.AuthInfo.Impersonate = opts.AsUser
+	overrides.AuthInfo.ImpersonateGroups = opts.AsGroups
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		clientcmd.NewDefaultClientConfigLoadingRules(), overrides).ClientConfig()
 	if err != nil {
 		return nil, fmt.Errorf("couldn't build kubernetes config: %s", err)
 	}
+	if opts.QPS > 0 {
+		config.QPS = opts.QPS
+	}
+	if opts.Burst > 0 {
+		config.Burst = opts.Burst
+	}
 	clientset, err := k8s.NewForConfig(config)
 	if err != nil {
 		return nil, errors.Wrap(err, "couldn't create kubernetes client")